@@ -1,6 +1,7 @@
 // src/engine.rs
 use std::collections::HashMap;
-use crate::models::{Command, EngineEvent, Order};
+use rust_decimal::Decimal;
+use crate::models::{Command, EngineEvent, Order, OrderType, RejectReason};
 use crate::orderbook::OrderBook;
 
 pub struct MatchingEngine {
@@ -19,11 +20,22 @@ impl MatchingEngine {
     pub fn process_command(&mut self, cmd: Command) -> Vec<EngineEvent> {
         match cmd {
             Command::Place(order) => self.process_place(order),
-            Command::Cancel(order_id) => self.process_cancel(order_id),
+            Command::Cancel(target) => self.process_cancel(target.order_id()),
         }
     }
 
     fn process_place(&mut self, order: Order) -> Vec<EngineEvent> {
+        // 0. Lệnh không hợp lệ -> từ chối ngay, không vào OrderBook
+        if let Some((reason, message)) = Self::validate(&order) {
+            return vec![EngineEvent::OrderRejected {
+                order_id: order.id,
+                user_id: order.user_id,
+                symbol: order.symbol,
+                reason,
+                message,
+            }];
+        }
+
         let symbol = order.symbol.clone();
         
         // 1. Tìm OrderBook của cặp tiền này (nếu chưa có thì tạo mới)
@@ -55,6 +67,28 @@ impl MatchingEngine {
         events
     }
 
+    // Kiểm tra lệnh trước khi khớp, trả về lý do nếu phải từ chối
+    fn validate(order: &Order) -> Option<(RejectReason, String)> {
+        if order.amount <= Decimal::ZERO {
+            return Some((RejectReason::InvalidAmount, format!("amount must be positive, got {}", order.amount)));
+        }
+        if order.order_type != OrderType::Market && order.price <= Decimal::ZERO {
+            return Some((RejectReason::InvalidPrice, format!("price must be positive, got {}", order.price)));
+        }
+        if order.order_type == OrderType::StopLimit {
+            match order.trigger_price {
+                Some(trigger) if trigger > Decimal::ZERO => {}
+                _ => {
+                    return Some((
+                        RejectReason::InvalidTriggerPrice,
+                        "stop-limit order requires a positive trigger_price".to_string(),
+                    ))
+                }
+            }
+        }
+        None
+    }
+
     fn process_cancel(&mut self, order_id: u64) -> Vec<EngineEvent> {
         // Vấn đề: Ta chỉ có ID, không biết lệnh nằm ở OrderBook nào (Symbol nào).
         // Giải pháp đơn giản (Tạm thời): Quét tất cả OrderBook.
@@ -71,6 +105,14 @@ impl MatchingEngine {
         vec![EngineEvent::OrderCancelled { order_id, success }]
     }
 
+    // Tìm symbol của một lệnh đang nằm trong OrderBook (dùng cho Cancel)
+    pub fn find_symbol(&self, order_id: u64) -> Option<String> {
+        self.orderbooks
+            .iter()
+            .find(|(_, book)| book.contains_order(order_id))
+            .map(|(symbol, _)| symbol.clone())
+    }
+
     // MỚI: Hàm lấy reference đến OrderBook của một symbol (để snapshot)
     pub fn get_orderbook(&self, symbol: &str) -> Option<&OrderBook> {
         self.orderbooks.get(symbol)
@@ -7,10 +7,36 @@ mod snapshot; // MỚI: Import module snapshot
 mod tests;
 
 use engine::MatchingEngine;
-use models::Command;
+use models::{Command, CommandMeta, OrderAck};
 use snapshot::SnapshotManager; // MỚI: Import SnapshotManager
+use async_nats::jetstream::{self, consumer::{pull, AckPolicy, DeliverPolicy}};
 use futures::StreamExt; // Để dùng hàm .next() cho stream
 use std::str::from_utf8;
+use std::time::{Duration, SystemTime, UNIX_EPOCH};
+
+// Version của envelope event (gateway từ chối version lớn hơn version nó hỗ trợ)
+const EVENT_VERSION: u32 = 2;
+
+// JetStream: gateway tạo các stream (internal/messaging/jetstream.go), engine đọc command
+// qua durable consumer riêng và publish event có chờ PubAck
+const ORDERS_STREAM: &str = "ORDERS";
+const ORDERS_SUBJECT: &str = "orders";
+const ORDERS_CONSUMER: &str = "matching-engine";
+const EVENTS_STREAM: &str = "EVENTS";
+const EVENTS_SUBJECT: &str = "events";
+
+// Chờ gateway tạo stream (engine có thể khởi động trước gateway)
+async fn wait_for_stream(js: &jetstream::Context, name: &str) -> jetstream::stream::Stream {
+    loop {
+        match js.get_stream(name).await {
+            Ok(stream) => return stream,
+            Err(e) => {
+                eprintln!("⏳ Waiting for JetStream stream {}: {}", name, e);
+                tokio::time::sleep(Duration::from_secs(2)).await;
+            }
+        }
+    }
+}
 
 #[tokio::main]
 async fn main() -> Result<(), anyhow::Error> {
@@ -23,9 +49,24 @@ async fn main() -> Result<(), anyhow::Error> {
     let client = async_nats::connect(nats_url).await?;
     println!("✅ Connected to NATS!");
 
-    // 2. Subscribe (Lắng nghe) topic "orders"
-    let mut subscriber = client.subscribe("orders").await?;
-    println!("🎧 Listening on subject 'orders'...");
+    // 2. Durable pull consumer trên stream ORDERS: command gửi tới khi engine đang down vẫn được giao
+    // khi engine chạy lại, và chỉ được ack sau khi xử lý xong (chưa ack -> JetStream giao lại)
+    let js = jetstream::new(client.clone());
+    let orders_stream = wait_for_stream(&js, ORDERS_STREAM).await;
+    wait_for_stream(&js, EVENTS_STREAM).await;
+
+    let consumer: jetstream::consumer::PullConsumer = orders_stream
+        .get_or_create_consumer(ORDERS_CONSUMER, pull::Config {
+            durable_name: Some(ORDERS_CONSUMER.to_string()),
+            description: Some("Matching engine command processor".to_string()),
+            filter_subject: ORDERS_SUBJECT.to_string(),
+            deliver_policy: DeliverPolicy::All,
+            ack_policy: AckPolicy::Explicit,
+            ..Default::default()
+        })
+        .await?;
+    let mut messages = consumer.messages().await?;
+    println!("🎧 Consuming '{}' from stream {} (consumer {})...", ORDERS_SUBJECT, ORDERS_STREAM, ORDERS_CONSUMER);
 
     // 3. Khởi tạo Engine
     let mut engine = MatchingEngine::new();
@@ -37,6 +78,11 @@ async fn main() -> Result<(), anyhow::Error> {
     let snapshot_manager = match SnapshotManager::new(&redis_url) {
         Ok(manager) => {
             println!("✅ Redis connection established!");
+            // Sổ lệnh bắt đầu rỗng: xóa snapshot cũ để gateway không đối soát với dữ liệu của lần chạy trước
+            match manager.clear_all() {
+                Ok(count) => println!("🗑️  Cleared {} stale snapshot(s)", count),
+                Err(e) => eprintln!("⚠️  Failed to clear stale snapshots: {}", e),
+            }
             Some(manager)
         },
         Err(e) => {
@@ -46,31 +92,90 @@ async fn main() -> Result<(), anyhow::Error> {
         }
     };
 
+    // 3.2 Sequence cho event: gateway dùng (epoch, seq) để chống xử lý trùng và phát hiện mất event.
+    // Engine chưa lưu state nên seq bắt đầu lại từ 1 mỗi lần khởi động, epoch phân biệt các lần chạy.
+    let epoch = SystemTime::now().duration_since(UNIX_EPOCH)?.as_millis() as u64;
+    let mut event_seq: u64 = 0;
+
+    // Stream sequence của command cuối đã xử lý: bản giao lại của command đã xử lý (vd. ack bị mất)
+    // chỉ được ack lại, không khớp lần nữa. Consumer giao theo thứ tự stream nên chỉ cần giữ một số.
+    let mut last_stream_seq: u64 = 0;
+
     // 4. Vòng lặp xử lý Message
-    while let Some(message) = subscriber.next().await {
+    while let Some(message) = messages.next().await {
+        let message = message?;
+        let stream_seq = message
+            .info()
+            .map_err(|e| anyhow::anyhow!("invalid JetStream message: {}", e))?
+            .stream_sequence;
+        if stream_seq <= last_stream_seq {
+            println!("\n↩️  Skipping redelivered command (stream seq {})", stream_seq);
+            message.ack().await.map_err(|e| anyhow::anyhow!("failed to ack command: {}", e))?;
+            continue;
+        }
+
         // Parse message từ bytes sang JSON String
-        let json_str = from_utf8(&message.payload)?;
+        let json_str = match from_utf8(&message.payload) {
+            Ok(json_str) => json_str,
+            Err(e) => {
+                // Không bao giờ xử lý được: ack để không bị giao lại mãi
+                eprintln!("❌ Command is not valid UTF-8: {}", e);
+                last_stream_seq = stream_seq;
+                message.ack().await.map_err(|e| anyhow::anyhow!("failed to ack command: {}", e))?;
+                continue;
+            }
+        };
         println!("\n📩 Received: {}", json_str);
 
         // Parse từ JSON sang Command struct
         match serde_json::from_str::<Command>(json_str) {
             Ok(cmd) => {
-                // Lưu symbol để update snapshot sau
+                // Lưu symbol để update snapshot sau và gắn vào event (gateway xử lý song song theo symbol)
                 let symbol = match &cmd {
                     Command::Place(order) => Some(order.symbol.clone()),
-                    Command::Cancel(_) => None, // Cancel không biết symbol trước
+                    Command::Cancel(target) => engine.find_symbol(target.order_id()), // None nếu lệnh không còn trong sổ
+                };
+
+                // Gateway chờ kết quả đồng bộ: gửi ack cho lệnh đặt về reply_to sau khi publish event
+                let meta = serde_json::from_str::<CommandMeta>(json_str).unwrap_or_default();
+                let ack_target = match (&cmd, meta.reply_to) {
+                    (Command::Place(order), Some(reply_to)) => Some((order.id, reply_to)),
+                    _ => None,
                 };
 
                 // Xử lý lệnh
                 let events = engine.process_command(cmd);
                 
                 // Publish kết quả (Event) ngược lại NATS
-                for event in events {
-                    let event_json = serde_json::to_string(&event)?;
+                for event in &events {
+                    event_seq += 1;
+                    let event_id = format!("{}-{}", epoch, event_seq);
+                    let mut event_value = serde_json::to_value(event)?;
+                    if let Some(fields) = event_value.as_object_mut() {
+                        fields.insert("v".to_string(), serde_json::json!(EVENT_VERSION));
+                        fields.insert("event_id".to_string(), serde_json::json!(event_id));
+                        fields.insert("epoch".to_string(), serde_json::json!(epoch));
+                        fields.insert("seq".to_string(), serde_json::json!(event_seq));
+                        if let Some(ref sym) = symbol {
+                            fields.insert("symbol".to_string(), serde_json::json!(sym));
+                        }
+                    }
+                    let event_json = serde_json::to_string(&event_value)?;
                     println!("   📤 Publishing Event: {}", event_json);
-                    
-                    // Bắn event ra topic "events"
-                    client.publish("events", event_json.into()).await?;
+
+                    // Bắn event vào stream EVENTS và chờ PubAck; event_id làm Nats-Msg-Id để JetStream bỏ bản trùng
+                    let mut headers = async_nats::HeaderMap::new();
+                    headers.insert("Nats-Msg-Id", event_id.as_str());
+                    js.publish_with_headers(EVENTS_SUBJECT, headers, event_json.into())
+                        .await?
+                        .await?;
+                }
+
+                if let Some((order_id, reply_to)) = ack_target {
+                    let ack = OrderAck::from_events(order_id, &events);
+                    let ack_json = serde_json::to_string(&ack)?;
+                    println!("   ↩️  Replying ack to {}: {}", reply_to, ack_json);
+                    client.publish(reply_to, ack_json.into()).await?;
                 }
 
                 // MỚI: Cập nhật snapshot lên Redis sau khi xử lý xong
@@ -86,6 +191,10 @@ async fn main() -> Result<(), anyhow::Error> {
                 eprintln!("❌ Error parsing command: {}", e);
             }
         }
+
+        // Xử lý xong (kể cả command sai format, giao lại cũng không xử lý được): ack
+        last_stream_seq = stream_seq;
+        message.ack().await.map_err(|e| anyhow::anyhow!("failed to ack command: {}", e))?;
     }
 
     Ok(())
@@ -77,6 +77,7 @@ pub struct Trade {
     pub trade_id: u64,         // ID duy nhất của trade
     pub buyer_order_id: u64,   // ID lệnh mua
     pub seller_order_id: u64,  // ID lệnh bán
+    pub taker_order_id: u64,   // ID lệnh khớp vào sổ (taker); lệnh còn lại đang nằm trong sổ là maker
     pub price: Decimal,        // Giá khớp
     pub amount: Decimal,       // Số lượng khớp
     pub timestamp: u64,        // Thời điểm khớp
@@ -87,7 +88,24 @@ pub struct Trade {
 #[serde(tag = "type", content = "data")] // Giúp JSON đẹp hơn: {"type": "place", "data": {...}}
 pub enum Command {
     Place(Order),
-    Cancel(u64), // Chỉ cần ID để hủy
+    Cancel(CancelTarget), // Chỉ cần ID để hủy
+}
+
+// Lệnh cần hủy: gateway gửi {"order_id": 123}, client cũ gửi thẳng 123
+#[derive(Debug, Clone, Copy, Deserialize, Serialize)]
+#[serde(untagged)]
+pub enum CancelTarget {
+    Id(u64),
+    Order { order_id: u64 },
+}
+
+impl CancelTarget {
+    pub fn order_id(&self) -> u64 {
+        match self {
+            CancelTarget::Id(id) => *id,
+            CancelTarget::Order { order_id } => *order_id,
+        }
+    }
 }
 
 // Output: Kết quả Engine trả ra
@@ -104,4 +122,96 @@ pub enum EngineEvent {
     },
     OrderCancelled { order_id: u64, success: bool },
     TradeExecuted { trade: Trade },
+    // Lệnh không hợp lệ, không vào OrderBook
+    OrderRejected {
+        order_id: u64,
+        user_id: u64,
+        symbol: String,
+        reason: RejectReason,
+        message: String,
+    },
+}
+
+// Mã lý do từ chối lệnh (gateway hiển thị cho user)
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "SCREAMING_SNAKE_CASE")]
+pub enum RejectReason {
+    InvalidAmount,       // amount <= 0
+    InvalidPrice,        // Limit/StopLimit có price <= 0
+    InvalidTriggerPrice, // StopLimit thiếu trigger_price hoặc trigger_price <= 0
+}
+
+// Thông tin đi kèm command (ngoài type/data). reply_to có khi gateway chờ kết quả đồng bộ
+#[derive(Debug, Default, Deserialize)]
+pub struct CommandMeta {
+    #[serde(default)]
+    pub reply_to: Option<String>,
+}
+
+// Trạng thái lệnh ngay sau khi Engine xử lý xong
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+#[serde(rename_all = "snake_case")]
+pub enum AckStatus {
+    Accepted,        // Vào OrderBook, chưa khớp
+    PartiallyFilled, // Khớp một phần
+    Filled,          // Khớp hết
+    Rejected,        // Bị từ chối (xem reason)
+}
+
+// Kết quả đặt lệnh gửi về reply_to của command
+#[derive(Debug, Serialize)]
+pub struct OrderAck {
+    pub order_id: u64,
+    pub status: AckStatus,
+    pub filled_amount: Decimal,
+    pub fills: Vec<Trade>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub reason: Option<RejectReason>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub message: Option<String>,
+}
+
+impl OrderAck {
+    // Tổng hợp ack cho lệnh order_id từ các event Engine vừa bắn ra
+    pub fn from_events(order_id: u64, events: &[EngineEvent]) -> Self {
+        let mut ack = OrderAck {
+            order_id,
+            status: AckStatus::Accepted,
+            filled_amount: Decimal::ZERO,
+            fills: Vec::new(),
+            reason: None,
+            message: None,
+        };
+        let mut amount = Decimal::ZERO;
+
+        for event in events {
+            match event {
+                EngineEvent::OrderRejected { order_id: id, reason, message, .. } if *id == order_id => {
+                    ack.status = AckStatus::Rejected;
+                    ack.reason = Some(*reason);
+                    ack.message = Some(message.clone());
+                    return ack;
+                }
+                EngineEvent::OrderPlaced { order_id: id, amount: placed, .. } if *id == order_id => {
+                    amount = *placed;
+                }
+                EngineEvent::TradeExecuted { trade }
+                    if trade.buyer_order_id == order_id || trade.seller_order_id == order_id =>
+                {
+                    ack.filled_amount += trade.amount;
+                    ack.fills.push(trade.clone());
+                }
+                _ => {}
+            }
+        }
+
+        if ack.filled_amount > Decimal::ZERO {
+            ack.status = if ack.filled_amount >= amount {
+                AckStatus::Filled
+            } else {
+                AckStatus::PartiallyFilled
+            };
+        }
+        ack
+    }
 }
@@ -69,6 +69,18 @@ impl OrderBook {
     }
 
     // MỚI: Hàm Hủy Lệnh (Trả về true nếu hủy thành công)
+    // Tất cả lệnh đang nằm trong sổ (kể cả StopLimit chưa kích hoạt), dùng cho snapshot đối soát
+    pub fn open_orders(&self) -> Vec<&Order> {
+        let resting = self.bids.values().chain(self.asks.values()).flat_map(|queue| queue.iter());
+        let stops = self.stop_bids.values().chain(self.stop_asks.values()).flat_map(|list| list.iter());
+        resting.chain(stops).collect()
+    }
+
+    // Kiểm tra lệnh có đang nằm trong sổ lệnh này không (O(1))
+    pub fn contains_order(&self, order_id: u64) -> bool {
+        self.order_locations.contains_key(&order_id)
+    }
+
     pub fn cancel_order(&mut self, order_id: u64) -> bool {
         // 1. Tra cứu xem lệnh nằm ở đâu (O(1))
         if let Some(location) = self.order_locations.remove(&order_id) {
@@ -160,6 +172,7 @@ impl OrderBook {
                         trade_id: trade_counter,
                         buyer_order_id: buyer_id,
                         seller_order_id: seller_id,
+                        taker_order_id: order.id, // Lệnh vừa tới khớp vào sổ là taker
                         price,
                         amount: match_amount,
                         timestamp: 0,
@@ -380,6 +393,7 @@ impl OrderBook {
                         trade_id: trade_counter,
                         buyer_order_id: buyer_id,
                         seller_order_id: seller_id,
+                        taker_order_id: order.id, // Lệnh vừa tới khớp vào sổ là taker
                         price,
                         amount: match_amount,
                         timestamp: 0,
@@ -1,4 +1,5 @@
 // src/snapshot.rs
+use crate::models::Side;
 use crate::orderbook::OrderBook;
 use redis::{Commands, RedisError};
 use serde::Serialize;
@@ -10,6 +11,19 @@ pub struct OrderBookSnapshot {
     pub bids: Vec<(String, String)>, // (Price, Amount) - Dùng String để giữ chính xác Decimal
     pub asks: Vec<(String, String)>,
     pub timestamp: u64,
+    // Toàn bộ lệnh đang nằm trong sổ: chỉ ghi vào key (gateway dùng để đối soát), không publish
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub orders: Option<Vec<SnapshotOrder>>,
+}
+
+/// Một lệnh đang nằm trong sổ
+#[derive(Debug, Serialize)]
+pub struct SnapshotOrder {
+    pub id: u64,
+    pub side: Side,
+    pub price: String,
+    pub amount: String, // Số lượng còn lại
+    pub stop: bool,     // StopLimit chưa kích hoạt
 }
 
 /// SnapshotManager quản lý việc đẩy dữ liệu Orderbook lên Redis
@@ -39,7 +53,18 @@ impl SnapshotManager {
         let mut conn = self.client.get_connection()?;
 
         // 1. Convert OrderBook nội bộ thành Snapshot (chỉ lấy top 10 lệnh mỗi bên)
-        let snapshot = OrderBookSnapshot {
+        let orders = book
+            .open_orders()
+            .into_iter()
+            .map(|order| SnapshotOrder {
+                id: order.id,
+                side: order.side,
+                price: order.price.to_string(),
+                amount: order.amount.to_string(),
+                stop: order.trigger_price.is_some(),
+            })
+            .collect();
+        let mut snapshot = OrderBookSnapshot {
             symbol: symbol.to_string(),
             bids: book.get_depth(10, true),  // Top 10 Bids (giá cao nhất)
             asks: book.get_depth(10, false), // Top 10 Asks (giá thấp nhất)
@@ -47,14 +72,17 @@ impl SnapshotManager {
                 .duration_since(std::time::UNIX_EPOCH)
                 .unwrap()
                 .as_secs(),
+            orders: Some(orders),
         };
 
-        // 2. Serialize thành chuỗi JSON
-        let json_data = serde_json::to_string(&snapshot)?;
-
-        // 3. Lưu vào Redis (Key ví dụ: "orderbook:BTC/USDT")
+        // 2. Lưu vào Redis kèm danh sách lệnh (Key ví dụ: "orderbook:BTC/USDT")
         let key = format!("orderbook:{}", symbol);
-        let _: () = conn.set(&key, &json_data)?;
+        let full_json = serde_json::to_string(&snapshot)?;
+        let _: () = conn.set(&key, &full_json)?;
+
+        // 3. Bản publish chỉ cần depth
+        snapshot.orders = None;
+        let json_data = serde_json::to_string(&snapshot)?;
 
         // 4. (Tùy chọn) Publish vào kênh Redis PubSub để WebSocket bên Go nhận được ngay
         let channel = format!("ob_update:{}", symbol);
@@ -74,6 +102,17 @@ impl SnapshotManager {
         Ok(result)
     }
 
+    /// Xóa mọi snapshot. Gọi khi Engine khởi động: sổ lệnh chỉ nằm trong bộ nhớ nên đang rỗng,
+    /// snapshot của lần chạy trước không còn đúng.
+    pub fn clear_all(&self) -> anyhow::Result<usize> {
+        let mut conn = self.client.get_connection()?;
+        let keys: Vec<String> = conn.scan_match("orderbook:*")?.collect();
+        for key in &keys {
+            let _: () = conn.del(key)?;
+        }
+        Ok(keys.len())
+    }
+
     /// Xóa snapshot khỏi Redis
     pub fn clear_snapshot(&self, symbol: &str) -> anyhow::Result<()> {
         let mut conn = self.client.get_connection()?;
@@ -110,6 +149,7 @@ mod tests {
                 ("50002.00".to_string(), "3.0".to_string()),
             ],
             timestamp: 1234567890,
+            orders: None,
         };
 
         let json = serde_json::to_string(&snapshot).unwrap();
@@ -211,3 +211,27 @@ fn test_market_order_ignores_price_field() {
     assert_eq!(trades.len(), 1, "Khớp được 1 trade");
     assert_eq!(trades[0].price, dec!(50000), "Khớp ở giá 50000");
 }
+
+#[test]
+fn test_trade_taker_is_incoming_order() {
+    let mut book = OrderBook::new();
+
+    // Setup: Lệnh mua nằm sẵn trong sổ (maker)
+    book.add_limit_order(Order::new(1, 101, dec!(50000), dec!(1.0), Side::Bid, OrderType::Limit));
+
+    // Action: Lệnh bán tới sau khớp vào (taker)
+    let sell_order = Order::new(2, 102, dec!(49000), dec!(0.4), Side::Ask, OrderType::Limit);
+    let trades = book.process_order(sell_order);
+
+    // Verify: Taker là lệnh bán dù người mua vẫn là buyer
+    assert_eq!(trades.len(), 1, "Khớp được 1 trade");
+    assert_eq!(trades[0].buyer_order_id, 1);
+    assert_eq!(trades[0].seller_order_id, 2);
+    assert_eq!(trades[0].taker_order_id, 2, "Lệnh bán tới sau là taker");
+
+    // Action: Lệnh mua tới sau khớp với lệnh bán trong sổ
+    let mut book = OrderBook::new();
+    book.add_limit_order(Order::new(3, 103, dec!(50000), dec!(1.0), Side::Ask, OrderType::Limit));
+    let trades = book.process_order(Order::new(4, 104, dec!(51000), dec!(1.0), Side::Bid, OrderType::Limit));
+    assert_eq!(trades[0].taker_order_id, 4, "Lệnh mua tới sau là taker");
+}
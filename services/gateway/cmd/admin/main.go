@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+const usage = `Gateway admin CLI
+
+Usage:
+  admin [flags] dlq list [-status pending|replayed|discarded] [-limit N] [-offset N]
+  admin [flags] dlq show <id>
+  admin [flags] dlq replay <id>
+  admin [flags] dlq discard <id>
+  admin [flags] events resume [-accept-gap]
+  admin [flags] reconcile run [-fix]
+  admin [flags] reconcile report
+  admin [flags] users balances|orders <username>
+  admin [flags] users role <username> <user|support|market-ops|admin>
+  admin [flags] users unlock <username>
+  admin [flags] ips unlock <ip>
+  admin [flags] users adjust <username> -currency USDT -amount -10.5 -reason "..."
+  admin [flags] orders cancel <order-uuid> -reason "..."
+  admin [flags] symbols halts
+  admin [flags] symbols halt <symbol> -reason "..."
+  admin [flags] symbols resume <symbol>
+  admin [flags] audit list [-username U] [-action A] [-resource-type T] [-resource-id ID] [-ip IP]
+                           [-from RFC3339] [-to RFC3339] [-limit N] [-offset N]
+  admin [flags] withdrawals list [-status pending] [-username U] [-currency C] [-limit N] [-offset N]
+  admin [flags] withdrawals approve <id>
+  admin [flags] withdrawals reject|fail <id> -reason "..."
+  admin [flags] withdrawals complete <id> -ref <tx-hash>
+  admin [flags] ledger check [-fix]
+  admin [flags] ledger report
+  admin [flags] ledger journals [-username U -currency C [-account-type spot|margin|futures]]
+                                [-type T] [-reference-id R] [-limit N] [-offset N]
+
+Flags:
+  -url     Gateway base URL (env GATEWAY_URL, default http://localhost:8080)
+  -token   Admin API token (env ADMIN_API_TOKEN)
+`
+
+type client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+func main() {
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	baseURL := flag.String("url", envOr("GATEWAY_URL", "http://localhost:8080"), "gateway base URL")
+	token := flag.String("token", os.Getenv("ADMIN_API_TOKEN"), "admin API token")
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) < 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	c := &client{
+		baseURL: *baseURL + "/api/v1/admin",
+		token:   *token,
+		http:    &http.Client{Timeout: 30 * time.Second},
+	}
+
+	var err error
+	switch args[0] {
+	case "dlq":
+		err = runDLQ(c, args[1], args[2:])
+	case "events":
+		err = runEvents(c, args[1], args[2:])
+	case "reconcile":
+		err = runReconcile(c, args[1], args[2:])
+	case "users":
+		err = runUsers(c, args[1], args[2:])
+	case "orders":
+		err = runOrders(c, args[1], args[2:])
+	case "ips":
+		err = runIPs(c, args[1], args[2:])
+	case "symbols":
+		err = runSymbols(c, args[1], args[2:])
+	case "audit":
+		err = runAudit(c, args[1], args[2:])
+	case "withdrawals":
+		err = runWithdrawals(c, args[1], args[2:])
+	case "ledger":
+		err = runLedger(c, args[1], args[2:])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌", err)
+		os.Exit(1)
+	}
+}
+
+func runDLQ(c *client, cmd string, args []string) error {
+	switch cmd {
+	case "list":
+		fs := flag.NewFlagSet("dlq list", flag.ExitOnError)
+		status := fs.String("status", "pending", "filter by status (empty = all)")
+		limit := fs.Int("limit", 50, "max events to return")
+		offset := fs.Int("offset", 0, "events to skip")
+		fs.Parse(args)
+
+		query := url.Values{}
+		if *status != "" {
+			query.Set("status", *status)
+		}
+		query.Set("limit", fmt.Sprint(*limit))
+		query.Set("offset", fmt.Sprint(*offset))
+		return c.do(http.MethodGet, "/events/dead-letters?"+query.Encode(), nil)
+	case "show", "replay", "discard":
+		if len(args) != 1 {
+			return fmt.Errorf("dlq %s requires an id", cmd)
+		}
+		path := "/events/dead-letters/" + url.PathEscape(args[0])
+		if cmd == "show" {
+			return c.do(http.MethodGet, path, nil)
+		}
+		return c.do(http.MethodPost, path+"/"+cmd, nil)
+	default:
+		return fmt.Errorf("unknown dlq command: %s", cmd)
+	}
+}
+
+func runEvents(c *client, cmd string, args []string) error {
+	switch cmd {
+	case "resume":
+		fs := flag.NewFlagSet("events resume", flag.ExitOnError)
+		acceptGap := fs.Bool("accept-gap", false, "skip the missing sequence numbers instead of retrying")
+		fs.Parse(args)
+		return c.do(http.MethodPost, fmt.Sprintf("/events/resume?accept_gap=%t", *acceptGap), nil)
+	default:
+		return fmt.Errorf("unknown events command: %s", cmd)
+	}
+}
+
+func runReconcile(c *client, cmd string, args []string) error {
+	switch cmd {
+	case "run":
+		fs := flag.NewFlagSet("reconcile run", flag.ExitOnError)
+		fix := fs.Bool("fix", false, "apply the fix for each discrepancy instead of only reporting")
+		fs.Parse(args)
+		return c.do(http.MethodPost, fmt.Sprintf("/reconcile?fix=%t", *fix), nil)
+	case "report":
+		return c.do(http.MethodGet, "/reconcile", nil)
+	default:
+		return fmt.Errorf("unknown reconcile command: %s", cmd)
+	}
+}
+
+func runUsers(c *client, cmd string, args []string) error {
+	switch cmd {
+	case "balances", "orders":
+		if len(args) != 1 {
+			return fmt.Errorf("users %s requires a username", cmd)
+		}
+		return c.do(http.MethodGet, "/users/"+url.PathEscape(args[0])+"/"+cmd, nil)
+	case "role":
+		if len(args) != 2 {
+			return fmt.Errorf("users role requires a username and a role")
+		}
+		return c.do(http.MethodPut, "/users/"+url.PathEscape(args[0])+"/role", map[string]string{"role": args[1]})
+	case "unlock":
+		if len(args) != 1 {
+			return fmt.Errorf("users unlock requires a username")
+		}
+		return c.do(http.MethodPost, "/users/"+url.PathEscape(args[0])+"/unlock", nil)
+	case "adjust":
+		if len(args) < 1 {
+			return fmt.Errorf("users adjust requires a username")
+		}
+		fs := flag.NewFlagSet("users adjust", flag.ExitOnError)
+		currency := fs.String("currency", "", "currency to adjust")
+		amount := fs.String("amount", "", "signed amount (negative = debit)")
+		reason := fs.String("reason", "", "reason recorded on the transaction")
+		fs.Parse(args[1:])
+		return c.do(http.MethodPost, "/users/"+url.PathEscape(args[0])+"/balance-adjustments", map[string]string{
+			"currency": *currency,
+			"amount":   *amount,
+			"reason":   *reason,
+		})
+	default:
+		return fmt.Errorf("unknown users command: %s", cmd)
+	}
+}
+
+func runIPs(c *client, cmd string, args []string) error {
+	switch cmd {
+	case "unlock":
+		if len(args) != 1 {
+			return fmt.Errorf("ips unlock requires an ip address")
+		}
+		return c.do(http.MethodPost, "/ips/unlock", map[string]string{"ip": args[0]})
+	default:
+		return fmt.Errorf("unknown ips command: %s", cmd)
+	}
+}
+
+func runOrders(c *client, cmd string, args []string) error {
+	switch cmd {
+	case "cancel":
+		if len(args) < 1 {
+			return fmt.Errorf("orders cancel requires an order id")
+		}
+		fs := flag.NewFlagSet("orders cancel", flag.ExitOnError)
+		reason := fs.String("reason", "", "why the order is cancelled")
+		fs.Parse(args[1:])
+		return c.do(http.MethodPost, "/orders/cancel", map[string]string{"order_id": args[0], "reason": *reason})
+	default:
+		return fmt.Errorf("unknown orders command: %s", cmd)
+	}
+}
+
+func runSymbols(c *client, cmd string, args []string) error {
+	switch cmd {
+	case "halts":
+		return c.do(http.MethodGet, "/symbols/halts", nil)
+	case "halt":
+		if len(args) < 1 {
+			return fmt.Errorf("symbols halt requires a symbol")
+		}
+		fs := flag.NewFlagSet("symbols halt", flag.ExitOnError)
+		reason := fs.String("reason", "", "why trading is halted")
+		fs.Parse(args[1:])
+		return c.do(http.MethodPost, "/symbols/halt", map[string]string{"symbol": args[0], "reason": *reason})
+	case "resume":
+		if len(args) != 1 {
+			return fmt.Errorf("symbols resume requires a symbol")
+		}
+		return c.do(http.MethodPost, "/symbols/resume", map[string]string{"symbol": args[0]})
+	default:
+		return fmt.Errorf("unknown symbols command: %s", cmd)
+	}
+}
+
+func runAudit(c *client, cmd string, args []string) error {
+	switch cmd {
+	case "list":
+		fs := flag.NewFlagSet("audit list", flag.ExitOnError)
+		filters := map[string]*string{
+			"username":      fs.String("username", "", "filter by user"),
+			"action":        fs.String("action", "", "filter by action (login_failed, deposit, admin_action...)"),
+			"resource_type": fs.String("resource-type", "", "filter by resource type"),
+			"resource_id":   fs.String("resource-id", "", "filter by resource UUID"),
+			"ip":            fs.String("ip", "", "filter by client IP"),
+			"from":          fs.String("from", "", "entries at or after this time (RFC3339)"),
+			"to":            fs.String("to", "", "entries before this time (RFC3339)"),
+		}
+		limit := fs.Int("limit", 50, "max entries to return")
+		offset := fs.Int("offset", 0, "entries to skip")
+		fs.Parse(args)
+
+		query := url.Values{}
+		for name, value := range filters {
+			if *value != "" {
+				query.Set(name, *value)
+			}
+		}
+		query.Set("limit", fmt.Sprint(*limit))
+		query.Set("offset", fmt.Sprint(*offset))
+		return c.do(http.MethodGet, "/audit-logs?"+query.Encode(), nil)
+	default:
+		return fmt.Errorf("unknown audit command: %s", cmd)
+	}
+}
+
+func runWithdrawals(c *client, cmd string, args []string) error {
+	switch cmd {
+	case "list":
+		fs := flag.NewFlagSet("withdrawals list", flag.ExitOnError)
+		status := fs.String("status", "pending", "pending|approved|completed|failed|rejected|cancelled (empty = all)")
+		username := fs.String("username", "", "filter by user")
+		currency := fs.String("currency", "", "filter by currency")
+		limit := fs.Int("limit", 50, "max withdrawals to return")
+		offset := fs.Int("offset", 0, "withdrawals to skip")
+		fs.Parse(args)
+
+		query := url.Values{}
+		query.Set("status", *status)
+		query.Set("username", *username)
+		query.Set("currency", *currency)
+		query.Set("limit", fmt.Sprint(*limit))
+		query.Set("offset", fmt.Sprint(*offset))
+		return c.do(http.MethodGet, "/withdrawals?"+query.Encode(), nil)
+	case "approve":
+		if len(args) != 1 {
+			return fmt.Errorf("withdrawals approve requires a withdrawal id")
+		}
+		return c.do(http.MethodPost, "/withdrawals/"+url.PathEscape(args[0])+"/approve", nil)
+	case "reject", "fail":
+		if len(args) < 1 {
+			return fmt.Errorf("withdrawals %s requires a withdrawal id", cmd)
+		}
+		fs := flag.NewFlagSet("withdrawals "+cmd, flag.ExitOnError)
+		reason := fs.String("reason", "", "reason shown to the user")
+		fs.Parse(args[1:])
+		return c.do(http.MethodPost, "/withdrawals/"+url.PathEscape(args[0])+"/"+cmd, map[string]string{"reason": *reason})
+	case "complete":
+		if len(args) < 1 {
+			return fmt.Errorf("withdrawals complete requires a withdrawal id")
+		}
+		fs := flag.NewFlagSet("withdrawals complete", flag.ExitOnError)
+		ref := fs.String("ref", "", "transaction hash or bank transfer reference")
+		fs.Parse(args[1:])
+		return c.do(http.MethodPost, "/withdrawals/"+url.PathEscape(args[0])+"/complete", map[string]string{"external_reference": *ref})
+	default:
+		return fmt.Errorf("unknown withdrawals command: %s", cmd)
+	}
+}
+
+func runLedger(c *client, cmd string, args []string) error {
+	switch cmd {
+	case "check":
+		fs := flag.NewFlagSet("ledger check", flag.ExitOnError)
+		fix := fs.Bool("fix", false, "reset mismatched account balances to the ledger")
+		fs.Parse(args)
+		return c.do(http.MethodPost, fmt.Sprintf("/ledger/check?fix=%t", *fix), nil)
+	case "report":
+		return c.do(http.MethodGet, "/ledger/check", nil)
+	case "journals":
+		fs := flag.NewFlagSet("ledger journals", flag.ExitOnError)
+		filters := map[string]*string{
+			"username":     fs.String("username", "", "filter by user account (requires -currency)"),
+			"currency":     fs.String("currency", "", "account currency"),
+			"account_type": fs.String("account-type", "", "spot|margin|futures (default spot)"),
+			"type":         fs.String("type", "", "journal type (deposit, transfer, withdrawal_hold...)"),
+			"reference_id": fs.String("reference-id", "", "filter by reference (e.g. withdrawal:<id>)"),
+		}
+		limit := fs.Int("limit", 50, "max journals to return")
+		offset := fs.Int("offset", 0, "journals to skip")
+		fs.Parse(args)
+
+		query := url.Values{}
+		for name, value := range filters {
+			if *value != "" {
+				query.Set(name, *value)
+			}
+		}
+		query.Set("limit", fmt.Sprint(*limit))
+		query.Set("offset", fmt.Sprint(*offset))
+		return c.do(http.MethodGet, "/ledger/journals?"+query.Encode(), nil)
+	default:
+		return fmt.Errorf("unknown ledger command: %s", cmd)
+	}
+}
+
+// do gọi admin API (payload != nil được gửi dưới dạng JSON) và in response JSON (đã format) ra stdout
+func (c *client) do(method, path string, payload interface{}) error {
+	var reqBody io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Admin-Token", c.token)
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var pretty bytes.Buffer
+	if json.Indent(&pretty, body, "", "  ") == nil {
+		body = pretty.Bytes()
+	}
+	fmt.Println(string(body))
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+	return nil
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -6,7 +6,11 @@ import (
 	"fmt"
 	"math/rand"
 	"net/http"
+	"os"
+	"strconv"
 	"time"
+
+	"github.com/trading-platform/gateway/internal/util"
 )
 
 const (
@@ -20,24 +24,38 @@ type LoginResponse struct {
 	AccessToken string `json:"access_token"`
 }
 
+type APIKeyResponse struct {
+	APIKey    string `json:"api_key"`
+	APISecret string `json:"api_secret"`
+}
+
 func main() {
 	fmt.Println("🤖 Market Maker Bot starting...")
 
-	// 1. Đăng nhập để lấy Token
-	token, err := login()
-	if err != nil {
-		// Nếu lỗi, thử đăng ký user bot luôn (cho tiện)
-		fmt.Println("⚠️  Login failed, trying to register...")
-		err = register()
+	// 1. Lấy API key: dùng BOT_API_KEY/BOT_API_SECRET nếu có, nếu không thì đăng nhập và tạo key mới
+	apiKey, apiSecret := os.Getenv("BOT_API_KEY"), os.Getenv("BOT_API_SECRET")
+	if apiKey == "" || apiSecret == "" {
+		token, err := login()
 		if err != nil {
-			panic(fmt.Errorf("register failed: %v", err))
+			// Nếu lỗi, thử đăng ký user bot luôn (cho tiện)
+			fmt.Println("⚠️  Login failed, trying to register...")
+			err = register()
+			if err != nil {
+				panic(fmt.Errorf("register failed: %v", err))
+			}
+			token, err = login()
+			if err != nil {
+				panic(fmt.Errorf("login after register failed: %v", err))
+			}
 		}
-		token, err = login()
+
+		apiKey, apiSecret, err = createAPIKey(token)
 		if err != nil {
-			panic(fmt.Errorf("login after register failed: %v", err))
+			panic(fmt.Errorf("create api key failed: %v", err))
 		}
+		fmt.Printf("🔑 Created API key. Reuse it with:\n   export BOT_API_KEY=%s BOT_API_SECRET=%s\n", apiKey, apiSecret)
 	}
-	fmt.Println("✅ Bot logged in! Token:", token[:10]+"...")
+	fmt.Println("✅ Bot authenticated with API key:", apiKey[:10]+"...")
 
 	// 2. Vòng lặp giao dịch
 	for {
@@ -52,14 +70,14 @@ func main() {
 		// Số lượng từ 0.1 đến 1.0
 		amount := 0.1 + rand.Float64()
 
-		placeOrder(token, side, float64(price), amount)
+		placeOrder(apiKey, apiSecret, side, float64(price), amount)
 
 		// Nghỉ 500ms (2 lệnh/giây)
 		time.Sleep(500 * time.Millisecond)
 	}
 }
 
-func placeOrder(token, side string, price, amount float64) {
+func placeOrder(apiKey, apiSecret, side string, price, amount float64) {
 	url := baseURL + "/orders"
 
 	// Gửi number thay vì string
@@ -73,7 +91,7 @@ func placeOrder(token, side string, price, amount float64) {
 
 	req, _ := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+token)
+	signRequest(req, apiKey, apiSecret, jsonData)
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
@@ -114,6 +132,41 @@ func login() (string, error) {
 	return res.AccessToken, nil
 }
 
+// createAPIKey tạo API key chỉ có quyền read + trade cho bot (cần access token)
+func createAPIKey(token string) (string, string, error) {
+	url := baseURL + "/api-keys"
+	data := map[string]interface{}{"name": "market-maker-bot", "permissions": []string{"read", "trade"}}
+	jsonData, _ := json.Marshal(data)
+
+	req, _ := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		var errMsg map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&errMsg)
+		return "", "", fmt.Errorf("create api key failed code %d: %v", resp.StatusCode, errMsg)
+	}
+
+	var res APIKeyResponse
+	json.NewDecoder(resp.Body).Decode(&res)
+	return res.APIKey, res.APISecret, nil
+}
+
+// signRequest thêm header API key và chữ ký HMAC (timestamp, method, path, body)
+func signRequest(req *http.Request, apiKey, apiSecret string, body []byte) {
+	timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+	req.Header.Set(util.APIKeyHeader, apiKey)
+	req.Header.Set(util.APITimestampHeader, timestamp)
+	req.Header.Set(util.APISignatureHeader, util.SignRequest(apiSecret, timestamp, req.Method, req.URL.RequestURI(), body))
+}
+
 func register() error {
 	url := baseURL + "/auth/register"
 	data := map[string]string{"username": username, "email": email, "password": pass}
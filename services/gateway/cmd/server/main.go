@@ -13,6 +13,10 @@ import (
 	"github.com/trading-platform/gateway/internal/api"
 	"github.com/trading-platform/gateway/internal/config"
 	db "github.com/trading-platform/gateway/internal/database/sqlc"
+	"github.com/trading-platform/gateway/internal/mailer"
+	"github.com/trading-platform/gateway/internal/marketdata"
+	"github.com/trading-platform/gateway/internal/messaging"
+	"github.com/trading-platform/gateway/internal/ratelimit"
 	"github.com/trading-platform/gateway/internal/websocket"
 	"github.com/trading-platform/gateway/internal/worker"
 )
@@ -49,21 +53,51 @@ func main() {
 
 	// Kết nối NATS
 	log.Println("🔌 Connecting to NATS...")
-	nc, err := nats.Connect("nats://localhost:4222")
+	nc, err := nats.Connect(cfg.NATS.URL)
 	if err != nil {
 		log.Fatalf("Cannot connect to NATS: %v", err)
 	}
 	defer nc.Close()
 	log.Println("✅ NATS connected successfully")
 
+	// JetStream: lưu bền vững command (ORDERS) và event (EVENTS)
+	jsOpts := messaging.Options{
+		StreamMaxAge:      cfg.NATS.StreamMaxAge,
+		DuplicateWindow:   cfg.NATS.DuplicateWindow,
+		AckWait:           cfg.NATS.AckWait,
+		MaxDeliver:        cfg.NATS.MaxDeliver,
+		PublishTimeout:    cfg.NATS.PublishTimeout,
+		MaxAckPending:     cfg.NATS.MaxAckPending,
+		StreamStorageFile: cfg.NATS.StreamFileStorage,
+	}
+	js, err := messaging.SetupJetStream(ctx, nc, jsOpts)
+	if err != nil {
+		log.Fatalf("Cannot setup JetStream: %v", err)
+	}
+	publisher := messaging.NewCommandPublisher(js, cfg.NATS.PublishTimeout)
+
 	// 1. Khởi tạo WebSocket Hub (di chuyển lên trước để có thể dùng trong processor)
 	log.Println("🔌 Initializing WebSocket Hub...")
-	wsHub := websocket.NewHub()
+	wsHub := websocket.NewHub(websocket.Options{
+		SendBufferSize:     cfg.WebSocket.SendBufferSize,
+		SlowConsumerPolicy: websocket.SlowConsumerPolicy(cfg.WebSocket.SlowConsumerPolicy),
+		WriteWait:          cfg.WebSocket.WriteWait,
+		PongWait:           cfg.WebSocket.PongWait,
+		PingInterval:       cfg.WebSocket.PingInterval,
+		MaxMessageSize:     cfg.WebSocket.MaxMessageSize,
+	})
 	go wsHub.Run() // Chạy Hub ngầm
 
 	// Khởi động Event Processor (Worker) trong goroutine riêng
 	log.Println("🔧 Starting Event Processor Worker...")
-	processor := worker.NewEventProcessor(store, nc, wsHub) // Truyền wsHub vào
+	processor := worker.NewEventProcessor(store, js, jsOpts, worker.EventProcessorOptions{
+		Workers:   cfg.Events.Workers,
+		QueueSize: cfg.Events.QueueSize,
+		BatchSize: cfg.Events.BatchSize,
+
+		MakerFeeRate: cfg.Trading.MakerFeeRate,
+		TakerFeeRate: cfg.Trading.TakerFeeRate,
+	}, wsHub) // Truyền wsHub vào
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -76,15 +110,89 @@ func main() {
 
 	// 2. Khởi tạo Redis Listener để cầu nối dữ liệu
 	log.Println("📡 Starting Redis Listener...")
-	redisAddr := os.Getenv("REDIS_URL")
-	if redisAddr == "" {
-		redisAddr = "localhost:6379" // Default Redis address
+	rdb, err := worker.NewRedisClient(cfg.Redis)
+	if err != nil {
+		log.Fatalf("Cannot create Redis client: %v", err)
 	}
-	redisListener := worker.NewRedisListener(redisAddr, wsHub)
-	go redisListener.Start() // Chạy Listener ngầm
+	defer rdb.Close()
+
+	// Depth feed: snapshot ban đầu từ key orderbook:{symbol}, sau đó là delta có sequence
+	depthFeed := marketdata.NewDepthFeed(marketdata.NewRedisSnapshotLoader(rdb), cfg.Market.DepthHistorySize)
+	wsHub.RegisterChannel(marketdata.DepthChannel, depthFeed)
+
+	redisListener := worker.NewRedisListener(rdb, store, wsHub, depthFeed, worker.RedisListenerOptions{
+		SubscribeMode:       cfg.Market.SubscribeMode,
+		RefreshInterval:     cfg.Market.SymbolRefreshInterval,
+		HealthCheckInterval: cfg.Redis.HealthCheckInterval,
+		MinBackoff:          cfg.Redis.ReconnectMinBackoff,
+		MaxBackoff:          cfg.Redis.ReconnectMaxBackoff,
+	})
+	go redisListener.Start(ctx) // Chạy Listener ngầm, dừng khi shutdown
+
+	// 3. Outbox Relay: publish các command đã ghi cùng transaction với order lên JetStream
+	log.Println("📤 Starting Outbox Relay...")
+	outboxRelay := worker.NewOutboxRelay(store, publisher, worker.OutboxRelayOptions{
+		PollInterval: cfg.Outbox.PollInterval,
+		BatchSize:    cfg.Outbox.BatchSize,
+	})
+	go outboxRelay.Start(ctx)
+
+	// 4. Reconciler: đối soát order mở trong DB với sổ lệnh engine (snapshot Redis)
+	reconciler := worker.NewReconciler(store, marketdata.NewRedisSnapshotLoader(rdb), outboxRelay, processor, worker.ReconcilerOptions{
+		Interval:     cfg.Reconcile.Interval,
+		MinAge:       cfg.Reconcile.MinAge,
+		AutoFix:      cfg.Reconcile.AutoFix,
+		OrphanAction: cfg.Reconcile.OrphanAction,
+	})
+	go reconciler.Start(ctx)
+
+	// 5. Ledger checker: đối chiếu số dư các ví với tổng entry trong sổ cái
+	ledgerChecker := worker.NewLedgerChecker(store, worker.LedgerCheckerOptions{
+		Interval: cfg.Ledger.CheckInterval,
+		AutoFix:  cfg.Ledger.AutoFix,
+	})
+	go ledgerChecker.Start(ctx)
+
+	// 6. Audit Writer: ghi audit log theo lô, request chỉ đưa entry vào hàng đợi
+	auditWriter := worker.NewAuditWriter(store, worker.AuditWriterOptions{
+		QueueSize:     cfg.Audit.QueueSize,
+		BatchSize:     cfg.Audit.BatchSize,
+		FlushInterval: cfg.Audit.FlushInterval,
+	})
+	go auditWriter.Start(ctx)
 
 	// Create and start server
-	server := api.NewServer(*cfg, store, nc, wsHub)
+	mail, err := mailer.New(cfg.Mail)
+	if err != nil {
+		log.Fatalf("Cannot create mailer: %v", err)
+	}
+	log.Printf("📧 Mail driver: %s", cfg.Mail.Driver)
+
+	// Rate limit: bucket trong RAM, hoặc trong Redis khi chạy nhiều gateway
+	var limits ratelimit.Store = ratelimit.NewMemoryStore()
+	if cfg.RateLimit.Backend == "redis" {
+		limits = ratelimit.NewRedisStore(rdb, cfg.RateLimit.RedisPrefix)
+	}
+	log.Printf("🚦 Rate limit backend: %s (enabled=%t)", cfg.RateLimit.Backend, cfg.RateLimit.Enabled)
+
+	server := api.NewServer(*cfg, store, nc, outboxRelay, processor, reconciler, ledgerChecker, mail, auditWriter, limits, wsHub, depthFeed)
+	server.RegisterHealthCheck("redis", func() (bool, interface{}) {
+		health := redisListener.Health()
+		return health.Connected, health
+	})
+	server.RegisterHealthCheck("events", func() (bool, interface{}) {
+		health := processor.Health()
+		return !health.Paused, health
+	})
+	server.RegisterHealthCheck("outbox", func() (bool, interface{}) {
+		health := outboxRelay.Health()
+		return health.LastError == "", health
+	})
+	server.RegisterHealthCheck("audit", func() (bool, interface{}) {
+		health := auditWriter.Health()
+		return health.LastError == "", health
+	})
+	server.RegisterHealthCheck("ledger", ledgerChecker.Health)
 
 	address := fmt.Sprintf(":%s", cfg.Server.Port)
 	log.Printf("🚀 Gateway server starting on port %s", cfg.Server.Port)
@@ -97,6 +205,10 @@ func main() {
 		<-sigChan
 		log.Println("🛑 Shutting down gracefully...")
 		cancel() // Cancel context to stop worker
+
+		// Chờ audit log còn trong hàng đợi được ghi xong rồi mới thoát
+		<-auditWriter.Stopped()
+		os.Exit(0)
 	}()
 
 	if err := server.Start(address); err != nil {
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	db "github.com/trading-platform/gateway/internal/database/sqlc"
+	"github.com/trading-platform/gateway/internal/util"
+)
+
+const (
+	authorizationAPIKeyKey = "authorization_api_key" // *db.APIKey khi request được xác thực bằng API key
+	maxSignedBodySize      = 1 << 20
+)
+
+// apiKeyAuth xác thực request ký bằng API key (HMAC-SHA256 trên timestamp, method, path và body)
+type apiKeyAuth struct {
+	store         db.Store
+	encryptionKey []byte
+	window        time.Duration // Độ lệch timestamp tối đa; chữ ký đã dùng được nhớ trong khoảng này
+
+	mu        sync.Mutex
+	seen      map[string]time.Time // Chữ ký đã dùng -> hết hạn, chống gửi lại nguyên request
+	lastSweep time.Time
+}
+
+func newAPIKeyAuth(store db.Store, encryptionKey []byte, window time.Duration) *apiKeyAuth {
+	return &apiKeyAuth{
+		store:         store,
+		encryptionKey: encryptionKey,
+		window:        window,
+		seen:          make(map[string]time.Time),
+	}
+}
+
+// authenticate kiểm tra header API key; trả về HTTP status và lỗi khi thất bại
+func (a *apiKeyAuth) authenticate(ctx *gin.Context) (*db.APIKey, int, error) {
+	timestamp := ctx.GetHeader(util.APITimestampHeader)
+	signature := ctx.GetHeader(util.APISignatureHeader)
+	if timestamp == "" || signature == "" {
+		return nil, http.StatusUnauthorized, fmt.Errorf("%s and %s headers are required", util.APITimestampHeader, util.APISignatureHeader)
+	}
+
+	ms, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, http.StatusUnauthorized, fmt.Errorf("invalid %s", util.APITimestampHeader)
+	}
+	now := time.Now()
+	if skew := now.Sub(time.UnixMilli(ms)); skew > a.window || skew < -a.window {
+		return nil, http.StatusUnauthorized, fmt.Errorf("request timestamp is outside the allowed window")
+	}
+
+	key, err := a.store.GetAPIKeyByHash(ctx, util.HashToken(ctx.GetHeader(util.APIKeyHeader)))
+	if err != nil {
+		if err.Error() == "api key not found" {
+			return nil, http.StatusUnauthorized, fmt.Errorf("invalid api key")
+		}
+		return nil, http.StatusInternalServerError, fmt.Errorf("failed to check api key")
+	}
+	if !key.IsActive || key.RevokedAt != nil {
+		return nil, http.StatusUnauthorized, fmt.Errorf("api key has been revoked")
+	}
+	if key.ExpiresAt != nil && now.After(*key.ExpiresAt) {
+		return nil, http.StatusUnauthorized, fmt.Errorf("api key has expired")
+	}
+	if !util.IPAllowed(key.AllowedIPs, ctx.ClientIP()) {
+		return nil, http.StatusForbidden, fmt.Errorf("ip address is not allowed for this api key")
+	}
+
+	// Đọc body để kiểm tra chữ ký, rồi trả lại cho handler
+	body, err := io.ReadAll(io.LimitReader(ctx.Request.Body, maxSignedBodySize+1))
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("failed to read request body")
+	}
+	if len(body) > maxSignedBodySize {
+		return nil, http.StatusRequestEntityTooLarge, fmt.Errorf("request body is too large")
+	}
+	ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	secret, err := util.DecryptSecret(a.encryptionKey, key.SecretCiphertext)
+	if err != nil {
+		log.Printf("❌ Failed to decrypt secret of api key %s: %v", key.ID, err)
+		return nil, http.StatusUnauthorized, fmt.Errorf("invalid api key")
+	}
+	if !util.VerifySignature(secret, timestamp, ctx.Request.Method, ctx.Request.URL.RequestURI(), body, signature) {
+		return nil, http.StatusUnauthorized, fmt.Errorf("invalid signature")
+	}
+	if !a.markSeen(signature, now) {
+		return nil, http.StatusUnauthorized, fmt.Errorf("request has already been used")
+	}
+
+	if err := a.store.TouchAPIKey(ctx, key.ID); err != nil {
+		log.Printf("⚠️  Failed to update last_used_at of api key %s: %v", key.ID, err)
+	}
+	return &key, 0, nil
+}
+
+// markSeen ghi nhận chữ ký; trả về false nếu chữ ký đã được dùng trong cửa sổ hiện tại.
+// Bộ nhớ nằm trong từng process: chạy nhiều gateway thì mỗi instance chặn replay của riêng nó.
+func (a *apiKeyAuth) markSeen(signature string, now time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if now.Sub(a.lastSweep) > a.window {
+		for sig, expiry := range a.seen {
+			if now.After(expiry) {
+				delete(a.seen, sig)
+			}
+		}
+		a.lastSweep = now
+	}
+
+	if expiry, ok := a.seen[signature]; ok && now.Before(expiry) {
+		return false
+	}
+	// Timestamp hợp lệ trong ±window nên chữ ký cần được nhớ 2*window
+	a.seen[signature] = now.Add(2 * a.window)
+	return true
+}
+
+// requirePermission chặn request dùng API key không có quyền perm. Đăng nhập bằng session có đủ quyền.
+func requirePermission(perm string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		value, ok := ctx.Get(authorizationAPIKeyKey)
+		if !ok {
+			ctx.Next()
+			return
+		}
+
+		key := value.(*db.APIKey)
+		for _, p := range key.Permissions {
+			if p == perm {
+				ctx.Next()
+				return
+			}
+		}
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("api key lacks '%s' permission", perm)})
+	}
+}
+
+// requireSession chặn API key ở các route quản lý tài khoản (session, API key...)
+func requireSession() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if _, ok := ctx.Get(authorizationAPIKeyKey); ok {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "this endpoint requires a user session, not an api key"})
+			return
+		}
+		ctx.Next()
+	}
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/trading-platform/gateway/internal/api/handlers"
+	db "github.com/trading-platform/gateway/internal/database/sqlc"
+	"github.com/trading-platform/gateway/internal/util"
+)
+
+const maxAuditBodySize = 16 << 10 // Body lớn hơn không được chép vào audit log
+
+// auditAdminActions ghi audit log cho mọi request thay đổi dữ liệu qua admin API (dùng sau adminMiddleware):
+// ai làm, route nào, tham số, body JSON và status trả về. Ghi cả request bị từ chối (403, 400...).
+func auditAdminActions(store db.Store, audit handlers.AuditLogger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if ctx.Request.Method == http.MethodGet {
+			ctx.Next()
+			return
+		}
+
+		// Đọc trước tối đa maxAuditBodySize byte rồi ghép lại để handler vẫn đọc được toàn bộ body
+		var body []byte
+		if ctx.Request.Body != nil {
+			original := ctx.Request.Body
+			body, _ = io.ReadAll(io.LimitReader(original, maxAuditBodySize+1))
+			ctx.Request.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), original), original}
+		}
+
+		ctx.Next()
+
+		payload := ctx.MustGet(authorizationPayloadKey).(*util.Payload)
+		params := map[string]string{}
+		for _, p := range ctx.Params {
+			params[p.Key] = p.Value
+		}
+		details := map[string]interface{}{
+			"actor":      payload.Username,
+			"actor_role": payload.Role,
+			"method":     ctx.Request.Method,
+			"route":      ctx.FullPath(),
+			"path":       ctx.Request.URL.Path,
+			"params":     params,
+			"status":     ctx.Writer.Status(),
+		}
+		if len(body) > 0 && len(body) <= maxAuditBodySize && json.Valid(body) {
+			details["body"] = json.RawMessage(body)
+		}
+
+		// Nhân viên đăng nhập bằng session: gắn user_id của họ; X-Admin-Token không ứng với user nào
+		entry := db.CreateAuditLogParams{
+			Action:       handlers.AuditAdminAction,
+			ResourceType: "admin",
+			IPAddress:    ctx.ClientIP(),
+			UserAgent:    ctx.Request.UserAgent(),
+			Details:      details,
+		}
+		if payload.Username != adminTokenActor {
+			if user, err := store.GetUserByUsername(ctx, payload.Username); err == nil {
+				entry.UserID = user.ID
+			}
+		}
+		audit.Log(entry)
+	}
+}
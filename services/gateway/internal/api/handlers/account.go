@@ -2,21 +2,27 @@ package handlers
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/trading-platform/gateway/internal/config"
 	db "github.com/trading-platform/gateway/internal/database/sqlc"
 	"github.com/trading-platform/gateway/internal/util"
 )
 
 // AccountHandler handles account-related requests
 type AccountHandler struct {
-	store db.Store
+	store            db.Store
+	audit            AuditLogger
+	withdrawalLimits map[string]string // Hạn mức rút mỗi 24 giờ theo currency
 }
 
 // NewAccountHandler creates a new account handler
-func NewAccountHandler(store db.Store) *AccountHandler {
+func NewAccountHandler(store db.Store, audit AuditLogger, withdrawal config.WithdrawalConfig) *AccountHandler {
 	return &AccountHandler{
-		store: store,
+		store:            store,
+		audit:            audit,
+		withdrawalLimits: withdrawal.DailyLimits,
 	}
 }
 
@@ -83,6 +89,19 @@ func (h *AccountHandler) AddDeposit(ctx *gin.Context) {
 		return
 	}
 
+	recordAudit(ctx, h.audit, db.CreateAuditLogParams{
+		UserID:       user.ID,
+		Action:       AuditDeposit,
+		ResourceType: "transaction",
+		Details: map[string]interface{}{
+			"transaction_id": result.Transaction.ID,
+			"account_id":     result.Account.ID,
+			"currency":       req.Currency,
+			"amount":         req.Amount,
+			"balance":        result.Account.Balance,
+		},
+	})
+
 	// 3. Trả về kết quả
 	ctx.JSON(http.StatusOK, gin.H{
 		"message":     "Deposit successful",
@@ -132,3 +151,62 @@ func (h *AccountHandler) GetAccountBalance(ctx *gin.Context) {
 		"account": account,
 	})
 }
+
+// --- API: Lịch sử giao dịch của ví (GET /api/v1/accounts/:currency/transactions) ---
+
+type listTransactionsRequest struct {
+	AccountType string `form:"account_type" binding:"omitempty,oneof=spot margin futures"`
+	Type        string `form:"type" binding:"omitempty,oneof=deposit withdraw transfer_in transfer_out adjustment"`
+	Limit       int32  `form:"limit" binding:"omitempty,min=1,max=500"`
+	Offset      int32  `form:"offset" binding:"omitempty,min=0"`
+}
+
+// ListTransactions returns a page of the account's transactions, newest first.
+// Chưa có ví thì trả danh sách rỗng, không tạo ví mới.
+func (h *AccountHandler) ListTransactions(ctx *gin.Context) {
+	var req listTransactionsRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = 50
+	}
+
+	payload := ctx.MustGet("authorization_payload").(*util.Payload)
+	user, err := h.store.GetUserByUsername(ctx, payload.Username)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	account, err := h.store.GetAccountByUserAndType(ctx, db.GetAccountByUserAndTypeParams{
+		UserID:      util.HashStringToInt32(user.ID),
+		AccountType: req.AccountType,
+		Currency:    strings.ToUpper(ctx.Param("currency")),
+	})
+	if err != nil {
+		if err.Error() == "account not found" {
+			ctx.JSON(http.StatusOK, gin.H{"transactions": []db.Transactions{}})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	transactions, err := h.store.GetTransactionsByAccountID(ctx, db.GetTransactionsByAccountIDParams{
+		AccountID: account.ID,
+		Type:      req.Type,
+		Limit:     req.Limit,
+		Offset:    req.Offset,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"account":      account,
+		"transactions": transactions,
+	})
+}
@@ -0,0 +1,353 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	db "github.com/trading-platform/gateway/internal/database/sqlc"
+	"github.com/trading-platform/gateway/internal/messaging"
+	"github.com/trading-platform/gateway/internal/models"
+	"github.com/trading-platform/gateway/internal/util"
+)
+
+// AdminHandler handles staff operations on users, orders and symbols (/api/v1/admin)
+type AdminHandler struct {
+	store  db.Store
+	outbox OutboxNotifier
+}
+
+// NewAdminHandler creates a new admin handler
+func NewAdminHandler(store db.Store, outbox OutboxNotifier) *AdminHandler {
+	return &AdminHandler{
+		store:  store,
+		outbox: outbox,
+	}
+}
+
+// GetUserBalances returns any user's accounts (GET /api/v1/admin/users/:username/balances)
+func (h *AdminHandler) GetUserBalances(ctx *gin.Context) {
+	user, ok := h.targetUser(ctx)
+	if !ok {
+		return
+	}
+
+	accounts, err := h.store.GetAccountsByUserID(ctx, util.HashStringToInt32(user.ID))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if accounts == nil {
+		accounts = []db.Accounts{}
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"user":     adminUserView(user),
+		"accounts": accounts,
+	})
+}
+
+// GetUserOrders returns any user's orders (GET /api/v1/admin/users/:username/orders)
+func (h *AdminHandler) GetUserOrders(ctx *gin.Context) {
+	user, ok := h.targetUser(ctx)
+	if !ok {
+		return
+	}
+
+	orders, err := h.store.ListOrdersWithUUID(ctx, user.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to query orders"})
+		return
+	}
+	if orders == nil {
+		orders = []map[string]interface{}{}
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"user":   adminUserView(user),
+		"orders": orders,
+	})
+}
+
+type updateUserRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// UpdateUserRole changes a user's role (PUT /api/v1/admin/users/:username/role).
+// Mọi session của user bị thu hồi để role mới có hiệu lực ngay (role nằm trong access token).
+func (h *AdminHandler) UpdateUserRole(ctx *gin.Context) {
+	var req updateUserRoleRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !util.ValidRole(req.Role) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid role: %s", req.Role)})
+		return
+	}
+
+	user, ok := h.targetUser(ctx)
+	if !ok {
+		return
+	}
+
+	user, err := h.store.UpdateUserRole(ctx, user.ID, req.Role)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	revoked, err := h.store.RevokeUserSessions(ctx, user.ID, "")
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("👮 %s changed role of %s to %s", actor(ctx), user.Username, user.Role)
+	ctx.JSON(http.StatusOK, gin.H{
+		"user":             adminUserView(user),
+		"sessions_revoked": revoked,
+	})
+}
+
+// UnlockUser clears a user's failed-login counter and lockout (POST /api/v1/admin/users/:username/unlock)
+func (h *AdminHandler) UnlockUser(ctx *gin.Context) {
+	user, ok := h.targetUser(ctx)
+	if !ok {
+		return
+	}
+
+	unlocked, err := h.store.ClearLoginFailures(ctx, loginKeyUsername, user.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("🔓 %s unlocked login of %s", actor(ctx), user.Username)
+	ctx.JSON(http.StatusOK, gin.H{"message": "account unlocked", "username": user.Username, "had_failures": unlocked})
+}
+
+type unlockIPRequest struct {
+	IP string `json:"ip" binding:"required,ip"`
+}
+
+// UnlockIP clears the failed-login counter and lockout of an IP address (POST /api/v1/admin/ips/unlock)
+func (h *AdminHandler) UnlockIP(ctx *gin.Context) {
+	var req unlockIPRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	unlocked, err := h.store.ClearLoginFailures(ctx, loginKeyIP, req.IP)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("🔓 %s unlocked login from %s", actor(ctx), req.IP)
+	ctx.JSON(http.StatusOK, gin.H{"message": "ip unlocked", "ip": req.IP, "had_failures": unlocked})
+}
+
+type adjustBalanceRequest struct {
+	Currency string `json:"currency" binding:"required,oneof=USD USDT BTC ETH"`
+	Amount   string `json:"amount" binding:"required"` // Có dấu: "-10.5" = trừ
+	Reason   string `json:"reason" binding:"required,min=5,max=500"`
+}
+
+// AdjustBalance credits or debits a user's balance with a mandatory reason
+// (POST /api/v1/admin/users/:username/balance-adjustments)
+func (h *AdminHandler) AdjustBalance(ctx *gin.Context) {
+	var req adjustBalanceRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if amount, err := strconv.ParseFloat(req.Amount, 64); err != nil || amount == 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "amount must be a non-zero decimal"})
+		return
+	}
+
+	user, ok := h.targetUser(ctx)
+	if !ok {
+		return
+	}
+
+	result, err := h.store.AdjustBalanceTx(ctx, db.AdjustBalanceTxParams{
+		UserID:   user.ID,
+		Currency: req.Currency,
+		Amount:   req.Amount,
+		Reason:   req.Reason,
+		Actor:    actor(ctx),
+	})
+	if err != nil {
+		if err.Error() == "insufficient balance" {
+			ctx.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("👮 %s adjusted %s balance of %s by %s: %s", actor(ctx), req.Currency, user.Username, req.Amount, req.Reason)
+	ctx.JSON(http.StatusOK, gin.H{
+		"account":     result.Account,
+		"transaction": result.Transaction,
+	})
+}
+
+// ListSymbolHalts lists halted symbols (GET /api/v1/admin/symbols/halts)
+func (h *AdminHandler) ListSymbolHalts(ctx *gin.Context) {
+	halts, err := h.store.ListSymbolHalts(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if halts == nil {
+		halts = []db.SymbolHalt{}
+	}
+	ctx.JSON(http.StatusOK, halts)
+}
+
+type haltSymbolRequest struct {
+	Symbol string `json:"symbol" binding:"required"`
+	Reason string `json:"reason" binding:"required,max=500"`
+}
+
+// HaltSymbol stops accepting new orders for a symbol (POST /api/v1/admin/symbols/halt).
+// Lệnh đang nằm trong sổ không bị động tới; user vẫn hủy được.
+func (h *AdminHandler) HaltSymbol(ctx *gin.Context) {
+	var req haltSymbolRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	halt, err := h.store.CreateSymbolHalt(ctx, db.CreateSymbolHaltParams{
+		Symbol:   req.Symbol,
+		Reason:   req.Reason,
+		HaltedBy: actor(ctx),
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("⛔ %s halted %s: %s", halt.HaltedBy, halt.Symbol, halt.Reason)
+	ctx.JSON(http.StatusOK, halt)
+}
+
+type resumeSymbolRequest struct {
+	Symbol string `json:"symbol" binding:"required"`
+}
+
+// ResumeSymbol resumes trading of a halted symbol (POST /api/v1/admin/symbols/resume)
+func (h *AdminHandler) ResumeSymbol(ctx *gin.Context) {
+	var req resumeSymbolRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	resumed, err := h.store.DeleteSymbolHalt(ctx, req.Symbol)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !resumed {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "symbol is not halted"})
+		return
+	}
+
+	log.Printf("✅ %s resumed %s", actor(ctx), req.Symbol)
+	ctx.JSON(http.StatusOK, gin.H{"message": "trading resumed", "symbol": req.Symbol})
+}
+
+type adminCancelOrderRequest struct {
+	OrderID string `json:"order_id" binding:"required"` // UUID trong bảng orders
+	Reason  string `json:"reason" binding:"required,max=500"`
+}
+
+// CancelOrder cancels a user's order on their behalf (POST /api/v1/admin/orders/cancel).
+// Lệnh hủy đi qua engine như khi user tự hủy; order chuyển CANCELLED khi có event OrderCancelled.
+func (h *AdminHandler) CancelOrder(ctx *gin.Context) {
+	var req adminCancelOrderRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := uuid.Parse(req.OrderID); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid order id"})
+		return
+	}
+
+	order, err := h.store.GetOrderByUUID(ctx, req.OrderID)
+	if err != nil {
+		if err.Error() == "order not found" {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if order.Status != "OPEN" && order.Status != "PARTIALLY_FILLED" {
+		ctx.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("order is %s", order.Status)})
+		return
+	}
+
+	payload, err := json.Marshal(models.Command{
+		Type: "Cancel",
+		Data: models.CancelData{OrderID: uint64(order.EngineOrderID)},
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encode cancel command"})
+		return
+	}
+
+	engineOrderID := strconv.FormatInt(order.EngineOrderID, 10)
+	if _, err := h.store.CreateOutboxMessage(ctx, db.CreateOutboxMessageParams{
+		AggregateID: engineOrderID,
+		Subject:     messaging.OrdersSubject,
+		MsgID:       fmt.Sprintf("admin-cancel-%s-%d", engineOrderID, time.Now().UnixNano()),
+		Payload:     payload,
+	}); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to queue cancel command"})
+		return
+	}
+	h.outbox.Notify()
+
+	log.Printf("👮 %s cancelled order %s of user %s: %s", actor(ctx), order.ID, order.UserID, req.Reason)
+	ctx.JSON(http.StatusOK, gin.H{"message": "Cancel request sent successfully", "order_id": order.ID})
+}
+
+// targetUser đọc :username từ URL; trả về false (đã ghi response) nếu không tìm thấy
+func (h *AdminHandler) targetUser(ctx *gin.Context) (db.Users, bool) {
+	user, err := h.store.GetUserByUsername(ctx, ctx.Param("username"))
+	if err != nil {
+		if err.Error() == "user not found" {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return db.Users{}, false
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return db.Users{}, false
+	}
+	return user, true
+}
+
+// actor là username của nhân viên thực hiện thao tác
+func actor(ctx *gin.Context) string {
+	return ctx.MustGet("authorization_payload").(*util.Payload).Username
+}
+
+func adminUserView(user db.Users) gin.H {
+	return gin.H{
+		"id":       user.ID,
+		"username": user.Username,
+		"email":    user.Email,
+		"role":     user.Role,
+	}
+}
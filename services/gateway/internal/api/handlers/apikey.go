@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	db "github.com/trading-platform/gateway/internal/database/sqlc"
+	"github.com/trading-platform/gateway/internal/util"
+)
+
+// Quyền của API key
+const (
+	PermissionRead     = "read"     // Xem số dư, lệnh, giao dịch
+	PermissionTrade    = "trade"    // Đặt/hủy lệnh
+	PermissionWithdraw = "withdraw" // Rút tiền, chuyển tiền, hủy yêu cầu rút tiền (user đã bật 2FA: rút/chuyển chỉ qua session)
+)
+
+// APIKeyHandler handles API key management for the current user
+type APIKeyHandler struct {
+	store         db.Store
+	encryptionKey []byte // Khóa AES-256 mã hóa secret trong DB
+	audit         AuditLogger
+}
+
+// NewAPIKeyHandler creates a new API key handler
+func NewAPIKeyHandler(store db.Store, encryptionKey []byte, audit AuditLogger) *APIKeyHandler {
+	return &APIKeyHandler{
+		store:         store,
+		encryptionKey: encryptionKey,
+		audit:         audit,
+	}
+}
+
+// CreateAPIKeyRequest represents the request body for creating an API key
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Permissions   []string `json:"permissions" binding:"required,min=1,dive,oneof=read trade withdraw"`
+	AllowedIPs    []string `json:"allowed_ips" binding:"omitempty,max=20"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"omitempty,min=1,max=365"`
+}
+
+// CreateAPIKey creates an API key; secret chỉ được trả về một lần trong response này
+// (POST /api/v1/api-keys)
+func (h *APIKeyHandler) CreateAPIKey(ctx *gin.Context) {
+	var req CreateAPIKeyRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	allowedIPs, err := util.ParseIPAllowlist(req.AllowedIPs)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	payload := ctx.MustGet("authorization_payload").(*util.Payload)
+	user, err := h.store.GetUserByUsername(ctx, payload.Username)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+		return
+	}
+
+	key, secret, err := util.GenerateAPIKey()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate api key"})
+		return
+	}
+	ciphertext, err := util.EncryptSecret(h.encryptionKey, secret)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encrypt api secret"})
+		return
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInDays > 0 {
+		t := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		expiresAt = &t
+	}
+
+	apiKey, err := h.store.CreateAPIKey(ctx, db.CreateAPIKeyParams{
+		UserID:           user.ID,
+		Name:             req.Name,
+		KeyPrefix:        key[:10],
+		KeyHash:          util.HashToken(key),
+		SecretHash:       util.HashToken(secret),
+		SecretCiphertext: ciphertext,
+		Permissions:      uniqueStrings(req.Permissions),
+		AllowedIPs:       allowedIPs,
+		ExpiresAt:        expiresAt,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create api key: " + err.Error()})
+		return
+	}
+
+	recordAudit(ctx, h.audit, db.CreateAuditLogParams{
+		UserID:       user.ID,
+		Action:       AuditAPIKeyCreated,
+		ResourceType: "api_key",
+		ResourceID:   apiKey.ID,
+		Details: map[string]interface{}{
+			"name":        apiKey.Name,
+			"key_prefix":  apiKey.KeyPrefix,
+			"permissions": apiKey.Permissions,
+			"allowed_ips": apiKey.AllowedIPs,
+			"expires_at":  apiKey.ExpiresAt,
+		},
+	})
+	ctx.JSON(http.StatusCreated, gin.H{
+		"api_key":    key,
+		"api_secret": secret,
+		"key":        apiKey,
+		"warning":    "store the secret now, it cannot be shown again",
+	})
+}
+
+// ListAPIKeys lists the current user's API keys (không có secret) (GET /api/v1/api-keys)
+func (h *APIKeyHandler) ListAPIKeys(ctx *gin.Context) {
+	payload := ctx.MustGet("authorization_payload").(*util.Payload)
+	user, err := h.store.GetUserByUsername(ctx, payload.Username)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+		return
+	}
+
+	keys, err := h.store.ListAPIKeys(ctx, user.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Ensure we always return an array, not null
+	if keys == nil {
+		keys = []db.APIKey{}
+	}
+	ctx.JSON(http.StatusOK, keys)
+}
+
+// RevokeAPIKey revokes one of the current user's API keys (DELETE /api/v1/api-keys/:id)
+func (h *APIKeyHandler) RevokeAPIKey(ctx *gin.Context) {
+	payload := ctx.MustGet("authorization_payload").(*util.Payload)
+	user, err := h.store.GetUserByUsername(ctx, payload.Username)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+		return
+	}
+
+	id := ctx.Param("id")
+	if _, err := uuid.Parse(id); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid api key id"})
+		return
+	}
+
+	revoked, err := h.store.RevokeAPIKey(ctx, id, user.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !revoked {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "api key not found"})
+		return
+	}
+	recordAudit(ctx, h.audit, db.CreateAuditLogParams{
+		UserID:       user.ID,
+		Action:       AuditAPIKeyRevoked,
+		ResourceType: "api_key",
+		ResourceID:   id,
+	})
+	ctx.JSON(http.StatusOK, gin.H{"message": "api key revoked", "id": id})
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	unique := make([]string, 0, len(values))
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
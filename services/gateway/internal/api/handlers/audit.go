@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	db "github.com/trading-platform/gateway/internal/database/sqlc"
+)
+
+// AuditLogger nhận audit log entry (worker.AuditWriter ghi bất đồng bộ theo lô)
+type AuditLogger interface {
+	Log(entry db.CreateAuditLogParams)
+}
+
+// Các action ghi vào audit_logs
+const (
+	AuditRegister             = "register"
+	AuditLogin                = "login"
+	AuditLoginFailed          = "login_failed"
+	AuditLogout               = "logout"
+	AuditPasswordReset        = "password_reset"
+	AuditTwoFactorEnabled     = "2fa_enabled"
+	AuditTwoFactorDisabled    = "2fa_disabled"
+	AuditAccountLocked        = "account_locked"
+	AuditIPLocked             = "ip_locked"
+	AuditDeposit              = "deposit"
+	AuditOrderPlaced          = "order_placed"
+	AuditOrderCancelRequested = "order_cancel_requested"
+	AuditAPIKeyCreated        = "api_key_created"
+	AuditAPIKeyRevoked        = "api_key_revoked"
+	AuditAdminAction          = "admin_action"
+)
+
+// recordAudit gắn IP và user agent của request vào entry rồi chuyển cho logger
+func recordAudit(ctx *gin.Context, logger AuditLogger, entry db.CreateAuditLogParams) {
+	entry.IPAddress = ctx.ClientIP()
+	entry.UserAgent = ctx.Request.UserAgent()
+	logger.Log(entry)
+}
+
+// AuditAdminHandler handles operator queries on the audit log
+type AuditAdminHandler struct {
+	store db.Store
+}
+
+// NewAuditAdminHandler creates a new audit admin handler
+func NewAuditAdminHandler(store db.Store) *AuditAdminHandler {
+	return &AuditAdminHandler{
+		store: store,
+	}
+}
+
+type listAuditLogsRequest struct {
+	Username     string    `form:"username"`
+	UserID       string    `form:"user_id" binding:"omitempty,uuid"`
+	Action       string    `form:"action"`
+	ResourceType string    `form:"resource_type"`
+	ResourceID   string    `form:"resource_id" binding:"omitempty,uuid"`
+	IP           string    `form:"ip" binding:"omitempty,ip"`
+	From         time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00"`
+	To           time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00"`
+	Limit        int32     `form:"limit" binding:"omitempty,min=1,max=500"`
+	Offset       int32     `form:"offset" binding:"omitempty,min=0"`
+}
+
+// ListAuditLogs lists audit log entries, newest first
+// (GET /api/v1/admin/audit-logs?username=alice&action=login_failed&from=2024-01-01T00:00:00Z)
+func (h *AuditAdminHandler) ListAuditLogs(ctx *gin.Context) {
+	var req listAuditLogsRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = 50
+	}
+
+	arg := db.ListAuditLogsParams{
+		UserID:       req.UserID,
+		Action:       req.Action,
+		ResourceType: req.ResourceType,
+		ResourceID:   req.ResourceID,
+		IPAddress:    req.IP,
+		Limit:        req.Limit,
+		Offset:       req.Offset,
+	}
+	if !req.From.IsZero() {
+		arg.From = &req.From
+	}
+	if !req.To.IsZero() {
+		arg.To = &req.To
+	}
+
+	// Lọc theo username: đổi sang user ID (audit log lưu user_id)
+	if req.Username != "" {
+		user, err := h.store.GetUserByUsername(ctx, req.Username)
+		if err != nil {
+			if err.Error() == "user not found" {
+				ctx.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+				return
+			}
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if arg.UserID != "" && arg.UserID != user.ID {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "username and user_id refer to different users"})
+			return
+		}
+		arg.UserID = user.ID
+	}
+
+	logs, err := h.store.ListAuditLogs(ctx, arg)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, logs)
+}
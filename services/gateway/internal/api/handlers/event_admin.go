@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	db "github.com/trading-platform/gateway/internal/database/sqlc"
+	"github.com/trading-platform/gateway/internal/worker"
+)
+
+// EventReplayer xử lý lại dead-letter event và điều khiển event processor (worker.EventProcessor)
+type EventReplayer interface {
+	Replay(ctx context.Context, id int64) (db.DeadLetterEvent, error)
+	Resume(acceptGap bool) error
+	Health() worker.EventProcessorHealth
+}
+
+// EventAdminHandler handles operator requests for engine event processing
+type EventAdminHandler struct {
+	store     db.Store
+	processor EventReplayer
+}
+
+// NewEventAdminHandler creates a new event admin handler
+func NewEventAdminHandler(store db.Store, processor EventReplayer) *EventAdminHandler {
+	return &EventAdminHandler{
+		store:     store,
+		processor: processor,
+	}
+}
+
+type listDeadLettersRequest struct {
+	Status string `form:"status" binding:"omitempty,oneof=pending replayed discarded"`
+	Limit  int32  `form:"limit" binding:"omitempty,min=1,max=500"`
+	Offset int32  `form:"offset" binding:"omitempty,min=0"`
+}
+
+// ListDeadLetters lists dead-letter events (GET /api/v1/admin/events/dead-letters?status=pending)
+func (h *EventAdminHandler) ListDeadLetters(ctx *gin.Context) {
+	var req listDeadLettersRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = 50
+	}
+
+	events, err := h.store.ListDeadLetterEvents(ctx, db.ListDeadLetterEventsParams{
+		Status: req.Status,
+		Limit:  req.Limit,
+		Offset: req.Offset,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Ensure we always return an array, not null
+	if events == nil {
+		events = []db.DeadLetterEvent{}
+	}
+	ctx.JSON(http.StatusOK, events)
+}
+
+// GetDeadLetter returns one dead-letter event with its payload and last error
+func (h *EventAdminHandler) GetDeadLetter(ctx *gin.Context) {
+	id, ok := deadLetterID(ctx)
+	if !ok {
+		return
+	}
+
+	event, err := h.store.GetDeadLetterEvent(ctx, id)
+	if err != nil {
+		respondDeadLetterError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, event)
+}
+
+// ReplayDeadLetter processes a dead-letter event again through the event processor
+func (h *EventAdminHandler) ReplayDeadLetter(ctx *gin.Context) {
+	id, ok := deadLetterID(ctx)
+	if !ok {
+		return
+	}
+
+	event, err := h.processor.Replay(ctx, id)
+	if err != nil {
+		if errors.Is(err, worker.ErrNotReplayable) {
+			ctx.JSON(http.StatusConflict, gin.H{"error": err.Error(), "event": event})
+			return
+		}
+		if err.Error() == "dead-letter event not found" {
+			respondDeadLetterError(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "event": event})
+		return
+	}
+	ctx.JSON(http.StatusOK, event)
+}
+
+// DiscardDeadLetter marks a dead-letter event as discarded (sẽ không replay)
+func (h *EventAdminHandler) DiscardDeadLetter(ctx *gin.Context) {
+	id, ok := deadLetterID(ctx)
+	if !ok {
+		return
+	}
+
+	event, err := h.store.GetDeadLetterEvent(ctx, id)
+	if err != nil {
+		respondDeadLetterError(ctx, err)
+		return
+	}
+	if event.Status != "pending" {
+		ctx.JSON(http.StatusConflict, gin.H{"error": worker.ErrNotReplayable.Error(), "event": event})
+		return
+	}
+
+	event, err = h.store.UpdateDeadLetterEventStatus(ctx, id, "discarded")
+	if err != nil {
+		respondDeadLetterError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, event)
+}
+
+type resumeEventsRequest struct {
+	AcceptGap bool `form:"accept_gap"`
+}
+
+// ResumeEvents resumes the event processor after it paused on a sequence gap
+// (POST /api/v1/admin/events/resume?accept_gap=true)
+func (h *EventAdminHandler) ResumeEvents(ctx *gin.Context) {
+	var req resumeEventsRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.processor.Resume(req.AcceptGap); err != nil {
+		if errors.Is(err, worker.ErrNotPaused) {
+			ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, h.processor.Health())
+}
+
+// deadLetterID đọc :id từ URL, trả về false (đã ghi response) nếu không hợp lệ
+func deadLetterID(ctx *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(ctx.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid dead-letter id"})
+		return 0, false
+	}
+	return id, true
+}
+
+func respondDeadLetterError(ctx *gin.Context, err error) {
+	if err.Error() == "dead-letter event not found" {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
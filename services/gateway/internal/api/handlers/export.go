@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	db "github.com/trading-platform/gateway/internal/database/sqlc"
+	"github.com/trading-platform/gateway/internal/util"
+)
+
+const (
+	exportMaxRange     = 366 * 24 * time.Hour // Tối đa một năm mỗi lần xuất
+	exportDefaultRange = 30 * 24 * time.Hour
+	exportFlushEvery   = 200 // Flush response sau mỗi N dòng
+	exportDateLayout   = "2006-01-02"
+)
+
+// ExportHandler streams a user's transactions, orders and trades as CSV or NDJSON
+type ExportHandler struct {
+	store db.Store
+}
+
+// NewExportHandler creates a new export handler
+func NewExportHandler(store db.Store) *ExportHandler {
+	return &ExportHandler{store: store}
+}
+
+type exportRequest struct {
+	Format string `form:"format" binding:"omitempty,oneof=csv ndjson"`
+	From   string `form:"from"` // YYYY-MM-DD hoặc RFC3339
+	To     string `form:"to"`   // YYYY-MM-DD (tính cả ngày đó) hoặc RFC3339; mặc định là hiện tại
+}
+
+var (
+	transactionExportHeader = []string{"id", "created_at", "account_type", "currency", "type", "amount", "status", "reference_id", "description"}
+	orderExportHeader       = []string{"id", "created_at", "symbol", "side", "type", "price", "quantity", "filled", "status", "reject_reason"}
+	tradeExportHeader       = []string{"trade_id", "created_at", "order_id", "symbol", "side", "liquidity", "price", "amount", "total"}
+)
+
+// ExportTransactions streams the user's transactions on all accounts (GET /api/v1/exports/transactions)
+func (h *ExportHandler) ExportTransactions(ctx *gin.Context) {
+	h.export(ctx, "transactions", transactionExportHeader, func(reqCtx context.Context, arg db.ExportParams, emit exportEmitter) error {
+		return h.store.ExportTransactionsTx(reqCtx, arg, func(row db.TransactionExportRow) error {
+			return emit(row, []string{
+				strconv.FormatInt(row.ID, 10),
+				formatExportTime(row.CreatedAt),
+				row.AccountType,
+				row.Currency,
+				row.Type,
+				row.Amount,
+				row.Status,
+				csvText(row.ReferenceID),
+				csvText(row.Description),
+			})
+		})
+	})
+}
+
+// ExportOrders streams the user's orders in every status (GET /api/v1/exports/orders)
+func (h *ExportHandler) ExportOrders(ctx *gin.Context) {
+	h.export(ctx, "orders", orderExportHeader, func(reqCtx context.Context, arg db.ExportParams, emit exportEmitter) error {
+		return h.store.ExportOrdersTx(reqCtx, arg, func(row db.OrderExportRow) error {
+			return emit(row, []string{
+				row.ID,
+				formatExportTime(row.CreatedAt),
+				row.Symbol,
+				row.Side,
+				row.Type,
+				row.Price,
+				row.Quantity,
+				row.Filled,
+				row.Status,
+				csvText(row.RejectReason),
+			})
+		})
+	})
+}
+
+// ExportTrades streams the fills of the user's orders (GET /api/v1/exports/trades)
+func (h *ExportHandler) ExportTrades(ctx *gin.Context) {
+	h.export(ctx, "trades", tradeExportHeader, func(reqCtx context.Context, arg db.ExportParams, emit exportEmitter) error {
+		return h.store.ExportTradesTx(reqCtx, arg, func(row db.TradeExportRow) error {
+			return emit(row, []string{
+				strconv.FormatInt(row.TradeID, 10),
+				formatExportTime(row.CreatedAt),
+				row.OrderID,
+				row.Symbol,
+				row.Side,
+				row.Liquidity,
+				row.Price,
+				row.Amount,
+				row.Total,
+			})
+		})
+	})
+}
+
+// exportEmitter ghi một dòng: value khi xuất NDJSON, record khi xuất CSV
+type exportEmitter func(value interface{}, record []string) error
+
+// export kiểm tra tham số rồi stream kết quả của run. Header response chỉ được ghi khi có dòng đầu tiên
+// (hoặc khi run xong), nên lỗi query vẫn trả về 500 dạng JSON. Lỗi giữa chừng không đổi được status nữa:
+// response bị cắt và trailer X-Export-Error cho biết lý do.
+func (h *ExportHandler) export(ctx *gin.Context, kind string, header []string,
+	run func(reqCtx context.Context, arg db.ExportParams, emit exportEmitter) error) {
+	var req exportRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Format == "" {
+		req.Format = "csv"
+	}
+	from, to, err := parseExportRange(req.From, req.To, time.Now())
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	payload := ctx.MustGet("authorization_payload").(*util.Payload)
+	user, err := h.store.GetUserByUsername(ctx, payload.Username)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	w := ctx.Writer
+	csvWriter := csv.NewWriter(w)
+	encoder := json.NewEncoder(w)
+	started := false
+	rows := 0
+
+	start := func() error {
+		started = true
+		filename := fmt.Sprintf("%s_%s_%s.%s", kind, from.Format(exportDateLayout), to.Format(exportDateLayout), req.Format)
+		if req.Format == "csv" {
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		} else {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Trailer", "X-Export-Error")
+		w.WriteHeader(http.StatusOK)
+		if req.Format == "csv" {
+			return csvWriter.Write(header)
+		}
+		return nil
+	}
+
+	emit := func(value interface{}, record []string) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		if req.Format == "csv" {
+			if err := csvWriter.Write(record); err != nil {
+				return err
+			}
+		} else if err := encoder.Encode(value); err != nil {
+			return err
+		}
+
+		rows++
+		if rows%exportFlushEvery == 0 {
+			csvWriter.Flush()
+			if err := csvWriter.Error(); err != nil {
+				return err
+			}
+			w.Flush()
+		}
+		return nil
+	}
+
+	// Dùng context của request: client ngắt kết nối thì cursor và transaction được hủy
+	err = run(ctx.Request.Context(), db.ExportParams{UserID: user.ID, From: from, To: to}, emit)
+	if err == nil && !started {
+		err = start() // Không có dòng nào: vẫn trả file rỗng (CSV có header)
+	}
+	if err != nil {
+		if !started {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("❌ Export %s for %s failed after %d row(s): %v", kind, user.Username, rows, err)
+		csvWriter.Flush()
+		w.Header().Set("X-Export-Error", err.Error())
+		return
+	}
+	csvWriter.Flush()
+}
+
+// parseExportRange đọc khoảng [from, to); to mặc định là now, from mặc định 30 ngày trước to
+func parseExportRange(fromValue, toValue string, now time.Time) (time.Time, time.Time, error) {
+	to := now
+	if toValue != "" {
+		t, dateOnly, err := parseExportTime(toValue)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid to: %v", err)
+		}
+		to = t
+		if dateOnly {
+			to = to.AddDate(0, 0, 1)
+		}
+	}
+
+	from := to.Add(-exportDefaultRange)
+	if fromValue != "" {
+		t, _, err := parseExportTime(fromValue)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid from: %v", err)
+		}
+		from = t
+	}
+
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("from must be before to")
+	}
+	if to.Sub(from) > exportMaxRange {
+		return time.Time{}, time.Time{}, fmt.Errorf("date range must not exceed %d days", int(exportMaxRange.Hours()/24))
+	}
+	return from, to, nil
+}
+
+// parseExportTime nhận YYYY-MM-DD (00:00 UTC) hoặc RFC3339
+func parseExportTime(value string) (time.Time, bool, error) {
+	if t, err := time.Parse(exportDateLayout, value); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("expected YYYY-MM-DD or RFC3339, got %q", value)
+	}
+	return t, false, nil
+}
+
+func formatExportTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// csvText trả về ô văn bản tự do, thêm dấu ' trước ký tự mà Excel/Sheets coi là công thức
+func csvText(value *string) string {
+	if value == nil || *value == "" {
+		return ""
+	}
+	if strings.ContainsRune("=+-@\t\r", rune((*value)[0])) {
+		return "'" + *value
+	}
+	return *value
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	db "github.com/trading-platform/gateway/internal/database/sqlc"
+	"github.com/trading-platform/gateway/internal/util"
+	"github.com/trading-platform/gateway/internal/worker"
+)
+
+// LedgerCheckRunner kiểm tra sổ cái với số dư (worker.LedgerChecker)
+type LedgerCheckRunner interface {
+	Run(ctx context.Context, fix bool) (worker.LedgerReport, error)
+	LastReport() (worker.LedgerReport, bool)
+}
+
+// LedgerAdminHandler handles operator requests on the double-entry ledger
+type LedgerAdminHandler struct {
+	store   db.Store
+	checker LedgerCheckRunner
+}
+
+// NewLedgerAdminHandler creates a new ledger admin handler
+func NewLedgerAdminHandler(store db.Store, checker LedgerCheckRunner) *LedgerAdminHandler {
+	return &LedgerAdminHandler{store: store, checker: checker}
+}
+
+// GetLastCheck returns the result of the latest ledger check (GET /api/v1/admin/ledger/check)
+func (h *LedgerAdminHandler) GetLastCheck(ctx *gin.Context) {
+	report, ok := h.checker.LastReport()
+	if !ok {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "no ledger check has run yet"})
+		return
+	}
+	ctx.JSON(http.StatusOK, report)
+}
+
+type runLedgerCheckRequest struct {
+	Fix bool `form:"fix"`
+}
+
+// RunCheck checks the ledger now (POST /api/v1/admin/ledger/check?fix=true để đặt lại số dư theo sổ cái)
+func (h *LedgerAdminHandler) RunCheck(ctx *gin.Context) {
+	var req runLedgerCheckRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := h.checker.Run(ctx, req.Fix)
+	if err != nil {
+		if errors.Is(err, worker.ErrLedgerCheckRunning) {
+			ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, report)
+}
+
+type listLedgerJournalsRequest struct {
+	Username    string `form:"username"`
+	AccountType string `form:"account_type" binding:"omitempty,oneof=spot margin futures"`
+	Currency    string `form:"currency"`
+	Type        string `form:"type"`
+	ReferenceID string `form:"reference_id"`
+	Limit       int32  `form:"limit" binding:"omitempty,min=1,max=500"`
+	Offset      int32  `form:"offset" binding:"omitempty,min=0"`
+}
+
+// ListJournals lists ledger journals with their entries, newest first
+// (GET /api/v1/admin/ledger/journals?username=alice&currency=USDT hoặc ?reference_id=withdrawal:<id>)
+func (h *LedgerAdminHandler) ListJournals(ctx *gin.Context) {
+	var req listLedgerJournalsRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = 50
+	}
+
+	arg := db.ListLedgerJournalsParams{
+		Type:        req.Type,
+		ReferenceID: req.ReferenceID,
+		Limit:       req.Limit,
+		Offset:      req.Offset,
+	}
+
+	// Lọc theo ví: username + currency (+ account_type, mặc định spot)
+	if req.Username != "" {
+		if req.Currency == "" {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "currency is required when filtering by username"})
+			return
+		}
+		user, err := h.store.GetUserByUsername(ctx, req.Username)
+		if err != nil {
+			if err.Error() == "user not found" {
+				ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		account, err := h.store.GetAccountByUserAndType(ctx, db.GetAccountByUserAndTypeParams{
+			UserID:      util.HashStringToInt32(user.ID),
+			AccountType: req.AccountType,
+			Currency:    strings.ToUpper(req.Currency),
+		})
+		if err != nil {
+			if err.Error() == "account not found" {
+				ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		arg.AccountID = account.ID
+	}
+
+	journals, err := h.store.ListLedgerJournals(ctx, arg)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"journals": journals})
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/trading-platform/gateway/internal/config"
+	db "github.com/trading-platform/gateway/internal/database/sqlc"
+)
+
+// Loại khóa trong bảng login_failures
+const (
+	loginKeyUsername = "username"
+	loginKeyIP       = "ip"
+)
+
+// loginGuard chống dò mật khẩu: đếm lần sai theo username và theo IP, bắt chờ lâu dần giữa các lần thử
+// của cùng username và khóa tạm khi vượt ngưỡng. Bộ đếm nằm trong Postgres nên đúng cả khi chạy nhiều gateway.
+type loginGuard struct {
+	store db.Store
+	cfg   config.LoginConfig
+	audit AuditLogger
+}
+
+func newLoginGuard(store db.Store, cfg config.LoginConfig, audit AuditLogger) *loginGuard {
+	return &loginGuard{store: store, cfg: cfg, audit: audit}
+}
+
+// check trả về thời gian phải chờ trước lần thử tiếp theo (0 = được thử) và username/IP có đang bị khóa không
+func (g *loginGuard) check(ctx context.Context, username, ip string) (time.Duration, bool, error) {
+	now := time.Now()
+	var wait time.Duration
+	locked := false
+
+	for _, key := range [][2]string{{loginKeyUsername, username}, {loginKeyIP, ip}} {
+		f, err := g.store.GetLoginFailure(ctx, key[0], key[1])
+		if err != nil {
+			if err.Error() == "login failure not found" {
+				continue
+			}
+			return 0, false, err
+		}
+
+		if f.LockedUntil != nil && now.Before(*f.LockedUntil) {
+			locked = true
+			wait = maxDuration(wait, f.LockedUntil.Sub(now))
+			continue
+		}
+		// Chờ lâu dần chỉ áp dụng cho username; IP có thể là NAT chung của nhiều người
+		if key[0] == loginKeyUsername && now.Sub(f.LastFailedAt) < g.cfg.FailureWindow {
+			if until := f.LastFailedAt.Add(g.delay(f.Failures)); now.Before(until) {
+				wait = maxDuration(wait, until.Sub(now))
+			}
+		}
+	}
+	return wait, locked, nil
+}
+
+// delay = DelayBase * 2^(failures-1), tối đa DelayMax
+func (g *loginGuard) delay(failures int32) time.Duration {
+	if failures < 1 {
+		return 0
+	}
+	d := float64(g.cfg.DelayBase) * math.Pow(2, float64(failures-1))
+	if d > float64(g.cfg.DelayMax) {
+		return g.cfg.DelayMax
+	}
+	return time.Duration(d)
+}
+
+// fail ghi nhận một lần đăng nhập sai (reason: "invalid_credentials", "invalid_2fa_code"...);
+// userID rỗng nếu username không tồn tại.
+// Lỗi chỉ được log: không ghi được bộ đếm không được làm hỏng response đăng nhập.
+func (g *loginGuard) fail(ctx *gin.Context, username, userID, reason string) {
+	now := time.Now()
+	ip := ctx.ClientIP()
+
+	recordAudit(ctx, g.audit, db.CreateAuditLogParams{
+		UserID:       userID,
+		Action:       AuditLoginFailed,
+		ResourceType: "user",
+		ResourceID:   userID,
+		Details:      map[string]interface{}{"username": username, "reason": reason},
+	})
+
+	f, err := g.record(ctx, loginKeyUsername, username, g.cfg.MaxFailures, now)
+	if err != nil {
+		log.Printf("⚠️  Failed to record login failure for %s: %v", username, err)
+	} else if f.LockedUntil != nil && f.Failures == int32(g.cfg.MaxFailures) {
+		log.Printf("🔒 Account %s locked until %s after %d failed logins", username, f.LockedUntil.Format(time.RFC3339), f.Failures)
+		recordAudit(ctx, g.audit, db.CreateAuditLogParams{
+			UserID:       userID,
+			Action:       AuditAccountLocked,
+			ResourceType: "user",
+			ResourceID:   userID,
+			Details: map[string]interface{}{
+				"username":     username,
+				"failures":     f.Failures,
+				"locked_until": f.LockedUntil,
+			},
+		})
+	}
+
+	f, err = g.record(ctx, loginKeyIP, ip, g.cfg.IPMaxFailures, now)
+	if err != nil {
+		log.Printf("⚠️  Failed to record login failure for ip %s: %v", ip, err)
+	} else if f.LockedUntil != nil && f.Failures == int32(g.cfg.IPMaxFailures) {
+		log.Printf("🔒 IP %s locked until %s after %d failed logins", ip, f.LockedUntil.Format(time.RFC3339), f.Failures)
+		recordAudit(ctx, g.audit, db.CreateAuditLogParams{
+			Action: AuditIPLocked,
+			Details: map[string]interface{}{
+				"ip":            ip,
+				"failures":      f.Failures,
+				"locked_until":  f.LockedUntil,
+				"last_username": username,
+			},
+		})
+	}
+}
+
+func (g *loginGuard) record(ctx context.Context, keyType, key string, maxFailures int, now time.Time) (db.LoginFailure, error) {
+	return g.store.RecordLoginFailure(ctx, db.RecordLoginFailureParams{
+		KeyType:     keyType,
+		Key:         key,
+		ResetBefore: now.Add(-g.cfg.FailureWindow),
+		MaxFailures: int32(maxFailures),
+		LockedUntil: now.Add(g.cfg.LockoutDuration),
+	})
+}
+
+// succeed xóa bộ đếm của username sau khi đăng nhập thành công (bộ đếm IP tự hết hạn theo FailureWindow)
+func (g *loginGuard) succeed(ctx context.Context, username string) {
+	if _, err := g.store.ClearLoginFailures(ctx, loginKeyUsername, username); err != nil {
+		log.Printf("⚠️  Failed to clear login failures for %s: %v", username, err)
+	}
+}
+
+// reject trả về 429 kèm Retry-After khi check báo phải chờ; trả về true nếu đã ghi response
+func (g *loginGuard) reject(ctx *gin.Context, username string) bool {
+	wait, locked, err := g.check(ctx, username, ctx.ClientIP())
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check login attempts"})
+		return true
+	}
+	if wait <= 0 {
+		return false
+	}
+
+	retryAfter := int(math.Ceil(wait.Seconds()))
+	ctx.Header("Retry-After", strconv.Itoa(retryAfter))
+	message := "too many failed login attempts, retry later"
+	if locked {
+		message = "too many failed login attempts, temporarily locked"
+	}
+	ctx.JSON(http.StatusTooManyRequests, gin.H{"error": message, "retry_after": retryAfter})
+	return true
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
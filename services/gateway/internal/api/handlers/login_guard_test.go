@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/trading-platform/gateway/internal/config"
+	db "github.com/trading-platform/gateway/internal/database/sqlc"
+)
+
+// memLoginStore giữ bộ đếm login_failures trong bộ nhớ, cùng quy tắc với RecordLoginFailure
+type memLoginStore struct {
+	db.Store
+	failures map[string]db.LoginFailure
+}
+
+func newMemLoginStore() *memLoginStore {
+	return &memLoginStore{failures: map[string]db.LoginFailure{}}
+}
+
+func (s *memLoginStore) GetLoginFailure(ctx context.Context, keyType, key string) (db.LoginFailure, error) {
+	f, ok := s.failures[keyType+":"+key]
+	if !ok {
+		return db.LoginFailure{}, fmt.Errorf("login failure not found")
+	}
+	return f, nil
+}
+
+func (s *memLoginStore) RecordLoginFailure(ctx context.Context, arg db.RecordLoginFailureParams) (db.LoginFailure, error) {
+	now := time.Now()
+	f, ok := s.failures[arg.KeyType+":"+arg.Key]
+	if !ok || f.LastFailedAt.Before(arg.ResetBefore) || (f.LockedUntil != nil && f.LockedUntil.Before(now)) {
+		f = db.LoginFailure{KeyType: arg.KeyType, Key: arg.Key}
+	}
+	f.Failures++
+	f.LastFailedAt = now
+	if f.Failures >= arg.MaxFailures && f.LockedUntil == nil {
+		lockedUntil := arg.LockedUntil
+		f.LockedUntil = &lockedUntil
+	}
+	s.failures[arg.KeyType+":"+arg.Key] = f
+	return f, nil
+}
+
+func (s *memLoginStore) ClearLoginFailures(ctx context.Context, keyType, key string) (bool, error) {
+	_, ok := s.failures[keyType+":"+key]
+	delete(s.failures, keyType+":"+key)
+	return ok, nil
+}
+
+type discardAudit struct{}
+
+func (discardAudit) Log(db.CreateAuditLogParams) {}
+
+var testLoginConfig = config.LoginConfig{
+	MaxFailures:     100,
+	IPMaxFailures:   5,
+	LockoutDuration: 15 * time.Minute,
+	FailureWindow:   15 * time.Minute,
+	// Không bắt chờ giữa các lần thử để test chỉ đo bộ đếm theo IP
+}
+
+// newLoginGuardRouter dựng router ghi một lần đăng nhập sai mỗi request, tin proxy giống server
+func newLoginGuardRouter(t *testing.T, trustedProxies []string) (*gin.Engine, *memLoginStore, *loginGuard) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	store := newMemLoginStore()
+	guard := newLoginGuard(store, testLoginConfig, discardAudit{})
+
+	router := gin.New()
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		t.Fatalf("SetTrustedProxies: %v", err)
+	}
+	router.POST("/login", func(ctx *gin.Context) {
+		if guard.reject(ctx, "alice") {
+			return
+		}
+		guard.fail(ctx, "alice", "", "invalid_credentials")
+		ctx.Status(http.StatusUnauthorized)
+	})
+	return router, store, guard
+}
+
+func postLogin(router *gin.Engine, remoteAddr, forwardedFor string) int {
+	req := httptest.NewRequest(http.MethodPost, "/login", nil)
+	req.RemoteAddr = remoteAddr
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestLoginGuardIgnoresForgedForwardedFor(t *testing.T) {
+	router, store, guard := newLoginGuardRouter(t, nil)
+
+	// Mỗi lần thử giả một IP khác: bộ đếm vẫn tính cho IP kết nối thật
+	for i := 0; i < testLoginConfig.IPMaxFailures; i++ {
+		postLogin(router, "203.0.113.7:40000", fmt.Sprintf("198.51.100.%d", i+1))
+	}
+
+	f, ok := store.failures[loginKeyIP+":203.0.113.7"]
+	if !ok {
+		t.Fatalf("no failure counter for the connecting IP; counters: %v", store.failures)
+	}
+	if f.Failures != int32(testLoginConfig.IPMaxFailures) {
+		t.Errorf("failures = %d, want %d", f.Failures, testLoginConfig.IPMaxFailures)
+	}
+	if f.LockedUntil == nil {
+		t.Errorf("connecting IP is not locked after %d failures", f.Failures)
+	}
+	for i := 0; i < testLoginConfig.IPMaxFailures; i++ {
+		if _, forged := store.failures[fmt.Sprintf("%s:198.51.100.%d", loginKeyIP, i+1)]; forged {
+			t.Errorf("forged IP 198.51.100.%d got its own counter", i+1)
+		}
+	}
+
+	// IP bị khóa với mọi username, kể cả khi header đổi
+	_, locked, err := guard.check(context.Background(), "bob", "203.0.113.7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !locked {
+		t.Error("check() does not report the connecting IP as locked")
+	}
+	if code := postLogin(router, "203.0.113.7:40001", "192.0.2.200"); code != http.StatusTooManyRequests {
+		t.Errorf("request with a new forged header: status = %d, want %d", code, http.StatusTooManyRequests)
+	}
+}
+
+func TestLoginGuardUsesForwardedForFromTrustedProxy(t *testing.T) {
+	router, store, _ := newLoginGuardRouter(t, []string{"10.0.0.0/8"})
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		wantKey      string
+	}{
+		{"trusted proxy", "10.0.0.5:5000", "198.51.100.1", "198.51.100.1"},
+		// Client tự thêm IP vào đầu chuỗi: chỉ IP do proxy ghi (phải nhất, không tin cậy) được dùng
+		{"client-prepended entry", "10.0.0.5:5000", "192.0.2.99, 198.51.100.2", "198.51.100.2"},
+		{"untrusted peer", "203.0.113.9:5000", "198.51.100.3", "203.0.113.9"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			postLogin(router, tt.remoteAddr, tt.forwardedFor)
+			if _, ok := store.failures[loginKeyIP+":"+tt.wantKey]; !ok {
+				t.Errorf("failure not counted for %s; counters: %v", tt.wantKey, store.failures)
+			}
+		})
+	}
+	if _, ok := store.failures[loginKeyIP+":192.0.2.99"]; ok {
+		t.Error("client-supplied X-Forwarded-For entry was trusted")
+	}
+}
+
+func TestLoginGuardDelay(t *testing.T) {
+	guard := newLoginGuard(nil, config.LoginConfig{DelayBase: time.Second, DelayMax: 30 * time.Second}, discardAudit{})
+
+	tests := []struct {
+		failures int32
+		want     time.Duration
+	}{
+		{-1, 0},
+		{0, 0},
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{5, 16 * time.Second},
+		{6, 30 * time.Second}, // 32s bị chặn ở DelayMax
+		{40, 30 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := guard.delay(tt.failures); got != tt.want {
+			t.Errorf("delay(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLoginGuardCheckBacksOffPerUsername(t *testing.T) {
+	cfg := testLoginConfig
+	cfg.DelayBase = time.Minute
+	cfg.DelayMax = time.Hour
+	store := newMemLoginStore()
+	guard := newLoginGuard(store, cfg, discardAudit{})
+	now := time.Now()
+
+	store.failures[loginKeyUsername+":alice"] = db.LoginFailure{KeyType: loginKeyUsername, Key: "alice", Failures: 3, LastFailedAt: now}
+	store.failures[loginKeyIP+":203.0.113.7"] = db.LoginFailure{KeyType: loginKeyIP, Key: "203.0.113.7", Failures: 3, LastFailedAt: now}
+
+	// 3 lần sai -> chờ 4 phút; bộ đếm IP chưa tới ngưỡng thì không bắt chờ
+	wait, locked, err := guard.check(context.Background(), "alice", "198.51.100.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if locked || wait <= 3*time.Minute || wait > 4*time.Minute {
+		t.Errorf("alice: wait = %v, locked = %v; want ~4m, false", wait, locked)
+	}
+	if wait, _, _ := guard.check(context.Background(), "bob", "203.0.113.7"); wait != 0 {
+		t.Errorf("bob from a shared IP: wait = %v, want 0", wait)
+	}
+
+	// Lần sai cuối nằm ngoài FailureWindow thì không còn bị chờ
+	store.failures[loginKeyUsername+":alice"] = db.LoginFailure{KeyType: loginKeyUsername, Key: "alice", Failures: 3, LastFailedAt: now.Add(-cfg.FailureWindow - time.Second)}
+	if wait, _, _ := guard.check(context.Background(), "alice", "198.51.100.1"); wait != 0 {
+		t.Errorf("alice after the failure window: wait = %v, want 0", wait)
+	}
+
+	// Đang bị khóa: locked và chờ tới hết khóa
+	lockedUntil := now.Add(10 * time.Minute)
+	store.failures[loginKeyUsername+":alice"] = db.LoginFailure{KeyType: loginKeyUsername, Key: "alice", Failures: int32(cfg.MaxFailures), LastFailedAt: now, LockedUntil: &lockedUntil}
+	wait, locked, _ = guard.check(context.Background(), "alice", "198.51.100.1")
+	if !locked || wait <= 9*time.Minute {
+		t.Errorf("locked alice: wait = %v, locked = %v; want ~10m, true", wait, locked)
+	}
+}
+
+// stepUpStore: mã khôi phục nào cũng sai
+type stepUpStore struct {
+	*memLoginStore
+}
+
+func (s stepUpStore) UseRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error) {
+	return false, nil
+}
+
+func TestStepUpWrongCodesLockUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := testLoginConfig
+	cfg.MaxFailures = 3
+	store := stepUpStore{newMemLoginStore()}
+	verifier := NewStepUpVerifier(store, nil, cfg, discardAudit{})
+	user := db.Users{ID: "11111111-1111-1111-1111-111111111111", Username: "alice"}
+
+	router := gin.New()
+	router.POST("/withdraw", func(ctx *gin.Context) {
+		if verifier.Verify(ctx, user, db.UserTOTP{UserID: user.ID}, ctx.GetHeader("X-2FA-Code")) {
+			ctx.Status(http.StatusOK)
+		}
+	})
+
+	codes := []int{}
+	for i := 0; i < cfg.MaxFailures+1; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/withdraw", nil)
+		req.Header.Set("X-2FA-Code", fmt.Sprintf("guess-%05d", i))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		codes = append(codes, rec.Code)
+	}
+
+	want := []int{401, 401, 401, 429}
+	for i := range want {
+		if codes[i] != want[i] {
+			t.Fatalf("status codes = %v, want %v", codes, want)
+		}
+	}
+	if f := store.failures[loginKeyUsername+":alice"]; f.Failures != int32(cfg.MaxFailures) || f.LockedUntil == nil {
+		t.Errorf("username counter = %+v, want %d failures and locked", f, cfg.MaxFailures)
+	}
+}
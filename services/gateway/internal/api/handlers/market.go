@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/trading-platform/gateway/internal/marketdata"
+)
+
+// MarketHandler handles public market data requests
+type MarketHandler struct {
+	depth *marketdata.DepthFeed
+}
+
+// NewMarketHandler creates a new market data handler
+func NewMarketHandler(depth *marketdata.DepthFeed) *MarketHandler {
+	return &MarketHandler{depth: depth}
+}
+
+// --- API: Snapshot order book (GET /api/v1/orderbook?symbol=BTC/USDT&seq=42) ---
+
+// GetOrderBookSnapshot returns the order book snapshot, either the latest one or at a given sequence.
+// Clients that detect a gap in depth_update sequence numbers use it to resync.
+func (h *MarketHandler) GetOrderBookSnapshot(ctx *gin.Context) {
+	symbol := ctx.Query("symbol")
+	if symbol == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "symbol is required"})
+		return
+	}
+
+	// Không có seq -> trả về snapshot mới nhất
+	seqParam := ctx.Query("seq")
+	if seqParam == "" {
+		snapshot, err := h.depth.Snapshot(ctx, symbol)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load order book"})
+			return
+		}
+		ctx.JSON(http.StatusOK, snapshot)
+		return
+	}
+
+	seq, err := strconv.ParseUint(seqParam, 10, 64)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid seq"})
+		return
+	}
+
+	snapshot, err := h.depth.SnapshotAt(symbol, seq)
+	if err != nil {
+		if errors.Is(err, marketdata.ErrUnknownSymbol) || errors.Is(err, marketdata.ErrSequenceUnavailable) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, snapshot)
+}
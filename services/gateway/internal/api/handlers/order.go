@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -9,21 +11,32 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/nats-io/nats.go"
 	db "github.com/trading-platform/gateway/internal/database/sqlc"
+	"github.com/trading-platform/gateway/internal/messaging"
 	"github.com/trading-platform/gateway/internal/models"
 	"github.com/trading-platform/gateway/internal/util"
 )
 
+// OutboxNotifier được báo mỗi khi có command mới trong outbox (OutboxRelay publish ngay thay vì chờ chu kỳ quét)
+type OutboxNotifier interface {
+	Notify()
+}
+
 type OrderHandler struct {
-	natsConn *nats.Conn
-	store    db.Store
+	outbox     OutboxNotifier // Command được ghi vào outbox, relay gửi sang engine qua JetStream
+	acks       *messaging.OrderAckWaiter
+	ackTimeout time.Duration // Thời gian chờ engine xác nhận khi đặt lệnh đồng bộ
+	store      db.Store
+	audit      AuditLogger
 }
 
-func NewOrderHandler(nc *nats.Conn, store db.Store) *OrderHandler {
+func NewOrderHandler(outbox OutboxNotifier, acks *messaging.OrderAckWaiter, ackTimeout time.Duration, store db.Store, audit AuditLogger) *OrderHandler {
 	return &OrderHandler{
-		natsConn: nc,
-		store:    store,
+		outbox:     outbox,
+		acks:       acks,
+		ackTimeout: ackTimeout,
+		store:      store,
+		audit:      audit,
 	}
 }
 
@@ -35,6 +48,7 @@ type createOrderRequest struct {
 	Side         string  `json:"side" binding:"required"`
 	Type         string  `json:"type" binding:"required,oneof=Limit Market StopLimit"` // Thêm StopLimit
 	TriggerPrice float64 `json:"trigger_price"`                                        // Bắt buộc cho StopLimit
+	Sync         bool    `json:"sync"`                                                 // Chờ engine xác nhận (accepted/filled/rejected) rồi mới trả về
 }
 
 func (h *OrderHandler) PlaceOrder(ctx *gin.Context) {
@@ -51,9 +65,9 @@ func (h *OrderHandler) PlaceOrder(ctx *gin.Context) {
 	}
 
 	// Chuẩn hóa side: buy/sell/Bid/Ask -> BUY/SELL (cho database) và Bid/Ask (cho engine)
-	sideDB := ""        // Side cho database
-	sideEngine := ""    // Side cho engine
-	
+	sideDB := ""     // Side cho database
+	sideEngine := "" // Side cho engine
+
 	switch req.Side {
 	case "buy", "Buy", "BUY":
 		sideDB = "BUY"
@@ -77,7 +91,7 @@ func (h *OrderHandler) PlaceOrder(ctx *gin.Context) {
 	if orderType == "" {
 		orderType = "Limit"
 	}
-	
+
 	// Uppercase orderType cho database
 	orderTypeDB := ""
 	switch orderType {
@@ -114,6 +128,17 @@ func (h *OrderHandler) PlaceOrder(ctx *gin.Context) {
 		// (Tạm thời skip validation này, engine sẽ xử lý)
 	}
 
+	// Symbol bị market-ops tạm dừng thì không nhận lệnh mới (hủy lệnh vẫn được)
+	halt, err := h.store.GetSymbolHalt(ctx, req.Symbol)
+	if err == nil {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("trading is halted for %s", req.Symbol), "reason": halt.Reason})
+		return
+	}
+	if !errors.Is(err, db.ErrSymbolHaltNotFound) {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check symbol status"})
+		return
+	}
+
 	// 1. Lấy UserID từ Token và get user từ database
 	payload := ctx.MustGet("authorization_payload").(*util.Payload)
 	user, err := h.store.GetUserByUsername(ctx, payload.Username)
@@ -122,20 +147,10 @@ func (h *OrderHandler) PlaceOrder(ctx *gin.Context) {
 		return
 	}
 
-	// 2. Insert order vào database với UUID (dùng sideDB và orderTypeDB uppercase)
-	orderIDStr, err := h.store.InsertOrderWithUUID(ctx, user.ID, req.Symbol, sideDB, orderTypeDB, req.Price, amount)
-	if err != nil {
-		log.Printf("❌ Failed to insert order: %v", err)
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save order"})
-		return
-	}
-
-	log.Printf("✅ Order saved to database: ID=%s", orderIDStr)
-
-	// 3. Generate numeric order ID for engine
+	// 2. Generate numeric order ID for engine
 	orderID := uint64(time.Now().UnixNano())
 
-	// 4. Chuẩn bị trigger_price (chỉ có với StopLimit)
+	// 3. Chuẩn bị trigger_price (chỉ có với StopLimit)
 	triggerPrice := ""
 	if orderType == "StopLimit" {
 		triggerPrice = fmt.Sprintf("%.8f", req.TriggerPrice)
@@ -147,7 +162,7 @@ func (h *OrderHandler) PlaceOrder(ctx *gin.Context) {
 		userIDInt = id
 	}
 
-	// 5. Tạo Command chuẩn format Rust (chuyển số về string) - dùng sideEngine
+	// 4. Tạo Command chuẩn format Rust (chuyển số về string) - dùng sideEngine
 	cmd := models.Command{
 		Type: "Place",
 		Data: models.OrderData{
@@ -163,36 +178,136 @@ func (h *OrderHandler) PlaceOrder(ctx *gin.Context) {
 		},
 	}
 
-	// 6. Serialize sang JSON
-	data, err := json.Marshal(cmd)
+	// Đặt lệnh đồng bộ: mở inbox trước khi ghi outbox để không lỡ ack của engine
+	var pending *messaging.PendingAck
+	if req.Sync {
+		pending, err = h.acks.Subscribe()
+		if err != nil {
+			log.Printf("❌ Failed to open order ack inbox: %v", err)
+			ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": "synchronous order acknowledgement is unavailable"})
+			return
+		}
+		defer pending.Close()
+		cmd.ReplyTo = pending.Subject
+	}
+
+	cmdData, err := json.Marshal(cmd)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to marshal command"})
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encode order command"})
 		return
 	}
 
-	// 7. Bắn vào NATS topic "orders"
-	err = h.natsConn.Publish("orders", data)
+	// 5. Lưu order + command (outbox) + giữ số dư trong cùng transaction (dùng sideDB và orderTypeDB uppercase).
+	// OutboxRelay publish command lên JetStream sau khi commit.
+	result, err := h.store.PlaceOrderTx(ctx, db.PlaceOrderTxParams{
+		UserID:        user.ID,
+		Symbol:        req.Symbol,
+		Side:          sideDB,
+		OrderType:     orderTypeDB,
+		Price:         req.Price,
+		Quantity:      amount,
+		EngineOrderID: int64(orderID),
+		Subject:       messaging.OrdersSubject,
+		Command:       cmdData,
+	})
 	if err != nil {
-		// Nếu NATS fail, log nhưng vẫn trả về success vì order đã lưu database
-		log.Printf("⚠️ Failed to publish to NATS: %v", err)
+		switch err.Error() {
+		case "insufficient balance":
+			ctx.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		case "invalid symbol":
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid symbol (expected BASE/QUOTE)"})
+			return
+		}
+		log.Printf("❌ Failed to save order: %v", err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save order"})
+		return
 	}
+	orderIDStr := result.OrderID
+	h.outbox.Notify()
+
+	log.Printf("✅ Order saved to database: ID=%s (outbox #%d)", orderIDStr, result.OutboxID)
+	recordAudit(ctx, h.audit, db.CreateAuditLogParams{
+		UserID:       user.ID,
+		Action:       AuditOrderPlaced,
+		ResourceType: "order",
+		ResourceID:   orderIDStr,
+		Details: map[string]interface{}{
+			"engine_order_id": orderID,
+			"symbol":          req.Symbol,
+			"side":            sideDB,
+			"type":            orderTypeDB,
+			"price":           req.Price,
+			"amount":          amount,
+		},
+	})
 
-	// 8. Trả về thành công
+	order := gin.H{
+		"id":     orderIDStr,
+		"symbol": req.Symbol,
+		"side":   sideDB,
+		"price":  req.Price,
+		"amount": amount,
+		"type":   orderTypeDB,
+		"status": "OPEN",
+	}
+
+	// 6a. Fire-and-forget: trả về ngay, engine xử lý sau
+	if pending == nil {
+		ctx.JSON(http.StatusOK, gin.H{
+			"message":     "Order placed successfully",
+			"order_id":    orderID,
+			"order_id_db": orderIDStr,
+			"order":       order,
+		})
+		return
+	}
+
+	// 6b. Đồng bộ: chờ kết quả thật của engine
+	waitCtx, cancel := context.WithTimeout(ctx.Request.Context(), h.ackTimeout)
+	defer cancel()
+	ack, err := pending.Wait(waitCtx)
+	if err != nil {
+		// Order đã lưu và command nằm trong outbox nên vẫn sẽ được xử lý, chỉ là chưa biết kết quả
+		log.Printf("⏱️  No engine ack for order %d: %v", orderID, err)
+		order["status"] = "PENDING"
+		ctx.JSON(http.StatusAccepted, gin.H{
+			"message":     "Order accepted, engine acknowledgement timed out",
+			"order_id":    orderID,
+			"order_id_db": orderIDStr,
+			"order":       order,
+		})
+		return
+	}
+
+	if ack.Status == models.AckStatusRejected {
+		order["status"] = "REJECTED"
+		ctx.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":       ack.Message,
+			"reason":      ack.Reason,
+			"order_id":    orderID,
+			"order_id_db": orderIDStr,
+			"order":       order,
+		})
+		return
+	}
+
+	switch ack.Status {
+	case models.AckStatusFilled:
+		order["status"] = "FILLED"
+	case models.AckStatusPartiallyFilled:
+		order["status"] = "PARTIALLY_FILLED"
+	}
+	order["filled_amount"] = ack.FilledAmount
 	ctx.JSON(http.StatusOK, gin.H{
-		"message":      "Order placed successfully",
-		"order_id":     orderID,
-		"order_id_db":  orderIDStr,
-		"order": gin.H{
-			"id":     orderIDStr,
-			"symbol": req.Symbol,
-			"side":   sideDB,
-			"price":  req.Price,
-			"amount": amount,
-			"type":   orderTypeDB,
-			"status": "OPEN",
-		},
+		"message":     "Order placed successfully",
+		"order_id":    orderID,
+		"order_id_db": orderIDStr,
+		"order":       order,
+		"fills":       ack.Fills,
 	})
 }
+
 // cancelOrderRequest defines the request structure for canceling an order
 type cancelOrderRequest struct {
 	OrderID uint64 `json:"order_id" binding:"required"`
@@ -227,7 +342,7 @@ func (h *OrderHandler) ListOpenOrders(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, orders)
 }
 
-// CancelOrder sends a cancel command to the matching engine via NATS
+// CancelOrder queues a cancel command for the matching engine via the outbox
 func (h *OrderHandler) CancelOrder(ctx *gin.Context) {
 	var req cancelOrderRequest
 	if err := ctx.ShouldBindJSON(&req); err != nil {
@@ -235,8 +350,31 @@ func (h *OrderHandler) CancelOrder(ctx *gin.Context) {
 		return
 	}
 
-	// Verify that the order belongs to the user (optional security check)
-	// For now, we trust the request and send to engine
+	payload := ctx.MustGet("authorization_payload").(*util.Payload)
+	user, err := h.store.GetUserByUsername(ctx, payload.Username)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get user"})
+		return
+	}
+
+	// Chỉ chủ order được hủy; order của người khác trả 404 như order không tồn tại
+	order, err := h.store.GetOrderByEngineID(ctx, int64(req.OrderID))
+	if err != nil {
+		if err.Error() == "order not found" {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get order"})
+		return
+	}
+	if order.UserID != user.ID {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "order not found"})
+		return
+	}
+	if order.Status != "OPEN" && order.Status != "PARTIALLY_FILLED" {
+		ctx.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("order is %s", order.Status)})
+		return
+	}
 
 	// Tạo Command Hủy gửi sang NATS
 	cmd := models.Command{
@@ -246,18 +384,31 @@ func (h *OrderHandler) CancelOrder(ctx *gin.Context) {
 		},
 	}
 
-	// Serialize JSON
-	data, err := json.Marshal(cmd)
+	cmdData, err := json.Marshal(cmd)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to marshal cancel command"})
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encode cancel command"})
 		return
 	}
 
-	// Bắn sang NATS topic "orders" (Rust đang nghe cái này)
-	if err := h.natsConn.Publish("orders", data); err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to publish cancel command"})
+	// Ghi vào outbox, relay sẽ bắn sang JetStream subject "orders" (Rust đang nghe cái này)
+	engineOrderID := strconv.FormatUint(req.OrderID, 10)
+	if _, err := h.store.CreateOutboxMessage(ctx, db.CreateOutboxMessageParams{
+		AggregateID: engineOrderID,
+		Subject:     messaging.OrdersSubject,
+		MsgID:       "cancel-" + engineOrderID,
+		Payload:     cmdData,
+	}); err != nil {
+		log.Printf("❌ Failed to enqueue cancel for order %d: %v", req.OrderID, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to queue cancel command"})
 		return
 	}
+	h.outbox.Notify()
 
+	recordAudit(ctx, h.audit, db.CreateAuditLogParams{
+		UserID:       user.ID,
+		Action:       AuditOrderCancelRequested,
+		ResourceType: "order",
+		Details:      map[string]interface{}{"engine_order_id": req.OrderID},
+	})
 	ctx.JSON(http.StatusOK, gin.H{"message": "Cancel request sent successfully"})
 }
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	db "github.com/trading-platform/gateway/internal/database/sqlc"
+	"github.com/trading-platform/gateway/internal/util"
+)
+
+// cancelStore có hai order của hai user khác nhau và ghi lại các lệnh hủy được đưa vào outbox
+type cancelStore struct {
+	db.Store
+	users  map[string]db.Users
+	orders map[int64]db.ReconcileOrder
+	outbox []db.CreateOutboxMessageParams
+}
+
+func (s *cancelStore) GetUserByUsername(ctx context.Context, username string) (db.Users, error) {
+	user, ok := s.users[username]
+	if !ok {
+		return db.Users{}, fmt.Errorf("user not found")
+	}
+	return user, nil
+}
+
+func (s *cancelStore) GetOrderByEngineID(ctx context.Context, engineOrderID int64) (db.ReconcileOrder, error) {
+	order, ok := s.orders[engineOrderID]
+	if !ok {
+		return db.ReconcileOrder{}, fmt.Errorf("order not found")
+	}
+	return order, nil
+}
+
+func (s *cancelStore) CreateOutboxMessage(ctx context.Context, arg db.CreateOutboxMessageParams) (db.OutboxMessage, error) {
+	s.outbox = append(s.outbox, arg)
+	return db.OutboxMessage{}, nil
+}
+
+type noopNotifier struct{}
+
+func (noopNotifier) Notify() {}
+
+func TestCancelOrderRequiresOwnership(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	alice := db.Users{ID: "11111111-1111-1111-1111-111111111111", Username: "alice"}
+	bob := db.Users{ID: "22222222-2222-2222-2222-222222222222", Username: "bob"}
+
+	tests := []struct {
+		name       string
+		orderID    string
+		wantStatus int
+		wantQueued bool
+	}{
+		{"own open order", "1001", http.StatusOK, true},
+		{"other user's order", "2001", http.StatusNotFound, false},
+		{"unknown order", "9999", http.StatusNotFound, false},
+		{"own filled order", "1002", http.StatusConflict, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &cancelStore{
+				users: map[string]db.Users{"alice": alice, "bob": bob},
+				orders: map[int64]db.ReconcileOrder{
+					1001: {ID: "a-1001", UserID: alice.ID, EngineOrderID: 1001, Status: "OPEN"},
+					1002: {ID: "a-1002", UserID: alice.ID, EngineOrderID: 1002, Status: "FILLED"},
+					2001: {ID: "b-2001", UserID: bob.ID, EngineOrderID: 2001, Status: "OPEN"},
+				},
+			}
+			handler := NewOrderHandler(noopNotifier{}, nil, 0, store, discardAudit{})
+
+			router := gin.New()
+			router.POST("/orders/cancel", func(ctx *gin.Context) {
+				ctx.Set("authorization_payload", &util.Payload{Username: "alice"})
+				handler.CancelOrder(ctx)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/orders/cancel", strings.NewReader(`{"order_id":`+tt.orderID+`}`))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if queued := len(store.outbox) > 0; queued != tt.wantQueued {
+				t.Errorf("cancel queued = %v, want %v", queued, tt.wantQueued)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/trading-platform/gateway/internal/worker"
+)
+
+// ReconcileRunner chạy đối soát DB với sổ lệnh engine (worker.Reconciler)
+type ReconcileRunner interface {
+	Run(ctx context.Context, fix bool) (worker.ReconcileReport, error)
+	LastReport() (worker.ReconcileReport, bool)
+}
+
+// ReconcileAdminHandler handles operator requests for order book reconciliation
+type ReconcileAdminHandler struct {
+	reconciler ReconcileRunner
+}
+
+// NewReconcileAdminHandler creates a new reconcile admin handler
+func NewReconcileAdminHandler(reconciler ReconcileRunner) *ReconcileAdminHandler {
+	return &ReconcileAdminHandler{reconciler: reconciler}
+}
+
+// GetLastReport returns the result of the latest reconciliation run (GET /api/v1/admin/reconcile)
+func (h *ReconcileAdminHandler) GetLastReport(ctx *gin.Context) {
+	report, ok := h.reconciler.LastReport()
+	if !ok {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "no reconciliation has run yet"})
+		return
+	}
+	ctx.JSON(http.StatusOK, report)
+}
+
+type runReconcileRequest struct {
+	Fix bool `form:"fix"`
+}
+
+// RunReconcile runs a reconciliation now (POST /api/v1/admin/reconcile?fix=true để sửa sai lệch)
+func (h *ReconcileAdminHandler) RunReconcile(ctx *gin.Context) {
+	var req runReconcileRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := h.reconciler.Run(ctx, req.Fix)
+	if err != nil {
+		if errors.Is(err, worker.ErrReconcileRunning) {
+			ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, report)
+}
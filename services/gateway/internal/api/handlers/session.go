@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	db "github.com/trading-platform/gateway/internal/database/sqlc"
+	"github.com/trading-platform/gateway/internal/util"
+)
+
+// sessionTokens là cặp token trả về khi đăng nhập hoặc refresh
+type sessionTokens struct {
+	SessionID        string    `json:"session_id"`
+	AccessToken      string    `json:"access_token"`
+	RefreshToken     string    `json:"refresh_token"`
+	ExpiresAt        time.Time `json:"access_token_expires_at"`
+	RefreshExpiresAt time.Time `json:"refresh_token_expires_at"`
+}
+
+// RefreshTokenRequest represents the request body for refreshing an access token
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// SessionResponse represents one login session of the current user
+type SessionResponse struct {
+	ID           string    `json:"id"`
+	IPAddress    *string   `json:"ip_address"`
+	UserAgent    *string   `json:"user_agent"`
+	CreatedAt    time.Time `json:"created_at"`
+	LastActivity time.Time `json:"last_activity"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	Current      bool      `json:"current"`
+}
+
+// issueSession tạo session mới cho user kèm access token (mang sid) và refresh token
+func (h *UserHandler) issueSession(ctx *gin.Context, user db.Users) (sessionTokens, error) {
+	sessionID := uuid.NewString()
+	now := time.Now()
+
+	accessToken, err := util.CreateToken(user.Username, user.Role, sessionID, h.config.JWT.Secret, h.config.JWT.Expiry)
+	if err != nil {
+		return sessionTokens{}, err
+	}
+	refreshToken, err := util.NewRefreshToken(sessionID)
+	if err != nil {
+		return sessionTokens{}, err
+	}
+
+	session, err := h.store.CreateSession(ctx, db.CreateSessionParams{
+		ID:               sessionID,
+		UserID:           user.ID,
+		TokenHash:        util.HashToken(accessToken),
+		RefreshTokenHash: util.HashToken(refreshToken),
+		IPAddress:        ctx.ClientIP(),
+		UserAgent:        ctx.Request.UserAgent(),
+		ExpiresAt:        now.Add(h.config.JWT.RefreshExpiry),
+	})
+	if err != nil {
+		return sessionTokens{}, err
+	}
+
+	return sessionTokens{
+		SessionID:        session.ID,
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		ExpiresAt:        now.Add(h.config.JWT.Expiry),
+		RefreshExpiresAt: session.ExpiresAt,
+	}, nil
+}
+
+// RefreshToken đổi refresh token lấy cặp token mới (POST /api/v1/auth/refresh).
+// Refresh token chỉ dùng được một lần; dùng lại token đã bị thay = bị lộ, session bị thu hồi.
+func (h *UserHandler) RefreshToken(ctx *gin.Context) {
+	var req RefreshTokenRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sessionID, err := util.ParseRefreshToken(req.RefreshToken)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
+		return
+	}
+	if _, err := uuid.Parse(sessionID); err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
+		return
+	}
+
+	session, err := h.store.GetSession(ctx, sessionID)
+	if err != nil {
+		if err.Error() == "session not found" {
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "session has expired or been revoked"})
+		return
+	}
+
+	hash := util.HashToken(req.RefreshToken)
+	if session.PreviousRefreshTokenHash != nil && tokenHashEqual(hash, *session.PreviousRefreshTokenHash) {
+		if _, err := h.store.RevokeSession(ctx, session.ID, session.UserID); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "refresh token reuse detected, session revoked"})
+		return
+	}
+	if !tokenHashEqual(hash, session.RefreshTokenHash) {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
+		return
+	}
+
+	user, err := h.store.GetUserByUUID(ctx, session.UserID)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
+		return
+	}
+
+	accessToken, err := util.CreateToken(user.Username, user.Role, session.ID, h.config.JWT.Secret, h.config.JWT.Expiry)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create access token"})
+		return
+	}
+	refreshToken, err := util.NewRefreshToken(session.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create refresh token"})
+		return
+	}
+
+	session, err = h.store.RotateSession(ctx, db.RotateSessionParams{
+		ID:                  session.ID,
+		OldRefreshTokenHash: hash,
+		TokenHash:           util.HashToken(accessToken),
+		RefreshTokenHash:    util.HashToken(refreshToken),
+	})
+	if err != nil {
+		if err.Error() == "session not found" {
+			// Một request refresh khác đã dùng token này trước
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "invalid refresh token"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, sessionTokens{
+		SessionID:        session.ID,
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		ExpiresAt:        time.Now().Add(h.config.JWT.Expiry),
+		RefreshExpiresAt: session.ExpiresAt,
+	})
+}
+
+// Logout thu hồi session hiện tại (POST /api/v1/auth/logout)
+func (h *UserHandler) Logout(ctx *gin.Context) {
+	payload := ctx.MustGet("authorization_payload").(*util.Payload)
+	user, err := h.store.GetUserByUsername(ctx, payload.Username)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+		return
+	}
+
+	if _, err := h.store.RevokeSession(ctx, payload.SessionID, user.ID); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	recordAudit(ctx, h.audit, db.CreateAuditLogParams{
+		UserID:       user.ID,
+		Action:       AuditLogout,
+		ResourceType: "session",
+		ResourceID:   payload.SessionID,
+	})
+	ctx.JSON(http.StatusOK, gin.H{"message": "logged out"})
+}
+
+// ListSessions lists the current user's active sessions (GET /api/v1/auth/sessions)
+func (h *UserHandler) ListSessions(ctx *gin.Context) {
+	payload := ctx.MustGet("authorization_payload").(*util.Payload)
+	user, err := h.store.GetUserByUsername(ctx, payload.Username)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+		return
+	}
+
+	sessions, err := h.store.ListActiveSessions(ctx, user.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, SessionResponse{
+			ID:           session.ID,
+			IPAddress:    session.IPAddress,
+			UserAgent:    session.UserAgent,
+			CreatedAt:    session.CreatedAt,
+			LastActivity: session.LastActivity,
+			ExpiresAt:    session.ExpiresAt,
+			Current:      session.ID == payload.SessionID,
+		})
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// RevokeSession revokes one of the current user's sessions (DELETE /api/v1/auth/sessions/:id)
+func (h *UserHandler) RevokeSession(ctx *gin.Context) {
+	payload := ctx.MustGet("authorization_payload").(*util.Payload)
+	user, err := h.store.GetUserByUsername(ctx, payload.Username)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+		return
+	}
+
+	sessionID := ctx.Param("id")
+	if _, err := uuid.Parse(sessionID); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid session id"})
+		return
+	}
+
+	revoked, err := h.store.RevokeSession(ctx, sessionID, user.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !revoked {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "session revoked", "session_id": sessionID})
+}
+
+// RevokeOtherSessions revokes every session of the current user except this one (DELETE /api/v1/auth/sessions)
+func (h *UserHandler) RevokeOtherSessions(ctx *gin.Context) {
+	payload := ctx.MustGet("authorization_payload").(*util.Payload)
+	user, err := h.store.GetUserByUsername(ctx, payload.Username)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+		return
+	}
+
+	count, err := h.store.RevokeUserSessions(ctx, user.ID, payload.SessionID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "other sessions revoked", "revoked": count})
+}
+
+// tokenHashEqual so sánh hash token trong thời gian hằng
+func tokenHashEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	db "github.com/trading-platform/gateway/internal/database/sqlc"
+	"github.com/trading-platform/gateway/internal/util"
+)
+
+// AuditTransfer ghi lại chuyển tiền nội bộ (giữa user, hoặc giữa các ví của một user)
+const AuditTransfer = "transfer"
+
+// --- API: Chuyển tiền nội bộ (POST /api/v1/transfers) ---
+
+type transferRequest struct {
+	Currency        string `json:"currency" binding:"required"`
+	Amount          string `json:"amount" binding:"required"`
+	ToUsername      string `json:"to_username"`                                                     // Rỗng = chuyển giữa các ví của chính mình
+	FromAccountType string `json:"from_account_type" binding:"omitempty,oneof=spot margin futures"` // Mặc định spot
+	ToAccountType   string `json:"to_account_type" binding:"omitempty,oneof=spot margin futures"`   // Mặc định spot
+	Note            string `json:"note" binding:"max=200"`
+}
+
+// Transfer moves funds to another user's spot account by username, or between the
+// user's own spot/margin/futures accounts. Hai bên được ghi nhận trong cùng một transaction DB.
+func (h *AccountHandler) Transfer(ctx *gin.Context) {
+	var req transferRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Currency = strings.ToUpper(req.Currency)
+	if req.FromAccountType == "" {
+		req.FromAccountType = "spot"
+	}
+	if req.ToAccountType == "" {
+		req.ToAccountType = "spot"
+	}
+
+	currency, err := h.store.GetCurrency(ctx, req.Currency)
+	if err != nil {
+		if err.Error() == "currency not found" {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unsupported currency: %s", req.Currency)})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !currency.IsActive {
+		ctx.JSON(http.StatusUnprocessableEntity, gin.H{"error": fmt.Sprintf("%s is not active", currency.Code)})
+		return
+	}
+	amount, ok := new(big.Rat).SetString(req.Amount)
+	if !ok || amount.Sign() <= 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "amount must be a positive decimal"})
+		return
+	}
+	if !hasMaxDecimals(amount, currency.Decimals) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("amount of %s allows at most %d decimal places", currency.Code, currency.Decimals)})
+		return
+	}
+
+	payload := ctx.MustGet("authorization_payload").(*util.Payload)
+	user, err := h.store.GetUserByUsername(ctx, payload.Username)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	// Người nhận: user khác thì luôn vào ví spot của họ
+	recipient := user
+	if req.ToUsername != "" && req.ToUsername != user.Username {
+		recipient, err = h.store.GetUserByUsername(ctx, req.ToUsername)
+		if err != nil {
+			if err.Error() == "user not found" {
+				ctx.JSON(http.StatusNotFound, gin.H{"error": "recipient not found"})
+				return
+			}
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if req.ToAccountType != "spot" {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "transfers to another user go to their spot account"})
+			return
+		}
+	} else if req.FromAccountType == req.ToAccountType {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "cannot transfer to the same account"})
+		return
+	}
+
+	description := fmt.Sprintf("%s/%s -> %s/%s", user.Username, req.FromAccountType, recipient.Username, req.ToAccountType)
+	if req.Note != "" {
+		description += ": " + req.Note
+	}
+
+	result, err := h.store.TransferTx(ctx, db.TransferTxParams{
+		FromUserID:      user.ID,
+		FromAccountType: req.FromAccountType,
+		ToUserID:        recipient.ID,
+		ToAccountType:   req.ToAccountType,
+		Currency:        currency.Code,
+		Amount:          amount.FloatString(int(currency.Decimals)),
+		Description:     description,
+	})
+	if err != nil {
+		switch err.Error() {
+		case "insufficient balance":
+			ctx.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		case "cannot transfer to the same account":
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	recordAudit(ctx, h.audit, db.CreateAuditLogParams{
+		UserID:       user.ID,
+		Action:       AuditTransfer,
+		ResourceType: "transfer",
+		ResourceID:   result.TransferID,
+		Details: map[string]interface{}{
+			"to_user_id":        recipient.ID,
+			"from_account_type": req.FromAccountType,
+			"to_account_type":   req.ToAccountType,
+			"currency":          currency.Code,
+			"amount":            result.ToTransaction.Amount,
+			"transaction_ids":   []int64{result.FromTransaction.ID, result.ToTransaction.ID},
+		},
+	})
+
+	log.Printf("🔁 Transfer %s: %s %s (%s)", result.TransferID, result.ToTransaction.Amount, currency.Code, description)
+
+	// Không trả số dư ví của người nhận về cho người chuyển
+	response := gin.H{
+		"message":     "Transfer successful",
+		"transfer_id": result.TransferID,
+		"account":     result.FromAccount,
+		"transaction": result.FromTransaction,
+	}
+	if recipient.ID == user.ID {
+		response["to_account"] = result.ToAccount
+	}
+	ctx.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,419 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/trading-platform/gateway/internal/config"
+	db "github.com/trading-platform/gateway/internal/database/sqlc"
+	"github.com/trading-platform/gateway/internal/util"
+)
+
+const recoveryCodeCount = 10
+
+// TwoFactorCodeRequest represents a request carrying a TOTP or recovery code
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// LoginTwoFactorRequest represents the second login step for users with 2FA enabled
+type LoginTwoFactorRequest struct {
+	PreAuthToken string `json:"pre_auth_token" binding:"required"`
+	Code         string `json:"code" binding:"required"` // Mã TOTP hoặc mã khôi phục
+}
+
+// VerifySecondFactor kiểm tra mã TOTP (6 số) hoặc mã khôi phục của user đã bật 2FA.
+// Mỗi mã chỉ dùng được một lần.
+func VerifySecondFactor(ctx context.Context, store db.Store, encryptionKey []byte, totp db.UserTOTP, code string) error {
+	if len(code) == util.TOTPDigits {
+		secret, err := util.DecryptSecret(encryptionKey, totp.SecretCiphertext)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt totp secret: %w", err)
+		}
+		step, ok := util.VerifyTOTP(secret, code, time.Now())
+		if !ok {
+			return fmt.Errorf("invalid two-factor code")
+		}
+		fresh, err := store.UseTOTPStep(ctx, totp.UserID, step)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return fmt.Errorf("two-factor code already used")
+		}
+		return nil
+	}
+
+	used, err := store.UseRecoveryCode(ctx, totp.UserID, util.HashToken(util.NormalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return fmt.Errorf("invalid two-factor code")
+	}
+	log.Printf("🔑 Recovery code used by user %s", totp.UserID)
+	return nil
+}
+
+// IsTwoFactorCodeError cho biết lỗi của VerifySecondFactor là do mã sai (401) hay lỗi hệ thống
+func IsTwoFactorCodeError(err error) bool {
+	return err.Error() == "invalid two-factor code" || err.Error() == "two-factor code already used"
+}
+
+// LoginTwoFactor completes login with the pre-auth token and a 2FA code (POST /api/v1/auth/login/2fa)
+func (h *UserHandler) LoginTwoFactor(ctx *gin.Context) {
+	var req LoginTwoFactorRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	username, err := util.VerifyPreAuthToken(req.PreAuthToken, h.config.JWT.Secret)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired pre-auth token"})
+		return
+	}
+	user, err := h.store.GetUserByUsername(ctx, username)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired pre-auth token"})
+		return
+	}
+	totp, ok := h.userTOTP(ctx, user)
+	if !ok {
+		return
+	}
+	if totp.EnabledAt == nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired pre-auth token"})
+		return
+	}
+
+	// Mã 2FA sai được đếm chung với mật khẩu sai, để pre-auth token không dùng được để dò mã
+	if h.guard.reject(ctx, user.Username) {
+		return
+	}
+	key, err := h.config.APIKeyEncryptionKey()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := VerifySecondFactor(ctx, h.store, key, totp, req.Code); err != nil {
+		if IsTwoFactorCodeError(err) {
+			h.guard.fail(ctx, user.Username, user.ID, "invalid_2fa_code")
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.guard.succeed(ctx, user.Username)
+
+	tokens, err := h.issueSession(ctx, user)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create session"})
+		return
+	}
+	h.auditLogin(ctx, user, tokens, true)
+	ctx.JSON(http.StatusOK, loginResponse(user, tokens))
+}
+
+// GetTwoFactorStatus returns the current user's 2FA status (GET /api/v1/auth/2fa)
+func (h *UserHandler) GetTwoFactorStatus(ctx *gin.Context) {
+	user, ok := h.currentUser(ctx)
+	if !ok {
+		return
+	}
+
+	totp, err := h.store.GetUserTOTP(ctx, user.ID)
+	if err != nil {
+		if err.Error() == "totp not found" {
+			ctx.JSON(http.StatusOK, gin.H{"enabled": false, "pending": false, "recovery_codes_remaining": 0})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	remaining, err := h.store.CountRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"enabled":                  totp.EnabledAt != nil,
+		"enabled_at":               totp.EnabledAt,
+		"pending":                  totp.EnabledAt == nil,
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// SetupTwoFactor starts TOTP enrollment and returns the secret plus the otpauth:// URI for the QR code
+// (POST /api/v1/auth/2fa/setup). 2FA chỉ bật sau khi user xác nhận bằng một mã ở /2fa/enable.
+func (h *UserHandler) SetupTwoFactor(ctx *gin.Context) {
+	user, ok := h.currentUser(ctx)
+	if !ok {
+		return
+	}
+
+	secret, err := util.GenerateTOTPSecret()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate totp secret"})
+		return
+	}
+	key, err := h.config.APIKeyEncryptionKey()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ciphertext, err := util.EncryptSecret(key, secret)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encrypt totp secret"})
+		return
+	}
+
+	if _, err := h.store.UpsertPendingTOTP(ctx, user.ID, ciphertext); err != nil {
+		if err.Error() == "totp already enabled" {
+			ctx.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication is already enabled"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"secret":           secret,
+		"provisioning_uri": util.TOTPProvisioningURI(h.config.TwoFactor.Issuer, user.Username, secret),
+		"digits":           util.TOTPDigits,
+		"period":           util.TOTPPeriod,
+	})
+}
+
+// EnableTwoFactor confirms enrollment with the first code and returns recovery codes (POST /api/v1/auth/2fa/enable).
+// Mã khôi phục chỉ hiển thị một lần trong response này.
+func (h *UserHandler) EnableTwoFactor(ctx *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := h.currentUser(ctx)
+	if !ok {
+		return
+	}
+	totp, ok := h.userTOTP(ctx, user)
+	if !ok {
+		return
+	}
+	if totp.EnabledAt != nil {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication is already enabled"})
+		return
+	}
+
+	key, err := h.config.APIKeyEncryptionKey()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	secret, err := util.DecryptSecret(key, totp.SecretCiphertext)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to decrypt totp secret"})
+		return
+	}
+	step, valid := util.VerifyTOTP(secret, req.Code, time.Now())
+	if !valid {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "invalid two-factor code"})
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate recovery codes"})
+		return
+	}
+	if _, err := h.store.EnableTOTPTx(ctx, user.ID, step, hashes); err != nil {
+		if err.Error() == "totp not found" {
+			ctx.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication is already enabled"})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	recordAudit(ctx, h.audit, db.CreateAuditLogParams{
+		UserID:       user.ID,
+		Action:       AuditTwoFactorEnabled,
+		ResourceType: "user",
+		ResourceID:   user.ID,
+	})
+	log.Printf("🔐 Two-factor authentication enabled for %s", user.Username)
+	ctx.JSON(http.StatusOK, gin.H{
+		"message":        "two-factor authentication enabled",
+		"recovery_codes": codes,
+		"warning":        "store the recovery codes now, they cannot be shown again",
+	})
+}
+
+// DisableTwoFactor turns 2FA off after verifying a current code (POST /api/v1/auth/2fa/disable)
+func (h *UserHandler) DisableTwoFactor(ctx *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := h.currentUser(ctx)
+	if !ok {
+		return
+	}
+	totp, ok := h.userTOTP(ctx, user)
+	if !ok {
+		return
+	}
+	// Đăng ký chưa xác nhận thì hủy luôn, không cần mã
+	if totp.EnabledAt != nil && !h.checkSecondFactor(ctx, user, totp, req.Code) {
+		return
+	}
+
+	if _, err := h.store.DisableTOTPTx(ctx, user.ID); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	recordAudit(ctx, h.audit, db.CreateAuditLogParams{
+		UserID:       user.ID,
+		Action:       AuditTwoFactorDisabled,
+		ResourceType: "user",
+		ResourceID:   user.ID,
+	})
+	log.Printf("🔓 Two-factor authentication disabled for %s", user.Username)
+	ctx.JSON(http.StatusOK, gin.H{"message": "two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after verifying a current code
+// (POST /api/v1/auth/2fa/recovery-codes)
+func (h *UserHandler) RegenerateRecoveryCodes(ctx *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := h.currentUser(ctx)
+	if !ok {
+		return
+	}
+	totp, ok := h.userTOTP(ctx, user)
+	if !ok {
+		return
+	}
+	if totp.EnabledAt == nil {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication is not enabled"})
+		return
+	}
+	if !h.checkSecondFactor(ctx, user, totp, req.Code) {
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate recovery codes"})
+		return
+	}
+	if err := h.store.ReplaceRecoveryCodesTx(ctx, user.ID, hashes); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"recovery_codes": codes,
+		"warning":        "store the recovery codes now, they cannot be shown again",
+	})
+}
+
+// currentUser lấy user của access token; trả về false (đã ghi response) nếu không tìm thấy
+func (h *UserHandler) currentUser(ctx *gin.Context) (db.Users, bool) {
+	payload := ctx.MustGet("authorization_payload").(*util.Payload)
+	user, err := h.store.GetUserByUsername(ctx, payload.Username)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+		return db.Users{}, false
+	}
+	return user, true
+}
+
+// userTOTP đọc đăng ký TOTP của user (đã bật hoặc đang chờ); 404 nếu chưa có
+func (h *UserHandler) userTOTP(ctx *gin.Context, user db.Users) (db.UserTOTP, bool) {
+	totp, err := h.store.GetUserTOTP(ctx, user.ID)
+	if err != nil {
+		if err.Error() == "totp not found" {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "two-factor authentication is not set up"})
+			return db.UserTOTP{}, false
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return db.UserTOTP{}, false
+	}
+	return totp, true
+}
+
+// checkSecondFactor kiểm tra mã 2FA của user đang đăng nhập và ghi response lỗi; trả về true nếu mã hợp lệ
+func (h *UserHandler) checkSecondFactor(ctx *gin.Context, user db.Users, totp db.UserTOTP, code string) bool {
+	key, err := h.config.APIKeyEncryptionKey()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	return verifyGuardedSecondFactor(ctx, h.store, h.guard, key, user, totp, code)
+}
+
+// StepUpVerifier kiểm tra mã 2FA cho thao tác nhạy cảm (middleware step-up)
+type StepUpVerifier struct {
+	store         db.Store
+	encryptionKey []byte
+	guard         *loginGuard
+}
+
+// NewStepUpVerifier creates a step-up verifier that shares the login failure counters
+func NewStepUpVerifier(store db.Store, encryptionKey []byte, login config.LoginConfig, audit AuditLogger) *StepUpVerifier {
+	return &StepUpVerifier{store: store, encryptionKey: encryptionKey, guard: newLoginGuard(store, login, audit)}
+}
+
+// Verify ghi response lỗi và trả về false nếu user đang phải chờ/bị khóa hoặc mã sai
+func (v *StepUpVerifier) Verify(ctx *gin.Context, user db.Users, totp db.UserTOTP, code string) bool {
+	return verifyGuardedSecondFactor(ctx, v.store, v.guard, v.encryptionKey, user, totp, code)
+}
+
+// verifyGuardedSecondFactor gọi VerifySecondFactor sau khi login guard cho phép thử. Mã sai được đếm như
+// đăng nhập sai của user (chờ lâu dần rồi khóa), để access token bị lộ không dùng được để dò mã 6 số.
+func verifyGuardedSecondFactor(ctx *gin.Context, store db.Store, guard *loginGuard, encryptionKey []byte,
+	user db.Users, totp db.UserTOTP, code string) bool {
+	if guard.reject(ctx, user.Username) {
+		return false
+	}
+	if err := VerifySecondFactor(ctx, store, encryptionKey, totp, code); err != nil {
+		if IsTwoFactorCodeError(err) {
+			guard.fail(ctx, user.Username, user.ID, "invalid_2fa_code")
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error(), "two_factor_required": true})
+			return false
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// newRecoveryCodes tạo mã khôi phục và hash tương ứng để lưu DB
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := util.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = util.HashToken(util.NormalizeRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
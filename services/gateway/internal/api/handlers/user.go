@@ -1,12 +1,14 @@
 package handlers
 
 import (
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/trading-platform/gateway/internal/config"
 	db "github.com/trading-platform/gateway/internal/database/sqlc"
+	"github.com/trading-platform/gateway/internal/mailer"
 	"github.com/trading-platform/gateway/internal/util"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -15,13 +17,19 @@ import (
 type UserHandler struct {
 	config config.Config
 	store  db.Store
+	guard  *loginGuard // Chống dò mật khẩu
+	mailer mailer.Mailer
+	audit  AuditLogger
 }
 
 // NewUserHandler creates a new user handler
-func NewUserHandler(cfg config.Config, store db.Store) *UserHandler {
+func NewUserHandler(cfg config.Config, store db.Store, mail mailer.Mailer, audit AuditLogger) *UserHandler {
 	return &UserHandler{
 		config: cfg,
 		store:  store,
+		guard:  newLoginGuard(store, cfg.Login, audit),
+		mailer: mail,
+		audit:  audit,
 	}
 }
 
@@ -71,24 +79,39 @@ func (h *UserHandler) RegisterUser(ctx *gin.Context) {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create user: " + err.Error()})
 		return
 	}
+	recordAudit(ctx, h.audit, db.CreateAuditLogParams{
+		UserID:       user.ID,
+		Action:       AuditRegister,
+		ResourceType: "user",
+		ResourceID:   user.ID,
+		Details:      map[string]interface{}{"username": user.Username, "email": user.Email},
+	})
+
+	// Gửi link xác minh email; đăng ký vẫn thành công nếu lỗi (user có thể yêu cầu gửi lại)
+	if err := h.sendVerificationEmail(user); err != nil {
+		log.Printf("❌ Failed to send verification email to %s: %v", user.Username, err)
+	}
 
-	// Create access token
-	accessToken, err := util.CreateToken(req.Username, h.config.JWT.Secret, h.config.JWT.Expiry)
+	// Create session (access + refresh token)
+	tokens, err := h.issueSession(ctx, user)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create access token"})
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create session"})
 		return
 	}
 
 	response := gin.H{
-		"username":     user.Username,
-		"email":        user.Email,
-		"access_token": accessToken,
-		"created_at":   user.CreatedAt,
+		"username":      user.Username,
+		"email":         user.Email,
+		"access_token":  tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"session_id":    tokens.SessionID,
+		"created_at":    user.CreatedAt,
 		"user": gin.H{
 			"id":       user.ID,
 			"username": user.Username,
 			"email":    user.Email,
 		},
+		"is_verified": user.IsVerified,
 	}
 
 	ctx.JSON(http.StatusOK, response)
@@ -102,9 +125,15 @@ func (h *UserHandler) LoginUser(ctx *gin.Context) {
 		return
 	}
 
+	// Username/IP vừa sai nhiều lần: bắt chờ hoặc đang bị khóa tạm
+	if h.guard.reject(ctx, req.Username) {
+		return
+	}
+
 	// Get user from database
 	user, err := h.store.GetUserByUsername(ctx, req.Username)
 	if err != nil {
+		h.guard.fail(ctx, req.Username, "", "unknown_username")
 		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "invalid username or password"})
 		return
 	}
@@ -112,23 +141,65 @@ func (h *UserHandler) LoginUser(ctx *gin.Context) {
 	// Verify password
 	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password))
 	if err != nil {
+		h.guard.fail(ctx, req.Username, user.ID, "invalid_password")
 		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "invalid username or password"})
 		return
 	}
 
-	// Create access token
-	accessToken, err := util.CreateToken(req.Username, h.config.JWT.Secret, h.config.JWT.Expiry)
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create access token"})
+	// User đã bật 2FA: chưa cấp session, trả về pre-auth token cho bước nhập mã (/auth/login/2fa)
+	totp, err := h.store.GetUserTOTP(ctx, user.ID)
+	if err != nil && err.Error() != "totp not found" {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err == nil && totp.EnabledAt != nil {
+		preAuthToken, err := util.CreatePreAuthToken(user.Username, h.config.JWT.Secret, h.config.TwoFactor.PreAuthExpiry)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create pre-auth token"})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"two_factor_required":       true,
+			"pre_auth_token":            preAuthToken,
+			"pre_auth_token_expires_at": time.Now().Add(h.config.TwoFactor.PreAuthExpiry),
+		})
 		return
 	}
 
-	response := gin.H{
-		"username":     user.Username,
-		"email":        user.Email,
-		"access_token": accessToken,
-		"token":        accessToken,
+	h.guard.succeed(ctx, user.Username)
+
+	// Create session (access + refresh token)
+	tokens, err := h.issueSession(ctx, user)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create session"})
+		return
 	}
+	h.auditLogin(ctx, user, tokens, false)
 
-	ctx.JSON(http.StatusOK, response)
+	ctx.JSON(http.StatusOK, loginResponse(user, tokens))
+}
+
+// auditLogin ghi audit log cho một lần đăng nhập thành công
+func (h *UserHandler) auditLogin(ctx *gin.Context, user db.Users, tokens sessionTokens, twoFactor bool) {
+	recordAudit(ctx, h.audit, db.CreateAuditLogParams{
+		UserID:       user.ID,
+		Action:       AuditLogin,
+		ResourceType: "session",
+		ResourceID:   tokens.SessionID,
+		Details:      map[string]interface{}{"username": user.Username, "two_factor": twoFactor},
+	})
+}
+
+// loginResponse là response khi đăng nhập thành công (cả khi qua bước 2FA)
+func loginResponse(user db.Users, tokens sessionTokens) gin.H {
+	return gin.H{
+		"username":                 user.Username,
+		"email":                    user.Email,
+		"access_token":             tokens.AccessToken,
+		"token":                    tokens.AccessToken,
+		"refresh_token":            tokens.RefreshToken,
+		"session_id":               tokens.SessionID,
+		"access_token_expires_at":  tokens.ExpiresAt,
+		"refresh_token_expires_at": tokens.RefreshExpiresAt,
+	}
 }
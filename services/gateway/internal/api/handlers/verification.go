@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	db "github.com/trading-platform/gateway/internal/database/sqlc"
+	"github.com/trading-platform/gateway/internal/mailer"
+	"github.com/trading-platform/gateway/internal/util"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const mailSendTimeout = 30 * time.Second
+
+// VerifyEmailRequest represents the request body for verifying an email address
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// ForgotPasswordRequest represents the request body for requesting a password reset email
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest represents the request body for setting a new password
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=6"`
+}
+
+// VerifyEmail marks the user's email as verified (GET /api/v1/auth/verify?token=... từ link trong email,
+// hoặc POST với body {"token": ...})
+func (h *UserHandler) VerifyEmail(ctx *gin.Context) {
+	token := ctx.Query("token")
+	if token == "" {
+		var req VerifyEmailRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		token = req.Token
+	}
+
+	userID, fingerprint, err := util.VerifyEmailToken(token, util.PurposeVerifyEmail, h.config.JWT.Secret)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired verification token"})
+		return
+	}
+	user, err := h.store.GetUserByUUID(ctx, userID)
+	if err != nil || !tokenHashEqual(fingerprint, tokenFingerprint(user.Email)) {
+		// Email đã đổi sau khi gửi link
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired verification token"})
+		return
+	}
+
+	verified, err := h.store.MarkUserVerified(ctx, user.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if verified {
+		log.Printf("✅ Email of %s verified", user.Username)
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "email verified", "username": user.Username})
+}
+
+// ResendVerification sends a new verification email to the current user (POST /api/v1/auth/verify/resend)
+func (h *UserHandler) ResendVerification(ctx *gin.Context) {
+	user, ok := h.currentUser(ctx)
+	if !ok {
+		return
+	}
+	if user.IsVerified {
+		ctx.JSON(http.StatusConflict, gin.H{"error": "email is already verified"})
+		return
+	}
+
+	if err := h.sendVerificationEmail(user); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create verification token"})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"message": "verification email sent"})
+}
+
+// ForgotPassword emails a password reset link (POST /api/v1/auth/forgot-password).
+// Luôn trả về cùng một response để không lộ email nào đã đăng ký.
+func (h *UserHandler) ForgotPassword(ctx *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.store.GetUserByEmail(ctx, req.Email)
+	if err == nil {
+		token, err := util.CreateEmailToken(util.PurposeResetPassword, user.ID, tokenFingerprint(user.PasswordHash), h.config.JWT.Secret, h.config.Mail.ResetExpiry)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create reset token"})
+			return
+		}
+		h.sendMail(mailer.Message{
+			To:      user.Email,
+			Subject: "Reset your password",
+			Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password of your account. Open the link below to choose a new password:\n\n%s\n\nThe link expires in %s. If you did not ask for this, ignore this email.\n",
+				user.Username, withToken(h.config.Mail.ResetPasswordURL, token), h.config.Mail.ResetExpiry),
+		})
+	} else if err.Error() != "user not found" {
+		log.Printf("❌ Failed to look up user for password reset: %v", err)
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "if the email is registered, a reset link has been sent"})
+}
+
+// ResetPassword sets a new password using the emailed token (POST /api/v1/auth/reset-password).
+// Mọi session bị thu hồi và bộ đếm đăng nhập sai được xóa.
+func (h *UserHandler) ResetPassword(ctx *gin.Context) {
+	var req ResetPasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, fingerprint, err := util.VerifyEmailToken(req.Token, util.PurposeResetPassword, h.config.JWT.Secret)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired reset token"})
+		return
+	}
+	user, err := h.store.GetUserByUUID(ctx, userID)
+	if err != nil || !tokenHashEqual(fingerprint, tokenFingerprint(user.PasswordHash)) {
+		// Mật khẩu đã đổi (kể cả bằng chính token này) -> token hết hiệu lực
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired reset token"})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to hash password"})
+		return
+	}
+	if err := h.store.UpdateUserPassword(ctx, user.ID, string(hashedPassword)); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	revoked, err := h.store.RevokeUserSessions(ctx, user.ID, "")
+	if err != nil {
+		log.Printf("⚠️  Failed to revoke sessions of %s after password reset: %v", user.Username, err)
+	}
+	h.guard.succeed(ctx, user.Username)
+
+	// Nhận được email reset nghĩa là email đúng là của user
+	if !user.IsVerified {
+		if _, err := h.store.MarkUserVerified(ctx, user.ID); err != nil {
+			log.Printf("⚠️  Failed to mark %s verified: %v", user.Username, err)
+		}
+	}
+
+	recordAudit(ctx, h.audit, db.CreateAuditLogParams{
+		UserID:       user.ID,
+		Action:       AuditPasswordReset,
+		ResourceType: "user",
+		ResourceID:   user.ID,
+		Details:      map[string]interface{}{"sessions_revoked": revoked},
+	})
+	log.Printf("🔑 Password of %s reset, %d sessions revoked", user.Username, revoked)
+	ctx.JSON(http.StatusOK, gin.H{"message": "password has been reset, please log in again"})
+}
+
+// sendVerificationEmail gửi link xác minh email (token gắn với địa chỉ email hiện tại)
+func (h *UserHandler) sendVerificationEmail(user db.Users) error {
+	token, err := util.CreateEmailToken(util.PurposeVerifyEmail, user.ID, tokenFingerprint(user.Email), h.config.JWT.Secret, h.config.Mail.VerifyExpiry)
+	if err != nil {
+		return err
+	}
+	h.sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below:\n\n%s\n\nThe link expires in %s.\n",
+			user.Username, withToken(h.config.Mail.VerifyURL, token), h.config.Mail.VerifyExpiry),
+	})
+	return nil
+}
+
+// sendMail gửi email ở goroutine riêng: SMTP chậm không làm chậm request, và thời gian response
+// của forgot-password không phụ thuộc việc email có tồn tại hay không
+func (h *UserHandler) sendMail(msg mailer.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailSendTimeout)
+		defer cancel()
+		if err := h.mailer.Send(ctx, msg); err != nil {
+			log.Printf("❌ Failed to send mail '%s' to %s: %v", msg.Subject, msg.To, err)
+		}
+	}()
+}
+
+// tokenFingerprint rút gọn một giá trị của user để gắn vào token email
+func tokenFingerprint(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:16])
+}
+
+func withToken(baseURL, token string) string {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return baseURL + "?token=" + url.QueryEscape(token)
+	}
+	query := u.Query()
+	query.Set("token", token)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
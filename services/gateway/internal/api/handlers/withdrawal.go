@@ -0,0 +1,346 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	db "github.com/trading-platform/gateway/internal/database/sqlc"
+	"github.com/trading-platform/gateway/internal/util"
+)
+
+// Các action rút tiền ghi vào audit_logs (thao tác của staff đã được auditAdminActions ghi)
+const (
+	AuditWithdrawalRequested = "withdrawal_requested"
+	AuditWithdrawalCancelled = "withdrawal_cancelled"
+)
+
+// --- API: Rút tiền (POST /api/v1/accounts/withdraw) ---
+
+type withdrawRequest struct {
+	Currency string `json:"currency" binding:"required"`
+	Amount   string `json:"amount" binding:"required"` // Đã gồm phí rút
+	Address  string `json:"address" binding:"required,max=255"`
+}
+
+// Withdraw creates a pending withdrawal request. Số tiền bị trừ khỏi ví ngay (giữ lại) cho tới khi
+// staff duyệt và xác nhận đã chuyển; bị từ chối, tự hủy hoặc chuyển thất bại thì được hoàn lại.
+func (h *AccountHandler) Withdraw(ctx *gin.Context) {
+	var req withdrawRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	req.Currency = strings.ToUpper(req.Currency)
+	req.Address = strings.TrimSpace(req.Address)
+
+	// 1. Kiểm tra theo cấu hình rút tiền của currency
+	currency, err := h.store.GetCurrency(ctx, req.Currency)
+	if err != nil {
+		if err.Error() == "currency not found" {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unsupported currency: %s", req.Currency)})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !currency.IsActive || !currency.IsWithdrawalEnabled {
+		ctx.JSON(http.StatusUnprocessableEntity, gin.H{"error": fmt.Sprintf("withdrawals of %s are disabled", currency.Code)})
+		return
+	}
+	if req.Address == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "address is required"})
+		return
+	}
+
+	amount, ok := new(big.Rat).SetString(req.Amount)
+	if !ok || amount.Sign() <= 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "amount must be a positive decimal"})
+		return
+	}
+	if !hasMaxDecimals(amount, currency.Decimals) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("amount of %s allows at most %d decimal places", currency.Code, currency.Decimals)})
+		return
+	}
+	if min, ok := new(big.Rat).SetString(currency.MinWithdrawal); ok && amount.Cmp(min) < 0 {
+		ctx.JSON(http.StatusUnprocessableEntity, gin.H{"error": fmt.Sprintf("minimum withdrawal is %s %s", currency.MinWithdrawal, currency.Code)})
+		return
+	}
+	if currency.MaxWithdrawal != nil {
+		if max, ok := new(big.Rat).SetString(*currency.MaxWithdrawal); ok && amount.Cmp(max) > 0 {
+			ctx.JSON(http.StatusUnprocessableEntity, gin.H{"error": fmt.Sprintf("maximum withdrawal is %s %s", *currency.MaxWithdrawal, currency.Code)})
+			return
+		}
+	}
+	if fee, ok := new(big.Rat).SetString(currency.WithdrawalFee); ok && amount.Cmp(fee) <= 0 {
+		ctx.JSON(http.StatusUnprocessableEntity, gin.H{"error": fmt.Sprintf("amount must be greater than the withdrawal fee of %s %s", currency.WithdrawalFee, currency.Code)})
+		return
+	}
+
+	// 2. Trừ tiền và tạo yêu cầu
+	payload := ctx.MustGet("authorization_payload").(*util.Payload)
+	user, err := h.store.GetUserByUsername(ctx, payload.Username)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	result, err := h.store.CreateWithdrawalTx(ctx, db.CreateWithdrawalTxParams{
+		UserID:     user.ID,
+		Currency:   currency.Code,
+		Amount:     amount.FloatString(int(currency.Decimals)),
+		Fee:        currency.WithdrawalFee,
+		Address:    req.Address,
+		DailyLimit: h.withdrawalLimits[currency.Code],
+		Since:      time.Now().Add(-24 * time.Hour),
+	})
+	if err != nil {
+		if err.Error() == "insufficient balance" || err.Error() == "daily withdrawal limit exceeded" {
+			ctx.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	recordAudit(ctx, h.audit, db.CreateAuditLogParams{
+		UserID:       user.ID,
+		Action:       AuditWithdrawalRequested,
+		ResourceType: "withdrawal",
+		ResourceID:   result.Withdrawal.ID,
+		Details: map[string]interface{}{
+			"transaction_id": result.Transaction.ID,
+			"currency":       result.Withdrawal.Currency,
+			"amount":         result.Withdrawal.Amount,
+			"fee":            result.Withdrawal.Fee,
+			"address":        result.Withdrawal.Address,
+			"balance":        result.Account.Balance,
+		},
+	})
+
+	log.Printf("💸 Withdrawal %s requested by %s: %s %s to %s", result.Withdrawal.ID, user.Username, result.Withdrawal.Amount, result.Withdrawal.Currency, result.Withdrawal.Address)
+	ctx.JSON(http.StatusCreated, gin.H{
+		"message":    "Withdrawal request submitted",
+		"withdrawal": result.Withdrawal,
+		"account":    result.Account,
+	})
+}
+
+// hasMaxDecimals cho biết x có biểu diễn được với tối đa decimals chữ số thập phân không
+func hasMaxDecimals(x *big.Rat, decimals int32) bool {
+	scaled := new(big.Rat).Mul(x, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)))
+	return scaled.IsInt()
+}
+
+type listWithdrawalsRequest struct {
+	Status   string `form:"status" binding:"omitempty,oneof=pending approved completed failed rejected cancelled"`
+	Currency string `form:"currency"`
+	Limit    int32  `form:"limit" binding:"omitempty,min=1,max=500"`
+	Offset   int32  `form:"offset" binding:"omitempty,min=0"`
+}
+
+// ListWithdrawals lists the user's withdrawal requests, newest first (GET /api/v1/withdrawals)
+func (h *AccountHandler) ListWithdrawals(ctx *gin.Context) {
+	var req listWithdrawalsRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = 50
+	}
+
+	payload := ctx.MustGet("authorization_payload").(*util.Payload)
+	user, err := h.store.GetUserByUsername(ctx, payload.Username)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	withdrawals, err := h.store.ListWithdrawals(ctx, db.ListWithdrawalsParams{
+		UserID:   user.ID,
+		Status:   req.Status,
+		Currency: strings.ToUpper(req.Currency),
+		Limit:    req.Limit,
+		Offset:   req.Offset,
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"withdrawals": withdrawals})
+}
+
+// CancelWithdrawal cancels the user's own pending withdrawal and refunds it
+// (POST /api/v1/withdrawals/:id/cancel). Yêu cầu đã được duyệt thì không hủy được nữa.
+func (h *AccountHandler) CancelWithdrawal(ctx *gin.Context) {
+	id := ctx.Param("id")
+	if _, err := uuid.Parse(id); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid withdrawal id"})
+		return
+	}
+
+	payload := ctx.MustGet("authorization_payload").(*util.Payload)
+	user, err := h.store.GetUserByUsername(ctx, payload.Username)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	result, ok := transitionWithdrawal(ctx, h.store, db.TransitionWithdrawalTxParams{
+		ID:     id,
+		UserID: user.ID,
+		Status: "cancelled",
+		Actor:  user.Username,
+	})
+	if !ok {
+		return
+	}
+
+	recordAudit(ctx, h.audit, db.CreateAuditLogParams{
+		UserID:       user.ID,
+		Action:       AuditWithdrawalCancelled,
+		ResourceType: "withdrawal",
+		ResourceID:   id,
+		Details: map[string]interface{}{
+			"currency": result.Withdrawal.Currency,
+			"amount":   result.Withdrawal.Amount,
+			"balance":  result.Account.Balance,
+		},
+	})
+
+	ctx.JSON(http.StatusOK, result)
+}
+
+// --- Admin: hàng đợi duyệt rút tiền (/api/v1/admin/withdrawals) ---
+
+type adminListWithdrawalsRequest struct {
+	listWithdrawalsRequest
+	Username string `form:"username"`
+}
+
+// ListWithdrawals lists withdrawal requests of all users (GET /api/v1/admin/withdrawals?status=pending).
+// Hàng đợi duyệt: status=pending; chờ chuyển tiền: status=approved.
+func (h *AdminHandler) ListWithdrawals(ctx *gin.Context) {
+	var req adminListWithdrawalsRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = 50
+	}
+
+	arg := db.ListWithdrawalsParams{
+		Status:   req.Status,
+		Currency: strings.ToUpper(req.Currency),
+		Limit:    req.Limit,
+		Offset:   req.Offset,
+	}
+	if req.Username != "" {
+		user, err := h.store.GetUserByUsername(ctx, req.Username)
+		if err != nil {
+			if err.Error() == "user not found" {
+				ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		arg.UserID = user.ID
+	}
+
+	withdrawals, err := h.store.ListWithdrawals(ctx, arg)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"withdrawals": withdrawals})
+}
+
+// ApproveWithdrawal approves a pending withdrawal for processing (POST /api/v1/admin/withdrawals/:id/approve)
+func (h *AdminHandler) ApproveWithdrawal(ctx *gin.Context) {
+	h.reviewWithdrawal(ctx, "approved", nil)
+}
+
+type withdrawalReasonRequest struct {
+	Reason string `json:"reason" binding:"required,min=5,max=500"`
+}
+
+// RejectWithdrawal rejects a pending withdrawal and refunds it (POST /api/v1/admin/withdrawals/:id/reject)
+func (h *AdminHandler) RejectWithdrawal(ctx *gin.Context) {
+	var req withdrawalReasonRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.reviewWithdrawal(ctx, "rejected", func(arg *db.TransitionWithdrawalTxParams) { arg.Reason = req.Reason })
+}
+
+type completeWithdrawalRequest struct {
+	ExternalReference string `json:"external_reference" binding:"required,max=255"` // Tx hash / mã chuyển khoản
+}
+
+// CompleteWithdrawal marks an approved withdrawal as sent (POST /api/v1/admin/withdrawals/:id/complete)
+func (h *AdminHandler) CompleteWithdrawal(ctx *gin.Context) {
+	var req completeWithdrawalRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.reviewWithdrawal(ctx, "completed", func(arg *db.TransitionWithdrawalTxParams) { arg.ExternalReference = req.ExternalReference })
+}
+
+// FailWithdrawal marks an approved withdrawal as failed and refunds it (POST /api/v1/admin/withdrawals/:id/fail)
+func (h *AdminHandler) FailWithdrawal(ctx *gin.Context) {
+	var req withdrawalReasonRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	h.reviewWithdrawal(ctx, "failed", func(arg *db.TransitionWithdrawalTxParams) { arg.Reason = req.Reason })
+}
+
+// reviewWithdrawal chuyển withdrawal :id sang status do staff thực hiện
+func (h *AdminHandler) reviewWithdrawal(ctx *gin.Context, status string, fill func(arg *db.TransitionWithdrawalTxParams)) {
+	id := ctx.Param("id")
+	if _, err := uuid.Parse(id); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid withdrawal id"})
+		return
+	}
+
+	arg := db.TransitionWithdrawalTxParams{ID: id, Status: status, Actor: actor(ctx)}
+	if fill != nil {
+		fill(&arg)
+	}
+
+	result, ok := transitionWithdrawal(ctx, h.store, arg)
+	if !ok {
+		return
+	}
+
+	log.Printf("👮 %s marked withdrawal %s (%s %s) as %s", arg.Actor, id, result.Withdrawal.Amount, result.Withdrawal.Currency, status)
+	ctx.JSON(http.StatusOK, result)
+}
+
+// transitionWithdrawal gọi TransitionWithdrawalTx; trả về false (đã ghi response) nếu lỗi
+func transitionWithdrawal(ctx *gin.Context, store db.Store, arg db.TransitionWithdrawalTxParams) (db.TransitionWithdrawalTxResult, bool) {
+	result, err := store.TransitionWithdrawalTx(ctx, arg)
+	if err != nil {
+		switch err.Error() {
+		case "withdrawal not found":
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case "invalid withdrawal status transition":
+			ctx.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("withdrawal cannot be %s from its current status", arg.Status)})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return result, false
+	}
+	return result, true
+}
@@ -1,55 +1,179 @@
 package api
 
 import (
+	"context"
+	"crypto/subtle"
+	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	db "github.com/trading-platform/gateway/internal/database/sqlc"
 	"github.com/trading-platform/gateway/internal/util"
 )
 
 const (
+	adminTokenHeaderKey     = "X-Admin-Token"
 	authorizationHeaderKey  = "authorization"
 	authorizationTypeBearer = "bearer"
 	authorizationPayloadKey = "authorization_payload"
+	adminTokenActor         = "admin-token" // Username ghi nhận cho thao tác dùng X-Admin-Token
 )
 
-// AuthMiddleware tạo ra một lớp bảo vệ cho các route cần đăng nhập
-func authMiddleware(jwtSecret string) gin.HandlerFunc {
+// AuthMiddleware tạo ra một lớp bảo vệ cho các route cần đăng nhập.
+// Chấp nhận Bearer access token (session) hoặc request ký bằng API key (header X-API-KEY).
+func authMiddleware(jwtSecret string, store db.Store, apiKeys *apiKeyAuth) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		// 1. Lấy header Authorization
-		authorizationHeader := ctx.GetHeader(authorizationHeaderKey)
-		if len(authorizationHeader) == 0 {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authorization header is not provided"})
+		// 0. Request ký bằng API key: quyền bị giới hạn theo key (xem requirePermission)
+		if ctx.GetHeader(util.APIKeyHeader) != "" {
+			key, status, err := apiKeys.authenticate(ctx)
+			if err != nil {
+				ctx.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+				return
+			}
+			ctx.Set(authorizationPayloadKey, &util.Payload{Username: key.Username, Role: util.RoleUser}) // API key không mang quyền quản trị
+			ctx.Set(authorizationAPIKeyKey, key)
+			ctx.Next()
 			return
 		}
 
-		// 2. Tách chuỗi "Bearer <token>"
-		fields := strings.Fields(authorizationHeader)
-		if len(fields) < 2 {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid authorization header format"})
+		// 1-3. Bearer access token + session còn hiệu lực
+		payload, err := authenticateBearer(ctx, jwtSecret, store)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 			return
 		}
 
-		authorizationType := strings.ToLower(fields[0])
-		if authorizationType != authorizationTypeBearer {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unsupported authorization type"})
-			return
+		// 4. Lưu thông tin user vào Context để các handler phía sau dùng
+		ctx.Set(authorizationPayloadKey, payload)
+
+		// Cho phép đi tiếp
+		ctx.Next()
+	}
+}
+
+// authenticateBearer đọc "Authorization: Bearer <token>", kiểm tra chữ ký JWT và session của token
+func authenticateBearer(ctx *gin.Context, jwtSecret string, store db.Store) (*util.Payload, error) {
+	// 1. Lấy header Authorization
+	authorizationHeader := ctx.GetHeader(authorizationHeaderKey)
+	if len(authorizationHeader) == 0 {
+		return nil, fmt.Errorf("authorization header is not provided")
+	}
+
+	// 2. Tách chuỗi "Bearer <token>"
+	fields := strings.Fields(authorizationHeader)
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("invalid authorization header format")
+	}
+
+	authorizationType := strings.ToLower(fields[0])
+	if authorizationType != authorizationTypeBearer {
+		return nil, fmt.Errorf("unsupported authorization type")
+	}
+
+	// 3. Verify Token
+	payload, err := util.VerifyToken(fields[1], jwtSecret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid access token")
+	}
+
+	// 3b. Session của token phải còn hiệu lực (logout / thu hồi có tác dụng ngay)
+	if err := checkSession(ctx, store, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// checkSession từ chối access token không gắn session, hoặc session đã bị thu hồi/hết hạn
+func checkSession(ctx context.Context, store db.Store, payload *util.Payload) error {
+	if payload.SessionID == "" {
+		return fmt.Errorf("access token has no session, please log in again")
+	}
+
+	session, err := store.GetSession(ctx, payload.SessionID)
+	if err != nil {
+		if err.Error() == "session not found" {
+			return fmt.Errorf("session has been revoked")
 		}
+		return fmt.Errorf("failed to check session")
+	}
+	if session.RevokedAt != nil {
+		return fmt.Errorf("session has been revoked")
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return fmt.Errorf("session has expired")
+	}
+	return nil
+}
 
-		accessToken := fields[1]
+// adminMiddleware bảo vệ nhóm /api/v1/admin. Chấp nhận nhân viên đăng nhập bằng session (role khác "user",
+// từng route kiểm tra thêm bằng requireRole), hoặc token tĩnh X-Admin-Token cho CLI vận hành (được coi là admin).
+// ADMIN_API_TOKEN rỗng = tắt cách dùng token tĩnh.
+func adminMiddleware(adminToken, jwtSecret string, store db.Store) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if token := ctx.GetHeader(adminTokenHeaderKey); token != "" {
+			if adminToken == "" {
+				ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin token is disabled"})
+				return
+			}
+			if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+				ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid admin token"})
+				return
+			}
+			ctx.Set(authorizationPayloadKey, &util.Payload{Username: adminTokenActor, Role: util.RoleAdmin})
+			ctx.Next()
+			return
+		}
 
-		// 3. Verify Token
-		payload, err := util.VerifyToken(accessToken, jwtSecret)
+		payload, err := authenticateBearer(ctx, jwtSecret, store)
 		if err != nil {
-			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid access token"})
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if payload.Role == util.RoleUser {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "staff role required"})
 			return
 		}
 
-		// 4. Lưu thông tin user vào Context để các handler phía sau dùng
 		ctx.Set(authorizationPayloadKey, payload)
+		ctx.Next()
+	}
+}
 
-		// Cho phép đi tiếp
+// requireRole chỉ cho các role trong danh sách đi tiếp (dùng sau adminMiddleware)
+func requireRole(roles ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		payload := ctx.MustGet(authorizationPayloadKey).(*util.Payload)
+		for _, role := range roles {
+			if payload.Role == role {
+				ctx.Next()
+				return
+			}
+		}
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("role '%s' is not allowed to perform this action", payload.Role)})
+	}
+}
+
+// requireVerifiedEmail chặn user chưa xác minh email khỏi thao tác action ("trading", "withdrawing"...).
+// Với giao dịch thì bật bằng REQUIRE_VERIFIED_EMAIL_FOR_TRADING; rút tiền luôn bật.
+func requireVerifiedEmail(store db.Store, enabled bool, action string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !enabled {
+			ctx.Next()
+			return
+		}
+
+		payload := ctx.MustGet(authorizationPayloadKey).(*util.Payload)
+		user, err := store.GetUserByUsername(ctx, payload.Username)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+			return
+		}
+		if !user.IsVerified {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "email address must be verified before " + action})
+			return
+		}
 		ctx.Next()
 	}
 }
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/trading-platform/gateway/internal/config"
+	db "github.com/trading-platform/gateway/internal/database/sqlc"
+	"github.com/trading-platform/gateway/internal/ratelimit"
+	"github.com/trading-platform/gateway/internal/util"
+)
+
+// Nhóm route có giới hạn riêng
+const (
+	rateClassAuth  = "auth"
+	rateClassOrder = "order"
+	rateClassRead  = "read"
+)
+
+// rateLimiter giới hạn request theo token bucket cho từng nhóm route.
+// Bucket theo API key nếu request ký bằng API key, theo user nếu có session, còn lại theo IP.
+type rateLimiter struct {
+	store   ratelimit.Store
+	limits  map[string]ratelimit.Limit
+	enabled bool
+
+	mu          sync.Mutex
+	lastErrorAt time.Time
+}
+
+func newRateLimiter(cfg config.RateLimitConfig, store ratelimit.Store) *rateLimiter {
+	return &rateLimiter{
+		store:   store,
+		enabled: cfg.Enabled && store != nil,
+		limits: map[string]ratelimit.Limit{
+			rateClassAuth:  ratelimit.PerMinute(cfg.Auth.PerMinute, cfg.Auth.Burst),
+			rateClassOrder: ratelimit.PerMinute(cfg.Order.PerMinute, cfg.Order.Burst),
+			rateClassRead:  ratelimit.PerMinute(cfg.Read.PerMinute, cfg.Read.Burst),
+		},
+	}
+}
+
+// limit trả về middleware cho nhóm route class. Route cần đăng nhập phải đặt nó sau authMiddleware.
+func (l *rateLimiter) limit(class string) gin.HandlerFunc {
+	limit := l.limits[class]
+	return func(ctx *gin.Context) {
+		if !l.enabled {
+			ctx.Next()
+			return
+		}
+
+		res, err := l.store.Take(ctx, class+":"+rateLimitKey(ctx, class), limit)
+		if err != nil {
+			// Store lỗi (Redis mất kết nối): cho request đi tiếp thay vì chặn toàn bộ API
+			l.logError(err)
+			ctx.Next()
+			return
+		}
+
+		ctx.Header("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+		ctx.Header("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		ctx.Header("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(res.ResetAfter)))
+		if !res.Allowed {
+			retryAfter := ceilSeconds(res.RetryAfter)
+			ctx.Header("Retry-After", strconv.Itoa(retryAfter))
+			ctx.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded, retry later", "retry_after": retryAfter})
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// rateLimitKey chọn đối tượng bị giới hạn. Nhóm auth luôn theo IP: request chưa đăng nhập,
+// username trong body do client tự khai (login guard đã đếm theo username).
+// IP là ClientIP(): X-Forwarded-For chỉ được dùng khi request đi qua proxy trong TRUSTED_PROXIES,
+// nếu không mỗi request giả header sẽ có bucket mới.
+func rateLimitKey(ctx *gin.Context, class string) string {
+	if class != rateClassAuth {
+		if value, ok := ctx.Get(authorizationAPIKeyKey); ok {
+			return "key:" + value.(*db.APIKey).ID
+		}
+		if value, ok := ctx.Get(authorizationPayloadKey); ok {
+			return "user:" + value.(*util.Payload).Username
+		}
+	}
+	return "ip:" + ctx.ClientIP()
+}
+
+// logError log lỗi store tối đa mỗi phút một lần
+func (l *rateLimiter) logError(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if time.Since(l.lastErrorAt) > time.Minute {
+		log.Printf("⚠️  Rate limiter store error, requests are not limited: %v", err)
+		l.lastErrorAt = time.Now()
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
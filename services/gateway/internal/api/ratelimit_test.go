@@ -0,0 +1,82 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/trading-platform/gateway/internal/config"
+	"github.com/trading-platform/gateway/internal/ratelimit"
+)
+
+func newRateLimitedRouter(t *testing.T, trustedProxies []string) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	limiter := newRateLimiter(config.RateLimitConfig{
+		Enabled: true,
+		Auth:    config.RateLimitRule{PerMinute: 1, Burst: 3},
+		Order:   config.RateLimitRule{PerMinute: 1, Burst: 3},
+		Read:    config.RateLimitRule{PerMinute: 1, Burst: 3},
+	}, ratelimit.NewMemoryStore())
+
+	router := gin.New()
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		t.Fatalf("SetTrustedProxies: %v", err)
+	}
+	router.POST("/login", limiter.limit(rateClassAuth), func(ctx *gin.Context) { ctx.Status(http.StatusOK) })
+	router.GET("/key", func(ctx *gin.Context) { ctx.String(http.StatusOK, rateLimitKey(ctx, rateClassAuth)) })
+	return router
+}
+
+func TestRateLimitIgnoresForgedForwardedFor(t *testing.T) {
+	router := newRateLimitedRouter(t, nil)
+
+	codes := make([]int, 0, 5)
+	for i := 0; i < 5; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/login", nil)
+		req.RemoteAddr = "203.0.113.7:40000"
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("198.51.100.%d", i+1))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		codes = append(codes, rec.Code)
+	}
+
+	want := []int{200, 200, 200, 429, 429}
+	for i := range want {
+		if codes[i] != want[i] {
+			t.Fatalf("status codes = %v, want %v (forged X-Forwarded-For must share the peer's bucket)", codes, want)
+		}
+	}
+}
+
+func TestRateLimitKeyClientIP(t *testing.T) {
+	router := newRateLimitedRouter(t, []string{"10.0.0.1"})
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		want         string
+	}{
+		{"direct client", "203.0.113.7:1000", "", "ip:203.0.113.7"},
+		{"forged header from direct client", "203.0.113.7:1000", "198.51.100.1", "ip:203.0.113.7"},
+		{"trusted proxy", "10.0.0.1:1000", "198.51.100.1", "ip:198.51.100.1"},
+		{"untrusted proxy", "10.0.0.2:1000", "198.51.100.1", "ip:10.0.0.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/key", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if got := rec.Body.String(); got != tt.want {
+				t.Errorf("rateLimitKey = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,17 +1,26 @@
 package api
 
 import (
+	"context"
 	"net/http"
+	"sync"
 
 	"github.com/gin-gonic/gin"
 	"github.com/nats-io/nats.go"
 	"github.com/trading-platform/gateway/internal/api/handlers"
 	"github.com/trading-platform/gateway/internal/config"
 	db "github.com/trading-platform/gateway/internal/database/sqlc"
+	"github.com/trading-platform/gateway/internal/mailer"
+	"github.com/trading-platform/gateway/internal/marketdata"
+	"github.com/trading-platform/gateway/internal/messaging"
+	"github.com/trading-platform/gateway/internal/ratelimit"
 	"github.com/trading-platform/gateway/internal/util"
 	"github.com/trading-platform/gateway/internal/websocket"
 )
 
+// HealthCheck reports whether a component is healthy, plus details for the health endpoint
+type HealthCheck func() (healthy bool, details interface{})
+
 // Server serves HTTP requests for our trading service
 type Server struct {
 	config   config.Config
@@ -19,23 +28,31 @@ type Server struct {
 	router   *gin.Engine
 	natsConn *nats.Conn     // NATS connection
 	wsHub    *websocket.Hub // WebSocket Hub
+
+	healthMu     sync.RWMutex
+	healthChecks map[string]HealthCheck // Các thành phần báo trạng thái cho /health
 }
 
 // NewServer creates a new HTTP server and setup routing
-func NewServer(cfg config.Config, store db.Store, nc *nats.Conn, wsHub *websocket.Hub) *Server {
+func NewServer(cfg config.Config, store db.Store, nc *nats.Conn, outbox handlers.OutboxNotifier, events handlers.EventReplayer, reconciler handlers.ReconcileRunner, ledger handlers.LedgerCheckRunner, mail mailer.Mailer, audit handlers.AuditLogger, limits ratelimit.Store, wsHub *websocket.Hub, depthFeed *marketdata.DepthFeed) *Server {
 	server := &Server{
-		config:   cfg,
-		store:    store,
-		natsConn: nc,
-		wsHub:    wsHub,
+		config:       cfg,
+		store:        store,
+		natsConn:     nc,
+		wsHub:        wsHub,
+		healthChecks: make(map[string]HealthCheck),
 	}
 	router := gin.Default()
+	// ClientIP() chỉ đọc X-Forwarded-For khi request đến từ proxy trong TRUSTED_PROXIES, còn lại dùng
+	// địa chỉ kết nối. Allowlist IP của API key, khóa đăng nhập theo IP và rate limit đều dựa vào nó.
+	_ = router.SetTrustedProxies(cfg.Server.TrustedProxies) // Đã kiểm tra trong cfg.Validate()
 
 	// Setup CORS middleware
 	router.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-KEY, X-API-TIMESTAMP, X-API-SIGNATURE, X-2FA-Code")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset, Content-Disposition")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(http.StatusNoContent)
@@ -46,56 +63,233 @@ func NewServer(cfg config.Config, store db.Store, nc *nats.Conn, wsHub *websocke
 	})
 
 	// Create handlers
-	userHandler := handlers.NewUserHandler(cfg, store)
-	accountHandler := handlers.NewAccountHandler(store)
-	orderHandler := handlers.NewOrderHandler(nc, store) // NATS Order Handler với store
-	balanceHandler := handlers.NewBalanceHandler(store) // Balance Handler
-	tradeHandler := handlers.NewTradeHandler(store)     // Trade Handler
+	orderAcks := messaging.NewOrderAckWaiter(nc) // Inbox nhận ack của engine khi đặt lệnh đồng bộ
+	userHandler := handlers.NewUserHandler(cfg, store, mail, audit)
+	accountHandler := handlers.NewAccountHandler(store, audit, cfg.Withdrawal)
+	orderHandler := handlers.NewOrderHandler(outbox, orderAcks, cfg.NATS.OrderAckTimeout, store, audit) // Order Handler ghi command qua outbox
+	balanceHandler := handlers.NewBalanceHandler(store)                                                 // Balance Handler
+	tradeHandler := handlers.NewTradeHandler(store)                                                     // Trade Handler
+	exportHandler := handlers.NewExportHandler(store)                                                   // Xuất CSV/NDJSON
+	marketHandler := handlers.NewMarketHandler(depthFeed)
+	apiKeyEncryption, _ := cfg.APIKeyEncryptionKey() // Đã kiểm tra trong cfg.Validate()
+	apiKeyHandler := handlers.NewAPIKeyHandler(store, apiKeyEncryption, audit)
+	apiKeys := newAPIKeyAuth(store, apiKeyEncryption, cfg.APIKey.ReplayWindow)
+	eventAdminHandler := handlers.NewEventAdminHandler(store, events)
+	reconcileAdminHandler := handlers.NewReconcileAdminHandler(reconciler)
+	ledgerAdminHandler := handlers.NewLedgerAdminHandler(store, ledger)
+	adminHandler := handlers.NewAdminHandler(store, outbox)
+	auditAdminHandler := handlers.NewAuditAdminHandler(store)
+
+	// Rate limit theo nhóm route (token bucket, xem RATE_LIMIT_*)
+	limiter := newRateLimiter(cfg.RateLimit, limits)
+	authLimit := limiter.limit(rateClassAuth)
+	orderLimit := limiter.limit(rateClassOrder)
+	readLimit := limiter.limit(rateClassRead)
 
 	// --- NHÓM PUBLIC ROUTES (Ai cũng gọi được) ---
-	router.POST("/api/v1/auth/register", userHandler.RegisterUser)
-	router.POST("/api/v1/auth/login", userHandler.LoginUser)
+	router.POST("/api/v1/auth/register", authLimit, userHandler.RegisterUser)
+	router.POST("/api/v1/auth/login", authLimit, userHandler.LoginUser)
+	router.POST("/api/v1/auth/login/2fa", authLimit, userHandler.LoginTwoFactor)
+	router.POST("/api/v1/auth/refresh", authLimit, userHandler.RefreshToken)
+	router.GET("/api/v1/auth/verify", authLimit, userHandler.VerifyEmail)
+	router.POST("/api/v1/auth/verify", authLimit, userHandler.VerifyEmail)
+	router.POST("/api/v1/auth/forgot-password", authLimit, userHandler.ForgotPassword)
+	router.POST("/api/v1/auth/reset-password", authLimit, userHandler.ResetPassword)
 
-	// WebSocket endpoint (Public route)
+	// WebSocket endpoint (Public route); kênh "user" cần op "auth" với access token
+	wsHub.SetAuthenticator(server.authenticateWebSocket)
 	router.GET("/ws", wsHub.HandleWebSocket)
 
+	// Order book snapshot (dùng để resync kênh depth)
+	router.GET("/api/v1/orderbook", readLimit, marketHandler.GetOrderBookSnapshot)
+
 	// Health check
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "ok", "service": "gateway"})
-	})
+	router.GET("/health", server.health)
+	router.GET("/health/:component", server.componentHealth)
 
-	// --- NHÓM PRIVATE ROUTES (Phải có Token mới gọi được) ---
-	// Tạo một nhóm route được bảo vệ bởi authMiddleware
-	authRoutes := router.Group("/").Use(authMiddleware(cfg.JWT.Secret))
+	// --- NHÓM PRIVATE ROUTES (Phải có Token hoặc API key mới gọi được) ---
+	// Tạo một nhóm route được bảo vệ bởi authMiddleware; API key chỉ gọi được route có quyền tương ứng
+	authRoutes := router.Group("/").Use(authMiddleware(cfg.JWT.Secret, store, apiKeys))
+	read := requirePermission(handlers.PermissionRead)
+	trade := requirePermission(handlers.PermissionTrade)
+	withdraw := requirePermission(handlers.PermissionWithdraw)
+	sessionOnly := requireSession()
+	stepUp := requireStepUp(store, handlers.NewStepUpVerifier(store, apiKeyEncryption, cfg.Login, audit)) // Thao tác nhạy cảm: cần mã 2FA nếu user đã bật
+	verified := requireVerifiedEmail(store, cfg.Mail.RequireVerified, "trading")
+	verifiedWithdraw := requireVerifiedEmail(store, true, "withdrawing")
+
+	// Session routes (protected)
+	authRoutes.POST("/api/v1/auth/logout", readLimit, sessionOnly, userHandler.Logout)
+	authRoutes.GET("/api/v1/auth/sessions", readLimit, sessionOnly, userHandler.ListSessions)
+	authRoutes.DELETE("/api/v1/auth/sessions", readLimit, sessionOnly, userHandler.RevokeOtherSessions)
+	authRoutes.DELETE("/api/v1/auth/sessions/:id", readLimit, sessionOnly, userHandler.RevokeSession)
+	authRoutes.POST("/api/v1/auth/verify/resend", readLimit, sessionOnly, userHandler.ResendVerification)
+
+	// Two-factor routes (protected, chỉ qua session)
+	authRoutes.GET("/api/v1/auth/2fa", readLimit, sessionOnly, userHandler.GetTwoFactorStatus)
+	authRoutes.POST("/api/v1/auth/2fa/setup", readLimit, sessionOnly, userHandler.SetupTwoFactor)
+	// Route nhận mã 2FA dùng giới hạn của nhóm auth (chặt hơn read) để khó dò mã
+	authRoutes.POST("/api/v1/auth/2fa/enable", authLimit, sessionOnly, userHandler.EnableTwoFactor)
+	authRoutes.POST("/api/v1/auth/2fa/disable", authLimit, sessionOnly, userHandler.DisableTwoFactor)
+	authRoutes.POST("/api/v1/auth/2fa/recovery-codes", authLimit, sessionOnly, userHandler.RegenerateRecoveryCodes)
+
+	// API key routes (protected, chỉ qua session)
+	authRoutes.POST("/api/v1/api-keys", authLimit, sessionOnly, stepUp, apiKeyHandler.CreateAPIKey)
+	authRoutes.GET("/api/v1/api-keys", readLimit, sessionOnly, apiKeyHandler.ListAPIKeys)
+	authRoutes.DELETE("/api/v1/api-keys/:id", readLimit, sessionOnly, apiKeyHandler.RevokeAPIKey)
 
 	// Account routes (protected)
-	authRoutes.GET("/api/v1/accounts", accountHandler.ListAccounts)
-	authRoutes.POST("/api/v1/accounts/deposit", accountHandler.AddDeposit)
-	authRoutes.GET("/api/v1/accounts/:currency", accountHandler.GetAccountBalance)
+	authRoutes.GET("/api/v1/accounts", readLimit, read, accountHandler.ListAccounts)
+	authRoutes.POST("/api/v1/accounts/deposit", readLimit, sessionOnly, accountHandler.AddDeposit)
+	authRoutes.GET("/api/v1/accounts/:currency", readLimit, read, accountHandler.GetAccountBalance)
+	authRoutes.GET("/api/v1/accounts/:currency/transactions", readLimit, read, accountHandler.ListTransactions)
+
+	// Withdrawal routes (protected): tiền bị giữ tới khi staff duyệt và xác nhận đã chuyển
+	// API key cần quyền withdraw và chỉ dùng được khi user chưa bật 2FA (step-up cần mã của người dùng)
+	authRoutes.POST("/api/v1/accounts/withdraw", authLimit, withdraw, verifiedWithdraw, stepUp, accountHandler.Withdraw)
+	authRoutes.GET("/api/v1/withdrawals", readLimit, read, accountHandler.ListWithdrawals)
+	authRoutes.POST("/api/v1/withdrawals/:id/cancel", readLimit, withdraw, accountHandler.CancelWithdrawal)
+
+	// Transfer routes (protected): tiền ra khỏi ví nên cùng điều kiện như tạo yêu cầu rút tiền
+	authRoutes.POST("/api/v1/transfers", authLimit, withdraw, verifiedWithdraw, stepUp, accountHandler.Transfer)
 
 	// Order routes (protected)
-	authRoutes.POST("/api/v1/orders", orderHandler.PlaceOrder)
-	authRoutes.GET("/api/v1/orders/open", orderHandler.ListOpenOrders)
-	authRoutes.POST("/api/v1/orders/cancel", orderHandler.CancelOrder)
+	authRoutes.POST("/api/v1/orders", orderLimit, trade, verified, orderHandler.PlaceOrder)
+	authRoutes.GET("/api/v1/orders/open", readLimit, read, orderHandler.ListOpenOrders)
+	authRoutes.POST("/api/v1/orders/cancel", orderLimit, trade, orderHandler.CancelOrder)
 
 	// Balance routes (protected)
-	authRoutes.GET("/api/v1/balance", balanceHandler.ListBalance)
+	authRoutes.GET("/api/v1/balance", readLimit, read, balanceHandler.ListBalance)
 
 	// Trade routes (protected)
-	authRoutes.GET("/api/v1/trades", tradeHandler.ListUserTrades)
+	authRoutes.GET("/api/v1/trades", readLimit, read, tradeHandler.ListUserTrades)
+
+	// Xuất dữ liệu cho kế toán/thuế (stream CSV hoặc NDJSON, ?from=&to=&format=)
+	authRoutes.GET("/api/v1/exports/transactions", readLimit, read, exportHandler.ExportTransactions)
+	authRoutes.GET("/api/v1/exports/orders", readLimit, read, exportHandler.ExportOrders)
+	authRoutes.GET("/api/v1/exports/trades", readLimit, read, exportHandler.ExportTrades)
 
 	// Tạm thời thử nghiệm: Route lấy thông tin User hiện tại
-	authRoutes.GET("/api/v1/users/me", func(ctx *gin.Context) {
+	authRoutes.GET("/api/v1/users/me", readLimit, read, func(ctx *gin.Context) {
 		// Lấy lại payload đã lưu ở bước middleware
 		payload := ctx.MustGet(authorizationPayloadKey).(*util.Payload)
 		ctx.JSON(http.StatusOK, gin.H{"message": "Hello " + payload.Username})
 	})
 
+	// --- NHÓM ADMIN ROUTES (X-Admin-Token hoặc session của nhân viên; quyền theo role) ---
+	// Mọi thao tác thay đổi (không phải GET) qua admin API đều được ghi audit log
+	adminRoutes := router.Group("/api/v1/admin").Use(adminMiddleware(cfg.Admin.APIToken, cfg.JWT.Secret, store), auditAdminActions(store, audit))
+	adminOnly := requireRole(util.RoleAdmin)
+	staff := requireRole(util.RoleSupport, util.RoleMarketOps, util.RoleAdmin)
+	marketOps := requireRole(util.RoleMarketOps, util.RoleAdmin)
+	support := requireRole(util.RoleSupport, util.RoleAdmin)
+
+	// Engine events: dead-letter và điều khiển event processor
+	adminRoutes.GET("/events/dead-letters", adminOnly, eventAdminHandler.ListDeadLetters)
+	adminRoutes.GET("/events/dead-letters/:id", adminOnly, eventAdminHandler.GetDeadLetter)
+	adminRoutes.POST("/events/dead-letters/:id/replay", adminOnly, eventAdminHandler.ReplayDeadLetter)
+	adminRoutes.POST("/events/dead-letters/:id/discard", adminOnly, eventAdminHandler.DiscardDeadLetter)
+	adminRoutes.POST("/events/resume", adminOnly, eventAdminHandler.ResumeEvents)
+	adminRoutes.GET("/reconcile", adminOnly, reconcileAdminHandler.GetLastReport)
+	adminRoutes.POST("/reconcile", adminOnly, reconcileAdminHandler.RunReconcile)
+
+	// Sổ cái: xem journal (support trở lên), kiểm tra/đặt lại số dư theo sổ cái (admin)
+	adminRoutes.GET("/ledger/journals", support, ledgerAdminHandler.ListJournals)
+	adminRoutes.GET("/ledger/check", adminOnly, ledgerAdminHandler.GetLastCheck)
+	adminRoutes.POST("/ledger/check", adminOnly, ledgerAdminHandler.RunCheck)
+
+	// Users: xem số dư/lệnh (support trở lên), đổi role và điều chỉnh số dư (admin)
+	adminRoutes.GET("/users/:username/balances", staff, adminHandler.GetUserBalances)
+	adminRoutes.GET("/users/:username/orders", staff, adminHandler.GetUserOrders)
+	adminRoutes.PUT("/users/:username/role", adminOnly, adminHandler.UpdateUserRole)
+	adminRoutes.POST("/users/:username/unlock", support, adminHandler.UnlockUser)
+	adminRoutes.POST("/ips/unlock", support, adminHandler.UnlockIP)
+	adminRoutes.POST("/users/:username/balance-adjustments", adminOnly, adminHandler.AdjustBalance)
+	adminRoutes.POST("/orders/cancel", staff, adminHandler.CancelOrder)
+
+	// Withdrawals: hàng đợi duyệt (support xem), duyệt/từ chối và xác nhận chuyển tiền (admin)
+	adminRoutes.GET("/withdrawals", support, adminHandler.ListWithdrawals)
+	adminRoutes.POST("/withdrawals/:id/approve", adminOnly, adminHandler.ApproveWithdrawal)
+	adminRoutes.POST("/withdrawals/:id/reject", adminOnly, adminHandler.RejectWithdrawal)
+	adminRoutes.POST("/withdrawals/:id/complete", adminOnly, adminHandler.CompleteWithdrawal)
+	adminRoutes.POST("/withdrawals/:id/fail", adminOnly, adminHandler.FailWithdrawal)
+
+	// Audit log: truy vết đăng nhập, nạp tiền, lệnh, API key và thao tác admin
+	adminRoutes.GET("/audit-logs", support, auditAdminHandler.ListAuditLogs)
+
+	// Symbols: symbol chứa '/' nên được gửi trong body thay vì path
+	adminRoutes.GET("/symbols/halts", staff, adminHandler.ListSymbolHalts)
+	adminRoutes.POST("/symbols/halt", marketOps, adminHandler.HaltSymbol)
+	adminRoutes.POST("/symbols/resume", marketOps, adminHandler.ResumeSymbol)
+
 	server.router = router
 	return server
 }
 
+// RegisterHealthCheck adds a component to the health endpoints
+func (server *Server) RegisterHealthCheck(name string, check HealthCheck) {
+	server.healthMu.Lock()
+	defer server.healthMu.Unlock()
+	server.healthChecks[name] = check
+}
+
+// health trả về trạng thái tổng hợp: "ok" nếu mọi thành phần healthy, ngược lại "degraded".
+// Luôn trả 200 để gateway vẫn nhận traffic khi một thành phần phụ (ví dụ Redis) bị lỗi.
+func (server *Server) health(ctx *gin.Context) {
+	server.healthMu.RLock()
+	defer server.healthMu.RUnlock()
+
+	status := "ok"
+	components := gin.H{}
+	for name, check := range server.healthChecks {
+		healthy, details := check()
+		if !healthy {
+			status = "degraded"
+		}
+		components[name] = details
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": status, "service": "gateway", "components": components})
+}
+
+// componentHealth trả về trạng thái một thành phần, 503 nếu không healthy
+func (server *Server) componentHealth(ctx *gin.Context) {
+	name := ctx.Param("component")
+
+	server.healthMu.RLock()
+	check, ok := server.healthChecks[name]
+	server.healthMu.RUnlock()
+	if !ok {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "unknown component: " + name})
+		return
+	}
+
+	healthy, details := check()
+	code := http.StatusOK
+	if !healthy {
+		code = http.StatusServiceUnavailable
+	}
+	ctx.JSON(code, gin.H{"healthy": healthy, "component": name, "details": details})
+}
+
 // Start runs the HTTP server on a specific address
 func (server *Server) Start(address string) error {
 	return server.router.Run(address)
 }
+
+// authenticateWebSocket xác thực access token gửi qua WebSocket, trả về user ID
+func (server *Server) authenticateWebSocket(ctx context.Context, token string) (string, error) {
+	payload, err := util.VerifyToken(token, server.config.JWT.Secret)
+	if err != nil {
+		return "", err
+	}
+	if err := checkSession(ctx, server.store, payload); err != nil {
+		return "", err
+	}
+
+	user, err := server.store.GetUserByUsername(ctx, payload.Username)
+	if err != nil {
+		return "", err
+	}
+	return user.ID, nil
+}
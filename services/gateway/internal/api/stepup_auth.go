@@ -0,0 +1,59 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/trading-platform/gateway/internal/api/handlers"
+	db "github.com/trading-platform/gateway/internal/database/sqlc"
+	"github.com/trading-platform/gateway/internal/util"
+)
+
+// requireStepUp yêu cầu mã 2FA mới (header X-2FA-Code) cho thao tác nhạy cảm nếu user đã bật TOTP.
+// API key không mang được mã của người dùng: user đã bật TOTP thì thao tác chỉ qua session đăng nhập,
+// chưa bật thì key có quyền của route (vd. withdraw) đi tiếp.
+func requireStepUp(store db.Store, verifier *handlers.StepUpVerifier) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		payload := ctx.MustGet(authorizationPayloadKey).(*util.Payload)
+		user, err := store.GetUserByUsername(ctx, payload.Username)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+			return
+		}
+		totp, err := store.GetUserTOTP(ctx, user.ID)
+		if err != nil {
+			if err.Error() == "totp not found" {
+				ctx.Next()
+				return
+			}
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if totp.EnabledAt == nil {
+			ctx.Next()
+			return
+		}
+		if _, ok := ctx.Get(authorizationAPIKeyKey); ok {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "two-factor authentication is enabled: this endpoint requires a user session, not an api key",
+			})
+			return
+		}
+
+		code := ctx.GetHeader(util.TwoFactorCodeHeader)
+		if code == "" {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error":               fmt.Sprintf("%s header is required for this action", util.TwoFactorCodeHeader),
+				"two_factor_required": true,
+			})
+			return
+		}
+		// Mã sai được đếm cùng bộ đếm đăng nhập sai của user
+		if !verifier.Verify(ctx, user, totp, code) {
+			ctx.Abort()
+			return
+		}
+		ctx.Next()
+	}
+}
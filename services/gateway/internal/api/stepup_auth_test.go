@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	db "github.com/trading-platform/gateway/internal/database/sqlc"
+	"github.com/trading-platform/gateway/internal/util"
+)
+
+// stepUpStore có một user, bật hoặc chưa bật TOTP
+type stepUpStore struct {
+	db.Store
+	user db.Users
+	totp *db.UserTOTP
+}
+
+func (s *stepUpStore) GetUserByUsername(ctx context.Context, username string) (db.Users, error) {
+	if username != s.user.Username {
+		return db.Users{}, fmt.Errorf("user not found")
+	}
+	return s.user, nil
+}
+
+func (s *stepUpStore) GetUserTOTP(ctx context.Context, userID string) (db.UserTOTP, error) {
+	if s.totp == nil || userID != s.user.ID {
+		return db.UserTOTP{}, fmt.Errorf("totp not found")
+	}
+	return *s.totp, nil
+}
+
+func TestRequireStepUpAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	user := db.Users{ID: "11111111-1111-1111-1111-111111111111", Username: "alice"}
+	enabledAt := time.Now()
+
+	tests := []struct {
+		name       string
+		totp       *db.UserTOTP
+		apiKey     bool
+		wantStatus int
+	}{
+		{"api key, no 2fa", nil, true, http.StatusOK},
+		{"api key, 2fa pending setup", &db.UserTOTP{UserID: user.ID}, true, http.StatusOK},
+		{"api key, 2fa enabled", &db.UserTOTP{UserID: user.ID, EnabledAt: &enabledAt}, true, http.StatusForbidden},
+		{"session, no 2fa", nil, false, http.StatusOK},
+		{"session, 2fa enabled, no code", &db.UserTOTP{UserID: user.ID, EnabledAt: &enabledAt}, false, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &stepUpStore{user: user, totp: tt.totp}
+			router := gin.New()
+			router.POST("/withdraw", func(ctx *gin.Context) {
+				ctx.Set(authorizationPayloadKey, &util.Payload{Username: user.Username})
+				if tt.apiKey {
+					ctx.Set(authorizationAPIKeyKey, &db.APIKey{Permissions: []string{"withdraw"}})
+				}
+			}, requireStepUp(store, nil), func(ctx *gin.Context) { ctx.Status(http.StatusOK) })
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/withdraw", nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d (body %s)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+}
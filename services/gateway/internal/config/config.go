@@ -1,8 +1,14 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"math/big"
+	"net"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -10,12 +16,27 @@ import (
 
 // Config holds all application configuration
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	Redis    RedisConfig
-	NATS     NATSConfig
-	JWT      JWTConfig
-	Log      LogConfig
+	Server     ServerConfig
+	Database   DatabaseConfig
+	Redis      RedisConfig
+	NATS       NATSConfig
+	Outbox     OutboxConfig
+	Events     EventsConfig
+	Trading    TradingConfig
+	Reconcile  ReconcileConfig
+	Ledger     LedgerConfig
+	Admin      AdminConfig
+	JWT        JWTConfig
+	APIKey     APIKeyConfig
+	TwoFactor  TwoFactorConfig
+	Login      LoginConfig
+	Audit      AuditConfig
+	RateLimit  RateLimitConfig
+	Withdrawal WithdrawalConfig
+	Mail       MailConfig
+	Log        LogConfig
+	WebSocket  WebSocketConfig
+	Market     MarketDataConfig
 }
 
 // ServerConfig holds server configuration
@@ -26,6 +47,7 @@ type ServerConfig struct {
 	WriteTimeout   time.Duration
 	MaxConnections int
 	Environment    string
+	TrustedProxies []string // IP/CIDR của reverse proxy được tin header X-Forwarded-For; rỗng = không tin ai
 }
 
 // DatabaseConfig holds database configuration
@@ -39,21 +61,136 @@ type DatabaseConfig struct {
 
 // RedisConfig holds Redis configuration
 type RedisConfig struct {
-	URL      string
-	Password string
-	DB       int
+	URL                 string
+	Password            string // Ghi đè password trong URL nếu được set
+	DB                  int    // Ghi đè DB trong URL nếu >= 0
+	HealthCheckInterval time.Duration
+	ReconnectMinBackoff time.Duration
+	ReconnectMaxBackoff time.Duration
 }
 
 // NATSConfig holds NATS configuration
 type NATSConfig struct {
-	URL string
+	URL               string
+	StreamMaxAge      time.Duration // Thời gian giữ command/event trong JetStream
+	DuplicateWindow   time.Duration // Cửa sổ chống publish trùng (Nats-Msg-Id)
+	StreamFileStorage bool          // Lưu stream xuống đĩa (mặc định) thay vì memory
+	AckWait           time.Duration // Thời gian chờ ack event trước khi redeliver
+	MaxDeliver        int           // Số lần deliver tối đa cho một event
+	MaxAckPending     int           // Số event tối đa đang xử lý chưa ack (giới hạn tổng các partition)
+	PublishTimeout    time.Duration // Thời gian chờ PubAck khi gửi command
+	OrderAckTimeout   time.Duration // Thời gian chờ engine xác nhận khi đặt lệnh đồng bộ
+}
+
+// OutboxConfig holds transactional outbox relay configuration
+type OutboxConfig struct {
+	PollInterval time.Duration // Chu kỳ quét command pending
+	BatchSize    int           // Số command tối đa publish mỗi lần quét
+}
+
+// EventsConfig holds engine event pipeline configuration
+type EventsConfig struct {
+	Workers   int // Số partition xử lý song song; event cùng symbol luôn vào cùng partition
+	QueueSize int // Số event chờ tối đa mỗi partition
+	BatchSize int // Số event tối đa ghi trong một transaction
+}
+
+// TradingConfig holds trading fee configuration (phí ghi vào sổ cái khi settle trade)
+type TradingConfig struct {
+	MakerFeeRate string // Tỉ lệ phí của maker, vd. "0.001" = 0.1%
+	TakerFeeRate string // Tỉ lệ phí của taker
+}
+
+// ReconcileConfig holds order book reconciliation configuration
+type ReconcileConfig struct {
+	Interval     time.Duration // Chu kỳ đối soát DB với sổ lệnh engine, 0 = chỉ chạy qua admin
+	MinAge       time.Duration // Order mới hơn chưa được đối soát (command có thể đang trên đường tới engine)
+	AutoFix      bool          // Lần chạy định kỳ tự sửa sai lệch (mặc định chỉ báo cáo)
+	OrphanAction string        // Order mở trong DB mà engine không có: "resubmit" hoặc "cancel"
+}
+
+// LedgerConfig holds double-entry ledger consistency check configuration
+type LedgerConfig struct {
+	CheckInterval time.Duration // Chu kỳ kiểm tra sổ cái với số dư, 0 = chỉ chạy qua admin
+	AutoFix       bool          // Lần chạy định kỳ đặt lại số dư bị lệch theo sổ cái (mặc định chỉ báo cáo)
+}
+
+// AdminConfig holds configuration for the operator endpoints under /api/v1/admin
+type AdminConfig struct {
+	APIToken string // Token gửi qua header X-Admin-Token; rỗng = chỉ nhân viên đăng nhập mới gọi được admin API
 }
 
 // JWTConfig holds JWT configuration
 type JWTConfig struct {
 	Secret        string
-	Expiry        time.Duration
-	RefreshExpiry time.Duration
+	Expiry        time.Duration // Thời hạn access token
+	RefreshExpiry time.Duration // Thời hạn session (refresh token), tính từ lúc đăng nhập
+}
+
+// APIKeyConfig holds API key (HMAC request signing) configuration
+type APIKeyConfig struct {
+	EncryptionKey string        // 32 byte dạng hex, mã hóa secret của API key trong DB; rỗng = suy ra từ JWT_SECRET
+	ReplayWindow  time.Duration // Độ lệch tối đa giữa X-API-TIMESTAMP và giờ server
+}
+
+// TwoFactorConfig holds TOTP two-factor authentication configuration
+type TwoFactorConfig struct {
+	Issuer        string        // Tên hiển thị trong app authenticator
+	PreAuthExpiry time.Duration // Thời hạn pre-auth token giữa bước mật khẩu và bước nhập mã
+}
+
+// LoginConfig holds login brute-force protection configuration
+type LoginConfig struct {
+	MaxFailures     int           // Số lần sai liên tiếp của một username trước khi bị khóa tạm
+	IPMaxFailures   int           // Số lần sai từ một IP (mọi username) trước khi IP bị khóa tạm
+	LockoutDuration time.Duration // Thời gian khóa
+	FailureWindow   time.Duration // Lần sai cũ hơn khoảng này không còn được đếm
+	DelayBase       time.Duration // Chờ sau lần sai đầu tiên; nhân đôi sau mỗi lần sai tiếp theo
+	DelayMax        time.Duration
+}
+
+// AuditConfig holds audit log writer configuration
+type AuditConfig struct {
+	QueueSize     int           // Số entry chờ ghi tối đa; đầy thì request tự ghi đồng bộ
+	BatchSize     int           // Số entry tối đa ghi trong một câu INSERT
+	FlushInterval time.Duration // Thời gian tối đa một entry nằm trong hàng đợi trước khi được ghi
+}
+
+// RateLimitConfig holds REST API rate limiting configuration
+type RateLimitConfig struct {
+	Enabled     bool
+	Backend     string        // "memory" (mỗi gateway đếm riêng) hoặc "redis" (chia chung giữa các gateway)
+	RedisPrefix string        // Prefix key bucket trong Redis
+	Auth        RateLimitRule // Đăng ký, đăng nhập, quên mật khẩu... (theo IP)
+	Order       RateLimitRule // Đặt/hủy lệnh (theo API key hoặc user)
+	Read        RateLimitRule // Các API còn lại (theo API key, user hoặc IP)
+}
+
+// RateLimitRule is a token bucket: PerMinute request mỗi phút, dồn tối đa Burst request
+type RateLimitRule struct {
+	PerMinute int
+	Burst     int
+}
+
+// WithdrawalConfig holds withdrawal limits (min/max mỗi lần và phí nằm trong bảng currencies)
+type WithdrawalConfig struct {
+	DailyLimits map[string]string // Tổng số tiền rút tối đa mỗi user trong 24 giờ theo currency; không có = không giới hạn
+}
+
+// MailConfig holds outgoing email and account verification configuration
+type MailConfig struct {
+	Driver           string // "log" (mặc định), "file" hoặc "smtp"
+	From             string
+	SMTPHost         string
+	SMTPPort         int
+	SMTPUsername     string
+	SMTPPassword     string
+	FileDir          string        // Thư mục ghi file .eml khi Driver = "file"
+	VerifyURL        string        // Link trong email xác minh, token được nối vào query "token"
+	ResetPasswordURL string        // Trang đặt lại mật khẩu của frontend, token được nối vào query "token"
+	VerifyExpiry     time.Duration // Thời hạn token xác minh email
+	ResetExpiry      time.Duration // Thời hạn token đặt lại mật khẩu
+	RequireVerified  bool          // true = chưa xác minh email thì không được đặt lệnh
 }
 
 // LogConfig holds logging configuration
@@ -62,6 +199,23 @@ type LogConfig struct {
 	Format string
 }
 
+// WebSocketConfig holds WebSocket hub configuration
+type WebSocketConfig struct {
+	SendBufferSize     int           // Số message tối đa chờ gửi cho mỗi client
+	SlowConsumerPolicy string        // "drop" hoặc "disconnect"
+	WriteWait          time.Duration // Thời gian tối đa cho một lần ghi
+	PongWait           time.Duration // Read deadline, được gia hạn mỗi khi nhận pong
+	PingInterval       time.Duration // Chu kỳ gửi ping (phải nhỏ hơn PongWait)
+	MaxMessageSize     int64         // Kích thước tối đa message client gửi lên
+}
+
+// MarketDataConfig holds market data feed configuration
+type MarketDataConfig struct {
+	DepthHistorySize      int           // Số snapshot gần nhất được giữ lại cho mỗi symbol (để resync theo seq)
+	SubscribeMode         string        // "pattern" (ob_update:*) hoặc "symbols" (theo trading_pairs)
+	SymbolRefreshInterval time.Duration // Chu kỳ đọc lại trading_pairs ở mode "symbols"
+}
+
 // Load loads configuration from environment variables
 func Load() (*Config, error) {
 	// Load .env file if exists
@@ -75,6 +229,7 @@ func Load() (*Config, error) {
 			WriteTimeout:   time.Second * 15,
 			MaxConnections: 10000,
 			Environment:    getEnv("ENV", "development"),
+			TrustedProxies: getEnvList("TRUSTED_PROXIES", ""),
 		},
 		Database: DatabaseConfig{
 			URL:             getEnv("DATABASE_URL", ""),
@@ -84,22 +239,127 @@ func Load() (*Config, error) {
 			ConnMaxLifetime: time.Minute * 5,
 		},
 		Redis: RedisConfig{
-			URL:      getEnv("REDIS_URL", "redis://localhost:6379/0"),
-			Password: getEnv("REDIS_PASSWORD", ""),
-			DB:       0,
+			URL:                 getEnv("REDIS_URL", "redis://localhost:6379/0"),
+			Password:            getEnv("REDIS_PASSWORD", ""),
+			DB:                  getEnvInt("REDIS_DB", -1),
+			HealthCheckInterval: getEnvDuration("REDIS_HEALTH_CHECK_INTERVAL", 15*time.Second),
+			ReconnectMinBackoff: getEnvDuration("REDIS_RECONNECT_MIN_BACKOFF", 500*time.Millisecond),
+			ReconnectMaxBackoff: getEnvDuration("REDIS_RECONNECT_MAX_BACKOFF", 30*time.Second),
 		},
 		NATS: NATSConfig{
-			URL: getEnv("NATS_URL", "nats://localhost:4222"),
+			URL:               getEnv("NATS_URL", "nats://localhost:4222"),
+			StreamMaxAge:      getEnvDuration("NATS_STREAM_MAX_AGE", 72*time.Hour),
+			DuplicateWindow:   getEnvDuration("NATS_DUPLICATE_WINDOW", 2*time.Minute),
+			StreamFileStorage: getEnv("NATS_STREAM_STORAGE", "file") == "file",
+			AckWait:           getEnvDuration("NATS_ACK_WAIT", 30*time.Second),
+			MaxDeliver:        getEnvInt("NATS_MAX_DELIVER", 10),
+			MaxAckPending:     getEnvInt("NATS_MAX_ACK_PENDING", 1024),
+			PublishTimeout:    getEnvDuration("NATS_PUBLISH_TIMEOUT", 5*time.Second),
+			OrderAckTimeout:   getEnvDuration("ORDER_ACK_TIMEOUT", 3*time.Second),
+		},
+		Outbox: OutboxConfig{
+			PollInterval: getEnvDuration("OUTBOX_POLL_INTERVAL", time.Second),
+			BatchSize:    getEnvInt("OUTBOX_BATCH_SIZE", 100),
+		},
+		Events: EventsConfig{
+			Workers:   getEnvInt("EVENT_WORKERS", 8),
+			QueueSize: getEnvInt("EVENT_QUEUE_SIZE", 256),
+			BatchSize: getEnvInt("EVENT_BATCH_SIZE", 100),
+		},
+		Trading: TradingConfig{
+			MakerFeeRate: getEnv("TRADING_MAKER_FEE_RATE", "0.001"),
+			TakerFeeRate: getEnv("TRADING_TAKER_FEE_RATE", "0.002"),
+		},
+		Reconcile: ReconcileConfig{
+			Interval:     getEnvDuration("RECONCILE_INTERVAL", 5*time.Minute),
+			MinAge:       getEnvDuration("RECONCILE_MIN_AGE", time.Minute),
+			AutoFix:      getEnv("RECONCILE_AUTO_FIX", "false") == "true",
+			OrphanAction: getEnv("RECONCILE_ORPHAN_ACTION", "resubmit"),
+		},
+		Ledger: LedgerConfig{
+			CheckInterval: getEnvDuration("LEDGER_CHECK_INTERVAL", 10*time.Minute),
+			AutoFix:       getEnv("LEDGER_AUTO_FIX", "false") == "true",
+		},
+		Admin: AdminConfig{
+			APIToken: getEnv("ADMIN_API_TOKEN", ""),
+		},
+		APIKey: APIKeyConfig{
+			EncryptionKey: getEnv("API_KEY_ENCRYPTION_KEY", ""),
+			ReplayWindow:  getEnvDuration("API_KEY_REPLAY_WINDOW", 30*time.Second),
+		},
+		TwoFactor: TwoFactorConfig{
+			Issuer:        getEnv("TOTP_ISSUER", "Trading Platform"),
+			PreAuthExpiry: getEnvDuration("TOTP_PRE_AUTH_EXPIRY", 5*time.Minute),
+		},
+		Login: LoginConfig{
+			MaxFailures:     getEnvInt("LOGIN_MAX_FAILURES", 5),
+			IPMaxFailures:   getEnvInt("LOGIN_IP_MAX_FAILURES", 20),
+			LockoutDuration: getEnvDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+			FailureWindow:   getEnvDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+			DelayBase:       getEnvDuration("LOGIN_DELAY_BASE", time.Second),
+			DelayMax:        getEnvDuration("LOGIN_DELAY_MAX", 30*time.Second),
+		},
+		RateLimit: RateLimitConfig{
+			Enabled:     getEnv("RATE_LIMIT_ENABLED", "true") == "true",
+			Backend:     getEnv("RATE_LIMIT_BACKEND", "memory"),
+			RedisPrefix: getEnv("RATE_LIMIT_REDIS_PREFIX", "ratelimit:"),
+			Auth: RateLimitRule{
+				PerMinute: getEnvInt("RATE_LIMIT_AUTH_PER_MINUTE", 20),
+				Burst:     getEnvInt("RATE_LIMIT_AUTH_BURST", 10),
+			},
+			Order: RateLimitRule{
+				PerMinute: getEnvInt("RATE_LIMIT_ORDER_PER_MINUTE", 600),
+				Burst:     getEnvInt("RATE_LIMIT_ORDER_BURST", 50),
+			},
+			Read: RateLimitRule{
+				PerMinute: getEnvInt("RATE_LIMIT_READ_PER_MINUTE", 1200),
+				Burst:     getEnvInt("RATE_LIMIT_READ_BURST", 100),
+			},
+		},
+		Audit: AuditConfig{
+			QueueSize:     getEnvInt("AUDIT_QUEUE_SIZE", 10000),
+			BatchSize:     getEnvInt("AUDIT_BATCH_SIZE", 200),
+			FlushInterval: getEnvDuration("AUDIT_FLUSH_INTERVAL", time.Second),
+		},
+		Withdrawal: WithdrawalConfig{
+			DailyLimits: getEnvMap("WITHDRAWAL_DAILY_LIMITS", "USD=50000,USDT=50000,BTC=2,ETH=30"),
+		},
+		Mail: MailConfig{
+			Driver:           getEnv("MAIL_DRIVER", "log"),
+			From:             getEnv("MAIL_FROM", "Trading Platform <no-reply@localhost>"),
+			SMTPHost:         getEnv("SMTP_HOST", "localhost"),
+			SMTPPort:         getEnvInt("SMTP_PORT", 587),
+			SMTPUsername:     getEnv("SMTP_USERNAME", ""),
+			SMTPPassword:     getEnv("SMTP_PASSWORD", ""),
+			FileDir:          getEnv("MAIL_FILE_DIR", "./tmp/mail"),
+			VerifyURL:        getEnv("MAIL_VERIFY_URL", "http://localhost:8080/api/v1/auth/verify"),
+			ResetPasswordURL: getEnv("MAIL_RESET_PASSWORD_URL", "http://localhost:3000/reset-password"),
+			VerifyExpiry:     getEnvDuration("EMAIL_VERIFY_TOKEN_EXPIRY", 48*time.Hour),
+			ResetExpiry:      getEnvDuration("PASSWORD_RESET_TOKEN_EXPIRY", time.Hour),
+			RequireVerified:  getEnv("REQUIRE_VERIFIED_EMAIL_FOR_TRADING", "false") == "true",
 		},
 		JWT: JWTConfig{
 			Secret:        getEnv("JWT_SECRET", "your-secret-key"),
-			Expiry:        time.Hour * 24,
-			RefreshExpiry: time.Hour * 24 * 7,
+			Expiry:        getEnvDuration("JWT_ACCESS_TOKEN_EXPIRY", 15*time.Minute),
+			RefreshExpiry: getEnvDuration("JWT_REFRESH_TOKEN_EXPIRY", 7*24*time.Hour),
 		},
 		Log: LogConfig{
 			Level:  getEnv("LOG_LEVEL", "info"),
 			Format: getEnv("LOG_FORMAT", "json"),
 		},
+		WebSocket: WebSocketConfig{
+			SendBufferSize:     getEnvInt("WS_SEND_BUFFER_SIZE", 256),
+			SlowConsumerPolicy: getEnv("WS_SLOW_CONSUMER_POLICY", "drop"),
+			WriteWait:          getEnvDuration("WS_WRITE_WAIT", 10*time.Second),
+			PongWait:           getEnvDuration("WS_PONG_WAIT", 60*time.Second),
+			PingInterval:       getEnvDuration("WS_PING_INTERVAL", 54*time.Second),
+			MaxMessageSize:     int64(getEnvInt("WS_MAX_MESSAGE_SIZE", 4096)),
+		},
+		Market: MarketDataConfig{
+			DepthHistorySize:      getEnvInt("DEPTH_HISTORY_SIZE", 1000),
+			SubscribeMode:         getEnv("OB_SUBSCRIBE_MODE", "pattern"),
+			SymbolRefreshInterval: getEnvDuration("OB_SYMBOL_REFRESH_INTERVAL", 30*time.Second),
+		},
 	}, nil
 }
 
@@ -111,9 +371,78 @@ func (c *Config) Validate() error {
 	if c.JWT.Secret == "" || c.JWT.Secret == "your-secret-key" {
 		return fmt.Errorf("JWT_SECRET must be set and not default value")
 	}
+	if c.WebSocket.SlowConsumerPolicy != "drop" && c.WebSocket.SlowConsumerPolicy != "disconnect" {
+		return fmt.Errorf("WS_SLOW_CONSUMER_POLICY must be 'drop' or 'disconnect'")
+	}
+	if c.Market.SubscribeMode != "pattern" && c.Market.SubscribeMode != "symbols" {
+		return fmt.Errorf("OB_SUBSCRIBE_MODE must be 'pattern' or 'symbols'")
+	}
+	if c.Events.Workers < 1 || c.Events.QueueSize < 1 || c.Events.BatchSize < 1 {
+		return fmt.Errorf("EVENT_WORKERS, EVENT_QUEUE_SIZE and EVENT_BATCH_SIZE must be positive")
+	}
+	if c.Reconcile.OrphanAction != "resubmit" && c.Reconcile.OrphanAction != "cancel" {
+		return fmt.Errorf("RECONCILE_ORPHAN_ACTION must be 'resubmit' or 'cancel'")
+	}
+	if _, err := c.APIKeyEncryptionKey(); err != nil {
+		return err
+	}
+	if c.APIKey.ReplayWindow <= 0 {
+		return fmt.Errorf("API_KEY_REPLAY_WINDOW must be positive")
+	}
+	if c.Mail.Driver != "log" && c.Mail.Driver != "file" && c.Mail.Driver != "smtp" {
+		return fmt.Errorf("MAIL_DRIVER must be 'log', 'file' or 'smtp'")
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				return fmt.Errorf("TRUSTED_PROXIES: %q is not an IP or CIDR", proxy)
+			}
+		}
+	}
+	if c.Login.MaxFailures < 1 || c.Login.IPMaxFailures < 1 {
+		return fmt.Errorf("LOGIN_MAX_FAILURES and LOGIN_IP_MAX_FAILURES must be positive")
+	}
+	if c.RateLimit.Backend != "memory" && c.RateLimit.Backend != "redis" {
+		return fmt.Errorf("RATE_LIMIT_BACKEND must be 'memory' or 'redis'")
+	}
+	for name, rule := range map[string]RateLimitRule{"AUTH": c.RateLimit.Auth, "ORDER": c.RateLimit.Order, "READ": c.RateLimit.Read} {
+		if rule.PerMinute < 1 || rule.Burst < 1 {
+			return fmt.Errorf("RATE_LIMIT_%s_PER_MINUTE and RATE_LIMIT_%s_BURST must be positive", name, name)
+		}
+	}
+	if c.Audit.QueueSize < 1 || c.Audit.BatchSize < 1 || c.Audit.FlushInterval <= 0 {
+		return fmt.Errorf("AUDIT_QUEUE_SIZE, AUDIT_BATCH_SIZE and AUDIT_FLUSH_INTERVAL must be positive")
+	}
+	for name, rate := range map[string]string{"MAKER": c.Trading.MakerFeeRate, "TAKER": c.Trading.TakerFeeRate} {
+		if r, ok := new(big.Rat).SetString(rate); !ok || r.Sign() < 0 || r.Cmp(big.NewRat(1, 1)) >= 0 {
+			return fmt.Errorf("TRADING_%s_FEE_RATE must be a number in [0, 1)", name)
+		}
+	}
+	for currency, limit := range c.Withdrawal.DailyLimits {
+		if amount, ok := new(big.Rat).SetString(limit); !ok || amount.Sign() <= 0 {
+			return fmt.Errorf("WITHDRAWAL_DAILY_LIMITS: limit of %s must be a positive number", currency)
+		}
+	}
+	if c.WebSocket.PingInterval >= c.WebSocket.PongWait {
+		return fmt.Errorf("WS_PING_INTERVAL must be shorter than WS_PONG_WAIT")
+	}
 	return nil
 }
 
+// APIKeyEncryptionKey trả về khóa AES-256 mã hóa secret của API key và secret TOTP.
+// Không cấu hình thì suy ra từ JWT_SECRET (đổi JWT_SECRET sẽ làm mọi API key và TOTP đã đăng ký hết dùng được).
+func (c *Config) APIKeyEncryptionKey() ([]byte, error) {
+	if c.APIKey.EncryptionKey == "" {
+		sum := sha256.Sum256([]byte("api-key-encryption:" + c.JWT.Secret))
+		return sum[:], nil
+	}
+	key, err := hex.DecodeString(c.APIKey.EncryptionKey)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("API_KEY_ENCRYPTION_KEY must be 32 bytes hex-encoded (64 characters)")
+	}
+	return key, nil
+}
+
 // getEnv gets an environment variable or returns a default value
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -121,3 +450,47 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvInt gets an integer environment variable or returns a default value
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+// getEnvDuration gets a duration environment variable (e.g. "30s") or returns a default value
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil {
+			return parsed
+		}
+	}
+	return defaultValue
+}
+
+// getEnvList gets a comma-separated environment variable as a list (bỏ phần tử rỗng)
+func getEnvList(key, defaultValue string) []string {
+	result := []string{}
+	for _, item := range strings.Split(getEnv(key, defaultValue), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// getEnvMap gets a "KEY=value,KEY=value" environment variable as a map or parses the default value
+func getEnvMap(key, defaultValue string) map[string]string {
+	result := map[string]string{}
+	for _, pair := range strings.Split(getEnv(key, defaultValue), ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(pair, "=")
+		result[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return result
+}
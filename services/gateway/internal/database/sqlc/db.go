@@ -2,8 +2,13 @@ package db
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
@@ -22,30 +27,113 @@ type Querier interface {
 	// User methods
 	GetUserByUsername(ctx context.Context, username string) (Users, error)
 	GetUserByID(ctx context.Context, id int64) (Users, error)
+	GetUserByUUID(ctx context.Context, id string) (Users, error)
+	UpdateUserRole(ctx context.Context, id, role string) (Users, error)
+	MarkUserVerified(ctx context.Context, id string) (bool, error)
+	UpdateUserPassword(ctx context.Context, id, passwordHash string) error
 	GetUserByEmail(ctx context.Context, email string) (Users, error)
 	CreateUser(ctx context.Context, arg CreateUserParams) (Users, error)
 
+	// Session methods
+	CreateSession(ctx context.Context, arg CreateSessionParams) (Session, error)
+	GetSession(ctx context.Context, id string) (Session, error)
+	ListActiveSessions(ctx context.Context, userID string) ([]Session, error)
+	RotateSession(ctx context.Context, arg RotateSessionParams) (Session, error)
+	RevokeSession(ctx context.Context, id, userID string) (bool, error)
+	RevokeUserSessions(ctx context.Context, userID, exceptID string) (int64, error)
+
+	// API key methods
+	CreateAPIKey(ctx context.Context, arg CreateAPIKeyParams) (APIKey, error)
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (APIKey, error)
+	ListAPIKeys(ctx context.Context, userID string) ([]APIKey, error)
+	RevokeAPIKey(ctx context.Context, id, userID string) (bool, error)
+	TouchAPIKey(ctx context.Context, id string) error
+
+	// Two-factor methods
+	UpsertPendingTOTP(ctx context.Context, userID, secretCiphertext string) (UserTOTP, error)
+	GetUserTOTP(ctx context.Context, userID string) (UserTOTP, error)
+	UseTOTPStep(ctx context.Context, userID string, step int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error)
+	CountRecoveryCodes(ctx context.Context, userID string) (int64, error)
+
+	// Login throttling methods
+	GetLoginFailure(ctx context.Context, keyType, key string) (LoginFailure, error)
+	RecordLoginFailure(ctx context.Context, arg RecordLoginFailureParams) (LoginFailure, error)
+	ClearLoginFailures(ctx context.Context, keyType, key string) (bool, error)
+
+	// Audit log methods
+	CreateAuditLogs(ctx context.Context, args []CreateAuditLogParams) (int64, error)
+	ListAuditLogs(ctx context.Context, arg ListAuditLogsParams) ([]AuditLog, error)
+
 	// Account methods
 	GetAccountsByUserID(ctx context.Context, userID int32) ([]Accounts, error)
 	GetAccountByUserAndType(ctx context.Context, arg GetAccountByUserAndTypeParams) (Accounts, error)
 	CreateAccount(ctx context.Context, arg CreateAccountParams) (Accounts, error)
-	UpdateAccountBalance(ctx context.Context, arg UpdateAccountBalanceParams) (Accounts, error)
 
 	// Transaction methods
 	CreateDeposit(ctx context.Context, arg CreateDepositParams) (Transactions, error)
-	GetTransactionsByAccountID(ctx context.Context, accountID int64) ([]Transactions, error)
+	GetTransactionsByAccountID(ctx context.Context, arg GetTransactionsByAccountIDParams) ([]Transactions, error)
+	CreateTransaction(ctx context.Context, arg CreateTransactionParams) (Transactions, error)
+
+	// Withdrawal methods
+	GetCurrency(ctx context.Context, code string) (Currency, error)
+	GetWithdrawal(ctx context.Context, id string) (Withdrawal, error)
+	ListWithdrawals(ctx context.Context, arg ListWithdrawalsParams) ([]Withdrawal, error)
+
+	// Ledger methods (ghi sổ cái qua các *Tx trong Store)
+	ListLedgerJournals(ctx context.Context, arg ListLedgerJournalsParams) ([]LedgerJournal, error)
+	ListLedgerBalanceMismatches(ctx context.Context) ([]LedgerBalanceMismatch, error)
+	ListLedgerImbalances(ctx context.Context) ([]LedgerImbalance, error)
 
 	// Order methods
 	CreateOrder(ctx context.Context, arg CreateOrderParams) (Orders, error)
 	UpdateOrderStatus(ctx context.Context, arg UpdateOrderStatusParams) (Orders, error)
 	ListPendingOrders(ctx context.Context, userID int64) ([]Orders, error)
+	RejectOrder(ctx context.Context, arg RejectOrderParams) (RejectedOrder, error)
+	GetRejectedOrder(ctx context.Context, engineOrderID int64) (RejectedOrder, error)
+	ReleaseEngineOrder(ctx context.Context, id int64, status string) (bool, error)
+	ListReconcileOrders(ctx context.Context, createdBefore time.Time) ([]ReconcileOrder, error)
+	ListOrdersByEngineIDs(ctx context.Context, engineOrderIDs []int64) ([]ReconcileOrder, error)
+	ListStaleEngineHolds(ctx context.Context) ([]StaleEngineHold, error)
+	CloseOrder(ctx context.Context, arg CloseOrderParams) (bool, error)
+	MarkOrderPartiallyFilled(ctx context.Context, id string) error
+	GetOrderByUUID(ctx context.Context, id string) (ReconcileOrder, error)
+	GetOrderByEngineID(ctx context.Context, engineOrderID int64) (ReconcileOrder, error)
 
 	// Balance methods
 	GetLockedAmountByUserAndCurrency(ctx context.Context, arg GetLockedAmountParams) (string, error)
 
 	// Trade methods
 	CreateTrade(ctx context.Context, arg CreateTradeParams) (Trades, error)
+	CreateTrades(ctx context.Context, args []CreateTradeParams) (int64, error)
 	ListUserTrades(ctx context.Context, userID int64) ([]ListUserTradesRow, error)
+
+	// Trading pair methods
+	ListActiveSymbols(ctx context.Context) ([]string, error)
+	CreateSymbolHalt(ctx context.Context, arg CreateSymbolHaltParams) (SymbolHalt, error)
+	DeleteSymbolHalt(ctx context.Context, symbol string) (bool, error)
+	GetSymbolHalt(ctx context.Context, symbol string) (SymbolHalt, error)
+	ListSymbolHalts(ctx context.Context) ([]SymbolHalt, error)
+
+	// Outbox methods
+	CreateOutboxMessage(ctx context.Context, arg CreateOutboxMessageParams) (OutboxMessage, error)
+	GetOutboxMessageByMsgID(ctx context.Context, msgID string) (OutboxMessage, error)
+	ListPendingOutboxMessages(ctx context.Context, limit int32) ([]OutboxMessage, error)
+	MarkOutboxMessageSent(ctx context.Context, id int64) error
+	MarkOutboxMessageFailed(ctx context.Context, arg MarkOutboxMessageFailedParams) error
+	CountPendingOutboxMessages(ctx context.Context) (int64, error)
+
+	// Event processing methods
+	MarkEventsProcessed(ctx context.Context, args []MarkEventProcessedParams) (map[string]bool, error)
+	GetEventSequence(ctx context.Context, source string) (EventSequence, error)
+	UpsertEventSequence(ctx context.Context, arg UpsertEventSequenceParams) error
+
+	// Dead-letter methods
+	CreateDeadLetterEvent(ctx context.Context, arg CreateDeadLetterEventParams) (DeadLetterEvent, error)
+	GetDeadLetterEvent(ctx context.Context, id int64) (DeadLetterEvent, error)
+	ListDeadLetterEvents(ctx context.Context, arg ListDeadLetterEventsParams) ([]DeadLetterEvent, error)
+	RecordDeadLetterFailure(ctx context.Context, arg RecordDeadLetterFailureParams) error
+	UpdateDeadLetterEventStatus(ctx context.Context, id int64, status string) (DeadLetterEvent, error)
 }
 
 // Queries provides methods to interact with the database
@@ -61,7 +149,7 @@ func New(db DBTX) *Queries {
 // --- User Queries Implementation ---
 
 func (q *Queries) GetUserByUsername(ctx context.Context, username string) (Users, error) {
-	query := `SELECT id, username, email, password_hash, created_at, updated_at 
+	query := `SELECT id, username, email, password_hash, role, COALESCE(is_verified, FALSE), created_at, updated_at 
               FROM users WHERE username = $1`
 
 	row := q.db.QueryRow(ctx, query, username)
@@ -71,6 +159,8 @@ func (q *Queries) GetUserByUsername(ctx context.Context, username string) (Users
 		&user.Username,
 		&user.Email,
 		&user.PasswordHash,
+		&user.Role,
+		&user.IsVerified,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -84,7 +174,7 @@ func (q *Queries) GetUserByUsername(ctx context.Context, username string) (Users
 }
 
 func (q *Queries) GetUserByEmail(ctx context.Context, email string) (Users, error) {
-	query := `SELECT id, username, email, password_hash, created_at, updated_at 
+	query := `SELECT id, username, email, password_hash, role, COALESCE(is_verified, FALSE), created_at, updated_at 
               FROM users WHERE email = $1`
 
 	row := q.db.QueryRow(ctx, query, email)
@@ -94,6 +184,8 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (Users, erro
 		&user.Username,
 		&user.Email,
 		&user.PasswordHash,
+		&user.Role,
+		&user.IsVerified,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -107,7 +199,7 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (Users, erro
 }
 
 func (q *Queries) GetUserByID(ctx context.Context, id int64) (Users, error) {
-	query := `SELECT id, username, email, password_hash, created_at, updated_at 
+	query := `SELECT id, username, email, password_hash, role, COALESCE(is_verified, FALSE), created_at, updated_at 
               FROM users WHERE id = $1`
 
 	row := q.db.QueryRow(ctx, query, id)
@@ -117,6 +209,33 @@ func (q *Queries) GetUserByID(ctx context.Context, id int64) (Users, error) {
 		&user.Username,
 		&user.Email,
 		&user.PasswordHash,
+		&user.Role,
+		&user.IsVerified,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Users{}, fmt.Errorf("user not found")
+		}
+		return Users{}, err
+	}
+	return user, nil
+}
+
+func (q *Queries) GetUserByUUID(ctx context.Context, id string) (Users, error) {
+	query := `SELECT id, username, email, password_hash, role, COALESCE(is_verified, FALSE), created_at, updated_at 
+              FROM users WHERE id = $1::uuid`
+
+	row := q.db.QueryRow(ctx, query, id)
+	var user Users
+	err := row.Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.PasswordHash,
+		&user.Role,
+		&user.IsVerified,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -132,7 +251,7 @@ func (q *Queries) GetUserByID(ctx context.Context, id int64) (Users, error) {
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (Users, error) {
 	query := `INSERT INTO users (username, email, password_hash, created_at, updated_at) 
               VALUES ($1, $2, $3, $4, $5) 
-              RETURNING id, username, email, password_hash, created_at, updated_at`
+              RETURNING id, username, email, password_hash, role, COALESCE(is_verified, FALSE), created_at, updated_at`
 
 	now := time.Now()
 	row := q.db.QueryRow(ctx, query, arg.Username, arg.Email, arg.PasswordHash, now, now)
@@ -142,17 +261,508 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (Users,
 		&user.Username,
 		&user.Email,
 		&user.PasswordHash,
+		&user.Role,
+		&user.IsVerified,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
 	return user, err
 }
 
+// MarkUserVerified đánh dấu email của user đã xác minh; false nếu đã xác minh từ trước
+func (q *Queries) MarkUserVerified(ctx context.Context, id string) (bool, error) {
+	query := `UPDATE users SET is_verified = TRUE, updated_at = NOW()
+              WHERE id = $1::uuid AND is_verified IS NOT TRUE`
+
+	tag, err := q.db.Exec(ctx, query, id)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// UpdateUserPassword đổi password hash của user
+func (q *Queries) UpdateUserPassword(ctx context.Context, id, passwordHash string) error {
+	query := `UPDATE users SET password_hash = $2, updated_at = NOW() WHERE id = $1::uuid`
+
+	tag, err := q.db.Exec(ctx, query, id, passwordHash)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("user not found")
+	}
+	return nil
+}
+
+// UpdateUserRole đổi role của user
+func (q *Queries) UpdateUserRole(ctx context.Context, id, role string) (Users, error) {
+	query := `UPDATE users SET role = $2, updated_at = NOW()
+              WHERE id = $1::uuid
+              RETURNING id, username, email, password_hash, role, COALESCE(is_verified, FALSE), created_at, updated_at`
+
+	row := q.db.QueryRow(ctx, query, id, role)
+	var user Users
+	err := row.Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.PasswordHash,
+		&user.Role,
+		&user.IsVerified,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Users{}, fmt.Errorf("user not found")
+		}
+		return Users{}, err
+	}
+	return user, nil
+}
+
+// --- Session Queries Implementation ---
+
+const sessionColumns = `id::text, user_id::text, token_hash, COALESCE(refresh_token_hash, ''), previous_refresh_token_hash,
+              ip_address, user_agent, expires_at, created_at, last_activity, revoked_at`
+
+func scanSession(row pgx.Row) (Session, error) {
+	var session Session
+	err := row.Scan(
+		&session.ID,
+		&session.UserID,
+		&session.TokenHash,
+		&session.RefreshTokenHash,
+		&session.PreviousRefreshTokenHash,
+		&session.IPAddress,
+		&session.UserAgent,
+		&session.ExpiresAt,
+		&session.CreatedAt,
+		&session.LastActivity,
+		&session.RevokedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Session{}, fmt.Errorf("session not found")
+		}
+		return Session{}, err
+	}
+	return session, nil
+}
+
+func (q *Queries) CreateSession(ctx context.Context, arg CreateSessionParams) (Session, error) {
+	query := `INSERT INTO sessions (id, user_id, token_hash, refresh_token_hash, ip_address, user_agent, expires_at)
+              VALUES ($1::uuid, $2::uuid, $3, $4, NULLIF($5, ''), NULLIF($6, ''), $7)
+              RETURNING ` + sessionColumns
+
+	return scanSession(q.db.QueryRow(ctx, query,
+		arg.ID, arg.UserID, arg.TokenHash, arg.RefreshTokenHash, arg.IPAddress, arg.UserAgent, arg.ExpiresAt))
+}
+
+func (q *Queries) GetSession(ctx context.Context, id string) (Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE id = $1::uuid`
+
+	return scanSession(q.db.QueryRow(ctx, query, id))
+}
+
+// ListActiveSessions lists a user's sessions that are neither revoked nor expired, mới nhất trước
+func (q *Queries) ListActiveSessions(ctx context.Context, userID string) ([]Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions
+              WHERE user_id = $1::uuid AND revoked_at IS NULL AND expires_at > NOW()
+              ORDER BY last_activity DESC`
+
+	rows, err := q.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// RotateSession thay access/refresh token của session đang hoạt động.
+// Điều kiện trên refresh token cũ bảo đảm hai request refresh đồng thời chỉ một cái thành công.
+func (q *Queries) RotateSession(ctx context.Context, arg RotateSessionParams) (Session, error) {
+	query := `UPDATE sessions
+              SET token_hash = $3, previous_refresh_token_hash = refresh_token_hash,
+                  refresh_token_hash = $4, last_activity = NOW()
+              WHERE id = $1::uuid AND refresh_token_hash = $2
+                AND revoked_at IS NULL AND expires_at > NOW()
+              RETURNING ` + sessionColumns
+
+	return scanSession(q.db.QueryRow(ctx, query, arg.ID, arg.OldRefreshTokenHash, arg.TokenHash, arg.RefreshTokenHash))
+}
+
+// RevokeSession revokes one session of a user. Trả về false nếu không có session đang hoạt động.
+func (q *Queries) RevokeSession(ctx context.Context, id, userID string) (bool, error) {
+	query := `UPDATE sessions SET revoked_at = NOW()
+              WHERE id = $1::uuid AND user_id = $2::uuid AND revoked_at IS NULL`
+
+	tag, err := q.db.Exec(ctx, query, id, userID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// RevokeUserSessions revokes all active sessions of a user except exceptID (rỗng = tất cả)
+func (q *Queries) RevokeUserSessions(ctx context.Context, userID, exceptID string) (int64, error) {
+	query := `UPDATE sessions SET revoked_at = NOW()
+              WHERE user_id = $1::uuid AND revoked_at IS NULL
+                AND ($2 = '' OR id <> NULLIF($2, '')::uuid)`
+
+	tag, err := q.db.Exec(ctx, query, userID, exceptID)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// --- API Key Queries Implementation ---
+
+const apiKeyColumns = `k.id::text, k.user_id::text, u.username, k.name, COALESCE(k.key_prefix, ''), k.key_hash, k.secret_hash,
+              COALESCE(k.secret_ciphertext, ''), COALESCE(k.permissions, ARRAY[]::TEXT[]), COALESCE(k.allowed_ips, ARRAY[]::TEXT[]),
+              COALESCE(k.is_active, FALSE), k.last_used_at, k.expires_at, k.created_at, k.revoked_at`
+
+func scanAPIKey(row pgx.Row) (APIKey, error) {
+	var key APIKey
+	err := row.Scan(
+		&key.ID,
+		&key.UserID,
+		&key.Username,
+		&key.Name,
+		&key.KeyPrefix,
+		&key.KeyHash,
+		&key.SecretHash,
+		&key.SecretCiphertext,
+		&key.Permissions,
+		&key.AllowedIPs,
+		&key.IsActive,
+		&key.LastUsedAt,
+		&key.ExpiresAt,
+		&key.CreatedAt,
+		&key.RevokedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return APIKey{}, fmt.Errorf("api key not found")
+		}
+		return APIKey{}, err
+	}
+	return key, nil
+}
+
+func (q *Queries) CreateAPIKey(ctx context.Context, arg CreateAPIKeyParams) (APIKey, error) {
+	query := `WITH k AS (
+                  INSERT INTO api_keys (user_id, name, key_prefix, key_hash, secret_hash, secret_ciphertext, permissions, allowed_ips, expires_at)
+                  VALUES ($1::uuid, $2, $3, $4, $5, $6, $7, $8, $9)
+                  RETURNING *
+              )
+              SELECT ` + apiKeyColumns + ` FROM k JOIN users u ON u.id = k.user_id`
+
+	return scanAPIKey(q.db.QueryRow(ctx, query,
+		arg.UserID, arg.Name, arg.KeyPrefix, arg.KeyHash, arg.SecretHash, arg.SecretCiphertext,
+		arg.Permissions, arg.AllowedIPs, arg.ExpiresAt))
+}
+
+// GetAPIKeyByHash gets an API key (kể cả đã thu hồi) by the SHA-256 of the public key
+func (q *Queries) GetAPIKeyByHash(ctx context.Context, keyHash string) (APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + `
+              FROM api_keys k JOIN users u ON u.id = k.user_id
+              WHERE k.key_hash = $1`
+
+	return scanAPIKey(q.db.QueryRow(ctx, query, keyHash))
+}
+
+// ListAPIKeys lists a user's API keys that have not been revoked
+func (q *Queries) ListAPIKeys(ctx context.Context, userID string) ([]APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + `
+              FROM api_keys k JOIN users u ON u.id = k.user_id
+              WHERE k.user_id = $1::uuid AND k.revoked_at IS NULL
+              ORDER BY k.created_at DESC`
+
+	rows, err := q.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey deactivates one of a user's API keys. Trả về false nếu không có key đang hoạt động.
+func (q *Queries) RevokeAPIKey(ctx context.Context, id, userID string) (bool, error) {
+	query := `UPDATE api_keys SET is_active = FALSE, revoked_at = NOW()
+              WHERE id = $1::uuid AND user_id = $2::uuid AND revoked_at IS NULL`
+
+	tag, err := q.db.Exec(ctx, query, id, userID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// TouchAPIKey cập nhật last_used_at, tối đa mỗi phút một lần để không ghi DB ở mọi request
+func (q *Queries) TouchAPIKey(ctx context.Context, id string) error {
+	query := `UPDATE api_keys SET last_used_at = NOW()
+              WHERE id = $1::uuid AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')`
+
+	_, err := q.db.Exec(ctx, query, id)
+	return err
+}
+
+// --- Two-factor Queries Implementation ---
+
+const userTOTPColumns = `user_id::text, secret_ciphertext, enabled_at, last_used_step, created_at`
+
+func scanUserTOTP(row pgx.Row) (UserTOTP, error) {
+	var t UserTOTP
+	err := row.Scan(&t.UserID, &t.SecretCiphertext, &t.EnabledAt, &t.LastUsedStep, &t.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return UserTOTP{}, fmt.Errorf("totp not found")
+		}
+		return UserTOTP{}, err
+	}
+	return t, nil
+}
+
+// UpsertPendingTOTP lưu secret mới cho lần đăng ký TOTP chưa xác nhận; không ghi đè TOTP đã bật
+func (q *Queries) UpsertPendingTOTP(ctx context.Context, userID, secretCiphertext string) (UserTOTP, error) {
+	query := `INSERT INTO user_totp (user_id, secret_ciphertext)
+              VALUES ($1::uuid, $2)
+              ON CONFLICT (user_id) DO UPDATE
+                  SET secret_ciphertext = EXCLUDED.secret_ciphertext, last_used_step = NULL, created_at = NOW()
+                  WHERE user_totp.enabled_at IS NULL
+              RETURNING ` + userTOTPColumns
+
+	t, err := scanUserTOTP(q.db.QueryRow(ctx, query, userID, secretCiphertext))
+	if err != nil && err.Error() == "totp not found" {
+		return UserTOTP{}, fmt.Errorf("totp already enabled")
+	}
+	return t, err
+}
+
+func (q *Queries) GetUserTOTP(ctx context.Context, userID string) (UserTOTP, error) {
+	query := `SELECT ` + userTOTPColumns + ` FROM user_totp WHERE user_id = $1::uuid`
+
+	return scanUserTOTP(q.db.QueryRow(ctx, query, userID))
+}
+
+// UseTOTPStep ghi nhận bước thời gian của mã vừa dùng; false nếu mã của bước này (hoặc mới hơn) đã được dùng
+func (q *Queries) UseTOTPStep(ctx context.Context, userID string, step int64) (bool, error) {
+	query := `UPDATE user_totp SET last_used_step = $2
+              WHERE user_id = $1::uuid AND (last_used_step IS NULL OR last_used_step < $2)`
+
+	tag, err := q.db.Exec(ctx, query, userID, step)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// UseRecoveryCode đánh dấu mã khôi phục đã dùng; false nếu mã không tồn tại hoặc đã dùng
+func (q *Queries) UseRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error) {
+	query := `UPDATE user_recovery_codes SET used_at = NOW()
+              WHERE user_id = $1::uuid AND code_hash = $2 AND used_at IS NULL`
+
+	tag, err := q.db.Exec(ctx, query, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// CountRecoveryCodes counts a user's unused recovery codes
+func (q *Queries) CountRecoveryCodes(ctx context.Context, userID string) (int64, error) {
+	query := `SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = $1::uuid AND used_at IS NULL`
+
+	var count int64
+	err := q.db.QueryRow(ctx, query, userID).Scan(&count)
+	return count, err
+}
+
+// enableTOTP xác nhận lần đăng ký đang chờ
+func (q *Queries) enableTOTP(ctx context.Context, userID string, step int64) (UserTOTP, error) {
+	query := `UPDATE user_totp SET enabled_at = NOW(), last_used_step = $2
+              WHERE user_id = $1::uuid AND enabled_at IS NULL
+              RETURNING ` + userTOTPColumns
+
+	return scanUserTOTP(q.db.QueryRow(ctx, query, userID, step))
+}
+
+func (q *Queries) replaceRecoveryCodes(ctx context.Context, userID string, codeHashes []string) error {
+	if _, err := q.db.Exec(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1::uuid`, userID); err != nil {
+		return err
+	}
+	query := `INSERT INTO user_recovery_codes (user_id, code_hash)
+              SELECT $1::uuid, unnest($2::text[])`
+
+	_, err := q.db.Exec(ctx, query, userID, codeHashes)
+	return err
+}
+
+// --- Login Throttling Queries Implementation ---
+
+const loginFailureColumns = `key_type, key, failures, last_failed_at, locked_until`
+
+func scanLoginFailure(row pgx.Row) (LoginFailure, error) {
+	var f LoginFailure
+	err := row.Scan(&f.KeyType, &f.Key, &f.Failures, &f.LastFailedAt, &f.LockedUntil)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return LoginFailure{}, fmt.Errorf("login failure not found")
+		}
+		return LoginFailure{}, err
+	}
+	return f, nil
+}
+
+func (q *Queries) GetLoginFailure(ctx context.Context, keyType, key string) (LoginFailure, error) {
+	query := `SELECT ` + loginFailureColumns + ` FROM login_failures WHERE key_type = $1 AND key = $2`
+
+	return scanLoginFailure(q.db.QueryRow(ctx, query, keyType, key))
+}
+
+// RecordLoginFailure tăng bộ đếm (đếm lại nếu lần sai trước đã cũ hoặc khóa cũ đã hết hạn)
+// và khóa khi đạt MaxFailures
+func (q *Queries) RecordLoginFailure(ctx context.Context, arg RecordLoginFailureParams) (LoginFailure, error) {
+	query := `INSERT INTO login_failures (key_type, key, failures, last_failed_at, locked_until)
+              VALUES ($1, $2, 1, NOW(), CASE WHEN $4 <= 1 THEN $5::timestamptz END)
+              ON CONFLICT (key_type, key) DO UPDATE SET
+                  failures = CASE
+                      WHEN login_failures.last_failed_at < $3 OR login_failures.locked_until < NOW() THEN 1
+                      ELSE login_failures.failures + 1 END,
+                  locked_until = CASE
+                      WHEN login_failures.last_failed_at < $3 OR login_failures.locked_until < NOW() THEN
+                          CASE WHEN $4 <= 1 THEN $5::timestamptz END
+                      WHEN login_failures.failures + 1 >= $4 THEN $5::timestamptz
+                      ELSE login_failures.locked_until END,
+                  last_failed_at = NOW()
+              RETURNING ` + loginFailureColumns
+
+	return scanLoginFailure(q.db.QueryRow(ctx, query,
+		arg.KeyType, arg.Key, arg.ResetBefore, arg.MaxFailures, arg.LockedUntil))
+}
+
+// ClearLoginFailures xóa bộ đếm (đăng nhập thành công hoặc admin mở khóa); false nếu không có gì để xóa
+func (q *Queries) ClearLoginFailures(ctx context.Context, keyType, key string) (bool, error) {
+	tag, err := q.db.Exec(ctx, `DELETE FROM login_failures WHERE key_type = $1 AND key = $2`, keyType, key)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// --- Audit Log Queries Implementation ---
+
+const auditLogColumns = `id, user_id, action, resource_type, resource_id, ip_address, user_agent, details, created_at`
+
+// CreateAuditLogs inserts audit log entries in one multi-row insert (audit writer ghi theo lô)
+func (q *Queries) CreateAuditLogs(ctx context.Context, args []CreateAuditLogParams) (int64, error) {
+	if len(args) == 0 {
+		return 0, nil
+	}
+
+	var query strings.Builder
+	query.WriteString(`INSERT INTO audit_logs (user_id, action, resource_type, resource_id, ip_address, user_agent, details, created_at) VALUES `)
+	now := time.Now()
+	params := make([]interface{}, 0, len(args)*8)
+	for i, arg := range args {
+		var details []byte
+		if arg.Details != nil {
+			var err error
+			details, err = json.Marshal(arg.Details)
+			if err != nil {
+				return 0, fmt.Errorf("failed to encode audit details of %s: %w", arg.Action, err)
+			}
+		}
+		createdAt := arg.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = now
+		}
+
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		n := i * 8
+		fmt.Fprintf(&query, "(NULLIF($%d, '')::uuid, $%d, NULLIF($%d, ''), NULLIF($%d, '')::uuid, NULLIF($%d, ''), NULLIF($%d, ''), $%d::jsonb, $%d)",
+			n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8)
+		params = append(params, arg.UserID, arg.Action, arg.ResourceType, arg.ResourceID, arg.IPAddress, arg.UserAgent, details, createdAt)
+	}
+
+	tag, err := q.db.Exec(ctx, query.String(), params...)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// ListAuditLogs lists audit log entries matching the filters, newest first
+func (q *Queries) ListAuditLogs(ctx context.Context, arg ListAuditLogsParams) ([]AuditLog, error) {
+	query := `SELECT ` + auditLogColumns + `
+              FROM audit_logs
+              WHERE ($1 = '' OR user_id = NULLIF($1, '')::uuid)
+                AND ($2 = '' OR action = $2)
+                AND ($3 = '' OR resource_type = $3)
+                AND ($4 = '' OR resource_id = NULLIF($4, '')::uuid)
+                AND ($5 = '' OR ip_address = $5)
+                AND ($6::timestamptz IS NULL OR created_at >= $6)
+                AND ($7::timestamptz IS NULL OR created_at < $7)
+              ORDER BY created_at DESC, id
+              LIMIT $8 OFFSET $9`
+
+	rows, err := q.db.Query(ctx, query,
+		arg.UserID, arg.Action, arg.ResourceType, arg.ResourceID, arg.IPAddress, arg.From, arg.To, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	logs := []AuditLog{}
+	for rows.Next() {
+		var entry AuditLog
+		if err := rows.Scan(
+			&entry.ID,
+			&entry.UserID,
+			&entry.Action,
+			&entry.ResourceType,
+			&entry.ResourceID,
+			&entry.IPAddress,
+			&entry.UserAgent,
+			&entry.Details,
+			&entry.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		logs = append(logs, entry)
+	}
+	return logs, rows.Err()
+}
+
 // --- Account Queries Implementation ---
 
 func (q *Queries) GetAccountsByUserID(ctx context.Context, userID int32) ([]Accounts, error) {
-	query := `SELECT id, user_id, currency, balance, created_at, updated_at 
-              FROM accounts WHERE user_id = $1`
+	query := `SELECT id, user_id, account_type, currency, balance, created_at, updated_at 
+              FROM accounts WHERE user_id = $1
+              ORDER BY account_type, currency`
 
 	rows, err := q.db.Query(ctx, query, userID)
 	if err != nil {
@@ -166,6 +776,7 @@ func (q *Queries) GetAccountsByUserID(ctx context.Context, userID int32) ([]Acco
 		if err := rows.Scan(
 			&account.ID,
 			&account.UserID,
+			&account.AccountType,
 			&account.Currency,
 			&account.Balance,
 			&account.CreatedAt,
@@ -179,14 +790,15 @@ func (q *Queries) GetAccountsByUserID(ctx context.Context, userID int32) ([]Acco
 }
 
 func (q *Queries) GetAccountByUserAndType(ctx context.Context, arg GetAccountByUserAndTypeParams) (Accounts, error) {
-	query := `SELECT id, user_id, currency, balance, created_at, updated_at 
-              FROM accounts WHERE user_id = $1 AND currency = $2`
+	query := `SELECT id, user_id, account_type, currency, balance, created_at, updated_at 
+              FROM accounts WHERE user_id = $1 AND currency = $2 AND account_type = COALESCE(NULLIF($3, ''), 'spot')`
 
-	row := q.db.QueryRow(ctx, query, arg.UserID, arg.Currency)
+	row := q.db.QueryRow(ctx, query, arg.UserID, arg.Currency, arg.AccountType)
 	var account Accounts
 	err := row.Scan(
 		&account.ID,
 		&account.UserID,
+		&account.AccountType,
 		&account.Currency,
 		&account.Balance,
 		&account.CreatedAt,
@@ -202,16 +814,17 @@ func (q *Queries) GetAccountByUserAndType(ctx context.Context, arg GetAccountByU
 }
 
 func (q *Queries) CreateAccount(ctx context.Context, arg CreateAccountParams) (Accounts, error) {
-	query := `INSERT INTO accounts (user_id, currency, balance, created_at, updated_at) 
-              VALUES ($1, $2, $3, $4, $5) 
-              RETURNING id, user_id, currency, balance, created_at, updated_at`
+	query := `INSERT INTO accounts (user_id, account_type, currency, balance, created_at, updated_at) 
+              VALUES ($1, COALESCE(NULLIF($2, ''), 'spot'), $3, $4, $5, $6) 
+              RETURNING id, user_id, account_type, currency, balance, created_at, updated_at`
 
 	now := time.Now()
-	row := q.db.QueryRow(ctx, query, arg.UserID, arg.Currency, arg.Balance, now, now)
+	row := q.db.QueryRow(ctx, query, arg.UserID, arg.AccountType, arg.Currency, arg.Balance, now, now)
 	var account Accounts
 	err := row.Scan(
 		&account.ID,
 		&account.UserID,
+		&account.AccountType,
 		&account.Currency,
 		&account.Balance,
 		&account.CreatedAt,
@@ -220,13 +833,15 @@ func (q *Queries) CreateAccount(ctx context.Context, arg CreateAccountParams) (A
 	return account, err
 }
 
-func (q *Queries) UpdateAccountBalance(ctx context.Context, arg UpdateAccountBalanceParams) (Accounts, error) {
+// updateAccountBalance cộng dồn vào projection accounts.balance; chỉ postJournal được gọi
+// (mọi thay đổi số dư phải có entry tương ứng trong sổ cái)
+func (q *Queries) updateAccountBalance(ctx context.Context, arg UpdateAccountBalanceParams) (Accounts, error) {
 	// Sử dụng SQL để cộng dồn số dư (atomic operation)
 	query := `UPDATE accounts 
               SET balance = (balance::numeric + $2::numeric)::text, 
                   updated_at = $3 
               WHERE id = $1 
-              RETURNING id, user_id, currency, balance, created_at, updated_at`
+              RETURNING id, user_id, account_type, currency, balance, created_at, updated_at`
 
 	now := time.Now()
 	row := q.db.QueryRow(ctx, query, arg.ID, arg.Amount, now)
@@ -234,6 +849,7 @@ func (q *Queries) UpdateAccountBalance(ctx context.Context, arg UpdateAccountBal
 	err := row.Scan(
 		&account.ID,
 		&account.UserID,
+		&account.AccountType,
 		&account.Currency,
 		&account.Balance,
 		&account.CreatedAt,
@@ -264,17 +880,43 @@ func (q *Queries) CreateDeposit(ctx context.Context, arg CreateDepositParams) (T
 	return transaction, err
 }
 
-func (q *Queries) GetTransactionsByAccountID(ctx context.Context, accountID int64) ([]Transactions, error) {
-	query := `SELECT id, account_id, type, amount, status, created_at, updated_at 
-              FROM transactions WHERE account_id = $1 ORDER BY created_at DESC`
+// CreateTransaction records a balance movement of any type, kèm mô tả và mã tham chiếu
+func (q *Queries) CreateTransaction(ctx context.Context, arg CreateTransactionParams) (Transactions, error) {
+	query := `INSERT INTO transactions (account_id, type, amount, status, description, reference_id)
+              VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''))
+              RETURNING id, account_id, type, amount, status, description, reference_id, created_at, updated_at`
+
+	row := q.db.QueryRow(ctx, query, arg.AccountID, arg.Type, arg.Amount, arg.Status, arg.Description, arg.ReferenceID)
+	var transaction Transactions
+	err := row.Scan(
+		&transaction.ID,
+		&transaction.AccountID,
+		&transaction.Type,
+		&transaction.Amount,
+		&transaction.Status,
+		&transaction.Description,
+		&transaction.ReferenceID,
+		&transaction.CreatedAt,
+		&transaction.UpdatedAt,
+	)
+	return transaction, err
+}
+
+// GetTransactionsByAccountID lists an account's transactions, newest first (Type rỗng = mọi loại)
+func (q *Queries) GetTransactionsByAccountID(ctx context.Context, arg GetTransactionsByAccountIDParams) ([]Transactions, error) {
+	query := `SELECT id, account_id, type, amount, status, description, reference_id, created_at, updated_at
+              FROM transactions
+              WHERE account_id = $1 AND ($2 = '' OR type = $2)
+              ORDER BY created_at DESC, id DESC
+              LIMIT $3 OFFSET $4`
 
-	rows, err := q.db.Query(ctx, query, accountID)
+	rows, err := q.db.Query(ctx, query, arg.AccountID, arg.Type, arg.Limit, arg.Offset)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var transactions []Transactions
+	transactions := []Transactions{}
 	for rows.Next() {
 		var transaction Transactions
 		if err := rows.Scan(
@@ -283,6 +925,8 @@ func (q *Queries) GetTransactionsByAccountID(ctx context.Context, accountID int6
 			&transaction.Type,
 			&transaction.Amount,
 			&transaction.Status,
+			&transaction.Description,
+			&transaction.ReferenceID,
 			&transaction.CreatedAt,
 			&transaction.UpdatedAt,
 		); err != nil {
@@ -293,29 +937,422 @@ func (q *Queries) GetTransactionsByAccountID(ctx context.Context, accountID int6
 	return transactions, rows.Err()
 }
 
-// WithTx creates a new Queries instance using a transaction
-func (q *Queries) WithTx(tx pgx.Tx) *Queries {
-	return &Queries{
-		db: tx,
-	}
+// updateTransactionStatus đổi trạng thái một transaction (withdraw pending -> completed/failed/cancelled)
+func (q *Queries) updateTransactionStatus(ctx context.Context, id int64, status string) error {
+	_, err := q.db.Exec(ctx, `UPDATE transactions SET status = $2 WHERE id = $1`, id, status)
+	return err
 }
 
-// --- Order Queries Implementation ---
+// --- Withdrawal Queries Implementation ---
 
-func (q *Queries) CreateOrder(ctx context.Context, arg CreateOrderParams) (Orders, error) {
-	query := `INSERT INTO engine_orders (id, user_id, symbol, price, amount, side, status, created_at) 
-              VALUES ($1, $2, $3, $4, $5, $6, 'pending', $7) 
-              RETURNING id, user_id, symbol, price, amount, side, status, created_at`
+// GetCurrency returns a currency with its withdrawal settings
+func (q *Queries) GetCurrency(ctx context.Context, code string) (Currency, error) {
+	query := `SELECT code, name, type, decimals, min_withdrawal::text, max_withdrawal::text,
+                     COALESCE(withdrawal_fee, 0)::text, COALESCE(is_withdrawal_enabled, TRUE), COALESCE(is_active, TRUE)
+              FROM currencies WHERE code = $1`
 
-	now := time.Now()
-	row := q.db.QueryRow(ctx, query, arg.ID, arg.UserID, arg.Symbol, arg.Price, arg.Amount, arg.Side, now)
-	var order Orders
-	err := row.Scan(
-		&order.ID,
-		&order.UserID,
-		&order.Symbol,
-		&order.Price,
-		&order.Amount,
+	var currency Currency
+	err := q.db.QueryRow(ctx, query, code).Scan(
+		&currency.Code,
+		&currency.Name,
+		&currency.Type,
+		&currency.Decimals,
+		&currency.MinWithdrawal,
+		&currency.MaxWithdrawal,
+		&currency.WithdrawalFee,
+		&currency.IsWithdrawalEnabled,
+		&currency.IsActive,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Currency{}, fmt.Errorf("currency not found")
+		}
+		return Currency{}, err
+	}
+	return currency, nil
+}
+
+const withdrawalColumns = `id, user_id, account_id, transaction_id, currency, amount::text, fee::text, (amount - fee)::text,
+              address, status, reviewed_by, reviewed_at, processed_by, processed_at, external_reference, failure_reason,
+              created_at, updated_at`
+
+func scanWithdrawal(row pgx.Row) (Withdrawal, error) {
+	var w Withdrawal
+	err := row.Scan(
+		&w.ID,
+		&w.UserID,
+		&w.AccountID,
+		&w.TransactionID,
+		&w.Currency,
+		&w.Amount,
+		&w.Fee,
+		&w.NetAmount,
+		&w.Address,
+		&w.Status,
+		&w.ReviewedBy,
+		&w.ReviewedAt,
+		&w.ProcessedBy,
+		&w.ProcessedAt,
+		&w.ExternalReference,
+		&w.FailureReason,
+		&w.CreatedAt,
+		&w.UpdatedAt,
+	)
+	return w, err
+}
+
+// GetWithdrawal returns a withdrawal by ID
+func (q *Queries) GetWithdrawal(ctx context.Context, id string) (Withdrawal, error) {
+	w, err := scanWithdrawal(q.db.QueryRow(ctx, `SELECT `+withdrawalColumns+` FROM withdrawals WHERE id = $1`, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Withdrawal{}, fmt.Errorf("withdrawal not found")
+		}
+		return Withdrawal{}, err
+	}
+	return w, nil
+}
+
+// ListWithdrawals lists withdrawals matching the filters, newest first
+func (q *Queries) ListWithdrawals(ctx context.Context, arg ListWithdrawalsParams) ([]Withdrawal, error) {
+	query := `SELECT ` + withdrawalColumns + `
+              FROM withdrawals
+              WHERE ($1 = '' OR user_id = NULLIF($1, '')::uuid)
+                AND ($2 = '' OR status = $2)
+                AND ($3 = '' OR currency = $3)
+              ORDER BY created_at DESC
+              LIMIT $4 OFFSET $5`
+
+	rows, err := q.db.Query(ctx, query, arg.UserID, arg.Status, arg.Currency, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	withdrawals := []Withdrawal{}
+	for rows.Next() {
+		w, err := scanWithdrawal(rows)
+		if err != nil {
+			return nil, err
+		}
+		withdrawals = append(withdrawals, w)
+	}
+	return withdrawals, rows.Err()
+}
+
+// createWithdrawal ghi yêu cầu rút tiền (dùng trong CreateWithdrawalTx, sau khi đã trừ số dư)
+func (q *Queries) createWithdrawal(ctx context.Context, id string, accountID, transactionID int64, arg CreateWithdrawalTxParams) (Withdrawal, error) {
+	query := `INSERT INTO withdrawals (id, user_id, account_id, transaction_id, currency, amount, fee, address)
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+              RETURNING ` + withdrawalColumns
+
+	return scanWithdrawal(q.db.QueryRow(ctx, query,
+		id, arg.UserID, accountID, transactionID, arg.Currency, arg.Amount, arg.Fee, arg.Address))
+}
+
+// exceedsWithdrawalLimit cho biết amount cộng các yêu cầu còn hiệu lực từ since có vượt limit không
+func (q *Queries) exceedsWithdrawalLimit(ctx context.Context, userID, currency, amount, limit string, since time.Time) (bool, error) {
+	query := `SELECT COALESCE(SUM(amount), 0) + $3::numeric > $4::numeric
+              FROM withdrawals
+              WHERE user_id = $1 AND currency = $2 AND created_at >= $5
+                AND status IN ('pending', 'approved', 'completed')`
+
+	var exceeds bool
+	err := q.db.QueryRow(ctx, query, userID, currency, amount, limit, since).Scan(&exceeds)
+	return exceeds, err
+}
+
+// transitionWithdrawal đổi trạng thái nếu trạng thái hiện tại nằm trong from; pgx.ErrNoRows nếu không khớp
+func (q *Queries) transitionWithdrawal(ctx context.Context, arg TransitionWithdrawalTxParams, from []string) (Withdrawal, error) {
+	query := `UPDATE withdrawals
+              SET status = $2,
+                  reviewed_by = CASE WHEN $2 IN ('approved', 'rejected') THEN NULLIF($3, '') ELSE reviewed_by END,
+                  reviewed_at = CASE WHEN $2 IN ('approved', 'rejected') THEN NOW() ELSE reviewed_at END,
+                  processed_by = CASE WHEN $2 IN ('completed', 'failed') THEN NULLIF($3, '') ELSE processed_by END,
+                  processed_at = CASE WHEN $2 IN ('completed', 'failed') THEN NOW() ELSE processed_at END,
+                  failure_reason = COALESCE(NULLIF($4, ''), failure_reason),
+                  external_reference = COALESCE(NULLIF($5, ''), external_reference)
+              WHERE id = $1 AND status = ANY($6) AND ($7 = '' OR user_id = NULLIF($7, '')::uuid)
+              RETURNING ` + withdrawalColumns
+
+	return scanWithdrawal(q.db.QueryRow(ctx, query,
+		arg.ID, arg.Status, arg.Actor, arg.Reason, arg.ExternalReference, from, arg.UserID))
+}
+
+// --- Ledger Queries Implementation ---
+
+// postJournal ghi một journal cân bằng (bỏ qua posting bằng 0) và cập nhật accounts.balance của các ví
+// có trong journal. Trả về "insufficient balance" nếu ví nào bị âm; phải chạy trong execTx.
+func (q *Queries) postJournal(ctx context.Context, arg PostJournalParams) (LedgerJournal, map[int64]Accounts, error) {
+	postings, deltas, err := checkPostings(arg)
+	if err != nil {
+		return LedgerJournal{}, nil, err
+	}
+
+	// 1. Journal + entries
+	var journal LedgerJournal
+	err = q.db.QueryRow(ctx, `INSERT INTO ledger_journals (type, reference_id, description)
+              VALUES ($1, NULLIF($2, ''), NULLIF($3, ''))
+              RETURNING id, type, reference_id, description, created_at`,
+		arg.Type, arg.ReferenceID, arg.Description,
+	).Scan(&journal.ID, &journal.Type, &journal.ReferenceID, &journal.Description, &journal.CreatedAt)
+	if err != nil {
+		return LedgerJournal{}, nil, fmt.Errorf("failed to create ledger journal: %w", err)
+	}
+
+	var query strings.Builder
+	query.WriteString(`INSERT INTO ledger_entries (journal_id, ledger_account, account_id, currency, amount) VALUES `)
+	params := []interface{}{journal.ID}
+	for i, posting := range postings {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		n := len(params)
+		fmt.Fprintf(&query, "($1, $%d, $%d, $%d, $%d::numeric)", n+1, n+2, n+3, n+4)
+
+		ledgerAccount, accountID := posting.SystemAccount, (*int64)(nil)
+		if posting.AccountID != 0 {
+			id := posting.AccountID
+			ledgerAccount, accountID = "account:"+strconv.FormatInt(id, 10), &id
+		}
+		params = append(params, ledgerAccount, accountID, posting.Currency, posting.Amount)
+	}
+	query.WriteString(` RETURNING ` + ledgerEntryColumns)
+
+	rows, err := q.db.Query(ctx, query.String(), params...)
+	if err != nil {
+		return LedgerJournal{}, nil, fmt.Errorf("failed to create ledger entries: %w", err)
+	}
+	journal.Entries, err = scanLedgerEntries(rows)
+	if err != nil {
+		return LedgerJournal{}, nil, fmt.Errorf("failed to create ledger entries: %w", err)
+	}
+
+	// 2. Projection số dư, theo thứ tự ID tăng dần để hai journal đồng thời không khóa chéo nhau
+	ids := make([]int64, 0, len(deltas))
+	for id := range deltas {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	accounts := make(map[int64]Accounts, len(ids))
+	for _, id := range ids {
+		account, err := q.updateAccountBalance(ctx, UpdateAccountBalanceParams{ID: id, Amount: deltas[id].FloatString(8)})
+		if err != nil {
+			return LedgerJournal{}, nil, fmt.Errorf("failed to update balance: %w", err)
+		}
+		if strings.HasPrefix(account.Balance, "-") {
+			return LedgerJournal{}, nil, fmt.Errorf("insufficient balance")
+		}
+		accounts[id] = account
+	}
+	return journal, accounts, nil
+}
+
+// checkPostings bỏ các posting bằng 0, kiểm tra journal cân theo từng currency
+// và trả về thay đổi số dư của từng ví
+func checkPostings(arg PostJournalParams) ([]LedgerPosting, map[int64]*big.Rat, error) {
+	postings := make([]LedgerPosting, 0, len(arg.Postings))
+	sums := map[string]*big.Rat{}
+	deltas := map[int64]*big.Rat{}
+	for _, posting := range arg.Postings {
+		amount, ok := new(big.Rat).SetString(posting.Amount)
+		if !ok {
+			return nil, nil, fmt.Errorf("invalid ledger amount %q", posting.Amount)
+		}
+		if amount.Sign() == 0 {
+			continue
+		}
+		if (posting.AccountID == 0) == (posting.SystemAccount == "") {
+			return nil, nil, fmt.Errorf("ledger posting needs either an account or a system account")
+		}
+		if sums[posting.Currency] == nil {
+			sums[posting.Currency] = new(big.Rat)
+		}
+		sums[posting.Currency].Add(sums[posting.Currency], amount)
+		if posting.AccountID != 0 {
+			if deltas[posting.AccountID] == nil {
+				deltas[posting.AccountID] = new(big.Rat)
+			}
+			deltas[posting.AccountID].Add(deltas[posting.AccountID], amount)
+		}
+		postings = append(postings, posting)
+	}
+	for currency, sum := range sums {
+		if sum.Sign() != 0 {
+			return nil, nil, fmt.Errorf("ledger journal %s is not balanced in %s", arg.Type, currency)
+		}
+	}
+	if len(postings) == 0 {
+		return nil, nil, fmt.Errorf("ledger journal %s has no entries", arg.Type)
+	}
+	return postings, deltas, nil
+}
+
+const ledgerEntryColumns = `id, journal_id, ledger_account, account_id, currency, amount::text, created_at`
+
+func scanLedgerEntries(rows pgx.Rows) ([]LedgerEntry, error) {
+	defer rows.Close()
+
+	entries := []LedgerEntry{}
+	for rows.Next() {
+		var entry LedgerEntry
+		if err := rows.Scan(
+			&entry.ID,
+			&entry.JournalID,
+			&entry.LedgerAccount,
+			&entry.AccountID,
+			&entry.Currency,
+			&entry.Amount,
+			&entry.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// ListLedgerJournals lists ledger journals with their entries, newest first
+func (q *Queries) ListLedgerJournals(ctx context.Context, arg ListLedgerJournalsParams) ([]LedgerJournal, error) {
+	query := `SELECT j.id, j.type, j.reference_id, j.description, j.created_at
+              FROM ledger_journals j
+              WHERE ($1::bigint = 0 OR EXISTS (SELECT 1 FROM ledger_entries e WHERE e.journal_id = j.id AND e.account_id = $1))
+                AND ($2 = '' OR j.type = $2)
+                AND ($3 = '' OR j.reference_id = $3)
+              ORDER BY j.id DESC
+              LIMIT $4 OFFSET $5`
+
+	rows, err := q.db.Query(ctx, query, arg.AccountID, arg.Type, arg.ReferenceID, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	journals := []LedgerJournal{}
+	index := map[int64]int{}
+	ids := []int64{}
+	for rows.Next() {
+		var journal LedgerJournal
+		if err := rows.Scan(&journal.ID, &journal.Type, &journal.ReferenceID, &journal.Description, &journal.CreatedAt); err != nil {
+			return nil, err
+		}
+		journal.Entries = []LedgerEntry{}
+		index[journal.ID] = len(journals)
+		ids = append(ids, journal.ID)
+		journals = append(journals, journal)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return journals, nil
+	}
+
+	entryRows, err := q.db.Query(ctx, `SELECT `+ledgerEntryColumns+` FROM ledger_entries WHERE journal_id = ANY($1) ORDER BY id`, ids)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := scanLedgerEntries(entryRows)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		i := index[entry.JournalID]
+		journals[i].Entries = append(journals[i].Entries, entry)
+	}
+	return journals, nil
+}
+
+// ListLedgerBalanceMismatches trả về các ví có accounts.balance khác tổng entry trong sổ cái,
+// kể cả entry ghi vào ví không tồn tại hoặc khác currency của ví
+func (q *Queries) ListLedgerBalanceMismatches(ctx context.Context) ([]LedgerBalanceMismatch, error) {
+	query := `WITH totals AS (
+                  SELECT account_id, currency, SUM(amount) AS total
+                  FROM ledger_entries
+                  WHERE account_id IS NOT NULL
+                  GROUP BY account_id, currency
+              )
+              SELECT a.id, a.user_id, a.account_type, a.currency, a.balance::numeric::text, COALESCE(t.total, 0)::text
+              FROM accounts a
+              LEFT JOIN totals t ON t.account_id = a.id AND t.currency = a.currency
+              WHERE a.balance::numeric <> COALESCE(t.total, 0)
+              UNION ALL
+              SELECT t.account_id, COALESCE(a.user_id, 0), '', t.currency, '0', t.total::text
+              FROM totals t
+              LEFT JOIN accounts a ON a.id = t.account_id
+              WHERE (a.id IS NULL OR a.currency <> t.currency) AND t.total <> 0
+              ORDER BY 1`
+
+	rows, err := q.db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mismatches := []LedgerBalanceMismatch{}
+	for rows.Next() {
+		var m LedgerBalanceMismatch
+		if err := rows.Scan(&m.AccountID, &m.UserID, &m.AccountType, &m.Currency, &m.Balance, &m.LedgerBalance); err != nil {
+			return nil, err
+		}
+		mismatches = append(mismatches, m)
+	}
+	return mismatches, rows.Err()
+}
+
+// ListLedgerImbalances trả về các journal có tổng entry khác 0 theo currency
+// (trigger ledger_entries_balanced chặn từ lúc ghi; checker kiểm tra lại)
+func (q *Queries) ListLedgerImbalances(ctx context.Context) ([]LedgerImbalance, error) {
+	query := `SELECT journal_id, currency, SUM(amount)::text
+              FROM ledger_entries
+              GROUP BY journal_id, currency
+              HAVING SUM(amount) <> 0
+              ORDER BY journal_id`
+
+	rows, err := q.db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	imbalances := []LedgerImbalance{}
+	for rows.Next() {
+		var imbalance LedgerImbalance
+		if err := rows.Scan(&imbalance.JournalID, &imbalance.Currency, &imbalance.Sum); err != nil {
+			return nil, err
+		}
+		imbalances = append(imbalances, imbalance)
+	}
+	return imbalances, rows.Err()
+}
+
+// WithTx creates a new Queries instance using a transaction
+func (q *Queries) WithTx(tx pgx.Tx) *Queries {
+	return &Queries{
+		db: tx,
+	}
+}
+
+// --- Order Queries Implementation ---
+
+// CreateOrder stores an order acknowledged by the engine.
+// Lệnh được gửi lại sau đối soát (cùng id) ghi đè số lượng còn lại và giữ lại số dư.
+func (q *Queries) CreateOrder(ctx context.Context, arg CreateOrderParams) (Orders, error) {
+	query := `INSERT INTO engine_orders (id, user_id, symbol, price, amount, side, status, created_at) 
+              VALUES ($1, $2, $3, $4, $5, $6, 'pending', $7) 
+              ON CONFLICT (id) DO UPDATE SET amount = EXCLUDED.amount, status = 'pending'
+              RETURNING id, user_id, symbol, price, amount, side, status, created_at`
+
+	now := time.Now()
+	row := q.db.QueryRow(ctx, query, arg.ID, arg.UserID, arg.Symbol, arg.Price, arg.Amount, arg.Side, now)
+	var order Orders
+	err := row.Scan(
+		&order.ID,
+		&order.UserID,
+		&order.Symbol,
+		&order.Price,
+		&order.Amount,
 		&order.Side,
 		&order.Status,
 		&order.CreatedAt,
@@ -376,6 +1413,222 @@ func (q *Queries) ListPendingOrders(ctx context.Context, userID int64) ([]Orders
 	return orders, rows.Err()
 }
 
+// RejectOrder marks an open order (orders table) as REJECTED with the engine's reason code
+func (q *Queries) RejectOrder(ctx context.Context, arg RejectOrderParams) (RejectedOrder, error) {
+	query := `UPDATE orders
+              SET status = 'REJECTED', reject_reason = $2
+              WHERE engine_order_id = $1 AND status IN ('OPEN', 'PARTIALLY_FILLED')
+              RETURNING id::text, user_id::text, symbol, engine_order_id, reject_reason`
+
+	var order RejectedOrder
+	err := q.db.QueryRow(ctx, query, arg.EngineOrderID, arg.Reason).Scan(
+		&order.ID,
+		&order.UserID,
+		&order.Symbol,
+		&order.EngineOrderID,
+		&order.RejectReason,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return RejectedOrder{}, fmt.Errorf("order not found")
+		}
+		return RejectedOrder{}, err
+	}
+	return order, nil
+}
+
+// GetRejectedOrder gets a rejected order by the engine's numeric order ID
+func (q *Queries) GetRejectedOrder(ctx context.Context, engineOrderID int64) (RejectedOrder, error) {
+	query := `SELECT id::text, user_id::text, symbol, engine_order_id, reject_reason
+              FROM orders
+              WHERE engine_order_id = $1 AND status = 'REJECTED'`
+
+	var order RejectedOrder
+	err := q.db.QueryRow(ctx, query, engineOrderID).Scan(
+		&order.ID,
+		&order.UserID,
+		&order.Symbol,
+		&order.EngineOrderID,
+		&order.RejectReason,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return RejectedOrder{}, fmt.Errorf("order not found")
+		}
+		return RejectedOrder{}, err
+	}
+	return order, nil
+}
+
+// ReleaseEngineOrder moves a pending engine order to a final status.
+// GetLockedAmountByUserAndCurrency tính phần bị khóa từ các engine_orders 'pending'; số dư thật
+// được giữ và trả lại trong sổ cái (ReleaseOrderHold). Trả về false nếu order không còn pending.
+func (q *Queries) ReleaseEngineOrder(ctx context.Context, id int64, status string) (bool, error) {
+	query := `UPDATE engine_orders SET status = $2 WHERE id = $1 AND status = 'pending'`
+
+	tag, err := q.db.Exec(ctx, query, id, status)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// --- Reconciliation Queries Implementation ---
+
+// reconcileOrderSelect lấy order kèm số lượng đã khớp (engine_trades) và trạng thái giữ tiền (engine_orders)
+const reconcileOrderSelect = `SELECT o.id::text, o.user_id::text, o.symbol, o.side, o.order_type,
+                     COALESCE(o.price, 0)::text, o.quantity::text,
+                     COALESCE(f.filled, 0)::text, (o.quantity - COALESCE(f.filled, 0))::text,
+                     o.engine_order_id, o.status,
+                     EXISTS (SELECT 1 FROM engine_orders e WHERE e.id = o.engine_order_id AND e.status = 'pending'),
+                     o.created_at
+              FROM orders o
+              LEFT JOIN LATERAL (
+                  SELECT SUM(t.amount) AS filled
+                  FROM engine_trades t
+                  WHERE t.maker_order_id = o.engine_order_id OR t.taker_order_id = o.engine_order_id
+              ) f ON TRUE`
+
+func scanReconcileOrders(rows pgx.Rows) ([]ReconcileOrder, error) {
+	defer rows.Close()
+
+	var orders []ReconcileOrder
+	for rows.Next() {
+		var order ReconcileOrder
+		if err := rows.Scan(
+			&order.ID,
+			&order.UserID,
+			&order.Symbol,
+			&order.Side,
+			&order.OrderType,
+			&order.Price,
+			&order.Quantity,
+			&order.Filled,
+			&order.Remaining,
+			&order.EngineOrderID,
+			&order.Status,
+			&order.Held,
+			&order.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+	return orders, rows.Err()
+}
+
+// ListReconcileOrders lists open orders linked to an engine order, created before createdBefore
+// (order mới hơn có thể vẫn đang trên đường sang engine)
+func (q *Queries) ListReconcileOrders(ctx context.Context, createdBefore time.Time) ([]ReconcileOrder, error) {
+	query := reconcileOrderSelect + `
+              WHERE o.engine_order_id IS NOT NULL
+                AND o.status IN ('OPEN', 'PARTIALLY_FILLED')
+                AND o.created_at < $1
+              ORDER BY o.created_at`
+
+	rows, err := q.db.Query(ctx, query, createdBefore)
+	if err != nil {
+		return nil, err
+	}
+	return scanReconcileOrders(rows)
+}
+
+// ListOrdersByEngineIDs gets orders (any status) by the engine's numeric order IDs
+func (q *Queries) ListOrdersByEngineIDs(ctx context.Context, engineOrderIDs []int64) ([]ReconcileOrder, error) {
+	query := reconcileOrderSelect + `
+              WHERE o.engine_order_id = ANY($1)`
+
+	rows, err := q.db.Query(ctx, query, engineOrderIDs)
+	if err != nil {
+		return nil, err
+	}
+	return scanReconcileOrders(rows)
+}
+
+// ListStaleEngineHolds lists engine orders still holding funds although their order is closed
+func (q *Queries) ListStaleEngineHolds(ctx context.Context) ([]StaleEngineHold, error) {
+	query := `SELECT e.id, e.symbol, o.id::text, o.status
+              FROM engine_orders e
+              JOIN orders o ON o.engine_order_id = e.id
+              WHERE e.status = 'pending' AND o.status IN ('FILLED', 'CANCELLED', 'REJECTED')
+              ORDER BY e.id`
+
+	rows, err := q.db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var holds []StaleEngineHold
+	for rows.Next() {
+		var hold StaleEngineHold
+		if err := rows.Scan(&hold.EngineOrderID, &hold.Symbol, &hold.OrderID, &hold.OrderStatus); err != nil {
+			return nil, err
+		}
+		holds = append(holds, hold)
+	}
+	return holds, rows.Err()
+}
+
+// GetOrderByUUID gets an order (any status) by its UUID
+func (q *Queries) GetOrderByUUID(ctx context.Context, id string) (ReconcileOrder, error) {
+	query := reconcileOrderSelect + `
+              WHERE o.id = $1::uuid`
+
+	rows, err := q.db.Query(ctx, query, id)
+	if err != nil {
+		return ReconcileOrder{}, err
+	}
+	orders, err := scanReconcileOrders(rows)
+	if err != nil {
+		return ReconcileOrder{}, err
+	}
+	if len(orders) == 0 {
+		return ReconcileOrder{}, fmt.Errorf("order not found")
+	}
+	return orders[0], nil
+}
+
+// GetOrderByEngineID gets an order (any status) by the engine's numeric order ID
+func (q *Queries) GetOrderByEngineID(ctx context.Context, engineOrderID int64) (ReconcileOrder, error) {
+	query := reconcileOrderSelect + `
+              WHERE o.engine_order_id = $1`
+
+	rows, err := q.db.Query(ctx, query, engineOrderID)
+	if err != nil {
+		return ReconcileOrder{}, err
+	}
+	orders, err := scanReconcileOrders(rows)
+	if err != nil {
+		return ReconcileOrder{}, err
+	}
+	if len(orders) == 0 {
+		return ReconcileOrder{}, fmt.Errorf("order not found")
+	}
+	return orders[0], nil
+}
+
+// CloseOrder moves an open order to a final status. Trả về false nếu order không còn mở.
+func (q *Queries) CloseOrder(ctx context.Context, arg CloseOrderParams) (bool, error) {
+	query := `UPDATE orders SET status = $2, updated_at = NOW()
+              WHERE id = $1::uuid AND status IN ('OPEN', 'PARTIALLY_FILLED')`
+
+	tag, err := q.db.Exec(ctx, query, arg.ID, arg.Status)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// MarkOrderPartiallyFilled moves an OPEN order to PARTIALLY_FILLED. Order đã đóng thì giữ nguyên.
+func (q *Queries) MarkOrderPartiallyFilled(ctx context.Context, id string) error {
+	query := `UPDATE orders SET status = 'PARTIALLY_FILLED', updated_at = NOW()
+              WHERE id = $1::uuid AND status = 'OPEN'`
+
+	_, err := q.db.Exec(ctx, query, id)
+	return err
+}
+
 // --- Balance Queries Implementation ---
 
 // GetLockedAmountByUserAndCurrency calculates the total locked amount from pending orders
@@ -426,6 +1679,31 @@ func (q *Queries) CreateTrade(ctx context.Context, arg CreateTradeParams) (Trade
 	return trade, err
 }
 
+// CreateTrades inserts trades in one multi-row insert (dùng khi xử lý event theo lô)
+func (q *Queries) CreateTrades(ctx context.Context, args []CreateTradeParams) (int64, error) {
+	if len(args) == 0 {
+		return 0, nil
+	}
+
+	var query strings.Builder
+	query.WriteString(`INSERT INTO engine_trades (maker_order_id, taker_order_id, price, amount, created_at) VALUES `)
+	now := time.Now()
+	params := make([]interface{}, 0, len(args)*5)
+	for i, arg := range args {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		fmt.Fprintf(&query, "($%d, $%d, $%d, $%d, $%d)", i*5+1, i*5+2, i*5+3, i*5+4, i*5+5)
+		params = append(params, arg.MakerOrderID, arg.TakerOrderID, arg.Price, arg.Amount, now)
+	}
+
+	tag, err := q.db.Exec(ctx, query.String(), params...)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
 // ListUserTradesRow represents a trade from the user's perspective
 type ListUserTradesRow struct {
 	ID        int64     `json:"id"`
@@ -482,3 +1760,364 @@ func (q *Queries) ListUserTrades(ctx context.Context, userID int64) ([]ListUserT
 	}
 	return trades, rows.Err()
 }
+
+// --- Trading Pair Queries Implementation ---
+
+// ListActiveSymbols returns the symbols of all active trading pairs
+func (q *Queries) ListActiveSymbols(ctx context.Context) ([]string, error) {
+	query := `SELECT symbol FROM trading_pairs WHERE is_active = TRUE ORDER BY symbol`
+
+	rows, err := q.db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var symbols []string
+	for rows.Next() {
+		var symbol string
+		if err := rows.Scan(&symbol); err != nil {
+			return nil, err
+		}
+		symbols = append(symbols, symbol)
+	}
+	return symbols, rows.Err()
+}
+
+// --- Symbol Halt Queries Implementation ---
+
+// CreateSymbolHalt halts trading of a symbol; halt lại symbol đang dừng chỉ cập nhật lý do
+func (q *Queries) CreateSymbolHalt(ctx context.Context, arg CreateSymbolHaltParams) (SymbolHalt, error) {
+	query := `INSERT INTO symbol_halts (symbol, reason, halted_by)
+              VALUES ($1, $2, $3)
+              ON CONFLICT (symbol) DO UPDATE SET reason = EXCLUDED.reason, halted_by = EXCLUDED.halted_by
+              RETURNING symbol, reason, halted_by, halted_at`
+
+	var halt SymbolHalt
+	err := q.db.QueryRow(ctx, query, arg.Symbol, arg.Reason, arg.HaltedBy).Scan(&halt.Symbol, &halt.Reason, &halt.HaltedBy, &halt.HaltedAt)
+	return halt, err
+}
+
+// DeleteSymbolHalt resumes trading of a symbol. Trả về false nếu symbol không bị dừng.
+func (q *Queries) DeleteSymbolHalt(ctx context.Context, symbol string) (bool, error) {
+	tag, err := q.db.Exec(ctx, `DELETE FROM symbol_halts WHERE symbol = $1`, symbol)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// ErrSymbolHaltNotFound: symbol không bị dừng giao dịch
+var ErrSymbolHaltNotFound = errors.New("symbol halt not found")
+
+// GetSymbolHalt gets the halt of a symbol, ErrSymbolHaltNotFound nếu symbol đang giao dịch bình thường
+func (q *Queries) GetSymbolHalt(ctx context.Context, symbol string) (SymbolHalt, error) {
+	query := `SELECT symbol, reason, halted_by, halted_at FROM symbol_halts WHERE symbol = $1`
+
+	var halt SymbolHalt
+	err := q.db.QueryRow(ctx, query, symbol).Scan(&halt.Symbol, &halt.Reason, &halt.HaltedBy, &halt.HaltedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return SymbolHalt{}, ErrSymbolHaltNotFound
+		}
+		return SymbolHalt{}, err
+	}
+	return halt, nil
+}
+
+func (q *Queries) ListSymbolHalts(ctx context.Context) ([]SymbolHalt, error) {
+	query := `SELECT symbol, reason, halted_by, halted_at FROM symbol_halts ORDER BY symbol`
+
+	rows, err := q.db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var halts []SymbolHalt
+	for rows.Next() {
+		var halt SymbolHalt
+		if err := rows.Scan(&halt.Symbol, &halt.Reason, &halt.HaltedBy, &halt.HaltedAt); err != nil {
+			return nil, err
+		}
+		halts = append(halts, halt)
+	}
+	return halts, rows.Err()
+}
+
+// --- Outbox Queries Implementation ---
+
+const outboxColumns = `id, aggregate_id, subject, msg_id, payload, status, attempts, last_error, created_at, sent_at`
+
+func scanOutboxMessage(row pgx.Row) (OutboxMessage, error) {
+	var msg OutboxMessage
+	err := row.Scan(
+		&msg.ID,
+		&msg.AggregateID,
+		&msg.Subject,
+		&msg.MsgID,
+		&msg.Payload,
+		&msg.Status,
+		&msg.Attempts,
+		&msg.LastError,
+		&msg.CreatedAt,
+		&msg.SentAt,
+	)
+	return msg, err
+}
+
+// CreateOutboxMessage enqueues a command to be published by the outbox relay
+func (q *Queries) CreateOutboxMessage(ctx context.Context, arg CreateOutboxMessageParams) (OutboxMessage, error) {
+	query := `INSERT INTO outbox (aggregate_id, subject, msg_id, payload)
+              VALUES ($1, $2, $3, $4)
+              RETURNING ` + outboxColumns
+
+	return scanOutboxMessage(q.db.QueryRow(ctx, query, arg.AggregateID, arg.Subject, arg.MsgID, arg.Payload))
+}
+
+// GetOutboxMessageByMsgID gets an outbox message by its JetStream message ID
+func (q *Queries) GetOutboxMessageByMsgID(ctx context.Context, msgID string) (OutboxMessage, error) {
+	query := `SELECT ` + outboxColumns + ` FROM outbox WHERE msg_id = $1`
+
+	msg, err := scanOutboxMessage(q.db.QueryRow(ctx, query, msgID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return OutboxMessage{}, fmt.Errorf("outbox message not found")
+		}
+		return OutboxMessage{}, err
+	}
+	return msg, nil
+}
+
+// ListPendingOutboxMessages locks the oldest pending messages for publishing.
+// SKIP LOCKED cho phép nhiều gateway chạy relay cùng lúc mà không publish trùng một dòng;
+// phải gọi bên trong transaction để lock được giữ tới khi đánh dấu sent.
+func (q *Queries) ListPendingOutboxMessages(ctx context.Context, limit int32) ([]OutboxMessage, error) {
+	query := `SELECT ` + outboxColumns + `
+              FROM outbox
+              WHERE status = 'pending'
+              ORDER BY id
+              LIMIT $1
+              FOR UPDATE SKIP LOCKED`
+
+	rows, err := q.db.Query(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []OutboxMessage
+	for rows.Next() {
+		msg, err := scanOutboxMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+// MarkOutboxMessageSent marks a message as published
+func (q *Queries) MarkOutboxMessageSent(ctx context.Context, id int64) error {
+	query := `UPDATE outbox
+              SET status = 'sent', attempts = attempts + 1, last_error = NULL, sent_at = NOW()
+              WHERE id = $1`
+
+	_, err := q.db.Exec(ctx, query, id)
+	return err
+}
+
+// MarkOutboxMessageFailed records a failed publish attempt, the message stays pending
+func (q *Queries) MarkOutboxMessageFailed(ctx context.Context, arg MarkOutboxMessageFailedParams) error {
+	query := `UPDATE outbox SET attempts = attempts + 1, last_error = $2 WHERE id = $1`
+
+	_, err := q.db.Exec(ctx, query, arg.ID, arg.Error)
+	return err
+}
+
+// CountPendingOutboxMessages returns how many messages are waiting to be published
+func (q *Queries) CountPendingOutboxMessages(ctx context.Context) (int64, error) {
+	query := `SELECT COUNT(*) FROM outbox WHERE status = 'pending'`
+
+	var count int64
+	err := q.db.QueryRow(ctx, query).Scan(&count)
+	return count, err
+}
+
+// --- Event Processing Queries Implementation ---
+
+// MarkEventProcessed records an engine event as processed.
+// Trả về false nếu event đã có trong processed_events (event bị deliver lại).
+// MarkEventsProcessed records engine events as processed in one multi-row insert.
+// Trả về tập event_id vừa được ghi; event không có trong tập đã được xử lý trước đó.
+func (q *Queries) MarkEventsProcessed(ctx context.Context, args []MarkEventProcessedParams) (map[string]bool, error) {
+	inserted := make(map[string]bool, len(args))
+	if len(args) == 0 {
+		return inserted, nil
+	}
+
+	var query strings.Builder
+	query.WriteString(`INSERT INTO processed_events (event_id, event_type, epoch, seq) VALUES `)
+	params := make([]interface{}, 0, len(args)*4)
+	for i, arg := range args {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		fmt.Fprintf(&query, "($%d, $%d, $%d, $%d)", i*4+1, i*4+2, i*4+3, i*4+4)
+		params = append(params, arg.EventID, arg.EventType, arg.Epoch, arg.Seq)
+	}
+	query.WriteString(` ON CONFLICT (event_id) DO NOTHING RETURNING event_id`)
+
+	rows, err := q.db.Query(ctx, query.String(), params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var eventID string
+		if err := rows.Scan(&eventID); err != nil {
+			return nil, err
+		}
+		inserted[eventID] = true
+	}
+	return inserted, rows.Err()
+}
+
+// GetEventSequence returns the last processed sequence of a source
+func (q *Queries) GetEventSequence(ctx context.Context, source string) (EventSequence, error) {
+	query := `SELECT source, epoch, last_seq, updated_at
+              FROM event_sequences
+              WHERE source = $1`
+
+	var seq EventSequence
+	err := q.db.QueryRow(ctx, query, source).Scan(
+		&seq.Source,
+		&seq.Epoch,
+		&seq.LastSeq,
+		&seq.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return EventSequence{}, fmt.Errorf("event sequence not found")
+		}
+		return EventSequence{}, err
+	}
+	return seq, nil
+}
+
+// UpsertEventSequence advances the last processed sequence of a source.
+// Chỉ tiến lên (epoch mới hơn, hoặc seq lớn hơn trong cùng epoch): các partition commit không theo thứ tự seq.
+func (q *Queries) UpsertEventSequence(ctx context.Context, arg UpsertEventSequenceParams) error {
+	query := `INSERT INTO event_sequences (source, epoch, last_seq, updated_at)
+              VALUES ($1, $2, $3, NOW())
+              ON CONFLICT (source) DO UPDATE
+              SET epoch = EXCLUDED.epoch, last_seq = EXCLUDED.last_seq, updated_at = NOW()
+              WHERE (EXCLUDED.epoch, EXCLUDED.last_seq) > (event_sequences.epoch, event_sequences.last_seq)`
+
+	_, err := q.db.Exec(ctx, query, arg.Source, arg.Epoch, arg.LastSeq)
+	return err
+}
+
+// --- Dead-letter Queries Implementation ---
+
+const deadLetterColumns = `id, event_id, event_type, epoch, seq, stream_seq, payload, error, attempts, status, created_at, updated_at, replayed_at`
+
+func scanDeadLetterEvent(row pgx.Row) (DeadLetterEvent, error) {
+	var event DeadLetterEvent
+	err := row.Scan(
+		&event.ID,
+		&event.EventID,
+		&event.EventType,
+		&event.Epoch,
+		&event.Seq,
+		&event.StreamSeq,
+		&event.Payload,
+		&event.Error,
+		&event.Attempts,
+		&event.Status,
+		&event.CreatedAt,
+		&event.UpdatedAt,
+		&event.ReplayedAt,
+	)
+	return event, err
+}
+
+// CreateDeadLetterEvent stores a failed engine event
+func (q *Queries) CreateDeadLetterEvent(ctx context.Context, arg CreateDeadLetterEventParams) (DeadLetterEvent, error) {
+	query := `INSERT INTO dead_letter_events (event_id, event_type, epoch, seq, stream_seq, payload, error, attempts)
+              VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+              RETURNING ` + deadLetterColumns
+
+	return scanDeadLetterEvent(q.db.QueryRow(ctx, query,
+		arg.EventID, arg.EventType, arg.Epoch, arg.Seq, arg.StreamSeq, arg.Payload, arg.Error, arg.Attempts,
+	))
+}
+
+// GetDeadLetterEvent returns a dead-letter event by id
+func (q *Queries) GetDeadLetterEvent(ctx context.Context, id int64) (DeadLetterEvent, error) {
+	query := `SELECT ` + deadLetterColumns + ` FROM dead_letter_events WHERE id = $1`
+
+	event, err := scanDeadLetterEvent(q.db.QueryRow(ctx, query, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return DeadLetterEvent{}, fmt.Errorf("dead-letter event not found")
+		}
+		return DeadLetterEvent{}, err
+	}
+	return event, nil
+}
+
+// ListDeadLetterEvents lists dead-letter events, newest first
+func (q *Queries) ListDeadLetterEvents(ctx context.Context, arg ListDeadLetterEventsParams) ([]DeadLetterEvent, error) {
+	query := `SELECT ` + deadLetterColumns + `
+              FROM dead_letter_events
+              WHERE ($1 = '' OR status = $1)
+              ORDER BY id DESC
+              LIMIT $2 OFFSET $3`
+
+	rows, err := q.db.Query(ctx, query, arg.Status, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []DeadLetterEvent
+	for rows.Next() {
+		event, err := scanDeadLetterEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// RecordDeadLetterFailure records a failed replay attempt
+func (q *Queries) RecordDeadLetterFailure(ctx context.Context, arg RecordDeadLetterFailureParams) error {
+	query := `UPDATE dead_letter_events
+              SET attempts = attempts + 1, error = $2, updated_at = NOW()
+              WHERE id = $1`
+
+	_, err := q.db.Exec(ctx, query, arg.ID, arg.Error)
+	return err
+}
+
+// UpdateDeadLetterEventStatus marks a dead-letter event as replayed or discarded
+func (q *Queries) UpdateDeadLetterEventStatus(ctx context.Context, id int64, status string) (DeadLetterEvent, error) {
+	query := `UPDATE dead_letter_events
+              SET status = $2,
+                  replayed_at = CASE WHEN $2 = 'replayed' THEN NOW() ELSE replayed_at END,
+                  updated_at = NOW()
+              WHERE id = $1
+              RETURNING ` + deadLetterColumns
+
+	event, err := scanDeadLetterEvent(q.db.QueryRow(ctx, query, id, status))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return DeadLetterEvent{}, fmt.Errorf("dead-letter event not found")
+		}
+		return DeadLetterEvent{}, err
+	}
+	return event, nil
+}
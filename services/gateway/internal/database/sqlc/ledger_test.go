@@ -0,0 +1,289 @@
+package db
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestCheckPostings(t *testing.T) {
+	tests := []struct {
+		name     string
+		postings []LedgerPosting
+		wantErr  string
+		want     int              // Số posting còn lại sau khi bỏ posting bằng 0
+		deltas   map[int64]string // Thay đổi số dư của từng ví
+	}{
+		{
+			name: "balanced transfer",
+			postings: []LedgerPosting{
+				{AccountID: 1, Currency: "USDT", Amount: "-10.5"},
+				{AccountID: 2, Currency: "USDT", Amount: "10.5"},
+			},
+			want:   2,
+			deltas: map[int64]string{1: "-10.50000000", 2: "10.50000000"},
+		},
+		{
+			name: "balanced per currency",
+			postings: []LedgerPosting{
+				{AccountID: 1, Currency: "USDT", Amount: "-100"},
+				{AccountID: 2, Currency: "USDT", Amount: "100"},
+				{AccountID: 2, Currency: "BTC", Amount: "-0.002"},
+				{AccountID: 1, Currency: "BTC", Amount: "0.002"},
+			},
+			want:   4,
+			deltas: map[int64]string{1: "-99.99800000", 2: "99.99800000"},
+		},
+		{
+			name: "zero postings are dropped",
+			postings: []LedgerPosting{
+				{SystemAccount: "system:deposits", Currency: "USDT", Amount: "-5"},
+				{AccountID: 1, Currency: "USDT", Amount: "5"},
+				{AccountID: 1, Currency: "USDT", Amount: "0.00000000"},
+			},
+			want:   2,
+			deltas: map[int64]string{1: "5.00000000"},
+		},
+		{
+			name: "same account twice",
+			postings: []LedgerPosting{
+				{AccountID: 1, Currency: "USDT", Amount: "-3"},
+				{SystemAccount: "system:fees:trading", Currency: "USDT", Amount: "3"},
+				{AccountID: 1, Currency: "USDT", Amount: "-1"},
+				{SystemAccount: "system:adjustments", Currency: "USDT", Amount: "1"},
+			},
+			want:   4,
+			deltas: map[int64]string{1: "-4.00000000"},
+		},
+		{
+			name: "unbalanced",
+			postings: []LedgerPosting{
+				{AccountID: 1, Currency: "USDT", Amount: "-10"},
+				{AccountID: 2, Currency: "USDT", Amount: "9.99999999"},
+			},
+			wantErr: "not balanced in USDT",
+		},
+		{
+			name: "balanced total but not per currency",
+			postings: []LedgerPosting{
+				{AccountID: 1, Currency: "USDT", Amount: "-1"},
+				{AccountID: 2, Currency: "BTC", Amount: "1"},
+			},
+			wantErr: "not balanced",
+		},
+		{
+			name:     "only zero postings",
+			postings: []LedgerPosting{{AccountID: 1, Currency: "USDT", Amount: "0"}},
+			wantErr:  "has no entries",
+		},
+		{
+			name: "invalid amount",
+			postings: []LedgerPosting{
+				{AccountID: 1, Currency: "USDT", Amount: "ten"},
+			},
+			wantErr: "invalid ledger amount",
+		},
+		{
+			name: "account and system account",
+			postings: []LedgerPosting{
+				{AccountID: 1, SystemAccount: "system:deposits", Currency: "USDT", Amount: "1"},
+				{AccountID: 2, Currency: "USDT", Amount: "-1"},
+			},
+			wantErr: "either an account or a system account",
+		},
+		{
+			name: "neither account nor system account",
+			postings: []LedgerPosting{
+				{Currency: "USDT", Amount: "1"},
+				{AccountID: 2, Currency: "USDT", Amount: "-1"},
+			},
+			wantErr: "either an account or a system account",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			postings, deltas, err := checkPostings(PostJournalParams{Type: LedgerTransfer, Postings: tt.postings})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(postings) != tt.want {
+				t.Errorf("len(postings) = %d, want %d", len(postings), tt.want)
+			}
+			if len(deltas) != len(tt.deltas) {
+				t.Errorf("deltas = %v, want %v", deltas, tt.deltas)
+			}
+			for id, want := range tt.deltas {
+				if got := deltas[id]; got == nil || got.FloatString(8) != want {
+					t.Errorf("delta of account %d = %v, want %s", id, got, want)
+				}
+			}
+		})
+	}
+}
+
+// ledgerDB giả lập các câu lệnh postJournal dùng: journal, entries và accounts.balance trong bộ nhớ
+type ledgerDB struct {
+	balances map[int64]*big.Rat
+}
+
+func (d *ledgerDB) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, nil
+}
+
+func (d *ledgerDB) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	return emptyRows{}, nil // INSERT ledger_entries ... RETURNING: test không cần entry trả về
+}
+
+func (d *ledgerDB) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	switch {
+	case strings.Contains(sql, "INSERT INTO ledger_journals"):
+		return scanFunc(func(dest ...interface{}) error {
+			*dest[0].(*int64) = 1
+			*dest[1].(*string) = args[0].(string)
+			return nil
+		})
+	case strings.Contains(sql, "UPDATE accounts"):
+		id := args[0].(int64)
+		delta, _ := new(big.Rat).SetString(args[1].(string))
+		balance := d.balances[id].Add(d.balances[id], delta)
+		return scanFunc(func(dest ...interface{}) error {
+			*dest[0].(*int64) = id
+			*dest[4].(*string) = balance.FloatString(8)
+			return nil
+		})
+	}
+	return scanFunc(func(dest ...interface{}) error { return pgx.ErrNoRows })
+}
+
+type scanFunc func(dest ...interface{}) error
+
+func (f scanFunc) Scan(dest ...interface{}) error { return f(dest...) }
+
+type emptyRows struct{}
+
+func (emptyRows) Close()                                       {}
+func (emptyRows) Err() error                                   { return nil }
+func (emptyRows) CommandTag() pgconn.CommandTag                { return pgconn.CommandTag{} }
+func (emptyRows) FieldDescriptions() []pgconn.FieldDescription { return nil }
+func (emptyRows) Next() bool                                   { return false }
+func (emptyRows) Scan(dest ...interface{}) error               { return nil }
+func (emptyRows) Values() ([]interface{}, error)               { return nil, nil }
+func (emptyRows) RawValues() [][]byte                          { return nil }
+func (emptyRows) Conn() *pgx.Conn                              { return nil }
+
+func TestPostJournalBalances(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  string // Chuyển từ ví 1 (số dư 10) sang ví 2 (số dư 0)
+		wantErr string
+		want    map[int64]string
+	}{
+		{"partial", "4", "", map[int64]string{1: "6.00000000", 2: "4.00000000"}},
+		{"whole balance", "10", "", map[int64]string{1: "0.00000000", 2: "10.00000000"}},
+		{"overdraft", "10.00000001", "insufficient balance", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := New(&ledgerDB{balances: map[int64]*big.Rat{1: big.NewRat(10, 1), 2: new(big.Rat)}})
+			_, accounts, err := q.postJournal(context.Background(), PostJournalParams{
+				Type: LedgerTransfer,
+				Postings: []LedgerPosting{
+					{AccountID: 1, Currency: "USDT", Amount: "-" + tt.amount},
+					{AccountID: 2, Currency: "USDT", Amount: tt.amount},
+				},
+			})
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for id, want := range tt.want {
+				if got := accounts[id].Balance; got != want {
+					t.Errorf("balance of account %d = %s, want %s", id, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestOrderHoldAmount(t *testing.T) {
+	tests := []struct {
+		symbol, side, price, quantity string
+		wantCurrency, wantAmount      string
+		wantErr                       bool
+	}{
+		{"BTC/USDT", "BUY", "50000", "0.5", "USDT", "25000.00000000", false},
+		{"BTC/USDT", "SELL", "50000", "0.5", "BTC", "0.50000000", false},
+		{"ETH/BTC", "BUY", "0.05123456", "1.23456789", "BTC", "0.06325254", false}, // Làm tròn 8 chữ số
+		{"BTC/USDT", "BUY", "0", "2", "USDT", "0.00000000", false},                 // Market BUY: không giữ trước
+		{"BTCUSDT", "BUY", "1", "1", "", "", true},
+		{"/USDT", "SELL", "1", "1", "", "", true},
+	}
+	for _, tt := range tests {
+		price, _ := new(big.Rat).SetString(tt.price)
+		quantity, _ := new(big.Rat).SetString(tt.quantity)
+		currency, amount, err := orderHoldAmount(tt.symbol, tt.side, price, quantity)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("orderHoldAmount(%s, %s): want error", tt.symbol, tt.side)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("orderHoldAmount(%s, %s): %v", tt.symbol, tt.side, err)
+			continue
+		}
+		if currency != tt.wantCurrency || amount.FloatString(8) != tt.wantAmount {
+			t.Errorf("orderHoldAmount(%s, %s, %s, %s) = %s %s, want %s %s",
+				tt.symbol, tt.side, tt.price, tt.quantity, amount.FloatString(8), currency, tt.wantAmount, tt.wantCurrency)
+		}
+	}
+}
+
+func TestTradeFee(t *testing.T) {
+	tests := []struct {
+		amount, rate string
+		want         string
+		wantErr      bool
+	}{
+		{"25000", "0.001", "25.00000000", false},
+		{"0.5", "0.002", "0.00100000", false},
+		{"0.00000001", "0.002", "0.00000000", false}, // Nhỏ hơn 1e-8 thì làm tròn về 0
+		{"100", "", "0.00000000", false},
+		{"100", "0", "0.00000000", false},
+		{"100", "-0.001", "", true},
+		{"100", "1", "", true},
+		{"100", "abc", "", true},
+	}
+	for _, tt := range tests {
+		amount, _ := new(big.Rat).SetString(tt.amount)
+		fee, err := tradeFee(amount, tt.rate)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("tradeFee(%s, %q): want error", tt.amount, tt.rate)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("tradeFee(%s, %q): %v", tt.amount, tt.rate, err)
+			continue
+		}
+		if got := fee.FloatString(8); got != tt.want {
+			t.Errorf("tradeFee(%s, %q) = %s, want %s", tt.amount, tt.rate, got, tt.want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"encoding/json"
 	"time"
 )
 
@@ -10,29 +11,34 @@ type Users struct {
 	Username     string    `json:"username"`
 	Email        string    `json:"email"`
 	PasswordHash string    `json:"password_hash"`
+	Role         string    `json:"role"` // "user", "support", "admin", "market-ops"
+	IsVerified   bool      `json:"is_verified"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 }
 
 // Accounts represents a user's account (wallet)
 type Accounts struct {
-	ID        int64     `json:"id"`
-	UserID    int32     `json:"user_id"`
-	Currency  string    `json:"currency"`
-	Balance   string    `json:"balance"` // Sử dụng string để tránh lỗi làm tròn
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID          int64     `json:"id"`
+	UserID      int32     `json:"user_id"`
+	AccountType string    `json:"account_type"` // "spot", "margin" hoặc "futures"
+	Currency    string    `json:"currency"`
+	Balance     string    `json:"balance"` // Sử dụng string để tránh lỗi làm tròn
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
 }
 
 // Transactions represents a transaction record
 type Transactions struct {
-	ID        int64     `json:"id"`
-	AccountID int64     `json:"account_id"`
-	Type      string    `json:"type"` // "deposit", "withdraw", "transfer"
-	Amount    string    `json:"amount"`
-	Status    string    `json:"status"` // "pending", "completed", "failed"
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID          int64     `json:"id"`
+	AccountID   int64     `json:"account_id"`
+	Type        string    `json:"type"` // "deposit", "withdraw", "transfer"
+	Amount      string    `json:"amount"`
+	Status      string    `json:"status"` // "pending", "completed", "failed"
+	Description *string   `json:"description,omitempty"`
+	ReferenceID *string   `json:"reference_id,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
 }
 
 // Orders represents a trading order
@@ -59,6 +65,266 @@ type Trades struct {
 	CreatedAt    time.Time `json:"created_at"`
 }
 
+// OutboxMessage represents a command waiting to be (or already) published to NATS
+type OutboxMessage struct {
+	ID          int64      `json:"id"`
+	AggregateID string     `json:"aggregate_id"`
+	Subject     string     `json:"subject"`
+	MsgID       string     `json:"msg_id"`
+	Payload     []byte     `json:"payload"`
+	Status      string     `json:"status"` // "pending", "sent"
+	Attempts    int32      `json:"attempts"`
+	LastError   *string    `json:"last_error"`
+	CreatedAt   time.Time  `json:"created_at"`
+	SentAt      *time.Time `json:"sent_at"`
+}
+
+// EventSequence is the last engine event sequence processed from a source
+type EventSequence struct {
+	Source    string    `json:"source"`
+	Epoch     int64     `json:"epoch"`
+	LastSeq   int64     `json:"last_seq"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DeadLetterEvent represents an engine event that failed processing
+type DeadLetterEvent struct {
+	ID         int64      `json:"id"`
+	EventID    *string    `json:"event_id"`
+	EventType  *string    `json:"event_type"`
+	Epoch      int64      `json:"epoch"`
+	Seq        int64      `json:"seq"`
+	StreamSeq  int64      `json:"stream_seq"`
+	Payload    string     `json:"payload"`
+	Error      string     `json:"error"`
+	Attempts   int32      `json:"attempts"`
+	Status     string     `json:"status"` // "pending", "replayed", "discarded"
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	ReplayedAt *time.Time `json:"replayed_at"`
+}
+
+// RejectedOrder is an order marked REJECTED after an engine rejection
+type RejectedOrder struct {
+	ID            string `json:"id"`
+	UserID        string `json:"user_id"`
+	Symbol        string `json:"symbol"`
+	EngineOrderID int64  `json:"engine_order_id"`
+	RejectReason  string `json:"reject_reason"`
+}
+
+// ReconcileOrder is an order with its fill progress, used to reconcile against the engine's book
+type ReconcileOrder struct {
+	ID            string    `json:"id"`
+	UserID        string    `json:"user_id"`
+	Symbol        string    `json:"symbol"`
+	Side          string    `json:"side"`
+	OrderType     string    `json:"order_type"`
+	Price         string    `json:"price"`
+	Quantity      string    `json:"quantity"`
+	Filled        string    `json:"filled"`    // Tổng khớp theo engine_trades
+	Remaining     string    `json:"remaining"` // quantity - filled
+	EngineOrderID int64     `json:"engine_order_id"`
+	Status        string    `json:"status"`
+	Held          bool      `json:"held"` // engine_orders còn 'pending' (đang giữ số dư)
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// StaleEngineHold is a pending engine order whose order is already closed
+type StaleEngineHold struct {
+	EngineOrderID int64  `json:"engine_order_id"`
+	Symbol        string `json:"symbol"`
+	OrderID       string `json:"order_id"`
+	OrderStatus   string `json:"order_status"`
+}
+
+// Session is a login session; access token mang session ID (sid), refresh token xoay vòng mỗi lần refresh
+type Session struct {
+	ID                       string     `json:"id"`
+	UserID                   string     `json:"user_id"`
+	TokenHash                string     `json:"-"` // SHA-256 của access token cấp gần nhất
+	RefreshTokenHash         string     `json:"-"`
+	PreviousRefreshTokenHash *string    `json:"-"`
+	IPAddress                *string    `json:"ip_address"`
+	UserAgent                *string    `json:"user_agent"`
+	ExpiresAt                time.Time  `json:"expires_at"`
+	CreatedAt                time.Time  `json:"created_at"`
+	LastActivity             time.Time  `json:"last_activity"`
+	RevokedAt                *time.Time `json:"revoked_at,omitempty"`
+}
+
+// APIKey is a user's API key for signed (HMAC) requests
+type APIKey struct {
+	ID               string     `json:"id"`
+	UserID           string     `json:"user_id"`
+	Username         string     `json:"-"` // Chủ key (JOIN users), dùng khi xác thực
+	Name             string     `json:"name"`
+	KeyPrefix        string     `json:"key_prefix"`
+	KeyHash          string     `json:"-"`
+	SecretHash       string     `json:"-"`
+	SecretCiphertext string     `json:"-"` // Secret mã hóa AES-GCM, giải mã để kiểm tra chữ ký
+	Permissions      []string   `json:"permissions"`
+	AllowedIPs       []string   `json:"allowed_ips"`
+	IsActive         bool       `json:"is_active"`
+	LastUsedAt       *time.Time `json:"last_used_at"`
+	ExpiresAt        *time.Time `json:"expires_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+}
+
+// UserTOTP is a user's TOTP enrollment
+type UserTOTP struct {
+	UserID           string     `json:"user_id"`
+	SecretCiphertext string     `json:"-"` // Secret base32 mã hóa AES-GCM
+	EnabledAt        *time.Time `json:"enabled_at"`
+	LastUsedStep     *int64     `json:"-"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+// LoginFailure counts recent failed logins for a username or an IP address
+type LoginFailure struct {
+	KeyType      string     `json:"key_type"` // "username" hoặc "ip"
+	Key          string     `json:"key"`
+	Failures     int32      `json:"failures"`
+	LastFailedAt time.Time  `json:"last_failed_at"`
+	LockedUntil  *time.Time `json:"locked_until"`
+}
+
+// AuditLog is a security- or money-relevant action
+type AuditLog struct {
+	ID           string          `json:"id"`
+	UserID       *string         `json:"user_id"`
+	Action       string          `json:"action"`
+	ResourceType *string         `json:"resource_type"`
+	ResourceID   *string         `json:"resource_id"`
+	IPAddress    *string         `json:"ip_address"`
+	UserAgent    *string         `json:"user_agent"`
+	Details      json.RawMessage `json:"details"`
+	CreatedAt    time.Time       `json:"created_at"`
+}
+
+// Currency is a supported currency with its withdrawal settings
+type Currency struct {
+	Code                string  `json:"code"`
+	Name                string  `json:"name"`
+	Type                string  `json:"type"` // "fiat" hoặc "crypto"
+	Decimals            int32   `json:"decimals"`
+	MinWithdrawal       string  `json:"min_withdrawal"`
+	MaxWithdrawal       *string `json:"max_withdrawal"` // nil = không giới hạn mỗi lần rút
+	WithdrawalFee       string  `json:"withdrawal_fee"`
+	IsWithdrawalEnabled bool    `json:"is_withdrawal_enabled"`
+	IsActive            bool    `json:"is_active"`
+}
+
+// Withdrawal is a withdrawal request; amount đã bị trừ khỏi ví cho tới khi bị từ chối/hủy/thất bại
+type Withdrawal struct {
+	ID                string     `json:"id"`
+	UserID            string     `json:"user_id"`
+	AccountID         int64      `json:"account_id"`
+	TransactionID     int64      `json:"transaction_id"`
+	Currency          string     `json:"currency"`
+	Amount            string     `json:"amount"`     // Trừ khỏi ví
+	Fee               string     `json:"fee"`        // Phí rút, nằm trong amount
+	NetAmount         string     `json:"net_amount"` // Số thực chuyển đi = amount - fee
+	Address           string     `json:"address"`
+	Status            string     `json:"status"`
+	ReviewedBy        *string    `json:"reviewed_by"`
+	ReviewedAt        *time.Time `json:"reviewed_at"`
+	ProcessedBy       *string    `json:"processed_by"`
+	ProcessedAt       *time.Time `json:"processed_at"`
+	ExternalReference *string    `json:"external_reference"` // Tx hash / mã chuyển khoản khi hoàn tất
+	FailureReason     *string    `json:"failure_reason"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+// LedgerJournal is a balanced set of ledger entries recording one balance movement
+type LedgerJournal struct {
+	ID          int64         `json:"id"`
+	Type        string        `json:"type"` // "deposit", "transfer", "withdrawal_hold"...
+	ReferenceID *string       `json:"reference_id"`
+	Description *string       `json:"description"`
+	CreatedAt   time.Time     `json:"created_at"`
+	Entries     []LedgerEntry `json:"entries"`
+}
+
+// LedgerEntry is one side of a ledger journal
+type LedgerEntry struct {
+	ID            int64     `json:"id"`
+	JournalID     int64     `json:"journal_id"`
+	LedgerAccount string    `json:"ledger_account"` // "account:<id>" hoặc "system:<tên>"
+	AccountID     *int64    `json:"account_id"`     // nil với tài khoản hệ thống
+	Currency      string    `json:"currency"`
+	Amount        string    `json:"amount"` // > 0 tăng số dư, < 0 giảm số dư
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// LedgerBalanceMismatch is an account whose balance differs from the sum of its ledger entries
+type LedgerBalanceMismatch struct {
+	AccountID     int64  `json:"account_id"`
+	UserID        int32  `json:"user_id"`
+	AccountType   string `json:"account_type"` // Rỗng = entry ghi vào ví không tồn tại hoặc khác currency
+	Currency      string `json:"currency"`
+	Balance       string `json:"balance"`        // accounts.balance
+	LedgerBalance string `json:"ledger_balance"` // Tổng entry
+}
+
+// LedgerImbalance is a journal whose entries do not sum to zero in a currency
+type LedgerImbalance struct {
+	JournalID int64  `json:"journal_id"`
+	Currency  string `json:"currency"`
+	Sum       string `json:"sum"`
+}
+
+// TransactionExportRow is one of the user's transactions in an export, kèm ví (loại + currency)
+type TransactionExportRow struct {
+	ID          int64     `json:"id"`
+	AccountType string    `json:"account_type"`
+	Currency    string    `json:"currency"`
+	Type        string    `json:"type"`
+	Amount      string    `json:"amount"`
+	Status      string    `json:"status"`
+	Description *string   `json:"description"`
+	ReferenceID *string   `json:"reference_id"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// OrderExportRow is one of the user's orders in an export
+type OrderExportRow struct {
+	ID           string    `json:"id"`
+	Symbol       string    `json:"symbol"`
+	Side         string    `json:"side"`
+	Type         string    `json:"type"`
+	Price        string    `json:"price"` // "0" với lệnh market
+	Quantity     string    `json:"quantity"`
+	Filled       string    `json:"filled"` // Tổng khớp từ engine_trades
+	Status       string    `json:"status"`
+	RejectReason *string   `json:"reject_reason"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// TradeExportRow is a fill of one of the user's orders in an export
+// (tự khớp lệnh của chính mình thì có hai dòng, mỗi phía một dòng)
+type TradeExportRow struct {
+	TradeID   int64     `json:"trade_id"`
+	OrderID   string    `json:"order_id"`
+	Symbol    string    `json:"symbol"`
+	Side      string    `json:"side"`
+	Liquidity string    `json:"liquidity"` // "maker" hoặc "taker"
+	Price     string    `json:"price"`
+	Amount    string    `json:"amount"`
+	Total     string    `json:"total"` // price * amount
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SymbolHalt is a symbol whose trading is halted (lệnh mới bị từ chối)
+type SymbolHalt struct {
+	Symbol   string    `json:"symbol"`
+	Reason   string    `json:"reason"`
+	HaltedBy string    `json:"halted_by"`
+	HaltedAt time.Time `json:"halted_at"`
+}
+
 // --- Parameter Types for Queries ---
 
 // CreateUserParams contains the parameters for creating a user
@@ -68,17 +334,19 @@ type CreateUserParams struct {
 	PasswordHash string
 }
 
-// GetAccountByUserAndTypeParams contains the parameters for getting an account by user and currency
+// GetAccountByUserAndTypeParams contains the parameters for getting an account by user, account type and currency
 type GetAccountByUserAndTypeParams struct {
-	UserID   int32
-	Currency string
+	UserID      int32
+	AccountType string // Rỗng = "spot"
+	Currency    string
 }
 
 // CreateAccountParams contains the parameters for creating an account
 type CreateAccountParams struct {
-	UserID   int32
-	Currency string
-	Balance  string
+	UserID      int32
+	AccountType string // Rỗng = "spot"
+	Currency    string
+	Balance     string
 }
 
 // UpdateAccountBalanceParams contains the parameters for updating an account balance
@@ -93,6 +361,65 @@ type CreateDepositParams struct {
 	Amount    string
 }
 
+// CreateTransactionParams contains the parameters for recording a balance movement
+type CreateTransactionParams struct {
+	AccountID   int64
+	Type        string // "deposit", "withdraw", "transfer_in", "transfer_out", "adjustment"
+	Amount      string
+	Status      string // "pending", "completed", ...
+	Description string
+	ReferenceID string
+}
+
+// GetTransactionsByAccountIDParams contains the filters for listing an account's transactions
+type GetTransactionsByAccountIDParams struct {
+	AccountID int64
+	Type      string // Rỗng = mọi loại
+	Limit     int32
+	Offset    int32
+}
+
+// CreateSymbolHaltParams contains the parameters for halting a symbol
+type CreateSymbolHaltParams struct {
+	Symbol   string
+	Reason   string
+	HaltedBy string
+}
+
+// RecordLoginFailureParams contains the parameters for recording a failed login
+type RecordLoginFailureParams struct {
+	KeyType     string
+	Key         string
+	ResetBefore time.Time // Lần sai cuối trước mốc này thì đếm lại từ 1
+	MaxFailures int32     // Đạt ngưỡng thì khóa tới LockedUntil
+	LockedUntil time.Time
+}
+
+// CreateAuditLogParams contains the parameters for writing an audit log entry
+type CreateAuditLogParams struct {
+	UserID       string // Rỗng = không gắn user (vd. username không tồn tại)
+	Action       string
+	ResourceType string
+	ResourceID   string // UUID, rỗng = không có
+	IPAddress    string
+	UserAgent    string
+	Details      map[string]interface{}
+	CreatedAt    time.Time // Thời điểm xảy ra; zero = lúc ghi
+}
+
+// ListAuditLogsParams contains the filters for listing audit log entries (chuỗi rỗng / nil = không lọc)
+type ListAuditLogsParams struct {
+	UserID       string
+	Action       string
+	ResourceType string
+	ResourceID   string
+	IPAddress    string
+	From         *time.Time // Bao gồm
+	To           *time.Time // Không bao gồm
+	Limit        int32
+	Offset       int32
+}
+
 // CreateOrderParams contains the parameters for creating an order
 type CreateOrderParams struct {
 	ID           int64
@@ -126,6 +453,120 @@ type GetLockedAmountParams struct {
 	Symbol   string
 }
 
+// CreateOutboxMessageParams contains the parameters for enqueuing a command in the outbox
+type CreateOutboxMessageParams struct {
+	AggregateID string
+	Subject     string
+	MsgID       string
+	Payload     []byte
+}
+
+// MarkOutboxMessageFailedParams contains the parameters for recording a failed publish attempt
+type MarkOutboxMessageFailedParams struct {
+	ID    int64
+	Error string
+}
+
+// MarkEventProcessedParams contains the parameters for recording a processed engine event
+type MarkEventProcessedParams struct {
+	EventID   string
+	EventType string
+	Epoch     int64
+	Seq       int64
+}
+
+// UpsertEventSequenceParams contains the parameters for advancing an event source's sequence
+type UpsertEventSequenceParams struct {
+	Source  string
+	Epoch   int64
+	LastSeq int64
+}
+
+// CreateDeadLetterEventParams contains the parameters for storing a failed engine event
+type CreateDeadLetterEventParams struct {
+	EventID   *string
+	EventType *string
+	Epoch     int64
+	Seq       int64
+	StreamSeq int64
+	Payload   string
+	Error     string
+	Attempts  int32
+}
+
+// ListDeadLetterEventsParams contains the parameters for listing dead-letter events
+type ListDeadLetterEventsParams struct {
+	Status string // Rỗng = tất cả
+	Limit  int32
+	Offset int32
+}
+
+// RecordDeadLetterFailureParams contains the parameters for recording a failed replay
+type RecordDeadLetterFailureParams struct {
+	ID    int64
+	Error string
+}
+
+// RejectOrderParams contains the parameters for rejecting an order by its engine id
+type RejectOrderParams struct {
+	EngineOrderID int64
+	Reason        string
+}
+
+// CloseOrderParams contains the parameters for moving an open order to a final status
+type CloseOrderParams struct {
+	ID     string // UUID
+	Status string // FILLED hoặc CANCELLED
+}
+
+// CloseOrderTxParams contains input parameters for closing an order and releasing its hold
+type CloseOrderTxParams struct {
+	ID            string
+	EngineOrderID int64
+	Status        string
+}
+
+// CreateSessionParams contains the input parameters for creating a session
+type CreateSessionParams struct {
+	ID               string
+	UserID           string
+	TokenHash        string
+	RefreshTokenHash string
+	IPAddress        string
+	UserAgent        string
+	ExpiresAt        time.Time
+}
+
+// RotateSessionParams contains the input parameters for rotating a session's tokens
+type RotateSessionParams struct {
+	ID                  string
+	OldRefreshTokenHash string // Refresh token đang dùng; không khớp (đã bị xoay bởi request khác) = thất bại
+	TokenHash           string
+	RefreshTokenHash    string
+}
+
+// CreateAPIKeyParams contains the input parameters for creating an API key
+type CreateAPIKeyParams struct {
+	UserID           string
+	Name             string
+	KeyPrefix        string
+	KeyHash          string
+	SecretHash       string
+	SecretCiphertext string
+	Permissions      []string
+	AllowedIPs       []string
+	ExpiresAt        *time.Time
+}
+
+// AdjustBalanceTxParams contains the input parameters of an admin balance adjustment
+type AdjustBalanceTxParams struct {
+	UserID   string
+	Currency string
+	Amount   string // Có dấu: dương = cộng, âm = trừ
+	Reason   string // Bắt buộc, lưu vào description của transaction
+	Actor    string // Username của người điều chỉnh, lưu vào reference_id
+}
+
 // DepositTxParams contains input parameters for deposit transaction
 type DepositTxParams struct {
 	UserID   string `json:"user_id"`
@@ -138,3 +579,147 @@ type DepositTxResult struct {
 	Account     Accounts     `json:"account"`
 	Transaction Transactions `json:"transaction"`
 }
+
+// ListWithdrawalsParams contains the filters for listing withdrawals (chuỗi rỗng = không lọc)
+type ListWithdrawalsParams struct {
+	UserID   string
+	Status   string
+	Currency string
+	Limit    int32
+	Offset   int32
+}
+
+// CreateWithdrawalTxParams contains the input parameters of a withdrawal request
+type CreateWithdrawalTxParams struct {
+	UserID     string
+	Currency   string
+	Amount     string
+	Fee        string
+	Address    string
+	DailyLimit string    // Tổng amount tối đa của các yêu cầu (trừ bị từ chối/hủy/thất bại) từ Since; rỗng = không giới hạn
+	Since      time.Time // Đầu cửa sổ tính DailyLimit
+}
+
+// CreateWithdrawalTxResult contains the result of a withdrawal request
+type CreateWithdrawalTxResult struct {
+	Withdrawal  Withdrawal   `json:"withdrawal"`
+	Account     Accounts     `json:"account"`
+	Transaction Transactions `json:"transaction"`
+}
+
+// TransitionWithdrawalTxParams contains the input parameters for moving a withdrawal to another status
+type TransitionWithdrawalTxParams struct {
+	ID                string
+	UserID            string // Khác rỗng = chỉ áp dụng cho withdrawal của user này (user tự hủy)
+	Status            string // Trạng thái mới
+	Actor             string // Người duyệt / xử lý
+	Reason            string // Lý do từ chối / thất bại
+	ExternalReference string // Tx hash / mã chuyển khoản khi completed
+}
+
+// TransitionWithdrawalTxResult contains the result of a withdrawal status change
+type TransitionWithdrawalTxResult struct {
+	Withdrawal Withdrawal `json:"withdrawal"`
+	Account    *Accounts  `json:"account,omitempty"` // Số dư sau khi hoàn tiền (rejected/cancelled/failed)
+}
+
+// AdjustBalanceTxResult contains the result of a balance adjustment
+type AdjustBalanceTxResult struct {
+	Account     Accounts     `json:"account"`
+	Transaction Transactions `json:"transaction"`
+}
+
+// TransferTxParams contains the input parameters of an internal transfer.
+// Cùng user = chuyển giữa các ví spot/margin/futures; khác user = chuyển cho user khác.
+type TransferTxParams struct {
+	FromUserID      string
+	FromAccountType string
+	ToUserID        string
+	ToAccountType   string
+	Currency        string
+	Amount          string // Số dương
+	Description     string
+}
+
+// TransferTxResult contains the result of an internal transfer
+type TransferTxResult struct {
+	TransferID      string       `json:"transfer_id"` // reference_id của hai transaction là "transfer:<id>"
+	FromAccount     Accounts     `json:"from_account"`
+	ToAccount       Accounts     `json:"to_account"`
+	FromTransaction Transactions `json:"from_transaction"` // transfer_out
+	ToTransaction   Transactions `json:"to_transaction"`   // transfer_in
+}
+
+// SettleTradeParams contains the input parameters for settling a trade in the ledger
+type SettleTradeParams struct {
+	TradeID       int64
+	BuyerOrderID  int64 // engine_order_id của lệnh mua
+	SellerOrderID int64 // engine_order_id của lệnh bán
+	TakerOrderID  int64 // engine_order_id của lệnh khớp vào sổ (BuyerOrderID hoặc SellerOrderID)
+	Price         string
+	Amount        string
+	MakerFeeRate  string // Phí của lệnh nằm trong sổ, vd. "0.001"; mỗi bên trả trên phần mình nhận được
+	TakerFeeRate  string // Phí của lệnh khớp vào sổ
+}
+
+// LedgerPosting is one entry to post: AccountID của ví user, hoặc SystemAccount (vd. "system:deposits")
+type LedgerPosting struct {
+	AccountID     int64
+	SystemAccount string
+	Currency      string
+	Amount        string // Có dấu; tổng các posting của một currency phải bằng 0
+}
+
+// PostJournalParams contains the input parameters for posting a ledger journal
+type PostJournalParams struct {
+	Type        string
+	ReferenceID string
+	Description string
+	Postings    []LedgerPosting
+}
+
+// ListLedgerJournalsParams contains the filters for listing ledger journals (rỗng/0 = không lọc)
+type ListLedgerJournalsParams struct {
+	AccountID   int64
+	Type        string
+	ReferenceID string
+	Limit       int32
+	Offset      int32
+}
+
+// ExportParams selects a user's records created in [From, To) for an export
+type ExportParams struct {
+	UserID string
+	From   time.Time
+	To     time.Time
+}
+
+// PlaceOrderTxParams contains input parameters for placing an order together with its engine command
+type PlaceOrderTxParams struct {
+	UserID        string
+	Symbol        string
+	Side          string // "BUY" or "SELL"
+	OrderType     string // "LIMIT" or "MARKET"
+	Price         float64
+	Quantity      float64
+	EngineOrderID int64  // ID số gửi sang engine, dùng để map event về order
+	Subject       string // NATS subject của command
+	Command       []byte // Command đã serialize gửi sang engine
+}
+
+// PlaceOrderTxResult contains the result of place order transaction
+type PlaceOrderTxResult struct {
+	OrderID  string `json:"order_id"`
+	OutboxID int64  `json:"outbox_id"`
+}
+
+// ProcessEventBatchTxParams contains input parameters for processing a batch of engine events exactly once
+type ProcessEventBatchTxParams struct {
+	Source string                     // Nguồn sequence, ví dụ "engine"
+	Events []MarkEventProcessedParams // Theo thứ tự áp dụng; Seq = 0 nếu event không có sequence
+}
+
+// ProcessEventBatchTxResult contains the result of process event batch transaction
+type ProcessEventBatchTxResult struct {
+	Duplicate []bool `json:"duplicate"` // Theo chỉ số event: đã xử lý trước đó, side effect không chạy lại
+}
@@ -2,8 +2,13 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
 
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/trading-platform/gateway/internal/util"
@@ -13,9 +18,26 @@ import (
 type Store interface {
 	Querier
 	DepositTx(ctx context.Context, arg DepositTxParams) (DepositTxResult, error)
+	AdjustBalanceTx(ctx context.Context, arg AdjustBalanceTxParams) (AdjustBalanceTxResult, error)
 	CreateAccountIfNotExists(ctx context.Context, userID int32, currency string) (Accounts, error)
 	InsertOrderWithUUID(ctx context.Context, userID, symbol, side, orderType string, price, quantity float64) (string, error)
 	ListOrdersWithUUID(ctx context.Context, userID string) ([]map[string]interface{}, error)
+	UpdateOrderStatusWithUUID(ctx context.Context, orderID, status string) error
+	PlaceOrderTx(ctx context.Context, arg PlaceOrderTxParams) (PlaceOrderTxResult, error)
+	RelayOutboxTx(ctx context.Context, limit int32, publish func(OutboxMessage) error) (int, error)
+	ProcessEventBatchTx(ctx context.Context, arg ProcessEventBatchTxParams, fn func(b *EventBatch, i int) error) (ProcessEventBatchTxResult, error)
+	DeadLetterEventTx(ctx context.Context, source string, arg CreateDeadLetterEventParams) (DeadLetterEvent, error)
+	CloseOrderTx(ctx context.Context, arg CloseOrderTxParams) (bool, error)
+	EnableTOTPTx(ctx context.Context, userID string, step int64, codeHashes []string) (UserTOTP, error)
+	ReplaceRecoveryCodesTx(ctx context.Context, userID string, codeHashes []string) error
+	DisableTOTPTx(ctx context.Context, userID string) (bool, error)
+	TransferTx(ctx context.Context, arg TransferTxParams) (TransferTxResult, error)
+	SyncAccountBalanceTx(ctx context.Context, accountID int64) (Accounts, bool, error)
+	CreateWithdrawalTx(ctx context.Context, arg CreateWithdrawalTxParams) (CreateWithdrawalTxResult, error)
+	TransitionWithdrawalTx(ctx context.Context, arg TransitionWithdrawalTxParams) (TransitionWithdrawalTxResult, error)
+	ExportTransactionsTx(ctx context.Context, arg ExportParams, fn func(TransactionExportRow) error) error
+	ExportOrdersTx(ctx context.Context, arg ExportParams, fn func(OrderExportRow) error) error
+	ExportTradesTx(ctx context.Context, arg ExportParams, fn func(TradeExportRow) error) error
 }
 
 // SQLStore cung cấp tất cả các chức năng để thực hiện db queries và transactions
@@ -83,17 +105,7 @@ func (store *SQLStore) DepositTx(ctx context.Context, arg DepositTxParams) (Depo
 			}
 		}
 
-		// 2. Cộng tiền vào ví (Update Balance)
-		// SQL tự động xử lý phép cộng decimal an toàn
-		result.Account, err = q.UpdateAccountBalance(ctx, UpdateAccountBalanceParams{
-			ID:     account.ID,
-			Amount: arg.Amount,
-		})
-		if err != nil {
-			return fmt.Errorf("failed to update balance: %w", err)
-		}
-
-		// 3. Ghi lịch sử giao dịch (Create Deposit Record)
+		// 2. Ghi lịch sử giao dịch (Create Deposit Record)
 		result.Transaction, err = q.CreateDeposit(ctx, CreateDepositParams{
 			AccountID: account.ID,
 			Amount:    arg.Amount,
@@ -102,6 +114,168 @@ func (store *SQLStore) DepositTx(ctx context.Context, arg DepositTxParams) (Depo
 			return fmt.Errorf("failed to create deposit record: %w", err)
 		}
 
+		// 3. Ghi sổ cái và cộng tiền vào ví
+		_, accounts, err := q.postJournal(ctx, PostJournalParams{
+			Type:        LedgerDeposit,
+			ReferenceID: transactionReference(result.Transaction),
+			Postings: []LedgerPosting{
+				{AccountID: account.ID, Currency: arg.Currency, Amount: arg.Amount},
+				{SystemAccount: ledgerDeposits, Currency: arg.Currency, Amount: negate(arg.Amount)},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		result.Account = accounts[account.ID]
+
+		return nil
+	})
+
+	return result, err
+}
+
+// AdjustBalanceTx cộng/trừ số dư của user (admin điều chỉnh) và ghi transaction "adjustment" kèm lý do.
+// Số dư không được âm sau khi trừ.
+func (store *SQLStore) AdjustBalanceTx(ctx context.Context, arg AdjustBalanceTxParams) (AdjustBalanceTxResult, error) {
+	var result AdjustBalanceTxResult
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		account, err := q.GetAccountByUserAndType(ctx, GetAccountByUserAndTypeParams{
+			UserID:   util.HashStringToInt32(arg.UserID),
+			Currency: arg.Currency,
+		})
+		if err != nil {
+			if err.Error() != "account not found" {
+				return fmt.Errorf("failed to get account: %w", err)
+			}
+			account, err = q.CreateAccount(ctx, CreateAccountParams{
+				UserID:   util.HashStringToInt32(arg.UserID),
+				Currency: arg.Currency,
+				Balance:  "0",
+			})
+			if err != nil {
+				return fmt.Errorf("failed to create account: %w", err)
+			}
+		}
+
+		result.Transaction, err = q.CreateTransaction(ctx, CreateTransactionParams{
+			AccountID:   account.ID,
+			Type:        "adjustment",
+			Amount:      arg.Amount,
+			Status:      "completed",
+			Description: arg.Reason,
+			ReferenceID: "admin:" + arg.Actor,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create adjustment record: %w", err)
+		}
+
+		_, accounts, err := q.postJournal(ctx, PostJournalParams{
+			Type:        LedgerAdjustment,
+			ReferenceID: transactionReference(result.Transaction),
+			Description: arg.Reason,
+			Postings: []LedgerPosting{
+				{AccountID: account.ID, Currency: arg.Currency, Amount: arg.Amount},
+				{SystemAccount: ledgerAdjustments, Currency: arg.Currency, Amount: negate(arg.Amount)},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		result.Account = accounts[account.ID]
+		return nil
+	})
+
+	return result, err
+}
+
+// --- Logic Nghiệp vụ: Chuyển tiền nội bộ (Transaction) ---
+
+// TransferTx chuyển tiền giữa hai ví: trừ ví nguồn, cộng ví đích (tạo nếu chưa có)
+// và ghi cặp transaction transfer_out/transfer_in cùng reference_id.
+func (store *SQLStore) TransferTx(ctx context.Context, arg TransferTxParams) (TransferTxResult, error) {
+	var result TransferTxResult
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		// 1. Ví nguồn phải có sẵn; ví đích tạo mới nếu chưa có
+		from, err := q.GetAccountByUserAndType(ctx, GetAccountByUserAndTypeParams{
+			UserID:      util.HashStringToInt32(arg.FromUserID),
+			AccountType: arg.FromAccountType,
+			Currency:    arg.Currency,
+		})
+		if err != nil {
+			if err.Error() == "account not found" {
+				return fmt.Errorf("insufficient balance")
+			}
+			return fmt.Errorf("failed to get source account: %w", err)
+		}
+
+		to, err := q.GetAccountByUserAndType(ctx, GetAccountByUserAndTypeParams{
+			UserID:      util.HashStringToInt32(arg.ToUserID),
+			AccountType: arg.ToAccountType,
+			Currency:    arg.Currency,
+		})
+		if err != nil {
+			if err.Error() != "account not found" {
+				return fmt.Errorf("failed to get destination account: %w", err)
+			}
+			to, err = q.CreateAccount(ctx, CreateAccountParams{
+				UserID:      util.HashStringToInt32(arg.ToUserID),
+				AccountType: arg.ToAccountType,
+				Currency:    arg.Currency,
+				Balance:     "0",
+			})
+			if err != nil {
+				return fmt.Errorf("failed to create destination account: %w", err)
+			}
+		}
+		if from.ID == to.ID {
+			return fmt.Errorf("cannot transfer to the same account")
+		}
+
+		// 2. Ghi sổ cái: ví nguồn -> ví đích (postJournal khóa hai ví theo thứ tự ID nên không deadlock)
+		result.TransferID = uuid.NewString()
+		reference := "transfer:" + result.TransferID
+
+		_, accounts, err := q.postJournal(ctx, PostJournalParams{
+			Type:        LedgerTransfer,
+			ReferenceID: reference,
+			Description: arg.Description,
+			Postings: []LedgerPosting{
+				{AccountID: from.ID, Currency: arg.Currency, Amount: "-" + arg.Amount},
+				{AccountID: to.ID, Currency: arg.Currency, Amount: arg.Amount},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		result.FromAccount, result.ToAccount = accounts[from.ID], accounts[to.ID]
+
+		// 3. Cặp transaction cùng reference_id
+
+		result.FromTransaction, err = q.CreateTransaction(ctx, CreateTransactionParams{
+			AccountID:   from.ID,
+			Type:        "transfer_out",
+			Amount:      "-" + arg.Amount,
+			Status:      "completed",
+			Description: arg.Description,
+			ReferenceID: reference,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create transfer_out record: %w", err)
+		}
+
+		result.ToTransaction, err = q.CreateTransaction(ctx, CreateTransactionParams{
+			AccountID:   to.ID,
+			Type:        "transfer_in",
+			Amount:      arg.Amount,
+			Status:      "completed",
+			Description: arg.Description,
+			ReferenceID: reference,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create transfer_in record: %w", err)
+		}
 		return nil
 	})
 
@@ -133,19 +307,102 @@ func (store *SQLStore) CreateAccountIfNotExists(ctx context.Context, userID int3
 	return Accounts{}, err
 }
 
-// InsertOrderWithUUID inserts order into orders table with UUID
-func (store *SQLStore) InsertOrderWithUUID(ctx context.Context, userID, symbol, side, orderType string, price, quantity float64) (string, error) {
-	query := `
-		INSERT INTO orders (user_id, symbol, side, order_type, price, quantity, status, created_at)
-		VALUES ($1::uuid, $2, $3, $4, $5, $6, 'OPEN', NOW())
+const insertOrderWithUUIDQuery = `
+		INSERT INTO orders (user_id, symbol, side, order_type, price, quantity, engine_order_id, status, created_at)
+		VALUES ($1::uuid, $2, $3, $4, $5, $6, $7, 'OPEN', NOW())
 		RETURNING id::text
 	`
-	
+
+// InsertOrderWithUUID inserts order into orders table with UUID
+func (store *SQLStore) InsertOrderWithUUID(ctx context.Context, userID, symbol, side, orderType string, price, quantity float64) (string, error) {
 	var orderID string
-	err := store.connPool.QueryRow(ctx, query, userID, symbol, side, orderType, price, quantity).Scan(&orderID)
+	err := store.connPool.QueryRow(ctx, insertOrderWithUUIDQuery, userID, symbol, side, orderType, price, quantity, nil).Scan(&orderID)
 	return orderID, err
 }
 
+// --- Logic Nghiệp vụ: Đặt lệnh (Transaction) ---
+
+// PlaceOrderTx lưu order, command gửi sang engine (outbox) và journal giữ số dư trong cùng một transaction.
+// Order chỉ tồn tại khi command đã được ghi, relay worker sẽ publish command sau commit.
+// Ví không đủ số dư -> "insufficient balance", không có gì được ghi.
+func (store *SQLStore) PlaceOrderTx(ctx context.Context, arg PlaceOrderTxParams) (PlaceOrderTxResult, error) {
+	var result PlaceOrderTxResult
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		// 1. Ghi order
+		err := q.db.QueryRow(ctx, insertOrderWithUUIDQuery,
+			arg.UserID, arg.Symbol, arg.Side, arg.OrderType, arg.Price, arg.Quantity, arg.EngineOrderID,
+		).Scan(&result.OrderID)
+		if err != nil {
+			return fmt.Errorf("failed to insert order: %w", err)
+		}
+
+		// 2. Ghi command vào outbox, dùng order UUID làm Nats-Msg-Id
+		msg, err := q.CreateOutboxMessage(ctx, CreateOutboxMessageParams{
+			AggregateID: result.OrderID,
+			Subject:     arg.Subject,
+			MsgID:       result.OrderID,
+			Payload:     arg.Command,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to enqueue order command: %w", err)
+		}
+		result.OutboxID = msg.ID
+
+		// 3. Giữ số dư cho order (ví -> system:orders_held:<order id>)
+		return q.holdOrder(ctx, result.OrderID, arg)
+	})
+
+	return result, err
+}
+
+// --- Logic Nghiệp vụ: Outbox relay (Transaction) ---
+
+// RelayOutboxTx khóa tối đa limit command pending, gọi publish theo đúng thứ tự ghi
+// và đánh dấu sent. Dừng ở command đầu tiên publish lỗi (ghi lại lỗi, giữ pending)
+// để engine không nhận Cancel trước Place. Trả về số command đã publish.
+func (store *SQLStore) RelayOutboxTx(ctx context.Context, limit int32, publish func(OutboxMessage) error) (int, error) {
+	sent := 0
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		sent = 0
+
+		messages, err := q.ListPendingOutboxMessages(ctx, limit)
+		if err != nil {
+			return fmt.Errorf("failed to list pending outbox messages: %w", err)
+		}
+
+		for _, msg := range messages {
+			if pubErr := publish(msg); pubErr != nil {
+				if err := q.MarkOutboxMessageFailed(ctx, MarkOutboxMessageFailedParams{
+					ID:    msg.ID,
+					Error: pubErr.Error(),
+				}); err != nil {
+					return fmt.Errorf("failed to record outbox failure: %w", err)
+				}
+				return nil
+			}
+
+			if err := q.MarkOutboxMessageSent(ctx, msg.ID); err != nil {
+				return fmt.Errorf("failed to mark outbox message sent: %w", err)
+			}
+			sent++
+		}
+
+		return nil
+	})
+
+	return sent, err
+}
+
+// UpdateOrderStatusWithUUID updates the status of an order in orders table
+func (store *SQLStore) UpdateOrderStatusWithUUID(ctx context.Context, orderID, status string) error {
+	query := `UPDATE orders SET status = $2, updated_at = NOW() WHERE id = $1::uuid`
+
+	_, err := store.connPool.Exec(ctx, query, orderID, status)
+	return err
+}
+
 // ListOrdersWithUUID lists orders from orders table with UUID
 func (store *SQLStore) ListOrdersWithUUID(ctx context.Context, userID string) ([]map[string]interface{}, error) {
 	query := `
@@ -162,23 +419,23 @@ func (store *SQLStore) ListOrdersWithUUID(ctx context.Context, userID string) ([
 		WHERE user_id = $1::uuid AND status IN ('OPEN', 'PARTIALLY_FILLED')
 		ORDER BY created_at DESC
 	`
-	
+
 	rows, err := store.connPool.Query(ctx, query, userID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	
+
 	var orders []map[string]interface{}
 	for rows.Next() {
 		var id, symbol, side, orderType, status, createdAt string
 		var price, amount float64
-		
+
 		err := rows.Scan(&id, &symbol, &side, &orderType, &price, &amount, &status, &createdAt)
 		if err != nil {
 			return nil, err
 		}
-		
+
 		orders = append(orders, map[string]interface{}{
 			"id":         id,
 			"symbol":     symbol,
@@ -190,6 +447,928 @@ func (store *SQLStore) ListOrdersWithUUID(ctx context.Context, userID string) ([
 			"created_at": createdAt,
 		})
 	}
-	
+
 	return orders, nil
 }
+
+// --- Logic Nghiệp vụ: Xử lý event từ engine (Transaction) ---
+
+// EventBatch là Queries trong transaction xử lý một lô event.
+// Các bản ghi nhiều và đơn giản (trade) được gom lại, insert một lần trước khi commit.
+type EventBatch struct {
+	*Queries
+	trades []CreateTradeParams
+	filled map[int64]*big.Rat // engine order id -> số lượng khớp trong các trade đang gom (chưa có trong engine_trades)
+}
+
+// AddTrade gom trade để insert cùng các trade khác trong lô
+func (b *EventBatch) AddTrade(arg CreateTradeParams) {
+	b.trades = append(b.trades, arg)
+
+	amount, ok := new(big.Rat).SetString(arg.Amount)
+	if !ok {
+		return
+	}
+	if b.filled == nil {
+		b.filled = make(map[int64]*big.Rat)
+	}
+	for _, id := range []int64{arg.MakerOrderID, arg.TakerOrderID} {
+		if b.filled[id] == nil {
+			b.filled[id] = new(big.Rat)
+		}
+		b.filled[id].Add(b.filled[id], amount)
+	}
+}
+
+// FillOrder cập nhật trạng thái order theo tổng số lượng đã khớp (engine_trades cộng các trade đang gom):
+// khớp hết -> FILLED và trả phần còn giữ về ví (vd. lệnh mua khớp giá thấp hơn giá đặt), khớp một phần -> PARTIALLY_FILLED.
+// Gọi sau AddTrade và SettleTrade của trade đó.
+func (b *EventBatch) FillOrder(ctx context.Context, engineOrderID int64) error {
+	order, err := b.GetOrderByEngineID(ctx, engineOrderID)
+	if err != nil {
+		return err
+	}
+	if order.Status != "OPEN" && order.Status != "PARTIALLY_FILLED" {
+		return nil // Đã đóng trước khi event trade tới (vd. hủy)
+	}
+
+	filled, ok := new(big.Rat).SetString(order.Filled)
+	if !ok {
+		return fmt.Errorf("invalid filled quantity of order %s", order.ID)
+	}
+	quantity, ok := new(big.Rat).SetString(order.Quantity)
+	if !ok {
+		return fmt.Errorf("invalid quantity of order %s", order.ID)
+	}
+	if pending := b.filled[engineOrderID]; pending != nil {
+		filled.Add(filled, pending)
+	}
+
+	if filled.Cmp(quantity) < 0 {
+		if order.Status == "OPEN" {
+			return b.MarkOrderPartiallyFilled(ctx, order.ID)
+		}
+		return nil
+	}
+
+	closed, err := b.CloseOrder(ctx, CloseOrderParams{ID: order.ID, Status: "FILLED"})
+	if err != nil {
+		return fmt.Errorf("failed to close filled order: %w", err)
+	}
+	if !closed {
+		return nil
+	}
+	if _, err := b.ReleaseEngineOrder(ctx, engineOrderID, "filled"); err != nil {
+		return fmt.Errorf("failed to release engine order: %w", err)
+	}
+	return b.ReleaseOrderHold(ctx, order.ID)
+}
+
+// flush ghi các bản ghi đã gom
+func (b *EventBatch) flush(ctx context.Context) error {
+	if _, err := b.CreateTrades(ctx, b.trades); err != nil {
+		return fmt.Errorf("failed to store trades: %w", err)
+	}
+	b.trades = nil
+	return nil
+}
+
+// ProcessEventBatchTx chạy side effect của một lô event đúng một lần, trong một transaction:
+// ghi processed_events, gọi fn cho từng event chưa xử lý (theo thứ tự), ghi các bản ghi đã gom
+// và tiến sequence của source. Lỗi ở bất kỳ event nào -> rollback cả lô.
+func (store *SQLStore) ProcessEventBatchTx(ctx context.Context, arg ProcessEventBatchTxParams, fn func(b *EventBatch, i int) error) (ProcessEventBatchTxResult, error) {
+	var result ProcessEventBatchTxResult
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		result.Duplicate = make([]bool, len(arg.Events))
+
+		// 1. Đánh dấu event đã xử lý (khóa chính event_id chặn xử lý trùng)
+		inserted, err := q.MarkEventsProcessed(ctx, arg.Events)
+		if err != nil {
+			return fmt.Errorf("failed to mark events processed: %w", err)
+		}
+
+		// 2. Side effect của từng event; event trùng (kể cả trùng trong cùng lô) bị bỏ qua
+		batch := &EventBatch{Queries: q}
+		var last UpsertEventSequenceParams
+		for i, event := range arg.Events {
+			if !inserted[event.EventID] {
+				result.Duplicate[i] = true
+				continue
+			}
+			delete(inserted, event.EventID)
+
+			if err := fn(batch, i); err != nil {
+				return err
+			}
+			if event.Seq > 0 && (event.Epoch > last.Epoch || (event.Epoch == last.Epoch && event.Seq > last.LastSeq)) {
+				last = UpsertEventSequenceParams{Source: arg.Source, Epoch: event.Epoch, LastSeq: event.Seq}
+			}
+		}
+		if err := batch.flush(ctx); err != nil {
+			return err
+		}
+
+		// 3. Sequence đã xử lý (event cũ không có sequence thì bỏ qua)
+		if last.LastSeq > 0 {
+			if err := q.UpsertEventSequence(ctx, last); err != nil {
+				return fmt.Errorf("failed to update event sequence: %w", err)
+			}
+		}
+		return nil
+	})
+
+	return result, err
+}
+
+// --- Logic Nghiệp vụ: Dead-letter (Transaction) ---
+
+// DeadLetterEventTx lưu event xử lý thất bại vào dead_letter_events.
+// Sequence của event vẫn được tính là đã qua để các event sau không bị dừng vì gap;
+// side effect sẽ được áp dụng khi operator replay.
+func (store *SQLStore) DeadLetterEventTx(ctx context.Context, source string, arg CreateDeadLetterEventParams) (DeadLetterEvent, error) {
+	var result DeadLetterEvent
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		var err error
+
+		result, err = q.CreateDeadLetterEvent(ctx, arg)
+		if err != nil {
+			return fmt.Errorf("failed to store dead-letter event: %w", err)
+		}
+
+		if arg.Seq > 0 {
+			if err := q.UpsertEventSequence(ctx, UpsertEventSequenceParams{
+				Source:  source,
+				Epoch:   arg.Epoch,
+				LastSeq: arg.Seq,
+			}); err != nil {
+				return fmt.Errorf("failed to update event sequence: %w", err)
+			}
+		}
+		return nil
+	})
+
+	return result, err
+}
+
+// --- Logic Nghiệp vụ: Đối soát (Transaction) ---
+
+// CloseOrderTx đóng order (FILLED/CANCELLED), giải phóng engine_orders và trả phần số dư order còn giữ về ví.
+// Trả về false nếu order đã đóng từ trước (không thay đổi gì).
+func (store *SQLStore) CloseOrderTx(ctx context.Context, arg CloseOrderTxParams) (bool, error) {
+	var closed bool
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		var err error
+
+		closed, err = q.CloseOrder(ctx, CloseOrderParams{ID: arg.ID, Status: arg.Status})
+		if err != nil {
+			return fmt.Errorf("failed to close order: %w", err)
+		}
+		if !closed {
+			return nil
+		}
+
+		if _, err := q.ReleaseEngineOrder(ctx, arg.EngineOrderID, strings.ToLower(arg.Status)); err != nil {
+			return fmt.Errorf("failed to release engine order: %w", err)
+		}
+		return q.ReleaseOrderHold(ctx, arg.ID)
+	})
+
+	return closed, err
+}
+
+// --- Logic Nghiệp vụ: Xác thực hai lớp (Transaction) ---
+
+// EnableTOTPTx bật TOTP đang chờ xác nhận và thay bộ mã khôi phục.
+// step là bước thời gian của mã xác nhận, được ghi lại để mã đó không dùng lại được khi đăng nhập.
+func (store *SQLStore) EnableTOTPTx(ctx context.Context, userID string, step int64, codeHashes []string) (UserTOTP, error) {
+	var totp UserTOTP
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		var err error
+
+		totp, err = q.enableTOTP(ctx, userID, step)
+		if err != nil {
+			return err
+		}
+		return q.replaceRecoveryCodes(ctx, userID, codeHashes)
+	})
+
+	return totp, err
+}
+
+// ReplaceRecoveryCodesTx thay toàn bộ mã khôi phục (mã cũ, kể cả chưa dùng, hết hiệu lực)
+func (store *SQLStore) ReplaceRecoveryCodesTx(ctx context.Context, userID string, codeHashes []string) error {
+	return store.execTx(ctx, func(q *Queries) error {
+		return q.replaceRecoveryCodes(ctx, userID, codeHashes)
+	})
+}
+
+// DisableTOTPTx tắt TOTP và xóa mã khôi phục; trả về false nếu user chưa đăng ký TOTP
+func (store *SQLStore) DisableTOTPTx(ctx context.Context, userID string) (bool, error) {
+	var disabled bool
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		tag, err := q.db.Exec(ctx, `DELETE FROM user_totp WHERE user_id = $1::uuid`, userID)
+		if err != nil {
+			return err
+		}
+		disabled = tag.RowsAffected() == 1
+
+		_, err = q.db.Exec(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1::uuid`, userID)
+		return err
+	})
+
+	return disabled, err
+}
+
+// --- Logic Nghiệp vụ: Rút tiền (Transaction) ---
+
+// CreateWithdrawalTx trừ amount (đã gồm phí) khỏi ví, ghi transaction "withdraw" pending và yêu cầu rút tiền.
+// Tiền bị giữ ở trạng thái này tới khi yêu cầu hoàn tất, hoặc được hoàn lại nếu bị từ chối/hủy/thất bại.
+func (store *SQLStore) CreateWithdrawalTx(ctx context.Context, arg CreateWithdrawalTxParams) (CreateWithdrawalTxResult, error) {
+	var result CreateWithdrawalTxResult
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		account, err := q.GetAccountByUserAndType(ctx, GetAccountByUserAndTypeParams{
+			UserID:   util.HashStringToInt32(arg.UserID),
+			Currency: arg.Currency,
+		})
+		if err != nil {
+			if err.Error() == "account not found" {
+				return fmt.Errorf("insufficient balance")
+			}
+			return fmt.Errorf("failed to get account: %w", err)
+		}
+
+		// 1. Giữ tiền trước (ví -> system:withdrawals_pending): UPDATE khóa dòng account nên các yêu cầu
+		// đồng thời của cùng ví chạy lần lượt và bước kiểm tra hạn mức dưới đây thấy được yêu cầu vừa commit
+		id := uuid.NewString()
+		_, accounts, err := q.postJournal(ctx, PostJournalParams{
+			Type:        LedgerWithdrawalHold,
+			ReferenceID: "withdrawal:" + id,
+			Description: "withdrawal to " + arg.Address,
+			Postings: []LedgerPosting{
+				{AccountID: account.ID, Currency: arg.Currency, Amount: "-" + arg.Amount},
+				{SystemAccount: ledgerWithdrawalsPending, Currency: arg.Currency, Amount: arg.Amount},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		result.Account = accounts[account.ID]
+
+		// 2. Hạn mức theo ngày
+		if arg.DailyLimit != "" {
+			exceeds, err := q.exceedsWithdrawalLimit(ctx, arg.UserID, arg.Currency, arg.Amount, arg.DailyLimit, arg.Since)
+			if err != nil {
+				return fmt.Errorf("failed to check withdrawal limit: %w", err)
+			}
+			if exceeds {
+				return fmt.Errorf("daily withdrawal limit exceeded")
+			}
+		}
+
+		// 3. Transaction pending + yêu cầu rút tiền
+		result.Transaction, err = q.CreateTransaction(ctx, CreateTransactionParams{
+			AccountID:   account.ID,
+			Type:        "withdraw",
+			Amount:      "-" + arg.Amount,
+			Status:      "pending",
+			Description: "withdrawal to " + arg.Address,
+			ReferenceID: "withdrawal:" + id,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create withdrawal transaction: %w", err)
+		}
+
+		result.Withdrawal, err = q.createWithdrawal(ctx, id, account.ID, result.Transaction.ID, arg)
+		if err != nil {
+			return fmt.Errorf("failed to create withdrawal: %w", err)
+		}
+		return nil
+	})
+
+	return result, err
+}
+
+// withdrawalTransitions: trạng thái mới -> các trạng thái được phép chuyển từ đó
+var withdrawalTransitions = map[string][]string{
+	"approved":  {"pending"},
+	"rejected":  {"pending"},
+	"cancelled": {"pending"},
+	"completed": {"approved"},
+	"failed":    {"approved"},
+}
+
+// withdrawalTransactionStatus: trạng thái withdrawal -> trạng thái transaction tương ứng
+var withdrawalTransactionStatus = map[string]string{
+	"completed": "completed",
+	"failed":    "failed",
+	"rejected":  "cancelled",
+	"cancelled": "cancelled",
+}
+
+// TransitionWithdrawalTx chuyển withdrawal sang trạng thái mới theo state machine
+// pending -> approved -> completed/failed (pending cũng có thể bị rejected/cancelled).
+// Trạng thái kết thúc không thành công sẽ hoàn lại toàn bộ amount vào ví.
+func (store *SQLStore) TransitionWithdrawalTx(ctx context.Context, arg TransitionWithdrawalTxParams) (TransitionWithdrawalTxResult, error) {
+	var result TransitionWithdrawalTxResult
+
+	from, ok := withdrawalTransitions[arg.Status]
+	if !ok {
+		return result, fmt.Errorf("invalid withdrawal status transition")
+	}
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		var err error
+
+		// UPDATE có điều kiện trên status: hai người duyệt cùng lúc thì chỉ một người thành công
+		result.Withdrawal, err = q.transitionWithdrawal(ctx, arg, from)
+		if err != nil {
+			if !errors.Is(err, pgx.ErrNoRows) {
+				return fmt.Errorf("failed to update withdrawal: %w", err)
+			}
+			current, err := q.GetWithdrawal(ctx, arg.ID)
+			if err != nil {
+				return err
+			}
+			if arg.UserID != "" && current.UserID != arg.UserID {
+				return fmt.Errorf("withdrawal not found")
+			}
+			return fmt.Errorf("invalid withdrawal status transition")
+		}
+
+		if status, ok := withdrawalTransactionStatus[arg.Status]; ok {
+			if err := q.updateTransactionStatus(ctx, result.Withdrawal.TransactionID, status); err != nil {
+				return fmt.Errorf("failed to update withdrawal transaction: %w", err)
+			}
+		}
+
+		// Sổ cái: tiền đang giữ được trả lại ví, hoặc chuyển ra ngoài (trừ phí) khi hoàn tất
+		w := result.Withdrawal
+		journal := PostJournalParams{ReferenceID: "withdrawal:" + w.ID, Description: arg.Reason}
+		switch arg.Status {
+		case "rejected", "cancelled", "failed":
+			journal.Type = LedgerWithdrawalRelease
+			journal.Postings = []LedgerPosting{
+				{SystemAccount: ledgerWithdrawalsPending, Currency: w.Currency, Amount: "-" + w.Amount},
+				{AccountID: w.AccountID, Currency: w.Currency, Amount: w.Amount},
+			}
+		case "completed":
+			journal.Type = LedgerWithdrawalSettle
+			journal.Description = arg.ExternalReference
+			journal.Postings = []LedgerPosting{
+				{SystemAccount: ledgerWithdrawalsPending, Currency: w.Currency, Amount: "-" + w.Amount},
+				{SystemAccount: ledgerWithdrawalsSent, Currency: w.Currency, Amount: w.NetAmount},
+				{SystemAccount: ledgerWithdrawalFees, Currency: w.Currency, Amount: w.Fee},
+			}
+		default:
+			return nil
+		}
+
+		_, accounts, err := q.postJournal(ctx, journal)
+		if err != nil {
+			return err
+		}
+		if account, ok := accounts[w.AccountID]; ok {
+			result.Account = &account
+		}
+		return nil
+	})
+
+	return result, err
+}
+
+// --- Logic Nghiệp vụ: Sổ cái ---
+
+// Loại journal trong sổ cái
+const (
+	LedgerOpeningBalance    = "opening_balance"
+	LedgerDeposit           = "deposit"
+	LedgerAdjustment        = "adjustment"
+	LedgerTransfer          = "transfer"
+	LedgerWithdrawalHold    = "withdrawal_hold"
+	LedgerWithdrawalRelease = "withdrawal_release"
+	LedgerWithdrawalSettle  = "withdrawal_settle"
+	LedgerOrderHold         = "order_hold"
+	LedgerOrderRelease      = "order_release"
+	LedgerTrade             = "trade"
+	LedgerFee               = "fee"
+)
+
+// Tài khoản hệ thống: phía đối ứng của ví user trong mỗi journal
+const (
+	ledgerDeposits           = "system:deposits"            // Tiền nạp từ bên ngoài
+	ledgerAdjustments        = "system:adjustments"         // Admin điều chỉnh số dư
+	ledgerWithdrawalsPending = "system:withdrawals_pending" // Tiền rút đang giữ chờ duyệt/chuyển
+	ledgerWithdrawalsSent    = "system:withdrawals_sent"    // Tiền đã chuyển ra ngoài
+	ledgerWithdrawalFees     = "system:fees:withdrawal"     // Phí rút tiền
+	ledgerOrdersHeld         = "system:orders_held"         // Tiền giữ cho lệnh đang mở, mỗi order một tài khoản (orderHoldAccount)
+	ledgerTradingFees        = "system:fees:trading"        // Phí khớp lệnh
+)
+
+// SyncAccountBalanceTx đặt accounts.balance bằng tổng entry của ví trong sổ cái.
+// Trả về false nếu hai bên đã khớp (không thay đổi gì).
+func (store *SQLStore) SyncAccountBalanceTx(ctx context.Context, accountID int64) (Accounts, bool, error) {
+	var account Accounts
+	var synced bool
+
+	err := store.execTx(ctx, func(q *Queries) error {
+		// Khóa ví trước khi cộng entry: journal đang ghi dở vào ví này phải commit xong
+		var balance, ledgerBalance string
+		err := q.db.QueryRow(ctx, `SELECT balance::numeric::text FROM accounts WHERE id = $1 FOR UPDATE`, accountID).Scan(&balance)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return fmt.Errorf("account not found")
+			}
+			return err
+		}
+		err = q.db.QueryRow(ctx, `SELECT COALESCE(SUM(e.amount), 0)::text
+              FROM ledger_entries e JOIN accounts a ON a.id = e.account_id AND a.currency = e.currency
+              WHERE e.account_id = $1`, accountID).Scan(&ledgerBalance)
+		if err != nil {
+			return err
+		}
+
+		delta, _ := new(big.Rat).SetString(ledgerBalance)
+		current, _ := new(big.Rat).SetString(balance)
+		if delta == nil || current == nil {
+			return fmt.Errorf("invalid balance of account %d", accountID)
+		}
+		delta.Sub(delta, current)
+		synced = delta.Sign() != 0
+
+		account, err = q.updateAccountBalance(ctx, UpdateAccountBalanceParams{ID: accountID, Amount: delta.FloatString(8)})
+		return err
+	})
+
+	return account, synced, err
+}
+
+// transactionReference là reference_id của journal ghi cho một dòng transactions
+func transactionReference(tx Transactions) string {
+	return "transaction:" + strconv.FormatInt(tx.ID, 10)
+}
+
+// negate đổi dấu số tiền dạng chuỗi
+func negate(amount string) string {
+	amount = strings.TrimPrefix(amount, "+")
+	if strings.HasPrefix(amount, "-") {
+		return amount[1:]
+	}
+	return "-" + amount
+}
+
+// --- Logic Nghiệp vụ: Sổ cái cho lệnh ---
+
+// splitSymbol tách symbol dạng "BTC/USDT" thành base và quote
+func splitSymbol(symbol string) (string, string, error) {
+	base, quote, ok := strings.Cut(symbol, "/")
+	if !ok || base == "" || quote == "" {
+		return "", "", fmt.Errorf("invalid symbol")
+	}
+	return base, quote, nil
+}
+
+// orderHoldAccount là tài khoản hệ thống giữ số dư của một order
+func orderHoldAccount(orderID string) string {
+	return ledgerOrdersHeld + ":" + orderID
+}
+
+// roundAmount làm tròn về 8 chữ số thập phân như các cột DECIMAL(20, 8)
+func roundAmount(amount *big.Rat) *big.Rat {
+	rounded, _ := new(big.Rat).SetString(amount.FloatString(8))
+	return rounded
+}
+
+// negateAmount trả về -amount dạng chuỗi để ghi nợ
+func negateAmount(amount *big.Rat) string {
+	return new(big.Rat).Neg(amount).FloatString(8)
+}
+
+// orderHoldAmount trả về currency và số tiền order phải giữ: BUY giữ price*quantity quote, SELL giữ quantity base.
+// Market BUY có price = 0 (chưa biết giá khớp) nên không giữ trước.
+func orderHoldAmount(symbol, side string, price, quantity *big.Rat) (string, *big.Rat, error) {
+	base, quote, err := splitSymbol(symbol)
+	if err != nil {
+		return "", nil, err
+	}
+	if side == "SELL" {
+		return base, roundAmount(quantity), nil
+	}
+	return quote, roundAmount(new(big.Rat).Mul(price, quantity)), nil
+}
+
+// holdOrder ghi journal order_hold: ví -> system:orders_held:<order id>
+func (q *Queries) holdOrder(ctx context.Context, orderID string, arg PlaceOrderTxParams) error {
+	price, _ := new(big.Rat).SetString(strconv.FormatFloat(arg.Price, 'f', 8, 64))
+	quantity, _ := new(big.Rat).SetString(strconv.FormatFloat(arg.Quantity, 'f', 8, 64))
+	currency, amount, err := orderHoldAmount(arg.Symbol, arg.Side, price, quantity)
+	if err != nil {
+		return err
+	}
+	if amount.Sign() == 0 {
+		return nil
+	}
+
+	account, err := q.GetAccountByUserAndType(ctx, GetAccountByUserAndTypeParams{
+		UserID:   util.HashStringToInt32(arg.UserID),
+		Currency: currency,
+	})
+	if err != nil {
+		if err.Error() == "account not found" {
+			return fmt.Errorf("insufficient balance")
+		}
+		return fmt.Errorf("failed to get account: %w", err)
+	}
+
+	_, _, err = q.postJournal(ctx, PostJournalParams{
+		Type:        LedgerOrderHold,
+		ReferenceID: "order:" + orderID,
+		Description: fmt.Sprintf("%s %s %s", arg.Side, quantity.FloatString(8), arg.Symbol),
+		Postings: []LedgerPosting{
+			{AccountID: account.ID, Currency: currency, Amount: negateAmount(amount)},
+			{SystemAccount: orderHoldAccount(orderID), Currency: currency, Amount: amount.FloatString(8)},
+		},
+	})
+	return err
+}
+
+// ledgerOrder là phần của order cần để ghi sổ cái
+type ledgerOrder struct {
+	ID            string
+	UserID        string
+	Symbol        string
+	Side          string // BUY hoặc SELL
+	EngineOrderID int64
+}
+
+// lockLedgerOrders khóa các order thỏa condition (theo thứ tự ID) để hold/release/trade của cùng order chạy lần lượt
+func (q *Queries) lockLedgerOrders(ctx context.Context, condition string, arg interface{}) ([]ledgerOrder, error) {
+	rows, err := q.db.Query(ctx, `SELECT id::text, user_id::text, symbol, side, COALESCE(engine_order_id, 0)
+              FROM orders WHERE `+condition+`
+              ORDER BY id FOR UPDATE`, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []ledgerOrder
+	for rows.Next() {
+		var order ledgerOrder
+		if err := rows.Scan(&order.ID, &order.UserID, &order.Symbol, &order.Side, &order.EngineOrderID); err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+	return orders, rows.Err()
+}
+
+// orderHeld trả về số dư order còn giữ trong currency
+func (q *Queries) orderHeld(ctx context.Context, orderID, currency string) (*big.Rat, error) {
+	var held string
+	err := q.db.QueryRow(ctx, `SELECT COALESCE(SUM(amount), 0)::text FROM ledger_entries
+              WHERE ledger_account = $1 AND currency = $2`, orderHoldAccount(orderID), currency).Scan(&held)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order hold: %w", err)
+	}
+	amount, ok := new(big.Rat).SetString(held)
+	if !ok {
+		return nil, fmt.Errorf("invalid hold of order %s", orderID)
+	}
+	return amount, nil
+}
+
+// tradingAccount lấy ví spot của user theo currency, tạo mới nếu chưa có (ví nhận tiền khi khớp lệnh)
+func (q *Queries) tradingAccount(ctx context.Context, userID, currency string) (Accounts, error) {
+	account, err := q.GetAccountByUserAndType(ctx, GetAccountByUserAndTypeParams{
+		UserID:   util.HashStringToInt32(userID),
+		Currency: currency,
+	})
+	if err == nil || err.Error() != "account not found" {
+		return account, err
+	}
+	return q.CreateAccount(ctx, CreateAccountParams{
+		UserID:   util.HashStringToInt32(userID),
+		Currency: currency,
+		Balance:  "0",
+	})
+}
+
+// ReleaseOrderHold trả phần số dư order còn giữ về ví (order bị từ chối, hủy hoặc đã đóng).
+// Không còn gì giữ thì không ghi journal. Phải chạy trong transaction (execTx hoặc EventBatch).
+func (q *Queries) ReleaseOrderHold(ctx context.Context, orderID string) error {
+	orders, err := q.lockLedgerOrders(ctx, `id = $1::uuid`, orderID)
+	if err != nil {
+		return fmt.Errorf("failed to get order: %w", err)
+	}
+	if len(orders) == 0 {
+		return nil
+	}
+	order := orders[0]
+
+	currency, _, err := orderHoldAmount(order.Symbol, order.Side, new(big.Rat), new(big.Rat))
+	if err != nil {
+		return err
+	}
+	held, err := q.orderHeld(ctx, order.ID, currency)
+	if err != nil {
+		return err
+	}
+	if held.Sign() <= 0 {
+		return nil
+	}
+
+	account, err := q.tradingAccount(ctx, order.UserID, currency)
+	if err != nil {
+		return fmt.Errorf("failed to get account: %w", err)
+	}
+	_, _, err = q.postJournal(ctx, PostJournalParams{
+		Type:        LedgerOrderRelease,
+		ReferenceID: "order:" + order.ID,
+		Postings: []LedgerPosting{
+			{SystemAccount: orderHoldAccount(order.ID), Currency: currency, Amount: negateAmount(held)},
+			{AccountID: account.ID, Currency: currency, Amount: held.FloatString(8)},
+		},
+	})
+	return err
+}
+
+// payFromHold trả amount từ phần order đang giữ; phần thiếu (vd. market BUY không giữ trước,
+// hoặc order đã được giải phóng) trừ thẳng vào ví và bị postJournal từ chối nếu ví không đủ
+func (q *Queries) payFromHold(ctx context.Context, order ledgerOrder, account Accounts, currency string, amount *big.Rat) ([]LedgerPosting, error) {
+	held, err := q.orderHeld(ctx, order.ID, currency)
+	if err != nil {
+		return nil, err
+	}
+	fromHold := new(big.Rat).Set(amount)
+	if held.Cmp(amount) < 0 {
+		fromHold.Set(held)
+	}
+	if fromHold.Sign() < 0 {
+		fromHold.SetInt64(0)
+	}
+
+	return []LedgerPosting{
+		{SystemAccount: orderHoldAccount(order.ID), Currency: currency, Amount: negateAmount(fromHold)},
+		{AccountID: account.ID, Currency: currency, Amount: negateAmount(new(big.Rat).Sub(amount, fromHold))},
+	}, nil
+}
+
+// SettleTrade ghi một lần khớp vào sổ cái: journal trade (quote từ người mua sang người bán, base theo chiều
+// ngược lại, lấy từ phần order đang giữ) và journal fee (mỗi bên trả phí maker/taker trên phần mình nhận).
+// Trả về "order not found" nếu một trong hai order không có trong bảng orders. Phải chạy trong EventBatch.
+func (q *Queries) SettleTrade(ctx context.Context, arg SettleTradeParams) error {
+	orders, err := q.lockLedgerOrders(ctx, `engine_order_id = ANY($1)`, []int64{arg.BuyerOrderID, arg.SellerOrderID})
+	if err != nil {
+		return fmt.Errorf("failed to get trade orders: %w", err)
+	}
+	var buyer, seller *ledgerOrder
+	for i := range orders {
+		switch orders[i].EngineOrderID {
+		case arg.BuyerOrderID:
+			buyer = &orders[i]
+		case arg.SellerOrderID:
+			seller = &orders[i]
+		}
+	}
+	if buyer == nil || seller == nil {
+		return fmt.Errorf("order not found")
+	}
+
+	base, quote, err := splitSymbol(buyer.Symbol)
+	if err != nil {
+		return err
+	}
+	price, ok := new(big.Rat).SetString(arg.Price)
+	if !ok {
+		return fmt.Errorf("invalid trade price %q", arg.Price)
+	}
+	amount, ok := new(big.Rat).SetString(arg.Amount)
+	if !ok {
+		return fmt.Errorf("invalid trade amount %q", arg.Amount)
+	}
+	amount = roundAmount(amount)
+	cost := roundAmount(new(big.Rat).Mul(price, amount))
+
+	buyerBase, err := q.tradingAccount(ctx, buyer.UserID, base)
+	if err != nil {
+		return fmt.Errorf("failed to get buyer account: %w", err)
+	}
+	buyerQuote, err := q.tradingAccount(ctx, buyer.UserID, quote)
+	if err != nil {
+		return fmt.Errorf("failed to get buyer account: %w", err)
+	}
+	sellerBase, err := q.tradingAccount(ctx, seller.UserID, base)
+	if err != nil {
+		return fmt.Errorf("failed to get seller account: %w", err)
+	}
+	sellerQuote, err := q.tradingAccount(ctx, seller.UserID, quote)
+	if err != nil {
+		return fmt.Errorf("failed to get seller account: %w", err)
+	}
+
+	// 1. Trade: người mua trả cost quote, người bán giao amount base
+	postings, err := q.payFromHold(ctx, *buyer, buyerQuote, quote, cost)
+	if err != nil {
+		return err
+	}
+	sellerPays, err := q.payFromHold(ctx, *seller, sellerBase, base, amount)
+	if err != nil {
+		return err
+	}
+	postings = append(postings, sellerPays...)
+	postings = append(postings,
+		LedgerPosting{AccountID: sellerQuote.ID, Currency: quote, Amount: cost.FloatString(8)},
+		LedgerPosting{AccountID: buyerBase.ID, Currency: base, Amount: amount.FloatString(8)},
+	)
+
+	reference := "trade:" + strconv.FormatInt(arg.TradeID, 10)
+	if _, _, err := q.postJournal(ctx, PostJournalParams{
+		Type:        LedgerTrade,
+		ReferenceID: reference,
+		Description: fmt.Sprintf("%s %s @ %s", amount.FloatString(8), buyer.Symbol, price.FloatString(8)),
+		Postings:    postings,
+	}); err != nil {
+		return err
+	}
+
+	// 2. Phí: lệnh khớp vào sổ trả phí taker, lệnh nằm trong sổ trả phí maker
+	buyerRate, sellerRate := arg.TakerFeeRate, arg.MakerFeeRate
+	if arg.TakerOrderID == arg.SellerOrderID {
+		buyerRate, sellerRate = arg.MakerFeeRate, arg.TakerFeeRate
+	}
+	buyerFee, err := tradeFee(amount, buyerRate)
+	if err != nil {
+		return err
+	}
+	sellerFee, err := tradeFee(cost, sellerRate)
+	if err != nil {
+		return err
+	}
+	if buyerFee.Sign() == 0 && sellerFee.Sign() == 0 {
+		return nil
+	}
+	_, _, err = q.postJournal(ctx, PostJournalParams{
+		Type:        LedgerFee,
+		ReferenceID: reference,
+		Postings: []LedgerPosting{
+			{AccountID: buyerBase.ID, Currency: base, Amount: negateAmount(buyerFee)},
+			{SystemAccount: ledgerTradingFees, Currency: base, Amount: buyerFee.FloatString(8)},
+			{AccountID: sellerQuote.ID, Currency: quote, Amount: negateAmount(sellerFee)},
+			{SystemAccount: ledgerTradingFees, Currency: quote, Amount: sellerFee.FloatString(8)},
+		},
+	})
+	return err
+}
+
+// tradeFee tính phí amount*rate làm tròn 8 chữ số; rate rỗng = không thu phí
+func tradeFee(amount *big.Rat, rate string) (*big.Rat, error) {
+	if rate == "" {
+		return new(big.Rat), nil
+	}
+	r, ok := new(big.Rat).SetString(rate)
+	if !ok || r.Sign() < 0 || r.Cmp(big.NewRat(1, 1)) >= 0 {
+		return nil, fmt.Errorf("invalid fee rate %q", rate)
+	}
+	return roundAmount(new(big.Rat).Mul(amount, r)), nil
+}
+
+// --- Logic Nghiệp vụ: Xuất dữ liệu (cursor) ---
+
+// exportFetchSize là số dòng mỗi lần FETCH từ cursor khi xuất dữ liệu
+const exportFetchSize = 500
+
+// streamCursor chạy query qua server-side cursor trong một transaction chỉ đọc (snapshot nhất quán
+// suốt lần xuất), lấy từng lô exportFetchSize dòng và gọi scan cho mỗi dòng.
+// Bộ nhớ chỉ giữ một lô; scan trả lỗi (vd: client ngắt kết nối) thì dừng ngay.
+func (store *SQLStore) streamCursor(ctx context.Context, query string, args []interface{}, scan func(pgx.Rows) error) error {
+	tx, err := store.connPool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx) // Chỉ đọc, không có gì để commit
+
+	if _, err := tx.Exec(ctx, "DECLARE export_cursor NO SCROLL CURSOR FOR "+query, args...); err != nil {
+		return fmt.Errorf("failed to declare export cursor: %w", err)
+	}
+
+	fetch := fmt.Sprintf("FETCH FORWARD %d FROM export_cursor", exportFetchSize)
+	for {
+		rows, err := tx.Query(ctx, fetch)
+		if err != nil {
+			return fmt.Errorf("failed to fetch from export cursor: %w", err)
+		}
+		n := 0
+		for rows.Next() {
+			n++
+			if err := scan(rows); err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if n < exportFetchSize {
+			return nil
+		}
+	}
+}
+
+// ExportTransactionsTx streams the user's transactions on all accounts created in [From, To), oldest first
+func (store *SQLStore) ExportTransactionsTx(ctx context.Context, arg ExportParams, fn func(TransactionExportRow) error) error {
+	query := `SELECT t.id, a.account_type, a.currency, t.type, t.amount::text, t.status,
+                     t.description, t.reference_id, t.created_at
+              FROM transactions t
+              JOIN accounts a ON a.id = t.account_id
+              WHERE a.user_id = $1 AND t.created_at >= $2 AND t.created_at < $3
+              ORDER BY t.created_at, t.id`
+
+	args := []interface{}{util.HashStringToInt32(arg.UserID), arg.From, arg.To}
+	return store.streamCursor(ctx, query, args, func(rows pgx.Rows) error {
+		var row TransactionExportRow
+		if err := rows.Scan(
+			&row.ID,
+			&row.AccountType,
+			&row.Currency,
+			&row.Type,
+			&row.Amount,
+			&row.Status,
+			&row.Description,
+			&row.ReferenceID,
+			&row.CreatedAt,
+		); err != nil {
+			return err
+		}
+		return fn(row)
+	})
+}
+
+// ExportOrdersTx streams the user's orders (mọi trạng thái) created in [From, To), oldest first
+func (store *SQLStore) ExportOrdersTx(ctx context.Context, arg ExportParams, fn func(OrderExportRow) error) error {
+	query := `SELECT o.id::text, o.symbol, o.side, o.order_type, COALESCE(o.price, 0)::text, o.quantity::text,
+                     COALESCE(f.filled, 0)::text, o.status, o.reject_reason, o.created_at
+              FROM orders o
+              LEFT JOIN LATERAL (
+                  SELECT SUM(t.amount) AS filled
+                  FROM engine_trades t
+                  WHERE t.maker_order_id = o.engine_order_id OR t.taker_order_id = o.engine_order_id
+              ) f ON TRUE
+              WHERE o.user_id = $1::uuid AND o.created_at >= $2 AND o.created_at < $3
+              ORDER BY o.created_at, o.id`
+
+	args := []interface{}{arg.UserID, arg.From, arg.To}
+	return store.streamCursor(ctx, query, args, func(rows pgx.Rows) error {
+		var row OrderExportRow
+		if err := rows.Scan(
+			&row.ID,
+			&row.Symbol,
+			&row.Side,
+			&row.Type,
+			&row.Price,
+			&row.Quantity,
+			&row.Filled,
+			&row.Status,
+			&row.RejectReason,
+			&row.CreatedAt,
+		); err != nil {
+			return err
+		}
+		return fn(row)
+	})
+}
+
+// ExportTradesTx streams the fills of the user's orders executed in [From, To), oldest first
+func (store *SQLStore) ExportTradesTx(ctx context.Context, arg ExportParams, fn func(TradeExportRow) error) error {
+	query := `SELECT t.id, o.id::text, o.symbol, o.side,
+                     CASE WHEN t.maker_order_id = o.engine_order_id THEN 'maker' ELSE 'taker' END,
+                     t.price::text, t.amount::text, ROUND(t.price * t.amount, 8)::text, t.created_at
+              FROM engine_trades t
+              JOIN orders o ON o.engine_order_id IN (t.maker_order_id, t.taker_order_id)
+              WHERE o.user_id = $1::uuid AND t.created_at >= $2 AND t.created_at < $3
+              ORDER BY t.created_at, t.id, o.id`
+
+	args := []interface{}{arg.UserID, arg.From, arg.To}
+	return store.streamCursor(ctx, query, args, func(rows pgx.Rows) error {
+		var row TradeExportRow
+		if err := rows.Scan(
+			&row.TradeID,
+			&row.OrderID,
+			&row.Symbol,
+			&row.Side,
+			&row.Liquidity,
+			&row.Price,
+			&row.Amount,
+			&row.Total,
+			&row.CreatedAt,
+		); err != nil {
+			return err
+		}
+		return fn(row)
+	})
+}
@@ -0,0 +1,439 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/trading-platform/gateway/internal/util"
+)
+
+// Các test dưới đây chạy trên Postgres đã migrate (TEST_DATABASE_URL), không có thì bỏ qua.
+// Mỗi test tạo user riêng nên chạy lại được trên cùng database.
+
+func newTestStore(t *testing.T) *SQLStore {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	pool, err := pgxpool.New(context.Background(), url)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(pool.Close)
+	return NewStore(pool).(*SQLStore)
+}
+
+func createTestUser(t *testing.T, store *SQLStore) Users {
+	t.Helper()
+	name := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	user, err := store.CreateUser(context.Background(), CreateUserParams{
+		Username:     name,
+		Email:        name + "@example.com",
+		PasswordHash: "x",
+	})
+	if err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+func depositTest(t *testing.T, store *SQLStore, user Users, currency, amount string) Accounts {
+	t.Helper()
+	result, err := store.DepositTx(context.Background(), DepositTxParams{UserID: user.ID, Currency: currency, Amount: amount})
+	if err != nil {
+		t.Fatalf("deposit %s %s: %v", amount, currency, err)
+	}
+	return result.Account
+}
+
+// requireBalance so sánh accounts.balance theo giá trị và kiểm tra nó bằng tổng entry trong sổ cái
+func requireBalance(t *testing.T, store *SQLStore, user Users, currency, want string) {
+	t.Helper()
+	ctx := context.Background()
+	account, err := store.GetAccountByUserAndType(ctx, GetAccountByUserAndTypeParams{
+		UserID:   util.HashStringToInt32(user.ID),
+		Currency: currency,
+	})
+	if err != nil {
+		t.Fatalf("get %s account: %v", currency, err)
+	}
+	requireAmount(t, currency+" balance", account.Balance, want)
+
+	var ledger string
+	if err := store.connPool.QueryRow(ctx, `SELECT COALESCE(SUM(amount), 0)::text FROM ledger_entries WHERE account_id = $1`,
+		account.ID).Scan(&ledger); err != nil {
+		t.Fatal(err)
+	}
+	requireAmount(t, currency+" ledger balance", ledger, want)
+}
+
+func requireAmount(t *testing.T, what, got, want string) {
+	t.Helper()
+	g, ok := new(big.Rat).SetString(got)
+	w, _ := new(big.Rat).SetString(want)
+	if !ok || g.Cmp(w) != 0 {
+		t.Errorf("%s = %s, want %s", what, got, want)
+	}
+}
+
+func placeTestOrder(t *testing.T, store *SQLStore, user Users, side string, price, quantity float64) (string, int64, error) {
+	t.Helper()
+	engineID := time.Now().UnixNano()
+	result, err := store.PlaceOrderTx(context.Background(), PlaceOrderTxParams{
+		UserID:        user.ID,
+		Symbol:        "BTC/USDT",
+		Side:          side,
+		OrderType:     "LIMIT",
+		Price:         price,
+		Quantity:      quantity,
+		EngineOrderID: engineID,
+		Subject:       "orders",
+		Command:       []byte(`{}`),
+	})
+	return result.OrderID, engineID, err
+}
+
+func TestPlaceOrderTxHoldsAndCloseOrderTxReleases(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	user := createTestUser(t, store)
+	depositTest(t, store, user, "USDT", "1000")
+
+	// Không đủ số dư: không có order nào được ghi
+	if _, _, err := placeTestOrder(t, store, user, "BUY", 100, 11); err == nil || err.Error() != "insufficient balance" {
+		t.Fatalf("overdraft order: err = %v, want insufficient balance", err)
+	}
+	requireBalance(t, store, user, "USDT", "1000")
+
+	orderID, engineID, err := placeTestOrder(t, store, user, "BUY", 100, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requireBalance(t, store, user, "USDT", "600")
+
+	closed, err := store.CloseOrderTx(ctx, CloseOrderTxParams{ID: orderID, EngineOrderID: engineID, Status: "CANCELLED"})
+	if err != nil || !closed {
+		t.Fatalf("CloseOrderTx = %v, %v", closed, err)
+	}
+	requireBalance(t, store, user, "USDT", "1000")
+
+	// Đóng lần hai không trả tiền thêm
+	if closed, err := store.CloseOrderTx(ctx, CloseOrderTxParams{ID: orderID, EngineOrderID: engineID, Status: "CANCELLED"}); err != nil || closed {
+		t.Fatalf("second CloseOrderTx = %v, %v", closed, err)
+	}
+	requireBalance(t, store, user, "USDT", "1000")
+}
+
+// settleTestTrades ghi các trade trong một EventBatch như EventProcessor: AddTrade, SettleTrade, FillOrder
+func settleTestTrades(t *testing.T, store *SQLStore, trades ...SettleTradeParams) {
+	t.Helper()
+	ctx := context.Background()
+	err := store.execTx(ctx, func(q *Queries) error {
+		batch := &EventBatch{Queries: q}
+		for _, trade := range trades {
+			maker := trade.SellerOrderID
+			if trade.TakerOrderID == trade.SellerOrderID {
+				maker = trade.BuyerOrderID
+			}
+			batch.AddTrade(CreateTradeParams{
+				MakerOrderID: maker,
+				TakerOrderID: trade.TakerOrderID,
+				Price:        trade.Price,
+				Amount:       trade.Amount,
+			})
+			if err := batch.SettleTrade(ctx, trade); err != nil {
+				return err
+			}
+			for _, id := range []int64{trade.BuyerOrderID, trade.SellerOrderID} {
+				if err := batch.FillOrder(ctx, id); err != nil {
+					return err
+				}
+			}
+		}
+		return batch.flush(ctx)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// requireOrder kiểm tra trạng thái order và số dư order còn giữ
+func requireOrder(t *testing.T, store *SQLStore, orderID, currency, wantStatus, wantHeld string) {
+	t.Helper()
+	ctx := context.Background()
+	order, err := store.GetOrderByUUID(ctx, orderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != wantStatus {
+		t.Errorf("order %s status = %s, want %s", orderID, order.Status, wantStatus)
+	}
+	held, err := store.orderHeld(ctx, orderID, currency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requireAmount(t, "order "+orderID+" held "+currency, held.FloatString(8), wantHeld)
+}
+
+func TestSettleTrade(t *testing.T) {
+	store := newTestStore(t)
+	buyer := createTestUser(t, store)
+	seller := createTestUser(t, store)
+	depositTest(t, store, buyer, "USDT", "1000")
+	depositTest(t, store, seller, "BTC", "3")
+
+	buyOrder, buyEngineID, err := placeTestOrder(t, store, buyer, "BUY", 100, 2) // Giữ 200 USDT
+	if err != nil {
+		t.Fatal(err)
+	}
+	sellOrder, sellEngineID, err := placeTestOrder(t, store, seller, "SELL", 90, 3) // Giữ 3 BTC
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Hai lần khớp 1 BTC ở giá 90 trong cùng một lô (trade thứ hai chưa có trong engine_trades):
+	// người mua trả 180 USDT từ phần giữ, phí taker 0.2% trên BTC nhận được; người bán nhận 180 USDT, phí maker 0.1%
+	trade := SettleTradeParams{
+		BuyerOrderID:  buyEngineID,
+		SellerOrderID: sellEngineID,
+		TakerOrderID:  buyEngineID,
+		Price:         "90",
+		Amount:        "1",
+		MakerFeeRate:  "0.001",
+		TakerFeeRate:  "0.002",
+	}
+	first, second := trade, trade
+	first.TradeID = time.Now().UnixNano()
+	second.TradeID = first.TradeID + 1
+	settleTestTrades(t, store, first, second)
+
+	// Lệnh mua khớp hết ở giá tốt hơn giá đặt: FILLED và 20 USDT còn giữ được trả ngay
+	requireOrder(t, store, buyOrder, "USDT", "FILLED", "0")
+	requireBalance(t, store, buyer, "USDT", "820")
+	requireBalance(t, store, buyer, "BTC", "1.996")
+
+	// Lệnh bán khớp 2/3: vẫn giữ 1 BTC
+	requireOrder(t, store, sellOrder, "BTC", "PARTIALLY_FILLED", "1")
+	requireBalance(t, store, seller, "BTC", "0")
+	requireBalance(t, store, seller, "USDT", "179.82")
+}
+
+func TestSettleTradeMakerBuyer(t *testing.T) {
+	store := newTestStore(t)
+	buyer := createTestUser(t, store)
+	seller := createTestUser(t, store)
+	depositTest(t, store, buyer, "USDT", "100")
+	depositTest(t, store, seller, "BTC", "1")
+
+	buyOrder, buyEngineID, err := placeTestOrder(t, store, buyer, "BUY", 100, 1) // Nằm trong sổ trước: maker
+	if err != nil {
+		t.Fatal(err)
+	}
+	sellOrder, sellEngineID, err := placeTestOrder(t, store, seller, "SELL", 100, 1) // Khớp vào: taker
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Người mua là maker: phí 0.1% trên BTC nhận được; người bán là taker: phí 0.2% trên USDT nhận được
+	settleTestTrades(t, store, SettleTradeParams{
+		TradeID:       time.Now().UnixNano(),
+		BuyerOrderID:  buyEngineID,
+		SellerOrderID: sellEngineID,
+		TakerOrderID:  sellEngineID,
+		Price:         "100",
+		Amount:        "1",
+		MakerFeeRate:  "0.001",
+		TakerFeeRate:  "0.002",
+	})
+	requireBalance(t, store, buyer, "BTC", "0.999")
+	requireBalance(t, store, buyer, "USDT", "0")
+	requireBalance(t, store, seller, "USDT", "99.8")
+	requireOrder(t, store, buyOrder, "USDT", "FILLED", "0")
+	requireOrder(t, store, sellOrder, "BTC", "FILLED", "0")
+}
+
+func TestTransferTx(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	alice := createTestUser(t, store)
+	bob := createTestUser(t, store)
+	depositTest(t, store, alice, "USDT", "100")
+
+	tests := []struct {
+		name      string
+		to        Users
+		amount    string
+		wantErr   string
+		wantAlice string
+		wantBob   string
+	}{
+		{"to another user", bob, "30", "", "70", "30"},
+		{"whole balance", bob, "70", "", "0", "100"},
+		{"overdraft", bob, "0.00000001", "insufficient balance", "0", "100"},
+		{"same account", alice, "1", "cannot transfer to the same account", "0", "100"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := store.TransferTx(ctx, TransferTxParams{
+				FromUserID: alice.ID,
+				ToUserID:   tt.to.ID,
+				Currency:   "USDT",
+				Amount:     tt.amount,
+			})
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else if *result.FromTransaction.ReferenceID != "transfer:"+result.TransferID ||
+				*result.ToTransaction.ReferenceID != "transfer:"+result.TransferID {
+				t.Errorf("transactions not linked to transfer %s", result.TransferID)
+			}
+			// Lỗi thì cả transaction rollback: số dư và sổ cái không đổi
+			requireBalance(t, store, alice, "USDT", tt.wantAlice)
+			requireBalance(t, store, bob, "USDT", tt.wantBob)
+		})
+	}
+
+	// Chuyển giữa các ví của cùng user
+	depositTest(t, store, bob, "BTC", "1")
+	if _, err := store.TransferTx(ctx, TransferTxParams{
+		FromUserID: bob.ID, ToUserID: bob.ID, ToAccountType: "margin", Currency: "BTC", Amount: "0.25",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	requireBalance(t, store, bob, "BTC", "0.75")
+	margin, err := store.GetAccountByUserAndType(ctx, GetAccountByUserAndTypeParams{
+		UserID: util.HashStringToInt32(bob.ID), AccountType: "margin", Currency: "BTC",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	requireAmount(t, "margin BTC balance", margin.Balance, "0.25")
+}
+
+func TestWithdrawalTransitions(t *testing.T) {
+	statuses := []string{"pending", "approved", "rejected", "cancelled", "completed", "failed"}
+	allowed := map[[2]string]bool{
+		{"pending", "approved"}:   true,
+		{"pending", "rejected"}:   true,
+		{"pending", "cancelled"}:  true,
+		{"approved", "completed"}: true,
+		{"approved", "failed"}:    true,
+	}
+	for _, from := range statuses {
+		for _, to := range statuses {
+			got := false
+			for _, s := range withdrawalTransitions[to] {
+				got = got || s == from
+			}
+			if got != allowed[[2]string{from, to}] {
+				t.Errorf("%s -> %s allowed = %v, want %v", from, to, got, !got)
+			}
+		}
+	}
+
+	// Trạng thái kết thúc nào cũng phải cập nhật transaction đi kèm
+	for to, want := range map[string]string{"completed": "completed", "failed": "failed", "rejected": "cancelled", "cancelled": "cancelled"} {
+		if got := withdrawalTransactionStatus[to]; got != want {
+			t.Errorf("transaction status for %s = %q, want %q", to, got, want)
+		}
+	}
+	if _, ok := withdrawalTransactionStatus["approved"]; ok {
+		t.Error("approved must keep the transaction pending")
+	}
+
+	// Trạng thái không có trong state machine bị từ chối trước khi chạm tới database
+	for _, status := range []string{"pending", "unknown", ""} {
+		_, err := (&SQLStore{}).TransitionWithdrawalTx(context.Background(), TransitionWithdrawalTxParams{ID: "w", Status: status})
+		if err == nil || err.Error() != "invalid withdrawal status transition" {
+			t.Errorf("status %q: err = %v, want invalid withdrawal status transition", status, err)
+		}
+	}
+}
+
+func TestTransitionWithdrawalTx(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	user := createTestUser(t, store)
+	other := createTestUser(t, store)
+	depositTest(t, store, user, "USDT", "100")
+
+	withdraw := func(amount string) Withdrawal {
+		t.Helper()
+		result, err := store.CreateWithdrawalTx(ctx, CreateWithdrawalTxParams{
+			UserID: user.ID, Currency: "USDT", Amount: amount, Fee: "1", Address: "addr",
+		})
+		if err != nil {
+			t.Fatalf("create withdrawal: %v", err)
+		}
+		return result.Withdrawal
+	}
+	transition := func(w Withdrawal, userID, status string) (TransitionWithdrawalTxResult, error) {
+		return store.TransitionWithdrawalTx(ctx, TransitionWithdrawalTxParams{ID: w.ID, UserID: userID, Status: status, Actor: "admin"})
+	}
+
+	// Vượt số dư: không tạo yêu cầu, không giữ tiền
+	if _, err := store.CreateWithdrawalTx(ctx, CreateWithdrawalTxParams{
+		UserID: user.ID, Currency: "USDT", Amount: "100.00000001", Fee: "1", Address: "addr",
+	}); err == nil || err.Error() != "insufficient balance" {
+		t.Fatalf("overdraft withdrawal: err = %v, want insufficient balance", err)
+	}
+	requireBalance(t, store, user, "USDT", "100")
+
+	// pending -> rejected: tiền giữ được hoàn lại
+	rejected := withdraw("40")
+	requireBalance(t, store, user, "USDT", "60")
+	result, err := transition(rejected, "", "rejected")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Withdrawal.Status != "rejected" || result.Account == nil {
+		t.Fatalf("rejected withdrawal = %+v, account %v", result.Withdrawal, result.Account)
+	}
+	requireAmount(t, "refunded balance", result.Account.Balance, "100")
+	requireBalance(t, store, user, "USDT", "100")
+
+	// Không hủy được yêu cầu của user khác
+	completed := withdraw("30")
+	if _, err := transition(completed, other.ID, "cancelled"); err == nil || err.Error() != "withdrawal not found" {
+		t.Fatalf("cancel by other user: err = %v, want withdrawal not found", err)
+	}
+
+	// pending -> approved -> completed: tiền đã giữ không quay lại ví
+	if _, err := transition(completed, "", "approved"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := transition(completed, user.ID, "cancelled"); err == nil || err.Error() != "invalid withdrawal status transition" {
+		t.Fatalf("cancel approved withdrawal: err = %v, want invalid withdrawal status transition", err)
+	}
+	if result, err := transition(completed, "", "completed"); err != nil || result.Withdrawal.Status != "completed" {
+		t.Fatalf("complete withdrawal = %+v, %v", result.Withdrawal, err)
+	}
+	requireBalance(t, store, user, "USDT", "70")
+
+	// Trạng thái kết thúc không chuyển tiếp được nữa
+	for _, status := range []string{"failed", "approved", "cancelled"} {
+		if _, err := transition(completed, "", status); err == nil || err.Error() != "invalid withdrawal status transition" {
+			t.Errorf("completed -> %s: err = %v, want invalid withdrawal status transition", status, err)
+		}
+	}
+	requireBalance(t, store, user, "USDT", "70")
+
+	// Tiền đang giữ chỉ còn 0: yêu cầu bị từ chối đã trả, yêu cầu hoàn tất đã chuyển đi
+	var pending string
+	if err := store.connPool.QueryRow(ctx, `SELECT COALESCE(SUM(e.amount), 0)::text FROM ledger_entries e
+		JOIN ledger_journals j ON j.id = e.journal_id
+		WHERE e.ledger_account = $1 AND j.reference_id IN ($2, $3)`,
+		ledgerWithdrawalsPending, "withdrawal:"+rejected.ID, "withdrawal:"+completed.ID).Scan(&pending); err != nil {
+		t.Fatal(err)
+	}
+	requireAmount(t, "pending withdrawals", pending, "0")
+}
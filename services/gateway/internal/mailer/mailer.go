@@ -0,0 +1,129 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/trading-platform/gateway/internal/config"
+)
+
+// Message là một email dạng text
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer gửi email (xác minh tài khoản, đặt lại mật khẩu...)
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New tạo Mailer theo MAIL_DRIVER: "smtp", "file" hoặc "log"
+func New(cfg config.MailConfig) (Mailer, error) {
+	switch cfg.Driver {
+	case "smtp":
+		return newSMTPMailer(cfg)
+	case "file":
+		if err := os.MkdirAll(cfg.FileDir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create mail directory: %w", err)
+		}
+		return &FileMailer{dir: cfg.FileDir, from: cfg.From}, nil
+	case "log":
+		return &LogMailer{}, nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver: %s", cfg.Driver)
+	}
+}
+
+// SMTPMailer gửi email qua SMTP server (STARTTLS nếu server hỗ trợ)
+type SMTPMailer struct {
+	cfg      config.MailConfig
+	envelope string // Địa chỉ trần cho lệnh MAIL FROM
+	from     string // Dạng đầy đủ cho header From ("Tên <địa chỉ>")
+}
+
+// newSMTPMailer tách MAIL_FROM dạng "Tên <địa chỉ>": SMTP server chỉ nhận địa chỉ trần trong MAIL FROM
+func newSMTPMailer(cfg config.MailConfig) (*SMTPMailer, error) {
+	address, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MAIL_FROM %q: %w", cfg.From, err)
+	}
+	return &SMTPMailer{cfg: cfg, envelope: address.Address, from: address.String()}, nil
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	addr := net.JoinHostPort(m.cfg.SMTPHost, fmt.Sprint(m.cfg.SMTPPort))
+
+	var auth smtp.Auth
+	if m.cfg.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", m.cfg.SMTPUsername, m.cfg.SMTPPassword, m.cfg.SMTPHost)
+	}
+
+	// smtp.SendMail không nhận context; chạy trong goroutine để tôn trọng deadline của người gọi
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(addr, auth, m.envelope, []string{msg.To}, render(m.from, msg))
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// FileMailer ghi mỗi email thành một file .eml (dev: mở bằng mail client hoặc đọc trực tiếp)
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	name := fmt.Sprintf("%s_%s.eml", time.Now().Format("20060102T150405.000000000"), sanitize(msg.To))
+	path := filepath.Join(m.dir, name)
+	if err := os.WriteFile(path, render(m.from, msg), 0o600); err != nil {
+		return err
+	}
+	log.Printf("📧 Mail to %s written to %s", msg.To, path)
+	return nil
+}
+
+// LogMailer chỉ in email ra log (mặc định khi chạy local)
+type LogMailer struct{}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	log.Printf("📧 Mail to %s | %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// render tạo nội dung email theo RFC 5322 (text/plain, UTF-8)
+func render(from string, msg Message) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + msg.To + "\r\n")
+	b.WriteString("Subject: " + msg.Subject + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '@' || r == '.' || r == '-' || r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,39 @@
+package mailer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/trading-platform/gateway/internal/config"
+)
+
+func TestNewSMTPMailerFromAddress(t *testing.T) {
+	tests := []struct {
+		from         string
+		wantEnvelope string
+		wantHeader   string
+	}{
+		{"Trading Platform <no-reply@localhost>", "no-reply@localhost", `"Trading Platform" <no-reply@localhost>`},
+		{"no-reply@example.com", "no-reply@example.com", "<no-reply@example.com>"},
+		{"Sàn Giao Dịch <support@example.com>", "support@example.com", "=?utf-8?q?S=C3=A0n_Giao_D=E1=BB=8Bch?= <support@example.com>"},
+	}
+	for _, tt := range tests {
+		m, err := newSMTPMailer(config.MailConfig{From: tt.from})
+		if err != nil {
+			t.Fatalf("newSMTPMailer(%q): %v", tt.from, err)
+		}
+		if m.envelope != tt.wantEnvelope {
+			t.Errorf("envelope(%q) = %q, want %q", tt.from, m.envelope, tt.wantEnvelope)
+		}
+		if m.from != tt.wantHeader {
+			t.Errorf("header(%q) = %q, want %q", tt.from, m.from, tt.wantHeader)
+		}
+		if body := string(render(m.from, Message{To: "a@example.com"})); !strings.HasPrefix(body, "From: "+tt.wantHeader+"\r\n") {
+			t.Errorf("rendered From header = %q", strings.SplitN(body, "\r\n", 2)[0])
+		}
+	}
+
+	if _, err := newSMTPMailer(config.MailConfig{From: "Trading Platform"}); err == nil {
+		t.Error("newSMTPMailer accepted a MAIL_FROM without an address")
+	}
+}
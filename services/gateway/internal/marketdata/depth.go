@@ -0,0 +1,269 @@
+package marketdata
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DepthChannel là tên kênh WebSocket cho order book
+const DepthChannel = "depth"
+
+const (
+	// MessageTypeDepthSnapshot là toàn bộ order book tại một sequence
+	MessageTypeDepthSnapshot = "depth_snapshot"
+	// MessageTypeDepthUpdate là các mức giá thay đổi so với sequence trước
+	MessageTypeDepthUpdate = "depth_update"
+)
+
+var (
+	// ErrSequenceUnavailable khi sequence yêu cầu đã bị đẩy ra khỏi history (hoặc chưa tồn tại)
+	ErrSequenceUnavailable = errors.New("sequence not available")
+	// ErrUnknownSymbol khi chưa có dữ liệu order book cho symbol
+	ErrUnknownSymbol = errors.New("unknown symbol")
+)
+
+// Level là một mức giá [price, amount], khớp format tuple (String, String) bên Rust.
+// Trong depth_update, amount "0" nghĩa là mức giá đã bị xóa.
+type Level [2]string
+
+// EngineSnapshot là format snapshot Rust Engine ghi vào Redis (orderbook:{symbol} và ob_update:{symbol})
+type EngineSnapshot struct {
+	Symbol    string          `json:"symbol"`
+	Bids      []Level         `json:"bids"`
+	Asks      []Level         `json:"asks"`
+	Timestamp uint64          `json:"timestamp"`
+	Orders    []SnapshotOrder `json:"orders,omitempty"` // Chỉ có trong key orderbook:{symbol}; nil = engine cũ không ghi
+}
+
+// SnapshotOrder là một lệnh đang nằm trong sổ của engine (dùng để đối soát với DB)
+type SnapshotOrder struct {
+	ID     uint64 `json:"id"`
+	Side   string `json:"side"` // "Bid" hoặc "Ask"
+	Price  string `json:"price"`
+	Amount string `json:"amount"` // Số lượng còn lại
+	Stop   bool   `json:"stop"`   // StopLimit chưa kích hoạt
+}
+
+// DepthMessage là message gửi cho client trên kênh depth
+type DepthMessage struct {
+	Type      string  `json:"type"` // depth_snapshot hoặc depth_update
+	Channel   string  `json:"channel"`
+	Symbol    string  `json:"symbol"`
+	Seq       uint64  `json:"seq"`
+	PrevSeq   uint64  `json:"prev_seq,omitempty"` // Chỉ có ở depth_update, client dùng để phát hiện gap
+	Bids      []Level `json:"bids"`
+	Asks      []Level `json:"asks"`
+	Timestamp uint64  `json:"timestamp"`
+}
+
+// SnapshotLoader đọc snapshot hiện tại của engine (ví dụ từ Redis key orderbook:{symbol})
+type SnapshotLoader interface {
+	LoadSnapshot(ctx context.Context, symbol string) ([]byte, error)
+}
+
+// depthBook giữ trạng thái order book và history của một symbol
+type depthBook struct {
+	seq     uint64
+	current EngineSnapshot
+	history []DepthMessage // Ring buffer các snapshot theo sequence
+	next    int            // Vị trí ghi tiếp theo trong ring buffer
+}
+
+// DepthFeed biến các snapshot đầy đủ của engine thành snapshot + delta có sequence number
+type DepthFeed struct {
+	mu          sync.Mutex
+	books       map[string]*depthBook
+	loader      SnapshotLoader
+	historySize int
+}
+
+// NewDepthFeed tạo DepthFeed mới
+func NewDepthFeed(loader SnapshotLoader, historySize int) *DepthFeed {
+	if historySize <= 0 {
+		historySize = 1
+	}
+	return &DepthFeed{
+		books:       make(map[string]*depthBook),
+		loader:      loader,
+		historySize: historySize,
+	}
+}
+
+// Apply nhận snapshot mới từ engine và trả về delta đã encode JSON.
+// Trả về nil nếu order book không thay đổi.
+func (f *DepthFeed) Apply(symbol string, payload []byte) ([]byte, error) {
+	var snap EngineSnapshot
+	if err := json.Unmarshal(payload, &snap); err != nil {
+		return nil, fmt.Errorf("invalid orderbook payload: %w", err)
+	}
+	if snap.Symbol == "" {
+		snap.Symbol = symbol
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	book := f.book(symbol)
+	bids := diffLevels(book.current.Bids, snap.Bids)
+	asks := diffLevels(book.current.Asks, snap.Asks)
+	if book.seq > 0 && len(bids) == 0 && len(asks) == 0 {
+		return nil, nil
+	}
+
+	prevSeq := book.seq
+	book.seq++
+	book.current = snap
+	book.record(f.snapshotLocked(symbol, book))
+
+	delta := DepthMessage{
+		Type:      MessageTypeDepthUpdate,
+		Channel:   DepthChannel,
+		Symbol:    symbol,
+		Seq:       book.seq,
+		PrevSeq:   prevSeq,
+		Bids:      bids,
+		Asks:      asks,
+		Timestamp: snap.Timestamp,
+	}
+	return json.Marshal(delta)
+}
+
+// Snapshot trả về order book mới nhất của symbol.
+// Nếu gateway chưa nhận update nào, snapshot được nạp từ SnapshotLoader.
+func (f *DepthFeed) Snapshot(ctx context.Context, symbol string) (DepthMessage, error) {
+	f.mu.Lock()
+	book, ok := f.books[symbol]
+	if ok {
+		msg := f.snapshotLocked(symbol, book)
+		f.mu.Unlock()
+		return msg, nil
+	}
+	f.mu.Unlock()
+
+	// Chưa có trong bộ nhớ -> đọc snapshot engine đã lưu (không giữ lock khi gọi I/O)
+	var snap EngineSnapshot
+	if f.loader != nil {
+		payload, err := f.loader.LoadSnapshot(ctx, symbol)
+		if err != nil {
+			return DepthMessage{}, err
+		}
+		if len(payload) > 0 {
+			if err := json.Unmarshal(payload, &snap); err != nil {
+				return DepthMessage{}, fmt.Errorf("invalid orderbook snapshot: %w", err)
+			}
+			snap.Orders = nil // Depth feed chỉ cần các mức giá
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// Có thể Apply đã chạy trong lúc đọc Redis, khi đó dữ liệu trong bộ nhớ mới hơn
+	book, ok = f.books[symbol]
+	if !ok {
+		book = f.book(symbol)
+		book.current = snap
+		book.record(f.snapshotLocked(symbol, book))
+	}
+	return f.snapshotLocked(symbol, book), nil
+}
+
+// SnapshotAt trả về order book tại một sequence cụ thể (còn trong history)
+func (f *DepthFeed) SnapshotAt(symbol string, seq uint64) (DepthMessage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	book, ok := f.books[symbol]
+	if !ok {
+		return DepthMessage{}, ErrUnknownSymbol
+	}
+	for _, msg := range book.history {
+		if msg.Type != "" && msg.Seq == seq {
+			return msg, nil
+		}
+	}
+	return DepthMessage{}, ErrSequenceUnavailable
+}
+
+// SnapshotMessage trả về snapshot đã encode JSON, dùng cho WebSocket subscribe/resync
+func (f *DepthFeed) SnapshotMessage(ctx context.Context, symbol string) ([]byte, error) {
+	msg, err := f.Snapshot(ctx, symbol)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(msg)
+}
+
+// Remove xóa trạng thái order book của symbol (khi symbol bị delist)
+func (f *DepthFeed) Remove(symbol string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.books, symbol)
+}
+
+// book lấy hoặc tạo depthBook (caller phải giữ f.mu)
+func (f *DepthFeed) book(symbol string) *depthBook {
+	book, ok := f.books[symbol]
+	if !ok {
+		book = &depthBook{history: make([]DepthMessage, f.historySize)}
+		f.books[symbol] = book
+	}
+	return book
+}
+
+// snapshotLocked tạo DepthMessage snapshot từ trạng thái hiện tại (caller phải giữ f.mu)
+func (f *DepthFeed) snapshotLocked(symbol string, book *depthBook) DepthMessage {
+	timestamp := book.current.Timestamp
+	if timestamp == 0 {
+		timestamp = uint64(time.Now().Unix())
+	}
+	return DepthMessage{
+		Type:      MessageTypeDepthSnapshot,
+		Channel:   DepthChannel,
+		Symbol:    symbol,
+		Seq:       book.seq,
+		Bids:      copyLevels(book.current.Bids),
+		Asks:      copyLevels(book.current.Asks),
+		Timestamp: timestamp,
+	}
+}
+
+// record lưu snapshot vào ring buffer history
+func (b *depthBook) record(msg DepthMessage) {
+	b.history[b.next] = msg
+	b.next = (b.next + 1) % len(b.history)
+}
+
+// diffLevels trả về các mức giá thay đổi giữa hai snapshot.
+// Mức giá biến mất được trả về với amount "0".
+func diffLevels(prev, next []Level) []Level {
+	old := make(map[string]string, len(prev))
+	for _, level := range prev {
+		old[level[0]] = level[1]
+	}
+
+	changes := make([]Level, 0)
+	seen := make(map[string]bool, len(next))
+	for _, level := range next {
+		seen[level[0]] = true
+		if amount, ok := old[level[0]]; !ok || amount != level[1] {
+			changes = append(changes, level)
+		}
+	}
+	for _, level := range prev {
+		if !seen[level[0]] {
+			changes = append(changes, Level{level[0], "0"})
+		}
+	}
+	return changes
+}
+
+func copyLevels(levels []Level) []Level {
+	out := make([]Level, len(levels))
+	copy(out, levels)
+	return out
+}
@@ -0,0 +1,34 @@
+package marketdata
+
+import (
+	"context"
+	"errors"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// OrderBookKeyPrefix là prefix key Rust Engine lưu snapshot (snapshot.rs)
+	OrderBookKeyPrefix = "orderbook:"
+	// OrderBookChannelPrefix là prefix kênh PubSub Rust Engine bắn update
+	OrderBookChannelPrefix = "ob_update:"
+)
+
+// RedisSnapshotLoader đọc snapshot order book từ Redis key orderbook:{symbol}
+type RedisSnapshotLoader struct {
+	rdb *redis.Client
+}
+
+// NewRedisSnapshotLoader tạo loader mới
+func NewRedisSnapshotLoader(rdb *redis.Client) *RedisSnapshotLoader {
+	return &RedisSnapshotLoader{rdb: rdb}
+}
+
+// LoadSnapshot trả về snapshot JSON, hoặc nil nếu engine chưa ghi snapshot cho symbol
+func (l *RedisSnapshotLoader) LoadSnapshot(ctx context.Context, symbol string) ([]byte, error) {
+	data, err := l.rdb.Get(ctx, OrderBookKeyPrefix+symbol).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	return data, err
+}
@@ -0,0 +1,61 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+	"github.com/trading-platform/gateway/internal/models"
+)
+
+// OrderAckWaiter tạo inbox riêng cho từng lệnh đặt đồng bộ.
+// Command mang reply_to = inbox; engine publish OrderAck vào đó (core NATS) sau khi xử lý.
+type OrderAckWaiter struct {
+	nc *nats.Conn
+}
+
+// NewOrderAckWaiter tạo OrderAckWaiter mới
+func NewOrderAckWaiter(nc *nats.Conn) *OrderAckWaiter {
+	return &OrderAckWaiter{nc: nc}
+}
+
+// PendingAck là một inbox đang chờ ack của engine
+type PendingAck struct {
+	Subject string // Đặt vào Command.ReplyTo
+	sub     *nats.Subscription
+}
+
+// Subscribe tạo inbox và bắt đầu nhận. Phải gọi trước khi command được gửi đi,
+// nếu không ack có thể tới trước khi có subscriber và bị mất.
+func (w *OrderAckWaiter) Subscribe() (*PendingAck, error) {
+	inbox := w.nc.NewRespInbox()
+	sub, err := w.nc.SubscribeSync(inbox)
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe ack inbox: %w", err)
+	}
+	if err := sub.AutoUnsubscribe(1); err != nil {
+		sub.Unsubscribe()
+		return nil, fmt.Errorf("failed to subscribe ack inbox: %w", err)
+	}
+	return &PendingAck{Subject: inbox, sub: sub}, nil
+}
+
+// Wait chờ ack cho tới khi ctx hết hạn (trả về ctx.Err())
+func (a *PendingAck) Wait(ctx context.Context) (models.OrderAck, error) {
+	msg, err := a.sub.NextMsgWithContext(ctx)
+	if err != nil {
+		return models.OrderAck{}, err
+	}
+
+	var ack models.OrderAck
+	if err := json.Unmarshal(msg.Data, &ack); err != nil {
+		return models.OrderAck{}, fmt.Errorf("invalid order ack: %w", err)
+	}
+	return ack, nil
+}
+
+// Close hủy inbox (gọi khi không chờ nữa, kể cả khi timeout)
+func (a *PendingAck) Close() {
+	a.sub.Unsubscribe()
+}
@@ -0,0 +1,101 @@
+package messaging
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const (
+	// OrdersSubject là subject Rust Engine nghe lệnh (Place/Cancel)
+	OrdersSubject = "orders"
+	// EventsSubject là subject Rust Engine bắn event ra
+	EventsSubject = "events"
+
+	// OrdersStream lưu bền vững mọi command gửi sang engine
+	OrdersStream = "ORDERS"
+	// EventsStream lưu bền vững mọi event engine bắn ra, kể cả khi gateway đang down
+	EventsStream = "EVENTS"
+
+	// EventsConsumer là durable consumer của gateway trên EventsStream
+	EventsConsumer = "gateway-events"
+	// EngineConsumer là durable consumer của Rust Engine trên OrdersStream (engine tự tạo, ack sau khi xử lý command)
+	EngineConsumer = "matching-engine"
+)
+
+// Options cấu hình JetStream streams và consumers
+type Options struct {
+	StreamMaxAge      time.Duration // Thời gian giữ message trong stream
+	DuplicateWindow   time.Duration // Cửa sổ chống trùng theo Nats-Msg-Id
+	AckWait           time.Duration // Thời gian chờ ack trước khi redeliver
+	MaxDeliver        int           // Số lần deliver tối đa cho một event
+	PublishTimeout    time.Duration // Thời gian chờ PubAck khi publish command
+	MaxAckPending     int           // Số event tối đa đang xử lý (chưa ack); thứ tự theo symbol do EventProcessor giữ
+	StreamReplicas    int
+	StreamStorageFile bool // true = FileStorage, false = MemoryStorage
+}
+
+// SetupJetStream tạo (hoặc cập nhật) các stream cần thiết và trả về JetStream context
+func SetupJetStream(ctx context.Context, nc *nats.Conn, opts Options) (jetstream.JetStream, error) {
+	js, err := jetstream.New(nc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+
+	storage := jetstream.MemoryStorage
+	if opts.StreamStorageFile {
+		storage = jetstream.FileStorage
+	}
+	replicas := opts.StreamReplicas
+	if replicas <= 0 {
+		replicas = 1
+	}
+
+	streams := []jetstream.StreamConfig{
+		{
+			Name:        OrdersStream,
+			Description: "Commands sent from gateway to matching engine",
+			Subjects:    []string{OrdersSubject},
+			Storage:     storage,
+			Replicas:    replicas,
+			MaxAge:      opts.StreamMaxAge,
+			Duplicates:  opts.DuplicateWindow,
+		},
+		{
+			Name:        EventsStream,
+			Description: "Events published by matching engine",
+			Subjects:    []string{EventsSubject},
+			Storage:     storage,
+			Replicas:    replicas,
+			MaxAge:      opts.StreamMaxAge,
+			Duplicates:  opts.DuplicateWindow,
+		},
+	}
+
+	for _, cfg := range streams {
+		if _, err := js.CreateOrUpdateStream(ctx, cfg); err != nil {
+			return nil, fmt.Errorf("failed to setup stream %s: %w", cfg.Name, err)
+		}
+		log.Printf("✅ JetStream stream ready: %s (%v)", cfg.Name, cfg.Subjects)
+	}
+
+	return js, nil
+}
+
+// EventsConsumerConfig trả về cấu hình durable consumer cho EventsStream
+func EventsConsumerConfig(opts Options) jetstream.ConsumerConfig {
+	return jetstream.ConsumerConfig{
+		Durable:       EventsConsumer,
+		Description:   "Gateway event processor",
+		FilterSubject: EventsSubject,
+		DeliverPolicy: jetstream.DeliverAllPolicy,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       opts.AckWait,
+		MaxDeliver:    opts.MaxDeliver,
+		MaxAckPending: opts.MaxAckPending,
+	}
+}
@@ -0,0 +1,52 @@
+package messaging
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/trading-platform/gateway/internal/models"
+)
+
+// CommandPublisher gửi command sang engine qua JetStream và chờ PubAck,
+// nên khi Publish trả về nil thì command đã được lưu bền vững trong OrdersStream.
+type CommandPublisher struct {
+	js      jetstream.JetStream
+	timeout time.Duration
+}
+
+// NewCommandPublisher tạo CommandPublisher mới
+func NewCommandPublisher(js jetstream.JetStream, timeout time.Duration) *CommandPublisher {
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	return &CommandPublisher{js: js, timeout: timeout}
+}
+
+// Publish serialize command và publish vào OrdersSubject.
+// msgID được dùng làm Nats-Msg-Id để JetStream bỏ qua bản gửi trùng (retry).
+func (p *CommandPublisher) Publish(ctx context.Context, cmd models.Command, msgID string) error {
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return fmt.Errorf("failed to marshal command: %w", err)
+	}
+	return p.PublishRaw(ctx, OrdersSubject, data, msgID)
+}
+
+// PublishRaw publish payload đã serialize sẵn (ví dụ command lấy từ outbox) vào subject
+func (p *CommandPublisher) PublishRaw(ctx context.Context, subject string, data []byte, msgID string) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	var opts []jetstream.PublishOpt
+	if msgID != "" {
+		opts = append(opts, jetstream.WithMsgID(msgID))
+	}
+
+	if _, err := p.js.Publish(ctx, subject, data, opts...); err != nil {
+		return fmt.Errorf("failed to enqueue command: %w", err)
+	}
+	return nil
+}
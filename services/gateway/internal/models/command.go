@@ -2,8 +2,9 @@ package models
 
 // Command gửi sang Rust
 type Command struct {
-	Type string      `json:"type"` // "Place" hoặc "Cancel"
-	Data interface{} `json:"data"`
+	Type    string      `json:"type"` // "Place" hoặc "Cancel"
+	Data    interface{} `json:"data"`
+	ReplyTo string      `json:"reply_to,omitempty"` // Subject nhận OrderAck (chỉ khi đặt lệnh đồng bộ)
 }
 
 // Dữ liệu lệnh đặt (khớp với Order struct bên Rust)
@@ -23,3 +24,21 @@ type OrderData struct {
 type CancelData struct {
 	OrderID uint64 `json:"order_id"`
 }
+
+// Trạng thái trong OrderAck
+const (
+	AckStatusAccepted        = "accepted"
+	AckStatusPartiallyFilled = "partially_filled"
+	AckStatusFilled          = "filled"
+	AckStatusRejected        = "rejected"
+)
+
+// OrderAck là kết quả engine gửi về reply_to sau khi xử lý lệnh đặt
+type OrderAck struct {
+	OrderID      uint64      `json:"order_id"`
+	Status       string      `json:"status"`
+	FilledAmount string      `json:"filled_amount"`
+	Fills        []TradeData `json:"fills"`
+	Reason       string      `json:"reason,omitempty"`  // Chỉ khi rejected
+	Message      string      `json:"message,omitempty"` // Chỉ khi rejected
+}
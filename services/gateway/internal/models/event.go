@@ -1,9 +1,124 @@
 package models
 
-// EngineEvent là struct đại diện cho event từ Rust Engine
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+)
+
+const (
+	// EventVersionLegacy là format cũ: {"type", "data"}, không có id/sequence
+	EventVersionLegacy = 1
+	// EventVersion là format hiện tại: thêm "v", "event_id", "epoch", "seq"
+	EventVersion = 2
+)
+
+var (
+	// ErrUnsupportedEventVersion khi engine bắn event với version gateway chưa hỗ trợ
+	ErrUnsupportedEventVersion = errors.New("unsupported event version")
+	// ErrUnknownEventType khi chưa đăng ký loại event trong registry
+	ErrUnknownEventType = errors.New("unknown event type")
+)
+
+// EventData là payload đã decode của một loại event, tự kiểm tra tính hợp lệ của các trường
+type EventData interface {
+	Validate() error
+}
+
+// EngineEvent là envelope của event từ Rust Engine.
+// Data giữ nguyên JSON gốc, chỉ decode khi đã biết loại event.
 type EngineEvent struct {
-	Type string      `json:"type"` // "OrderPlaced", "TradeExecuted", "OrderCancelled"
-	Data interface{} `json:"data"`
+	V       int             `json:"v,omitempty"` // Không có = EventVersionLegacy
+	Type    string          `json:"type"`        // "OrderPlaced", "TradeExecuted", "OrderCancelled", "OrderRejected"
+	Data    json.RawMessage `json:"data"`
+	EventID string          `json:"event_id,omitempty"` // "{epoch}-{seq}", duy nhất cho mỗi event
+	Epoch   uint64          `json:"epoch,omitempty"`    // Lần khởi động của engine
+	Seq     uint64          `json:"seq,omitempty"`      // Tăng liên tục trong một epoch, bắt đầu từ 1
+	Symbol  string          `json:"symbol,omitempty"`   // Cặp tiền của event; trống nếu engine không xác định được
+}
+
+// DecodeEngineEvent decode và kiểm tra envelope. Trường lạ trong envelope bị từ chối.
+func DecodeEngineEvent(raw []byte) (EngineEvent, error) {
+	var event EngineEvent
+	if err := decodeStrict(raw, &event); err != nil {
+		return EngineEvent{}, fmt.Errorf("invalid event envelope: %w", err)
+	}
+
+	if event.V == 0 {
+		event.V = EventVersionLegacy
+	}
+	if event.V > EventVersion {
+		return EngineEvent{}, fmt.Errorf("%w: v%d", ErrUnsupportedEventVersion, event.V)
+	}
+	if event.Type == "" {
+		return EngineEvent{}, errors.New("invalid event envelope: missing type")
+	}
+	if len(event.Data) == 0 {
+		return EngineEvent{}, fmt.Errorf("invalid %s event: missing data", event.Type)
+	}
+
+	// Từ v2 mọi event phải có id và sequence
+	if event.V >= EventVersion && (event.EventID == "" || event.Epoch == 0 || event.Seq == 0) {
+		return EngineEvent{}, fmt.Errorf("invalid %s event: v%d requires event_id, epoch and seq", event.Type, event.V)
+	}
+	return event, nil
+}
+
+// DecodeData decode Data vào out (không chấp nhận trường lạ) rồi gọi Validate
+func (e EngineEvent) DecodeData(out EventData) error {
+	if err := decodeStrict(e.Data, out); err != nil {
+		return fmt.Errorf("invalid %s data: %w", e.Type, err)
+	}
+	if err := out.Validate(); err != nil {
+		return fmt.Errorf("invalid %s data: %w", e.Type, err)
+	}
+	return nil
+}
+
+// decodeStrict decode đúng một giá trị JSON, báo lỗi với trường không khai báo hoặc dữ liệu thừa
+func decodeStrict(raw []byte, out interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(out); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("unexpected data after JSON value")
+	}
+	return nil
+}
+
+// decimalPattern khớp số thập phân dạng string mà rust_decimal serialize ra
+var decimalPattern = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// validateDecimal kiểm tra value là số thập phân; positive = true yêu cầu > 0
+func validateDecimal(field, value string, positive bool) error {
+	if !decimalPattern.MatchString(value) {
+		return fmt.Errorf("%s: invalid decimal %q", field, value)
+	}
+	if value[0] == '-' || (positive && isZeroDecimal(value)) {
+		return fmt.Errorf("%s: must be positive, got %s", field, value)
+	}
+	return nil
+}
+
+func isZeroDecimal(value string) bool {
+	for _, c := range value {
+		if c != '0' && c != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+func validateSide(side string) error {
+	if side != "Bid" && side != "Ask" {
+		return fmt.Errorf("side: expected Bid or Ask, got %q", side)
+	}
+	return nil
 }
 
 // OrderPlacedData là dữ liệu khi order được đặt thành công
@@ -16,23 +131,112 @@ type OrderPlacedData struct {
 	Side    string `json:"side"` // "Bid" hoặc "Ask"
 }
 
+// Validate kiểm tra các trường bắt buộc của OrderPlaced
+func (d *OrderPlacedData) Validate() error {
+	if d.OrderID == 0 {
+		return errors.New("order_id is required")
+	}
+	if d.Symbol == "" {
+		return errors.New("symbol is required")
+	}
+	// Market order có price = 0
+	if err := validateDecimal("price", d.Price, false); err != nil {
+		return err
+	}
+	if err := validateDecimal("amount", d.Amount, true); err != nil {
+		return err
+	}
+	return validateSide(d.Side)
+}
+
 // TradeExecutedData là dữ liệu khi trade được khớp
 type TradeExecutedData struct {
 	Trade TradeData `json:"trade"`
 }
 
+// Validate kiểm tra các trường bắt buộc của TradeExecuted
+func (d *TradeExecutedData) Validate() error {
+	return d.Trade.Validate()
+}
+
 // TradeData chứa thông tin chi tiết của trade
 type TradeData struct {
 	TradeID       uint64 `json:"trade_id"`
 	BuyerOrderID  uint64 `json:"buyer_order_id"`
 	SellerOrderID uint64 `json:"seller_order_id"`
+	TakerOrderID  uint64 `json:"taker_order_id,omitempty"` // Lệnh khớp vào sổ; engine cũ không gửi
 	Price         string `json:"price"`
 	Amount        string `json:"amount"`
 	Timestamp     uint64 `json:"timestamp"`
 }
 
+// Validate kiểm tra các trường bắt buộc của trade
+func (d *TradeData) Validate() error {
+	if d.TradeID == 0 {
+		return errors.New("trade.trade_id is required")
+	}
+	if d.BuyerOrderID == 0 || d.SellerOrderID == 0 {
+		return errors.New("trade.buyer_order_id and trade.seller_order_id are required")
+	}
+	if d.TakerOrderID != 0 && d.TakerOrderID != d.BuyerOrderID && d.TakerOrderID != d.SellerOrderID {
+		return errors.New("trade.taker_order_id must be the buyer or seller order")
+	}
+	if err := validateDecimal("trade.price", d.Price, true); err != nil {
+		return err
+	}
+	return validateDecimal("trade.amount", d.Amount, true)
+}
+
+// MakerTaker trả về lệnh maker (nằm trong sổ) và taker (khớp vào).
+// Event từ engine cũ không có taker_order_id: coi người bán là maker như trước.
+func (d *TradeData) MakerTaker() (maker, taker uint64) {
+	if d.TakerOrderID == d.SellerOrderID {
+		return d.BuyerOrderID, d.SellerOrderID
+	}
+	return d.SellerOrderID, d.BuyerOrderID
+}
+
 // OrderCancelledData là dữ liệu khi order bị hủy
 type OrderCancelledData struct {
 	OrderID uint64 `json:"order_id"`
 	Success bool   `json:"success"`
 }
+
+// Validate kiểm tra các trường bắt buộc của OrderCancelled
+func (d *OrderCancelledData) Validate() error {
+	if d.OrderID == 0 {
+		return errors.New("order_id is required")
+	}
+	return nil
+}
+
+// Mã lý do engine từ chối lệnh (khớp enum RejectReason bên Rust)
+const (
+	RejectReasonInvalidAmount       = "INVALID_AMOUNT"
+	RejectReasonInvalidPrice        = "INVALID_PRICE"
+	RejectReasonInvalidTriggerPrice = "INVALID_TRIGGER_PRICE"
+)
+
+// rejectReasonPattern: mã lý do dạng SCREAMING_SNAKE_CASE; engine có thể thêm mã mới
+// mà gateway chưa biết, nên chỉ kiểm tra format chứ không giới hạn danh sách
+var rejectReasonPattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+// OrderRejectedData là dữ liệu khi engine từ chối một lệnh (lệnh không vào OrderBook)
+type OrderRejectedData struct {
+	OrderID uint64 `json:"order_id"`
+	UserID  uint64 `json:"user_id"`
+	Symbol  string `json:"symbol"`
+	Reason  string `json:"reason"`  // Mã lý do, ví dụ INVALID_TRIGGER_PRICE
+	Message string `json:"message"` // Mô tả cho người đọc
+}
+
+// Validate kiểm tra các trường bắt buộc của OrderRejected
+func (d *OrderRejectedData) Validate() error {
+	if d.OrderID == 0 {
+		return errors.New("order_id is required")
+	}
+	if !rejectReasonPattern.MatchString(d.Reason) {
+		return fmt.Errorf("reason: invalid code %q", d.Reason)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit là một token bucket: đầy tối đa Burst token, nạp lại Rate token mỗi giây
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// PerMinute tạo Limit nạp n token mỗi phút
+func PerMinute(n, burst int) Limit {
+	return Limit{Rate: float64(n) / 60, Burst: burst}
+}
+
+// Result là kết quả một lần lấy token
+type Result struct {
+	Allowed    bool
+	Limit      int           // = Burst
+	Remaining  int           // Token còn lại sau lần lấy này
+	RetryAfter time.Duration // Chờ bấy lâu thì có token (chỉ khi !Allowed)
+	ResetAfter time.Duration // Chờ bấy lâu thì bucket đầy lại
+}
+
+// Store giữ trạng thái các bucket theo key
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// result tính Result từ số token còn lại sau khi đã nạp (và trừ nếu allowed)
+func result(limit Limit, tokens float64, allowed bool) Result {
+	res := Result{
+		Allowed:    allowed,
+		Limit:      limit.Burst,
+		Remaining:  int(math.Floor(tokens)),
+		ResetAfter: time.Duration((float64(limit.Burst) - tokens) / limit.Rate * float64(time.Second)),
+	}
+	if !allowed {
+		res.RetryAfter = time.Duration((1 - tokens) / limit.Rate * float64(time.Second))
+	}
+	return res
+}
+
+// MemoryStore giữ bucket trong RAM của process (một gateway, hoặc khi chưa cần chia sẻ giữa các instance)
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time // Thời điểm bucket đầy lại nếu không ai lấy thêm -> xóa được
+}
+
+// NewMemoryStore creates an in-memory bucket store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucket)}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Dọn bucket đã đầy lại (tương đương bucket mới) mỗi phút một lần
+	if now.Sub(s.lastSweep) > time.Minute {
+		for k, b := range s.buckets {
+			if now.After(b.full) {
+				delete(s.buckets, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		s.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+
+	res := result(limit, b.tokens, allowed)
+	b.full = now.Add(res.ResetAfter)
+	return res, nil
+}
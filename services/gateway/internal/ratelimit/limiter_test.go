@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestResult(t *testing.T) {
+	limit := Limit{Rate: 2, Burst: 10} // 2 token/giây
+
+	tests := []struct {
+		name       string
+		tokens     float64
+		allowed    bool
+		remaining  int
+		retryAfter time.Duration
+		resetAfter time.Duration
+	}{
+		{"full after take", 9, true, 9, 0, 500 * time.Millisecond},
+		{"last token taken", 0, true, 0, 0, 5 * time.Second},
+		{"empty", 0, false, 0, 500 * time.Millisecond, 5 * time.Second},
+		{"half a token", 0.5, false, 0, 250 * time.Millisecond, 4750 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := result(limit, tt.tokens, tt.allowed)
+			if res.Allowed != tt.allowed || res.Limit != limit.Burst || res.Remaining != tt.remaining {
+				t.Errorf("result = %+v, want allowed=%v limit=%d remaining=%d", res, tt.allowed, limit.Burst, tt.remaining)
+			}
+			if res.RetryAfter != tt.retryAfter {
+				t.Errorf("RetryAfter = %v, want %v", res.RetryAfter, tt.retryAfter)
+			}
+			if res.ResetAfter != tt.resetAfter {
+				t.Errorf("ResetAfter = %v, want %v", res.ResetAfter, tt.resetAfter)
+			}
+		})
+	}
+}
+
+func TestPerMinute(t *testing.T) {
+	if got := PerMinute(120, 20); got.Rate != 2 || got.Burst != 20 {
+		t.Errorf("PerMinute(120, 20) = %+v, want {Rate:2 Burst:20}", got)
+	}
+}
+
+func TestMemoryStoreBurstThenLimit(t *testing.T) {
+	store := NewMemoryStore()
+	limit := PerMinute(1, 3) // Gần như không nạp lại trong thời gian test
+
+	for i := 0; i < 3; i++ {
+		res, err := store.Take(context.Background(), "ip:203.0.113.7", limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.Allowed || res.Remaining != 2-i {
+			t.Fatalf("take %d: %+v, want allowed with %d remaining", i+1, res, 2-i)
+		}
+	}
+
+	res, _ := store.Take(context.Background(), "ip:203.0.113.7", limit)
+	if res.Allowed {
+		t.Fatalf("take 4 allowed, want limited: %+v", res)
+	}
+	if res.RetryAfter <= 59*time.Second || res.RetryAfter > time.Minute {
+		t.Errorf("RetryAfter = %v, want ~1m", res.RetryAfter)
+	}
+
+	// Key khác có bucket riêng
+	if res, _ := store.Take(context.Background(), "ip:198.51.100.1", limit); !res.Allowed {
+		t.Errorf("other key limited: %+v", res)
+	}
+}
+
+func TestMemoryStoreRefill(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Rate: 100, Burst: 1} // Nạp 1 token mỗi 10ms
+
+	if res, _ := store.Take(context.Background(), "k", limit); !res.Allowed {
+		t.Fatalf("first take limited: %+v", res)
+	}
+	if res, _ := store.Take(context.Background(), "k", limit); res.Allowed {
+		t.Fatalf("second immediate take allowed: %+v", res)
+	}
+	time.Sleep(30 * time.Millisecond)
+	res, _ := store.Take(context.Background(), "k", limit)
+	if !res.Allowed {
+		t.Fatalf("take after refill limited: %+v", res)
+	}
+	// Không dồn quá Burst dù chờ lâu
+	if res.Remaining != 0 {
+		t.Errorf("Remaining = %d after refill, want 0 (burst 1)", res.Remaining)
+	}
+}
@@ -0,0 +1,142 @@
+package util
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// Header mà client gửi khi gọi API bằng API key
+const (
+	APIKeyHeader       = "X-API-KEY"
+	APITimestampHeader = "X-API-TIMESTAMP" // Unix milliseconds
+	APISignatureHeader = "X-API-SIGNATURE" // hex(HMAC-SHA256(secret, SignaturePayload(...)))
+)
+
+// GenerateAPIKey tạo cặp key công khai và secret ngẫu nhiên
+func GenerateAPIKey() (key string, secret string, err error) {
+	keyBytes := make([]byte, 24)
+	if _, err := rand.Read(keyBytes); err != nil {
+		return "", "", err
+	}
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", "", err
+	}
+	return "tk_" + base64.RawURLEncoding.EncodeToString(keyBytes), base64.RawURLEncoding.EncodeToString(secretBytes), nil
+}
+
+// SignaturePayload là chuỗi được ký: timestamp, method, path (kèm query) và body, ngăn cách bằng '\n'
+func SignaturePayload(timestamp, method, path string, body []byte) []byte {
+	payload := make([]byte, 0, len(timestamp)+len(method)+len(path)+len(body)+3)
+	payload = append(payload, timestamp...)
+	payload = append(payload, '\n')
+	payload = append(payload, method...)
+	payload = append(payload, '\n')
+	payload = append(payload, path...)
+	payload = append(payload, '\n')
+	return append(payload, body...)
+}
+
+// SignRequest tính chữ ký HMAC-SHA256 (hex) của một request
+func SignRequest(secret, timestamp, method, path string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(SignaturePayload(timestamp, method, path, body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature so sánh chữ ký trong thời gian hằng
+func VerifySignature(secret, timestamp, method, path string, body []byte, signature string) bool {
+	expected := SignRequest(secret, timestamp, method, path, body)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// ParseIPAllowlist chuẩn hóa danh sách IP/CIDR (IP đơn được chuyển thành /32 hoặc /128)
+func ParseIPAllowlist(entries []string) ([]string, error) {
+	normalized := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid IP range: %s", entry)
+			}
+			normalized = append(normalized, prefix.Masked().String())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP address: %s", entry)
+		}
+		addr = addr.Unmap()
+		normalized = append(normalized, netip.PrefixFrom(addr, addr.BitLen()).String())
+	}
+	return normalized, nil
+}
+
+// IPAllowed kiểm tra ip có thuộc allowlist không; allowlist rỗng = mọi IP
+func IPAllowed(allowlist []string, ip string) bool {
+	if len(allowlist) == 0 {
+		return true
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, entry := range allowlist {
+		prefix, err := netip.ParsePrefix(entry)
+		if err == nil && prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// EncryptSecret mã hóa secret bằng AES-256-GCM, trả về base64(nonce || ciphertext)
+func EncryptSecret(key []byte, secret string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(secret), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptSecret giải mã secret đã mã hóa bằng EncryptSecret
+func DecryptSecret(key []byte, ciphertext string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return "", fmt.Errorf("invalid secret ciphertext")
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret")
+	}
+	return string(plain), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,18 @@
+package util
+
+// Role của user, mang trong access token (claim "role")
+const (
+	RoleUser      = "user"       // Khách hàng, chỉ thao tác trên tài khoản của mình
+	RoleSupport   = "support"    // Xem số dư/lệnh của user, hủy lệnh giúp user
+	RoleMarketOps = "market-ops" // Điều hành thị trường: tạm dừng/mở lại symbol, hủy lệnh
+	RoleAdmin     = "admin"      // Toàn quyền, kể cả điều chỉnh số dư và phân quyền
+)
+
+// ValidRole kiểm tra role có nằm trong danh sách hỗ trợ không
+func ValidRole(role string) bool {
+	switch role {
+	case RoleUser, RoleSupport, RoleMarketOps, RoleAdmin:
+		return true
+	}
+	return false
+}
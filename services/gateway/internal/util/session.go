@@ -0,0 +1,35 @@
+package util
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// NewRefreshToken tạo refresh token dạng "<session id>.<secret ngẫu nhiên>".
+// Chỉ hash của token được lưu trong DB; session ID ở đầu giúp tra cứu không cần quét bảng.
+func NewRefreshToken(sessionID string) (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return sessionID + "." + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// ParseRefreshToken tách session ID khỏi refresh token
+func ParseRefreshToken(token string) (string, error) {
+	sessionID, secret, ok := strings.Cut(token, ".")
+	if !ok || sessionID == "" || secret == "" {
+		return "", fmt.Errorf("invalid refresh token")
+	}
+	return sessionID, nil
+}
+
+// HashToken trả về SHA-256 (hex) của token để lưu/so sánh thay cho token gốc
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -7,11 +7,13 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-// CreateToken tạo JWT token cho user
-func CreateToken(username string, secretKey string, duration time.Duration) (string, error) {
+// CreateToken tạo JWT access token cho user, gắn với session đăng nhập (sid) và role
+func CreateToken(username string, role string, sessionID string, secretKey string, duration time.Duration) (string, error) {
 	// Tạo Claims (payload) chứa thông tin user
 	claims := jwt.MapClaims{
 		"username": username,
+		"role":     role,
+		"sid":      sessionID,
 		"iat":      time.Now().Unix(),
 		"exp":      time.Now().Add(duration).Unix(),
 	}
@@ -31,6 +33,8 @@ func CreateToken(username string, secretKey string, duration time.Duration) (str
 // Payload chứa dữ liệu đầu ra của token
 type Payload struct {
 	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	SessionID string    `json:"session_id"` // Rỗng với token cấp trước khi có session
 	IssuedAt  time.Time `json:"issued_at"`
 	ExpiredAt time.Time `json:"expired_at"`
 }
@@ -56,9 +60,20 @@ func VerifyToken(tokenString string, secretKey string) (*Payload, error) {
 	if !ok || !token.Valid {
 		return nil, fmt.Errorf("invalid token")
 	}
+	// Token có "purpose" (vd. pre-auth 2FA) không phải access token
+	if _, ok := claims["purpose"]; ok {
+		return nil, fmt.Errorf("invalid token")
+	}
 
+	sessionID, _ := claims["sid"].(string)
+	role, _ := claims["role"].(string)
+	if role == "" {
+		role = RoleUser
+	}
 	payload := &Payload{
-		Username: claims["username"].(string),
+		Username:  claims["username"].(string),
+		Role:      role,
+		SessionID: sessionID,
 		// Lưu ý: JWT lưu time dưới dạng float64 khi parse ra map
 		IssuedAt:  time.Unix(int64(claims["iat"].(float64)), 0),
 		ExpiredAt: time.Unix(int64(claims["exp"].(float64)), 0),
@@ -66,3 +81,75 @@ func VerifyToken(tokenString string, secretKey string) (*Payload, error) {
 
 	return payload, nil
 }
+
+// Mục đích của token một lần (claim "purpose"); VerifyToken từ chối mọi token có purpose
+const (
+	preAuthPurpose       = "2fa"
+	PurposeVerifyEmail   = "verify_email"
+	PurposeResetPassword = "reset_password"
+)
+
+// CreatePreAuthToken tạo token ngắn hạn chứng minh user đã qua bước mật khẩu, dùng để gửi mã 2FA.
+// Token không có sid và mang claim "purpose" nên không dùng được như access token.
+func CreatePreAuthToken(username string, secretKey string, duration time.Duration) (string, error) {
+	return createPurposeToken(jwt.MapClaims{"username": username}, preAuthPurpose, secretKey, duration)
+}
+
+// VerifyPreAuthToken kiểm tra pre-auth token và trả về username
+func VerifyPreAuthToken(tokenString string, secretKey string) (string, error) {
+	claims, err := parsePurposeToken(tokenString, preAuthPurpose, secretKey)
+	if err != nil {
+		return "", err
+	}
+	username, ok := claims["username"].(string)
+	if !ok || username == "" {
+		return "", fmt.Errorf("invalid token")
+	}
+	return username, nil
+}
+
+// CreateEmailToken tạo token gửi qua email (xác minh email, đặt lại mật khẩu).
+// fingerprint gắn token với trạng thái hiện tại của user (vd. hash của password hash): trạng thái đổi thì token hết hiệu lực,
+// nên token đặt lại mật khẩu chỉ dùng được một lần mà không cần lưu DB.
+func CreateEmailToken(purpose, userID, fingerprint, secretKey string, duration time.Duration) (string, error) {
+	return createPurposeToken(jwt.MapClaims{"uid": userID, "fp": fingerprint}, purpose, secretKey, duration)
+}
+
+// VerifyEmailToken kiểm tra token email đúng mục đích, trả về user ID và fingerprint
+func VerifyEmailToken(tokenString, purpose, secretKey string) (userID string, fingerprint string, err error) {
+	claims, err := parsePurposeToken(tokenString, purpose, secretKey)
+	if err != nil {
+		return "", "", err
+	}
+	userID, _ = claims["uid"].(string)
+	fingerprint, _ = claims["fp"].(string)
+	if userID == "" || fingerprint == "" {
+		return "", "", fmt.Errorf("invalid token")
+	}
+	return userID, fingerprint, nil
+}
+
+func createPurposeToken(claims jwt.MapClaims, purpose, secretKey string, duration time.Duration) (string, error) {
+	claims["purpose"] = purpose
+	claims["iat"] = time.Now().Unix()
+	claims["exp"] = time.Now().Add(duration).Unix()
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secretKey))
+}
+
+func parsePurposeToken(tokenString, purpose, secretKey string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return []byte(secretKey), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid || claims["purpose"] != purpose {
+		return nil, fmt.Errorf("invalid token")
+	}
+	return claims, nil
+}
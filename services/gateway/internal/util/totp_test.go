@@ -0,0 +1,107 @@
+package util
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Secret ASCII "12345678901234567890" của RFC 6238 phụ lục B (SHA1), mã hóa base32
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// Vector RFC 6238 phụ lục B (SHA1): mã 8 số, TOTPCode trả về 6 số cuối
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "94287082"},
+	{1111111109, "07081804"},
+	{1111111111, "14050471"},
+	{1234567890, "89005924"},
+	{2000000000, "69279037"},
+	{20000000000, "65353130"},
+}
+
+func TestTOTPCodeRFC6238Vectors(t *testing.T) {
+	for _, tt := range rfc6238Vectors {
+		got, err := TOTPCode(rfc6238Secret, tt.unix/TOTPPeriod)
+		if err != nil {
+			t.Fatalf("TOTPCode(t=%d): %v", tt.unix, err)
+		}
+		if want := tt.code[len(tt.code)-TOTPDigits:]; got != want {
+			t.Errorf("TOTPCode(t=%d) = %s, want %s", tt.unix, got, want)
+		}
+	}
+}
+
+func TestTOTPCodeSecretFormats(t *testing.T) {
+	want, _ := TOTPCode(rfc6238Secret, 1)
+	for _, secret := range []string{strings.ToLower(rfc6238Secret), rfc6238Secret + "===="} {
+		if got, err := TOTPCode(secret, 1); err != nil || got != want {
+			t.Errorf("TOTPCode(%q) = %q, %v; want %q", secret, got, err, want)
+		}
+	}
+	if _, err := TOTPCode("not base32!", 1); err == nil {
+		t.Error("TOTPCode accepted an invalid secret")
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / TOTPPeriod
+	codeAt := func(step int64) string {
+		code, _ := TOTPCode(rfc6238Secret, step)
+		return code
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", codeAt(current), current, true},
+		{"previous step (clock skew)", codeAt(current - 1), current - 1, true},
+		{"next step (clock skew)", codeAt(current + 1), current + 1, true},
+		{"two steps old", codeAt(current - 2), 0, false},
+		{"two steps ahead", codeAt(current + 2), 0, false},
+		{"wrong length", "12345", 0, false},
+		{"recovery code format", "abcde-fghij", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := VerifyTOTP(rfc6238Secret, tt.code, now)
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("VerifyTOTP(%q) = %d, %v; want %d, %v", tt.code, step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' || code != strings.ToLower(code) {
+			t.Errorf("recovery code %q is not in xxxxx-xxxxx form", code)
+		}
+		if seen[code] {
+			t.Errorf("duplicate recovery code %q", code)
+		}
+		seen[code] = true
+	}
+
+	tests := []struct{ in, want string }{
+		{"abcde-fghij", "abcdefghij"},
+		{" ABCDE FGHIJ ", "abcdefghij"},
+		{"AbCdEfGhIj", "abcdefghij"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeRecoveryCode(tt.in); got != tt.want {
+			t.Errorf("NormalizeRecoveryCode(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
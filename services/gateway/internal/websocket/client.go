@@ -0,0 +1,227 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Client là một kết nối WebSocket với hàng đợi gửi riêng
+type Client struct {
+	hub  *Hub
+	conn *websocket.Conn
+	send chan []byte // Hàng đợi message chờ writePump ghi ra socket
+
+	topics map[string]bool // Các topic đã subscribe (được bảo vệ bởi hub.mu)
+	userID string          // User đã auth (chỉ readPump đọc/ghi)
+
+	mu     sync.Mutex // Bảo vệ send/closed để close() và enqueue() không đua nhau
+	closed bool
+}
+
+func newClient(hub *Hub, conn *websocket.Conn) *Client {
+	return &Client{
+		hub:    hub,
+		conn:   conn,
+		send:   make(chan []byte, hub.opts.SendBufferSize),
+		topics: make(map[string]bool),
+	}
+}
+
+// clientRequest là message client gửi lên, ví dụ:
+// {"op":"subscribe","channel":"depth","symbol":"BTC/USDT"} hoặc {"op":"auth","token":"<access token>"}
+type clientRequest struct {
+	Op      string `json:"op"` // "subscribe", "unsubscribe", "resync" hoặc "auth"
+	Channel string `json:"channel"`
+	Symbol  string `json:"symbol"`
+	Token   string `json:"token,omitempty"` // Chỉ dùng cho op "auth"
+}
+
+// serverReply là phản hồi cho một clientRequest
+type serverReply struct {
+	Type    string `json:"type"` // "subscribed", "unsubscribed", "authenticated" hoặc "error"
+	Channel string `json:"channel,omitempty"`
+	Symbol  string `json:"symbol,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// enqueue đưa message vào hàng đợi mà không block.
+// Trả về false nếu hàng đợi đã đầy (client chậm).
+func (c *Client) enqueue(message []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return true
+	}
+
+	select {
+	case c.send <- message:
+		return true
+	default:
+		return false
+	}
+}
+
+// close đóng hàng đợi gửi; writePump sẽ gửi close frame và đóng kết nối
+func (c *Client) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.closed {
+		c.closed = true
+		close(c.send)
+	}
+}
+
+func (c *Client) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// readPump đọc từ kết nối để phát hiện disconnect và xử lý pong.
+// Khi đọc lỗi (client đóng tab, mất mạng, hết read deadline), client được hủy đăng ký.
+func (c *Client) readPump() {
+	defer func() {
+		c.hub.unregister <- c
+		c.conn.Close()
+	}()
+
+	opts := c.hub.opts
+	c.conn.SetReadLimit(opts.MaxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(opts.PongWait))
+	c.conn.SetPongHandler(func(string) error {
+		// Nhận được pong -> gia hạn read deadline
+		return c.conn.SetReadDeadline(time.Now().Add(opts.PongWait))
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("❌ WS read error: %v", err)
+			}
+			return
+		}
+		c.handleRequest(data)
+	}
+}
+
+// handleRequest xử lý lệnh subscribe/unsubscribe/resync từ client
+func (c *Client) handleRequest(data []byte) {
+	var req clientRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		c.reply(serverReply{Type: "error", Error: "invalid request"})
+		return
+	}
+
+	if req.Op == "auth" {
+		c.authenticate(req.Token)
+		return
+	}
+
+	provider, ok := c.hub.provider(req.Channel)
+	if !ok || req.Symbol == "" {
+		c.reply(serverReply{Type: "error", Channel: req.Channel, Symbol: req.Symbol, Error: "unknown channel or missing symbol"})
+		return
+	}
+	topic := topicName(req.Channel, req.Symbol)
+
+	switch req.Op {
+	case "subscribe", "resync":
+		// Subscribe trước rồi mới lấy snapshot: mọi delta có seq > snapshot.seq đều sẽ tới client,
+		// client bỏ qua các delta có seq <= snapshot.seq
+		c.hub.subscribe(c, topic)
+		if req.Op == "subscribe" {
+			c.reply(serverReply{Type: "subscribed", Channel: req.Channel, Symbol: req.Symbol})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), c.hub.opts.WriteWait)
+		snapshot, err := provider.SnapshotMessage(ctx, req.Symbol)
+		cancel()
+		if err != nil {
+			log.Printf("❌ WS: failed to load %s snapshot: %v", topic, err)
+			c.reply(serverReply{Type: "error", Channel: req.Channel, Symbol: req.Symbol, Error: "snapshot unavailable"})
+			return
+		}
+		c.enqueue(snapshot)
+
+	case "unsubscribe":
+		c.hub.unsubscribe(c, topic)
+		c.reply(serverReply{Type: "unsubscribed", Channel: req.Channel, Symbol: req.Symbol})
+
+	default:
+		c.reply(serverReply{Type: "error", Error: "unknown op: " + req.Op})
+	}
+}
+
+// authenticate xác thực token và subscribe client vào kênh riêng của user
+func (c *Client) authenticate(token string) {
+	auth := c.hub.authenticator()
+	if auth == nil {
+		c.reply(serverReply{Type: "error", Channel: UserChannel, Error: "authentication not supported"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.hub.opts.WriteWait)
+	userID, err := auth(ctx, token)
+	cancel()
+	if err != nil {
+		c.reply(serverReply{Type: "error", Channel: UserChannel, Error: "invalid token"})
+		return
+	}
+
+	// Đổi user trên cùng kết nối -> bỏ kênh của user cũ
+	if c.userID != "" && c.userID != userID {
+		c.hub.unsubscribe(c, topicName(UserChannel, c.userID))
+	}
+	c.userID = userID
+	c.hub.subscribe(c, topicName(UserChannel, userID))
+	c.reply(serverReply{Type: "authenticated", Channel: UserChannel})
+}
+
+// reply gửi phản hồi cho riêng client này
+func (c *Client) reply(msg serverReply) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	c.enqueue(data)
+}
+
+// writePump là goroutine duy nhất ghi ra kết nối: message từ hàng đợi và ping định kỳ
+func (c *Client) writePump() {
+	opts := c.hub.opts
+	ticker := time.NewTicker(opts.PingInterval)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case message, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(opts.WriteWait))
+			if !ok {
+				// Hub đã đóng hàng đợi (disconnect hoặc slow consumer)
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				log.Printf("❌ WS Error: %v", err)
+				return
+			}
+
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(opts.WriteWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -1,9 +1,12 @@
 package websocket
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
@@ -19,24 +22,110 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
+// SlowConsumerPolicy quyết định cách xử lý client không đọc kịp
+type SlowConsumerPolicy string
+
+const (
+	// SlowConsumerDrop bỏ qua message mới khi hàng đợi của client đã đầy
+	SlowConsumerDrop SlowConsumerPolicy = "drop"
+	// SlowConsumerDisconnect ngắt kết nối client khi hàng đợi đã đầy
+	SlowConsumerDisconnect SlowConsumerPolicy = "disconnect"
+)
+
+// Options cấu hình Hub và các kết nối của nó
+type Options struct {
+	SendBufferSize     int
+	SlowConsumerPolicy SlowConsumerPolicy
+	WriteWait          time.Duration
+	PongWait           time.Duration
+	PingInterval       time.Duration
+	MaxMessageSize     int64
+}
+
+// DefaultOptions trả về cấu hình mặc định của Hub
+func DefaultOptions() Options {
+	return Options{
+		SendBufferSize:     256,
+		SlowConsumerPolicy: SlowConsumerDrop,
+		WriteWait:          10 * time.Second,
+		PongWait:           60 * time.Second,
+		PingInterval:       54 * time.Second,
+		MaxMessageSize:     4096,
+	}
+}
+
+// UserChannel là kênh riêng của từng user (order bị từ chối, ...), chỉ nhận sau khi auth
+const UserChannel = "user"
+
+// Authenticator xác thực access token client gửi qua op "auth", trả về user ID (UUID)
+type Authenticator func(ctx context.Context, token string) (userID string, err error)
+
+// SnapshotProvider cung cấp snapshot ban đầu khi client subscribe (hoặc resync) một kênh
+type SnapshotProvider interface {
+	SnapshotMessage(ctx context.Context, symbol string) ([]byte, error)
+}
+
+// topicMessage là message chỉ gửi cho các client đã subscribe topic
+type topicMessage struct {
+	topic   string
+	message []byte
+}
+
 // Hub quản lý tất cả clients đang kết nối
 type Hub struct {
-	clients    map[*websocket.Conn]bool // Danh sách clients
-	broadcast  chan []byte              // Kênh nhận tin để bắn cho tất cả
-	register   chan *websocket.Conn     // Kênh đăng ký user mới
-	unregister chan *websocket.Conn     // Kênh hủy đăng ký
-	mu         sync.Mutex               // Khóa để tránh race condition
+	opts       Options
+	clients    map[*Client]bool            // Danh sách clients
+	topics     map[string]map[*Client]bool // topic ("depth:BTC/USDT") -> clients đã subscribe
+	providers  map[string]SnapshotProvider // channel -> nguồn snapshot
+	auth       Authenticator               // nil = không hỗ trợ kênh user
+	broadcast  chan []byte                 // Kênh nhận tin để bắn cho tất cả
+	publish    chan topicMessage           // Kênh nhận tin cho một topic
+	register   chan *Client                // Kênh đăng ký user mới
+	unregister chan *Client                // Kênh hủy đăng ký
+	mu         sync.RWMutex                // Khóa để tránh race condition
+	dropped    atomic.Uint64               // Số message bị bỏ do client chậm
 }
 
-func NewHub() *Hub {
+// NewHub tạo Hub mới với cấu hình cho trước
+func NewHub(opts Options) *Hub {
+	if opts.SendBufferSize <= 0 {
+		opts.SendBufferSize = DefaultOptions().SendBufferSize
+	}
 	return &Hub{
-		broadcast:  make(chan []byte),
-		register:   make(chan *websocket.Conn),
-		unregister: make(chan *websocket.Conn),
-		clients:    make(map[*websocket.Conn]bool),
+		opts:       opts,
+		broadcast:  make(chan []byte, 1024),
+		publish:    make(chan topicMessage, 1024),
+		register:   make(chan *Client),
+		unregister: make(chan *Client),
+		clients:    make(map[*Client]bool),
+		topics:     make(map[string]map[*Client]bool),
+		providers:  make(map[string]SnapshotProvider),
 	}
 }
 
+// RegisterChannel khai báo một kênh client có thể subscribe, kèm nguồn snapshot ban đầu.
+// Phải gọi trước khi Hub bắt đầu nhận kết nối.
+func (h *Hub) RegisterChannel(channel string, provider SnapshotProvider) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.providers[channel] = provider
+}
+
+// SetAuthenticator bật kênh riêng theo user (op "auth").
+// Phải gọi trước khi Hub bắt đầu nhận kết nối.
+func (h *Hub) SetAuthenticator(auth Authenticator) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.auth = auth
+}
+
+// authenticator trả về Authenticator đã cấu hình (nếu có)
+func (h *Hub) authenticator() Authenticator {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.auth
+}
+
 // Run là vòng lặp chính của Hub
 func (h *Hub) Run() {
 	for {
@@ -44,34 +133,124 @@ func (h *Hub) Run() {
 		case client := <-h.register:
 			h.mu.Lock()
 			h.clients[client] = true
+			total := len(h.clients)
 			h.mu.Unlock()
-			log.Println("🔌 Client connected. Total:", len(h.clients))
+			log.Println("🔌 Client connected. Total:", total)
 
 		case client := <-h.unregister:
 			h.mu.Lock()
 			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				client.Close()
+				h.removeClientLocked(client)
 			}
+			total := len(h.clients)
 			h.mu.Unlock()
-			log.Println("🔌 Client disconnected. Total:", len(h.clients))
+			log.Println("🔌 Client disconnected. Total:", total)
+
+		case msg := <-h.publish:
+			// Chỉ gửi cho các client đã subscribe topic này
+			h.mu.RLock()
+			var slow []*Client
+			for client := range h.topics[msg.topic] {
+				if !client.enqueue(msg.message) {
+					slow = append(slow, client)
+				}
+			}
+			h.mu.RUnlock()
+
+			h.handleSlowClients(slow)
 
 		case message := <-h.broadcast:
-			// Khi nhận được tin (từ Redis), bắn cho TẤT CẢ client
-			h.mu.Lock()
+			// Khi nhận được tin (từ Redis/NATS), đẩy vào hàng đợi của từng client.
+			// Không bao giờ ghi trực tiếp ra socket ở đây, nên client chậm không chặn được Hub.
+			h.mu.RLock()
+			var slow []*Client
 			for client := range h.clients {
-				err := client.WriteMessage(websocket.TextMessage, message)
-				if err != nil {
-					log.Printf("❌ WS Error: %v", err)
-					client.Close()
-					delete(h.clients, client)
+				if !client.enqueue(message) {
+					slow = append(slow, client)
 				}
 			}
-			h.mu.Unlock()
+			h.mu.RUnlock()
+
+			h.handleSlowClients(slow)
+		}
+	}
+}
+
+// handleSlowClients áp dụng SlowConsumerPolicy cho các client có hàng đợi đã đầy
+func (h *Hub) handleSlowClients(slow []*Client) {
+	if len(slow) == 0 {
+		return
+	}
+
+	if h.opts.SlowConsumerPolicy != SlowConsumerDisconnect {
+		// Chỉ log lần đầu và mỗi 1000 message bị bỏ để tránh spam log
+		total := h.dropped.Add(uint64(len(slow)))
+		if prev := total - uint64(len(slow)); prev == 0 || prev/1000 != total/1000 {
+			log.Printf("⚠️  WS: dropped message for %d slow client(s) (total dropped: %d)", len(slow), total)
+		}
+		return
+	}
+
+	h.mu.Lock()
+	for _, client := range slow {
+		if _, ok := h.clients[client]; ok {
+			h.removeClientLocked(client)
+			log.Printf("⚠️  WS: disconnecting slow client %s", client.conn.RemoteAddr())
+		}
+	}
+	h.mu.Unlock()
+}
+
+// removeClientLocked xóa client khỏi Hub và mọi topic (caller phải giữ h.mu)
+func (h *Hub) removeClientLocked(client *Client) {
+	delete(h.clients, client)
+	for topic := range client.topics {
+		h.unsubscribeLocked(client, topic)
+	}
+	client.close()
+}
+
+// subscribe đăng ký client vào topic
+func (h *Hub) subscribe(client *Client, topic string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// Client đã bị đóng thì removeClientLocked đã chạy xong, không được thêm lại vào topic
+	if client.isClosed() {
+		return
+	}
+	if h.topics[topic] == nil {
+		h.topics[topic] = make(map[*Client]bool)
+	}
+	h.topics[topic][client] = true
+	client.topics[topic] = true
+}
+
+// unsubscribe hủy đăng ký client khỏi topic
+func (h *Hub) unsubscribe(client *Client, topic string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.unsubscribeLocked(client, topic)
+}
+
+func (h *Hub) unsubscribeLocked(client *Client, topic string) {
+	delete(client.topics, topic)
+	if subscribers, ok := h.topics[topic]; ok {
+		delete(subscribers, client)
+		if len(subscribers) == 0 {
+			delete(h.topics, topic)
 		}
 	}
 }
 
+// provider trả về SnapshotProvider của channel (nếu có)
+func (h *Hub) provider(channel string) (SnapshotProvider, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	p, ok := h.providers[channel]
+	return p, ok
+}
+
 // HandleWebSocket là handler cho Gin Route
 func (h *Hub) HandleWebSocket(ctx *gin.Context) {
 	conn, err := upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
@@ -79,10 +258,43 @@ func (h *Hub) HandleWebSocket(ctx *gin.Context) {
 		log.Println("Failed to upgrade websocket:", err)
 		return
 	}
-	h.register <- conn
+
+	client := newClient(h, conn)
+	h.register <- client
+
+	// Mỗi kết nối có một goroutine ghi và một goroutine đọc riêng
+	go client.writePump()
+	go client.readPump()
 }
 
 // BroadcastToClients giúp các package khác gọi gửi tin
 func (h *Hub) BroadcastToClients(message []byte) {
 	h.broadcast <- message
 }
+
+// Publish gửi message cho các client đã subscribe channel của symbol
+func (h *Hub) Publish(channel, symbol string, message []byte) {
+	h.publish <- topicMessage{topic: topicName(channel, symbol), message: message}
+}
+
+// SendToUser gửi message tới mọi kết nối đã auth của user
+func (h *Hub) SendToUser(userID string, message []byte) {
+	h.Publish(UserChannel, userID, message)
+}
+
+// topicName ghép channel và symbol thành tên topic, ví dụ "depth:BTC/USDT"
+func topicName(channel, symbol string) string {
+	return channel + ":" + symbol
+}
+
+// ClientCount trả về số client đang kết nối
+func (h *Hub) ClientCount() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients)
+}
+
+// DroppedMessages trả về tổng số message đã bị bỏ do client chậm
+func (h *Hub) DroppedMessages() uint64 {
+	return h.dropped.Load()
+}
@@ -0,0 +1,277 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	db "github.com/trading-platform/gateway/internal/database/sqlc"
+)
+
+const (
+	auditWriteTimeout    = 5 * time.Second  // Thời gian tối đa cho một lần INSERT
+	auditShutdownTimeout = 10 * time.Second // Thời gian ghi nốt hàng đợi khi shutdown
+	auditMinBackoff      = 200 * time.Millisecond
+	auditMaxBackoff      = 10 * time.Second
+)
+
+// AuditWriterOptions cấu hình hàng đợi và lô ghi audit log
+type AuditWriterOptions struct {
+	QueueSize     int           // Số entry chờ ghi tối đa
+	BatchSize     int           // Số entry tối đa mỗi câu INSERT
+	FlushInterval time.Duration // Entry chờ tối đa bấy lâu trước khi được ghi
+}
+
+// AuditWriterHealth mô tả trạng thái audit writer (dùng cho health endpoint)
+type AuditWriterHealth struct {
+	Queued        int        `json:"queued"`
+	Written       uint64     `json:"written"`
+	Lost          uint64     `json:"lost"` // Entry không ghi được vào DB, chỉ còn trong log của process
+	LastError     string     `json:"last_error,omitempty"`
+	LastWrittenAt *time.Time `json:"last_written_at,omitempty"`
+}
+
+// AuditWriter ghi audit log vào Postgres theo lô ở goroutine riêng để request không phải chờ INSERT.
+// Không bỏ entry khi DB chậm: hàng đợi đầy thì Log ghi đồng bộ, lô lỗi được thử lại với backoff,
+// shutdown thì ghi nốt hàng đợi. Entry thật sự không ghi được sẽ được in nguyên văn ra log.
+type AuditWriter struct {
+	store   db.Store
+	opts    AuditWriterOptions
+	queue   chan db.CreateAuditLogParams
+	done    chan struct{} // Đóng khi bắt đầu shutdown
+	stopped chan struct{} // Đóng khi đã ghi nốt hàng đợi
+
+	mu     sync.RWMutex
+	health AuditWriterHealth
+}
+
+func NewAuditWriter(store db.Store, opts AuditWriterOptions) *AuditWriter {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 10000
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 200
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+	return &AuditWriter{
+		store:   store,
+		opts:    opts,
+		queue:   make(chan db.CreateAuditLogParams, opts.QueueSize),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+// Log đưa entry vào hàng đợi; thời điểm xảy ra được chốt ngay tại đây chứ không phải lúc ghi
+func (w *AuditWriter) Log(entry db.CreateAuditLogParams) {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+
+	select {
+	case <-w.done:
+		// Writer đã dừng (đang shutdown): không còn ai đọc hàng đợi
+	default:
+		select {
+		case w.queue <- entry:
+			return
+		default:
+			// Hàng đợi đầy: ghi đồng bộ, request chậm đi còn hơn mất audit log
+		}
+	}
+
+	entries := []db.CreateAuditLogParams{entry}
+	if rest, err := w.write(entries); err != nil {
+		w.lose(rest, err)
+	}
+}
+
+// Start chạy writer cho đến khi ctx bị cancel, sau đó ghi nốt các entry còn trong hàng đợi
+func (w *AuditWriter) Start(ctx context.Context) {
+	log.Println("📝 Audit Writer started")
+
+	ticker := time.NewTicker(w.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]db.CreateAuditLogParams, 0, w.opts.BatchSize)
+	for {
+		select {
+		case <-ctx.Done():
+			w.shutdown(batch)
+			close(w.stopped)
+			log.Println("🛑 Audit Writer stopped")
+			return
+		case entry := <-w.queue:
+			batch = append(batch, entry)
+			if len(batch) < w.opts.BatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+
+		batch = w.flush(ctx, batch)
+	}
+}
+
+// Stopped đóng sau khi writer dừng và đã ghi nốt hàng đợi (chờ trước khi thoát process)
+func (w *AuditWriter) Stopped() <-chan struct{} {
+	return w.stopped
+}
+
+// Health trả về trạng thái writer kèm số entry đang chờ
+func (w *AuditWriter) Health() AuditWriterHealth {
+	w.mu.RLock()
+	health := w.health
+	w.mu.RUnlock()
+
+	health.Queued = len(w.queue)
+	return health
+}
+
+// flush ghi batch, thử lại với backoff cho tới khi thành công. Trong lúc thử lại writer không đọc
+// hàng đợi nên hàng đợi đầy dần và Log chuyển sang ghi đồng bộ (backpressure).
+// Trả về phần chưa ghi được nếu ctx bị cancel giữa chừng.
+func (w *AuditWriter) flush(ctx context.Context, batch []db.CreateAuditLogParams) []db.CreateAuditLogParams {
+	backoff := auditMinBackoff
+	for {
+		rest, err := w.write(batch)
+		if err == nil {
+			return batch[:0]
+		}
+		batch = rest
+
+		select {
+		case <-ctx.Done():
+			return batch
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > auditMaxBackoff {
+			backoff = auditMaxBackoff
+		}
+	}
+}
+
+// shutdown ghi nốt batch đang giữ và toàn bộ hàng đợi trong auditShutdownTimeout
+func (w *AuditWriter) shutdown(batch []db.CreateAuditLogParams) {
+	close(w.done)
+	deadline := time.Now().Add(auditShutdownTimeout)
+
+	for {
+	drain:
+		for len(batch) < w.opts.BatchSize {
+			select {
+			case entry := <-w.queue:
+				batch = append(batch, entry)
+			default:
+				break drain
+			}
+		}
+		if len(batch) == 0 {
+			return
+		}
+
+		rest, err := w.write(batch)
+		if err != nil && time.Now().After(deadline) {
+			w.lose(rest, err)
+			for len(w.queue) > 0 {
+				w.lose([]db.CreateAuditLogParams{<-w.queue}, err)
+			}
+			return
+		}
+		if err != nil {
+			time.Sleep(auditMinBackoff)
+			batch = rest
+			continue
+		}
+		batch = batch[:0]
+	}
+}
+
+// write ghi entries trong một câu INSERT; trả về các entry chưa ghi được kèm lỗi.
+// Lỗi do dữ liệu (Postgres từ chối, details không encode được) thì thử lại bao nhiêu lần cũng vậy:
+// ghi lại từng entry và bỏ riêng entry hỏng để nó không chặn cả lô.
+func (w *AuditWriter) write(entries []db.CreateAuditLogParams) ([]db.CreateAuditLogParams, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), auditWriteTimeout)
+	defer cancel()
+
+	_, err := w.store.CreateAuditLogs(ctx, entries)
+	if err == nil {
+		w.record(len(entries), nil)
+		return nil, nil
+	}
+	if !isPermanentAuditError(err) {
+		w.record(0, err)
+		return entries, err
+	}
+	if len(entries) == 1 {
+		w.lose(entries, err)
+		return nil, nil
+	}
+
+	written := 0
+	for i, entry := range entries {
+		if _, err := w.store.CreateAuditLogs(ctx, []db.CreateAuditLogParams{entry}); err != nil {
+			if !isPermanentAuditError(err) {
+				w.record(written, err)
+				return entries[i:], err
+			}
+			w.lose([]db.CreateAuditLogParams{entry}, err)
+			continue
+		}
+		written++
+	}
+	w.record(written, nil)
+	return nil, nil
+}
+
+func isPermanentAuditError(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) || strings.HasPrefix(err.Error(), "failed to encode audit details")
+}
+
+func (w *AuditWriter) record(written int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if written > 0 {
+		now := time.Now()
+		w.health.Written += uint64(written)
+		w.health.LastWrittenAt = &now
+	}
+	if err != nil {
+		// Chỉ log khi lỗi thay đổi để tránh spam mỗi lần thử lại
+		if err.Error() != w.health.LastError {
+			log.Printf("⚠️  Audit Writer error: %v", err)
+		}
+		w.health.LastError = err.Error()
+	} else {
+		w.health.LastError = ""
+	}
+}
+
+// lose in nguyên văn entry ra log: nơi cuối cùng còn dấu vết khi không ghi được vào DB
+func (w *AuditWriter) lose(entries []db.CreateAuditLogParams, err error) {
+	for _, entry := range entries {
+		raw, marshalErr := json.Marshal(entry)
+		if marshalErr != nil {
+			raw = []byte(fmt.Sprintf("%+v", entry))
+		}
+		log.Printf("🚨 Audit log entry not persisted (%v): %s", err, raw)
+	}
+
+	w.mu.Lock()
+	w.health.Lost += uint64(len(entries))
+	w.mu.Unlock()
+}
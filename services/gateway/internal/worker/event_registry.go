@@ -0,0 +1,70 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+
+	db "github.com/trading-platform/gateway/internal/database/sqlc"
+	"github.com/trading-platform/gateway/internal/models"
+)
+
+// EventHandler xử lý một loại event đã decode thành T
+type EventHandler[T any] struct {
+	// Apply ghi side effect vào DB, chạy trong transaction (theo lô) cùng processed_events
+	Apply func(ctx context.Context, q *db.EventBatch, data *T) error
+	// AfterCommit (tùy chọn) chạy sau khi commit, ví dụ broadcast WebSocket
+	AfterCommit func(ctx context.Context, data *T)
+}
+
+// boundEvent là event đã decode, sẵn sàng áp dụng
+type boundEvent struct {
+	apply       func(ctx context.Context, q *db.EventBatch) error
+	afterCommit func(ctx context.Context)
+}
+
+// EventRegistry ánh xạ tên loại event sang cách decode và xử lý.
+// Thêm loại event mới chỉ cần RegisterEvent, không phải sửa EventProcessor.
+type EventRegistry struct {
+	binders map[string]func(event models.EngineEvent) (boundEvent, error)
+}
+
+// NewEventRegistry tạo registry rỗng
+func NewEventRegistry() *EventRegistry {
+	return &EventRegistry{binders: make(map[string]func(models.EngineEvent) (boundEvent, error))}
+}
+
+// RegisterEvent đăng ký loại event eventType với payload kiểu T (*T phải implement models.EventData)
+func RegisterEvent[T any, PT interface {
+	*T
+	models.EventData
+}](r *EventRegistry, eventType string, handler EventHandler[T]) {
+	if _, exists := r.binders[eventType]; exists {
+		panic(fmt.Sprintf("event type %s registered twice", eventType))
+	}
+
+	r.binders[eventType] = func(event models.EngineEvent) (boundEvent, error) {
+		data := new(T)
+		if err := event.DecodeData(PT(data)); err != nil {
+			return boundEvent{}, err
+		}
+
+		bound := boundEvent{
+			apply: func(ctx context.Context, q *db.EventBatch) error {
+				return handler.Apply(ctx, q, data)
+			},
+		}
+		if handler.AfterCommit != nil {
+			bound.afterCommit = func(ctx context.Context) { handler.AfterCommit(ctx, data) }
+		}
+		return bound, nil
+	}
+}
+
+// bind decode data của event theo loại đã đăng ký
+func (r *EventRegistry) bind(event models.EngineEvent) (boundEvent, error) {
+	binder, ok := r.binders[event.Type]
+	if !ok {
+		return boundEvent{}, fmt.Errorf("%w: %s", models.ErrUnknownEventType, event.Type)
+	}
+	return binder(event)
+}
@@ -0,0 +1,167 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	db "github.com/trading-platform/gateway/internal/database/sqlc"
+)
+
+// ErrLedgerCheckRunning khi một lần kiểm tra sổ cái khác đang chạy
+var ErrLedgerCheckRunning = errors.New("ledger check is already running")
+
+// LedgerCheckerOptions cấu hình job kiểm tra sổ cái
+type LedgerCheckerOptions struct {
+	Interval time.Duration // Chu kỳ chạy định kỳ, 0 = chỉ chạy khi admin gọi
+	AutoFix  bool          // Lần chạy định kỳ tự đặt lại accounts.balance theo sổ cái
+}
+
+// LedgerBalanceIssue là một ví có số dư lệch với sổ cái
+type LedgerBalanceIssue struct {
+	db.LedgerBalanceMismatch
+	Fixed bool   `json:"fixed"`
+	Error string `json:"error,omitempty"`
+}
+
+// LedgerReport là kết quả một lần kiểm tra sổ cái
+type LedgerReport struct {
+	StartedAt  time.Time            `json:"started_at"`
+	FinishedAt time.Time            `json:"finished_at"`
+	Fix        bool                 `json:"fix"`
+	Mismatches []LedgerBalanceIssue `json:"mismatches"` // accounts.balance khác tổng entry
+	Imbalances []db.LedgerImbalance `json:"imbalances"` // Journal không cân (nợ != có)
+}
+
+// Consistent cho biết sổ cái và số dư khớp nhau
+func (r LedgerReport) Consistent() bool {
+	for _, issue := range r.Mismatches {
+		if !issue.Fixed {
+			return false
+		}
+	}
+	return len(r.Imbalances) == 0
+}
+
+// LedgerChecker kiểm tra sổ cái kép: mọi journal cân bằng và số dư mỗi ví (projection)
+// bằng tổng entry của ví đó. Sai lệch chỉ được sửa theo hướng sổ cái -> accounts.balance.
+type LedgerChecker struct {
+	store db.Store
+	opts  LedgerCheckerOptions
+
+	running sync.Mutex // Chỉ một lần kiểm tra tại một thời điểm
+	mu      sync.RWMutex
+	last    *LedgerReport
+}
+
+// NewLedgerChecker tạo LedgerChecker mới
+func NewLedgerChecker(store db.Store, opts LedgerCheckerOptions) *LedgerChecker {
+	return &LedgerChecker{store: store, opts: opts}
+}
+
+// Start chạy kiểm tra định kỳ cho tới khi ctx bị cancel (không làm gì nếu Interval = 0)
+func (c *LedgerChecker) Start(ctx context.Context) {
+	if c.opts.Interval <= 0 {
+		log.Println("📒 Ledger checker: periodic run disabled")
+		return
+	}
+
+	ticker := time.NewTicker(c.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := c.Run(ctx, c.opts.AutoFix); err != nil && !errors.Is(err, ErrLedgerCheckRunning) {
+				log.Printf("❌ Ledger check failed: %v", err)
+			}
+		}
+	}
+}
+
+// LastReport trả về kết quả lần kiểm tra gần nhất
+func (c *LedgerChecker) LastReport() (LedgerReport, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.last == nil {
+		return LedgerReport{}, false
+	}
+	return *c.last, true
+}
+
+// Run kiểm tra toàn bộ sổ cái; fix = true thì đặt lại số dư các ví bị lệch theo sổ cái
+func (c *LedgerChecker) Run(ctx context.Context, fix bool) (LedgerReport, error) {
+	if !c.running.TryLock() {
+		return LedgerReport{}, ErrLedgerCheckRunning
+	}
+	defer c.running.Unlock()
+
+	report := LedgerReport{StartedAt: time.Now(), Fix: fix, Mismatches: []LedgerBalanceIssue{}}
+
+	imbalances, err := c.store.ListLedgerImbalances(ctx)
+	if err != nil {
+		return report, fmt.Errorf("failed to check journals: %w", err)
+	}
+	report.Imbalances = imbalances
+
+	mismatches, err := c.store.ListLedgerBalanceMismatches(ctx)
+	if err != nil {
+		return report, fmt.Errorf("failed to check balances: %w", err)
+	}
+	for _, mismatch := range mismatches {
+		issue := LedgerBalanceIssue{LedgerBalanceMismatch: mismatch}
+		if fix {
+			c.fix(ctx, &issue)
+		}
+		report.Mismatches = append(report.Mismatches, issue)
+	}
+	report.FinishedAt = time.Now()
+
+	c.mu.Lock()
+	c.last = &report
+	c.mu.Unlock()
+
+	if report.Consistent() {
+		log.Printf("📒 Ledger check done: consistent (%d balance(s) fixed)", len(report.Mismatches))
+	} else {
+		log.Printf("🚨 Ledger check done: %d balance mismatch(es), %d unbalanced journal(s), fix=%v",
+			len(report.Mismatches), len(report.Imbalances), fix)
+	}
+	return report, nil
+}
+
+// fix đặt lại accounts.balance của ví theo sổ cái. SyncAccountBalanceTx khóa ví rồi tính lại,
+// nên journal vừa commit sau lần kiểm tra cũng được tính; đã khớp thì không đổi gì.
+func (c *LedgerChecker) fix(ctx context.Context, issue *LedgerBalanceIssue) {
+	if issue.AccountType == "" {
+		issue.Error = "ledger entries reference an account that does not exist or has another currency"
+		return
+	}
+
+	account, synced, err := c.store.SyncAccountBalanceTx(ctx, issue.AccountID)
+	if err != nil {
+		issue.Error = err.Error()
+		return
+	}
+	issue.Fixed = true
+	if synced {
+		log.Printf("🔧 Ledger: account %d balance %s -> %s", issue.AccountID, issue.Balance, account.Balance)
+	}
+}
+
+// Health trả về trạng thái lần kiểm tra gần nhất (healthy nếu chưa chạy lần nào)
+func (c *LedgerChecker) Health() (bool, interface{}) {
+	report, ok := c.LastReport()
+	if !ok {
+		return true, map[string]interface{}{"checked": false}
+	}
+	return report.Consistent(), map[string]interface{}{
+		"checked_at": report.FinishedAt,
+		"mismatches": len(report.Mismatches),
+		"imbalances": len(report.Imbalances),
+	}
+}
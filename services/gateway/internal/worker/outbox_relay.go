@@ -0,0 +1,138 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	db "github.com/trading-platform/gateway/internal/database/sqlc"
+	"github.com/trading-platform/gateway/internal/messaging"
+)
+
+// OutboxRelayOptions cấu hình chu kỳ quét outbox
+type OutboxRelayOptions struct {
+	PollInterval time.Duration // Chu kỳ quét outbox khi không có Notify
+	BatchSize    int           // Số command tối đa publish trong một transaction
+}
+
+// OutboxRelayHealth mô tả trạng thái relay (dùng cho health endpoint)
+type OutboxRelayHealth struct {
+	Pending    int64      `json:"pending"`
+	Sent       uint64     `json:"sent"`
+	LastError  string     `json:"last_error,omitempty"`
+	LastSentAt *time.Time `json:"last_sent_at,omitempty"`
+}
+
+// OutboxRelay publish các command pending trong bảng outbox lên JetStream.
+// Command được ghi cùng transaction với order nên mọi lệnh đã nhận đều tới engine ít nhất một lần;
+// bản publish lặp (crash sau publish, trước commit) bị JetStream loại nhờ Nats-Msg-Id.
+type OutboxRelay struct {
+	store     db.Store
+	publisher *messaging.CommandPublisher
+	opts      OutboxRelayOptions
+	notify    chan struct{}
+
+	mu     sync.RWMutex
+	health OutboxRelayHealth
+}
+
+func NewOutboxRelay(store db.Store, publisher *messaging.CommandPublisher, opts OutboxRelayOptions) *OutboxRelay {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	return &OutboxRelay{
+		store:     store,
+		publisher: publisher,
+		opts:      opts,
+		notify:    make(chan struct{}, 1),
+	}
+}
+
+// Notify báo relay có command mới để publish ngay, không chờ tới chu kỳ quét
+func (r *OutboxRelay) Notify() {
+	select {
+	case r.notify <- struct{}{}:
+	default:
+		// Đã có tín hiệu đang chờ, relay sẽ quét toàn bộ pending
+	}
+}
+
+// Start chạy relay cho đến khi ctx bị cancel
+func (r *OutboxRelay) Start(ctx context.Context) {
+	log.Println("📤 Outbox Relay started")
+
+	ticker := time.NewTicker(r.opts.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		r.drain(ctx)
+
+		select {
+		case <-ctx.Done():
+			log.Println("🛑 Outbox Relay stopped")
+			return
+		case <-ticker.C:
+		case <-r.notify:
+		}
+	}
+}
+
+// Health trả về trạng thái relay kèm số command đang chờ
+func (r *OutboxRelay) Health() OutboxRelayHealth {
+	r.mu.RLock()
+	health := r.health
+	r.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if pending, err := r.store.CountPendingOutboxMessages(ctx); err == nil {
+		health.Pending = pending
+	}
+	return health
+}
+
+// drain publish từng batch cho tới khi hết pending hoặc gặp lỗi
+func (r *OutboxRelay) drain(ctx context.Context) {
+	for ctx.Err() == nil {
+		var publishErr error
+		sent, err := r.store.RelayOutboxTx(ctx, int32(r.opts.BatchSize), func(msg db.OutboxMessage) error {
+			publishErr = r.publisher.PublishRaw(ctx, msg.Subject, msg.Payload, msg.MsgID)
+			if publishErr != nil {
+				log.Printf("❌ Failed to relay outbox message %d (%s): %v", msg.ID, msg.MsgID, publishErr)
+			}
+			return publishErr
+		})
+		if err == nil {
+			err = publishErr
+		}
+		r.record(sent, err)
+
+		if err != nil || sent < r.opts.BatchSize {
+			return
+		}
+	}
+}
+
+func (r *OutboxRelay) record(sent int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if sent > 0 {
+		now := time.Now()
+		r.health.Sent += uint64(sent)
+		r.health.LastSentAt = &now
+	}
+	if err != nil {
+		// Chỉ log khi lỗi thay đổi để tránh spam mỗi chu kỳ quét
+		if err.Error() != r.health.LastError {
+			log.Printf("⚠️  Outbox Relay error: %v", err)
+		}
+		r.health.LastError = err.Error()
+	} else {
+		r.health.LastError = ""
+	}
+}
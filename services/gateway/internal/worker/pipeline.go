@@ -0,0 +1,242 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+	db "github.com/trading-platform/gateway/internal/database/sqlc"
+	"github.com/trading-platform/gateway/internal/models"
+)
+
+// PipelineStats mô tả hàng đợi và độ trễ của các partition (dùng cho health endpoint)
+type PipelineStats struct {
+	QueueDepth int              `json:"queue_depth"` // Tổng event đang chờ trong các partition
+	MaxLagMs   int64            `json:"max_lag_ms"`  // Độ trễ lớn nhất hiện tại giữa các partition
+	Partitions []PartitionStats `json:"partitions"`
+}
+
+// PartitionStats mô tả một partition
+type PartitionStats struct {
+	QueueDepth int    `json:"queue_depth"`
+	Processed  uint64 `json:"processed"` // Số event đã commit (kể cả trùng)
+	Batches    uint64 `json:"batches"`   // Số transaction đã commit
+	LagMs      int64  `json:"lag_ms"`    // Tuổi của event đang xử lý, tính từ lúc vào stream (0 = rảnh)
+}
+
+// eventJob là một event đã decode, chờ xử lý trong partition
+type eventJob struct {
+	msg         jetstream.Msg // nil khi replay từ dead-letter
+	data        []byte
+	event       models.EngineEvent
+	bound       boundEvent
+	eventID     string
+	streamSeq   uint64
+	attempt     uint64
+	publishedAt time.Time
+}
+
+// partition xử lý tuần tự các event của những symbol được băm vào nó
+type partition struct {
+	index     int
+	queue     chan *eventJob
+	processed atomic.Uint64
+	batches   atomic.Uint64
+	headSince atomic.Int64 // UnixNano lúc event đang xử lý vào stream, 0 = rảnh
+}
+
+// partitionFor chọn partition theo symbol: cùng symbol luôn cùng partition nên giữ được thứ tự.
+// Event không có symbol (engine cũ) dồn vào một partition, xử lý tuần tự như trước.
+func (p *EventProcessor) partitionFor(symbol string) *partition {
+	h := fnv.New32a()
+	h.Write([]byte(symbol))
+	return p.partitions[h.Sum32()%uint32(len(p.partitions))]
+}
+
+// runPartition lấy event khỏi hàng đợi, gom những event đang chờ sẵn thành lô (tối đa batchSize)
+func (p *EventProcessor) runPartition(ctx context.Context, part *partition) {
+	batch := make([]*eventJob, 0, p.batchSize)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-part.queue:
+			batch = append(batch[:0], job)
+		}
+
+	collect:
+		for len(batch) < p.batchSize {
+			select {
+			case job := <-part.queue:
+				batch = append(batch, job)
+			default:
+				break collect
+			}
+		}
+
+		part.headSince.Store(batch[0].publishedAt.UnixNano())
+		p.processBatch(ctx, part, batch)
+		part.headSince.Store(0)
+	}
+}
+
+// processBatch ghi cả lô trong một transaction; lô lỗi thì xử lý lại từng event
+// để chỉ event hỏng bị retry/dead-letter, các event khác vẫn được áp dụng đúng thứ tự.
+func (p *EventProcessor) processBatch(ctx context.Context, part *partition, jobs []*eventJob) {
+	if len(jobs) > 1 {
+		result, err := p.applyBatch(ctx, jobs)
+		if err == nil {
+			p.complete(ctx, part, jobs, result.Duplicate)
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("⚠️  Batch of %d events failed on partition %d, retrying one by one: %v", len(jobs), part.index, err)
+	}
+
+	for _, job := range jobs {
+		if !p.processOne(ctx, part, job) {
+			return
+		}
+	}
+}
+
+// processOne xử lý một event, thử lại tại chỗ khi lỗi tạm thời (không Nak)
+// để event sau cùng symbol không vượt lên trước. Trả về false khi đang shutdown.
+func (p *EventProcessor) processOne(ctx context.Context, part *partition, job *eventJob) bool {
+	for {
+		result, err := p.applyBatch(ctx, []*eventJob{job})
+		if err == nil {
+			p.complete(ctx, part, []*eventJob{job}, result.Duplicate)
+			return true
+		}
+		if ctx.Err() != nil {
+			return false // Chưa ack: sẽ được deliver lại ở lần chạy sau
+		}
+
+		// Lỗi vĩnh viễn, hoặc đã thử đủ số lần: chuyển vào dead-letter thay vì bỏ mất
+		var permErr *permanentError
+		lastAttempt := p.opts.MaxDeliver > 0 && job.attempt >= uint64(p.opts.MaxDeliver)
+		if errors.As(err, &permErr) || lastAttempt {
+			dlqErr := p.deadLetter(ctx, job.data, job.streamSeq, job.attempt, err)
+			if dlqErr == nil {
+				if termErr := job.msg.Term(); termErr != nil {
+					log.Printf("⚠️  Failed to terminate event: %v", termErr)
+				}
+				return true
+			}
+			log.Printf("❌ Failed to dead-letter event (stream seq %d): %v", job.streamSeq, dlqErr)
+		} else {
+			log.Printf("❌ Event processing failed (attempt %d): %v", job.attempt, err)
+		}
+
+		delay := redeliveryDelay(job.attempt)
+		if !p.waitRetry(ctx, job.msg, delay) {
+			return false
+		}
+		job.attempt++
+	}
+}
+
+// waitRetry chờ trước lần thử lại, định kỳ báo JetStream event vẫn đang xử lý để không bị redeliver
+func (p *EventProcessor) waitRetry(ctx context.Context, msg jetstream.Msg, delay time.Duration) bool {
+	keepAlive := p.opts.AckWait / 2
+	if keepAlive <= 0 {
+		keepAlive = 10 * time.Second
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+
+	msg.InProgress()
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-timer.C:
+			return true
+		case <-ticker.C:
+			msg.InProgress()
+		}
+	}
+}
+
+// applyBatch chạy side effect của các event trong một transaction
+func (p *EventProcessor) applyBatch(ctx context.Context, jobs []*eventJob) (db.ProcessEventBatchTxResult, error) {
+	arg := db.ProcessEventBatchTxParams{
+		Source: EventSource,
+		Events: make([]db.MarkEventProcessedParams, len(jobs)),
+	}
+	for i, job := range jobs {
+		arg.Events[i] = db.MarkEventProcessedParams{
+			EventID:   job.eventID,
+			EventType: job.event.Type,
+			Epoch:     int64(job.event.Epoch),
+			Seq:       int64(job.event.Seq),
+		}
+	}
+
+	return p.store.ProcessEventBatchTx(ctx, arg, func(b *db.EventBatch, i int) error {
+		return jobs[i].bound.apply(ctx, b)
+	})
+}
+
+// complete ack các event đã commit, chạy bước sau commit (broadcast...) và cập nhật số liệu
+func (p *EventProcessor) complete(ctx context.Context, part *partition, jobs []*eventJob, duplicate []bool) {
+	var processed, duplicates uint64
+	for i, job := range jobs {
+		if err := job.msg.Ack(); err != nil {
+			log.Printf("⚠️  Failed to ack event: %v", err)
+		}
+
+		if duplicate[i] {
+			duplicates++
+			log.Printf("♻️  Skipping duplicate event %s (%s)", job.eventID, job.event.Type)
+			continue
+		}
+		processed++
+		if job.bound.afterCommit != nil {
+			job.bound.afterCommit(ctx)
+		}
+	}
+
+	part.processed.Add(uint64(len(jobs)))
+	part.batches.Add(1)
+
+	p.mu.Lock()
+	now := time.Now()
+	p.health.LastEventAt = &now
+	p.health.Processed += processed
+	p.health.Duplicates += duplicates
+	p.mu.Unlock()
+}
+
+// pipelineStats đọc độ sâu hàng đợi và độ trễ hiện tại của các partition
+func (p *EventProcessor) pipelineStats() PipelineStats {
+	stats := PipelineStats{Partitions: make([]PartitionStats, len(p.partitions))}
+	now := time.Now()
+	for i, part := range p.partitions {
+		ps := PartitionStats{
+			QueueDepth: len(part.queue),
+			Processed:  part.processed.Load(),
+			Batches:    part.batches.Load(),
+		}
+		if since := part.headSince.Load(); since > 0 {
+			ps.LagMs = now.Sub(time.Unix(0, since)).Milliseconds()
+		}
+
+		stats.QueueDepth += ps.QueueDepth
+		if ps.LagMs > stats.MaxLagMs {
+			stats.MaxLagMs = ps.LagMs
+		}
+		stats.Partitions[i] = ps
+	}
+	return stats
+}
@@ -3,84 +3,462 @@ package worker
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"sync"
+	"time"
 
-	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
 	db "github.com/trading-platform/gateway/internal/database/sqlc"
+	"github.com/trading-platform/gateway/internal/messaging"
 	"github.com/trading-platform/gateway/internal/models"
 	"github.com/trading-platform/gateway/internal/websocket"
 )
 
-// EventProcessor xử lý các event từ Rust Engine
+// permanentError là lỗi không thể tự hết khi retry (ví dụ event sai format)
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// permanent đánh dấu lỗi không nên redeliver
+func permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// EventSource là nguồn sequence của event engine trong bảng event_sequences
+const EventSource = "engine"
+
+var (
+	// ErrNotPaused khi gọi Resume lúc processor đang chạy bình thường
+	ErrNotPaused = errors.New("event processor is not paused")
+	// ErrNotReplayable khi replay một dead-letter event đã replay hoặc đã bỏ
+	ErrNotReplayable = errors.New("dead-letter event is not pending")
+)
+
+// EventGapError báo sequence event nhảy cóc: có event engine đã bắn nhưng gateway chưa nhận
+type EventGapError struct {
+	Source   string `json:"source"`
+	Epoch    int64  `json:"epoch"`
+	Expected int64  `json:"expected"`
+	Got      int64  `json:"got"`
+}
+
+func (e *EventGapError) Error() string {
+	return fmt.Sprintf("event sequence gap on %s (epoch %d): expected %d, got %d", e.Source, e.Epoch, e.Expected, e.Got)
+}
+
+// EventProcessorHealth mô tả trạng thái processor (dùng cho health endpoint)
+type EventProcessorHealth struct {
+	Paused       bool           `json:"paused"`
+	Gap          *EventGapError `json:"gap,omitempty"` // Sequence bị mất khiến processor tạm dừng
+	Processed    uint64         `json:"processed"`
+	Duplicates   uint64         `json:"duplicates"`
+	DeadLettered uint64         `json:"dead_lettered"`
+	LastEventAt  *time.Time     `json:"last_event_at,omitempty"`
+	Pipeline     PipelineStats  `json:"pipeline"`
+}
+
+// EventProcessorOptions cấu hình pipeline xử lý event
+type EventProcessorOptions struct {
+	Workers      int    // Số partition chạy song song (event cùng symbol vào cùng partition)
+	QueueSize    int    // Số event chờ tối đa mỗi partition
+	BatchSize    int    // Số event tối đa ghi trong một transaction
+	MakerFeeRate string // Phí khớp lệnh của maker (người bán), vd. "0.001"; rỗng = không thu
+	TakerFeeRate string // Phí khớp lệnh của taker (người mua)
+}
+
+// EventProcessor xử lý các event từ Rust Engine.
+// Event được nhận tuần tự từ stream, rồi chia theo symbol cho các partition:
+// cùng symbol giữ đúng thứ tự, khác symbol chạy song song.
 type EventProcessor struct {
-	store    db.Store
-	natsConn *nats.Conn
-	hub      *websocket.Hub // Thêm Hub để broadcast trades
+	store      db.Store
+	js         jetstream.JetStream
+	opts       messaging.Options
+	hub        *websocket.Hub // Thêm Hub để broadcast trades
+	events     *EventRegistry
+	partitions []*partition
+	batchSize  int
+
+	makerFeeRate string
+	takerFeeRate string
+
+	mu         sync.Mutex
+	runCtx     context.Context
+	consumer   jetstream.Consumer
+	consumeCtx jetstream.ConsumeContext
+	sequence   db.EventSequence // Sequence cuối cùng đã chuyển vào partition
+	acceptGap  *EventGapError   // Gap operator đã chấp nhận khi Resume
+	health     EventProcessorHealth
 }
 
 // NewEventProcessor tạo processor mới
-func NewEventProcessor(store db.Store, nc *nats.Conn, hub *websocket.Hub) *EventProcessor {
-	return &EventProcessor{
-		store:    store,
-		natsConn: nc,
-		hub:      hub,
+func NewEventProcessor(store db.Store, js jetstream.JetStream, opts messaging.Options, pipeline EventProcessorOptions, hub *websocket.Hub) *EventProcessor {
+	if pipeline.Workers < 1 {
+		pipeline.Workers = 1
+	}
+	if pipeline.BatchSize < 1 {
+		pipeline.BatchSize = 1
+	}
+
+	p := &EventProcessor{
+		store:      store,
+		js:         js,
+		opts:       opts,
+		hub:        hub,
+		events:     NewEventRegistry(),
+		partitions: make([]*partition, pipeline.Workers),
+		batchSize:  pipeline.BatchSize,
+
+		makerFeeRate: pipeline.MakerFeeRate,
+		takerFeeRate: pipeline.TakerFeeRate,
 	}
+	for i := range p.partitions {
+		p.partitions[i] = &partition{index: i, queue: make(chan *eventJob, pipeline.QueueSize)}
+	}
+	p.registerEvents()
+	return p
 }
 
-// Start bắt đầu lắng nghe events từ NATS
+// registerEvents đăng ký các loại event engine bắn ra
+func (p *EventProcessor) registerEvents() {
+	RegisterEvent(p.events, "OrderPlaced", EventHandler[models.OrderPlacedData]{
+		Apply: p.handleOrderPlaced,
+	})
+	RegisterEvent(p.events, "TradeExecuted", EventHandler[models.TradeExecutedData]{
+		Apply:       p.handleTradeExecuted,
+		AfterCommit: p.broadcastTrade,
+	})
+	RegisterEvent(p.events, "OrderCancelled", EventHandler[models.OrderCancelledData]{
+		Apply: p.handleOrderCancelled,
+	})
+	RegisterEvent(p.events, "OrderRejected", EventHandler[models.OrderRejectedData]{
+		Apply:       p.handleOrderRejected,
+		AfterCommit: p.notifyOrderRejected,
+	})
+}
+
+// Start bắt đầu consume events từ durable JetStream consumer.
+// Event chỉ được ack sau khi xử lý thành công, nên event bắn ra lúc gateway down
+// hoặc xử lý lỗi tạm thời sẽ được deliver lại.
 func (p *EventProcessor) Start(ctx context.Context) error {
 	log.Println("🎧 Starting Event Processor...")
 
-	// Subscribe vào topic "events" (Rust Engine sẽ publish vào đây)
-	_, err := p.natsConn.Subscribe("events", func(msg *nats.Msg) {
-		p.handleEvent(msg.Data)
-	})
+	sequence, err := p.store.GetEventSequence(ctx, EventSource)
+	if err != nil && err.Error() != "event sequence not found" {
+		return fmt.Errorf("failed to load event sequence: %w", err)
+	}
+
+	consumer, err := p.js.CreateOrUpdateConsumer(ctx, messaging.EventsStream, messaging.EventsConsumerConfig(p.opts))
+	if err != nil {
+		return fmt.Errorf("failed to create events consumer: %w", err)
+	}
+
+	for _, part := range p.partitions {
+		go p.runPartition(ctx, part)
+	}
 
+	p.mu.Lock()
+	p.runCtx = ctx
+	p.consumer = consumer
+	p.sequence = sequence
+	err = p.consumeLocked()
+	p.mu.Unlock()
 	if err != nil {
 		return err
 	}
 
-	log.Println("✅ Event Processor started successfully")
+	log.Printf("✅ Event Processor started successfully (%d partitions)", len(p.partitions))
 
-	// Chờ cho đến khi context bị cancel
+	// Chờ cho đến khi context bị cancel, rồi dừng nhận message mới.
+	// Event còn trong partition chưa được ack nên sẽ được deliver lại ở lần chạy sau.
 	<-ctx.Done()
+	p.mu.Lock()
+	if p.consumeCtx != nil {
+		p.consumeCtx.Drain()
+	}
+	p.mu.Unlock()
 	return nil
 }
 
-// handleEvent xử lý từng event nhận được
-func (p *EventProcessor) handleEvent(data []byte) {
-	log.Printf("📩 Received event: %s", string(data))
+// consumeLocked bắt đầu nhận message từ consumer (caller phải giữ p.mu)
+func (p *EventProcessor) consumeLocked() error {
+	ctx := p.runCtx
+	consumeCtx, err := p.consumer.Consume(func(msg jetstream.Msg) {
+		p.dispatch(ctx, msg)
+	}, jetstream.ConsumeErrHandler(func(_ jetstream.ConsumeContext, err error) {
+		log.Printf("⚠️  Events consumer error: %v", err)
+	}))
+	if err != nil {
+		return fmt.Errorf("failed to consume events: %w", err)
+	}
+	p.consumeCtx = consumeCtx
+	return nil
+}
 
-	// Parse event chung
-	var event models.EngineEvent
-	if err := json.Unmarshal(data, &event); err != nil {
-		log.Printf("❌ Error parsing event: %v", err)
-		return
+// Health trả về trạng thái hiện tại của processor
+func (p *EventProcessor) Health() EventProcessorHealth {
+	p.mu.Lock()
+	health := p.health
+	p.mu.Unlock()
+
+	health.Pipeline = p.pipelineStats()
+	return health
+}
+
+// paused cho biết processor có đang tạm dừng vì mất event không
+func (p *EventProcessor) paused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.health.Paused
+}
+
+// Resume tiếp tục xử lý sau khi bị tạm dừng vì mất event.
+// acceptGap = true: bỏ qua các sequence bị mất (operator đã đối soát thủ công);
+// false: chỉ thử lại, dùng khi event bị thiếu đã được bắn lại vào stream.
+func (p *EventProcessor) Resume(acceptGap bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.health.Paused {
+		return ErrNotPaused
 	}
 
-	// Xử lý theo loại event
-	switch event.Type {
-	case "OrderPlaced":
-		p.handleOrderPlaced(event.Data)
-	case "TradeExecuted":
-		p.handleTradeExecuted(event.Data)
-	case "OrderCancelled":
-		p.handleOrderCancelled(event.Data)
-	default:
-		log.Printf("⚠️  Unknown event type: %s", event.Type)
+	if acceptGap {
+		p.acceptGap = p.health.Gap
 	}
+	log.Printf("▶️  Resuming Event Processor (accept gap: %v)", acceptGap)
+
+	if err := p.consumeLocked(); err != nil {
+		return err
+	}
+	p.health.Paused = false
+	p.health.Gap = nil
+	return nil
 }
 
-// handleOrderPlaced xử lý event OrderPlaced
-func (p *EventProcessor) handleOrderPlaced(data interface{}) {
-	// Parse data thành struct cụ thể
-	jsonData, _ := json.Marshal(data)
-	var orderData models.OrderPlacedData
-	if err := json.Unmarshal(jsonData, &orderData); err != nil {
-		log.Printf("❌ Error parsing OrderPlaced data: %v", err)
+// pause dừng nhận event cho tới khi operator gọi Resume
+func (p *EventProcessor) pause(gap *EventGapError) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.health.Paused {
+		return
+	}
+	p.health.Paused = true
+	p.health.Gap = gap
+	if p.consumeCtx != nil {
+		p.consumeCtx.Stop()
+	}
+	log.Printf("🚨 ALERT: %v. Event Processor paused, events after seq %d are held until resumed", gap, gap.Expected-1)
+}
+
+// dispatch nhận message theo đúng thứ tự stream (callback của consumer chạy tuần tự):
+// kiểm tra sequence, decode rồi chuyển vào partition của symbol. Partition đầy thì chờ (backpressure).
+func (p *EventProcessor) dispatch(ctx context.Context, msg jetstream.Msg) {
+	if p.paused() {
+		// Message đã được fetch trước khi dừng: trả lại để xử lý sau khi resume
+		msg.Nak()
 		return
 	}
 
+	var streamSeq uint64
+	var attempt uint64 = 1
+	var publishedAt time.Time
+	if meta, metaErr := msg.Metadata(); metaErr == nil {
+		streamSeq = meta.Sequence.Stream
+		attempt = meta.NumDelivered
+		publishedAt = meta.Timestamp
+	}
+
+	// Sequence đọc từ envelope không strict: event sai format vẫn được tính vị trí rồi vào dead-letter
+	var header models.EngineEvent
+	if json.Unmarshal(msg.Data(), &header) == nil {
+		if gapErr := p.advanceSequence(int64(header.Epoch), int64(header.Seq)); gapErr != nil {
+			// Mất event: không xử lý tiếp để không áp dụng side effect sai thứ tự
+			p.pause(gapErr)
+			msg.Nak()
+			return
+		}
+	}
+
+	job, err := p.decodeEvent(msg.Data(), streamSeq)
+	if err != nil {
+		if dlqErr := p.deadLetter(ctx, msg.Data(), streamSeq, attempt, err); dlqErr != nil {
+			log.Printf("❌ Failed to dead-letter event (stream seq %d): %v", streamSeq, dlqErr)
+			msg.NakWithDelay(redeliveryDelay(attempt))
+			return
+		}
+		msg.Term()
+		return
+	}
+	job.msg = msg
+	job.attempt = attempt
+	job.publishedAt = publishedAt
+
+	part := p.partitionFor(job.event.Symbol)
+	select {
+	case part.queue <- job:
+	case <-ctx.Done():
+		msg.Nak()
+	}
+}
+
+// advanceSequence kiểm tra sequence của event theo thứ tự nhận từ stream.
+// Event deliver lại (seq đã qua, hoặc từ epoch cũ) vẫn được chuyển đi, processed_events sẽ lọc trùng.
+func (p *EventProcessor) advanceSequence(epoch, seq int64) *EventGapError {
+	if seq <= 0 {
+		return nil // Event cũ không có sequence
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if epoch < p.sequence.Epoch {
+		return nil
+	}
+	expected := int64(1) // Epoch mới (engine khởi động lại) bắt đầu từ 1
+	if epoch == p.sequence.Epoch {
+		expected = p.sequence.LastSeq + 1
+	}
+	if seq < expected {
+		return nil
+	}
+	if seq > expected {
+		gap := p.acceptGap
+		if gap == nil || gap.Epoch != epoch || gap.Got != seq {
+			return &EventGapError{Source: EventSource, Epoch: epoch, Expected: expected, Got: seq}
+		}
+		p.acceptGap = nil
+	}
+
+	p.sequence.Epoch = epoch
+	p.sequence.LastSeq = seq
+	return nil
+}
+
+// deadLetter lưu event thất bại vào dead_letter_events kèm lỗi và số lần thử
+func (p *EventProcessor) deadLetter(ctx context.Context, data []byte, streamSeq, attempt uint64, cause error) error {
+	arg := db.CreateDeadLetterEventParams{
+		StreamSeq: int64(streamSeq),
+		Payload:   string(data),
+		Error:     cause.Error(),
+		Attempts:  int32(attempt),
+	}
+
+	// Payload có thể hỏng: lấy được thông tin nào thì lưu thông tin đó
+	var event models.EngineEvent
+	if json.Unmarshal(data, &event) == nil {
+		if event.EventID != "" {
+			arg.EventID = &event.EventID
+		}
+		if event.Type != "" {
+			arg.EventType = &event.Type
+		}
+		arg.Epoch = int64(event.Epoch)
+		arg.Seq = int64(event.Seq)
+	}
+
+	dead, err := p.store.DeadLetterEventTx(ctx, EventSource, arg)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.health.DeadLettered++
+	p.mu.Unlock()
+
+	log.Printf("☠️  Event moved to dead-letter #%d after %d attempt(s): %v", dead.ID, attempt, cause)
+	return nil
+}
+
+// Replay xử lý lại một dead-letter event (sau khi đã sửa nguyên nhân lỗi).
+// Thành công -> đánh dấu replayed; thất bại -> tăng attempts và lưu lỗi mới.
+func (p *EventProcessor) Replay(ctx context.Context, id int64) (db.DeadLetterEvent, error) {
+	dead, err := p.store.GetDeadLetterEvent(ctx, id)
+	if err != nil {
+		return db.DeadLetterEvent{}, err
+	}
+	if dead.Status != "pending" {
+		return dead, ErrNotReplayable
+	}
+
+	log.Printf("🔁 Replaying dead-letter event #%d", dead.ID)
+	if err := p.replayEvent(ctx, []byte(dead.Payload), uint64(dead.StreamSeq)); err != nil {
+		if recordErr := p.store.RecordDeadLetterFailure(ctx, db.RecordDeadLetterFailureParams{
+			ID:    dead.ID,
+			Error: err.Error(),
+		}); recordErr != nil {
+			log.Printf("❌ Failed to record replay failure for dead-letter #%d: %v", dead.ID, recordErr)
+		}
+		return dead, fmt.Errorf("replay failed: %w", err)
+	}
+
+	return p.store.UpdateDeadLetterEventStatus(ctx, dead.ID, "replayed")
+}
+
+// replayEvent xử lý một event ngoài pipeline (không qua partition, không kiểm tra sequence)
+func (p *EventProcessor) replayEvent(ctx context.Context, data []byte, streamSeq uint64) error {
+	job, err := p.decodeEvent(data, streamSeq)
+	if err != nil {
+		return err
+	}
+
+	result, err := p.applyBatch(ctx, []*eventJob{job})
+	if err != nil {
+		return err
+	}
+	if !result.Duplicate[0] && job.bound.afterCommit != nil {
+		job.bound.afterCommit(ctx)
+	}
+	return nil
+}
+
+// redeliveryDelay tính thời gian chờ redeliver: 1s, 2s, 4s... tối đa 1 phút
+func redeliveryDelay(attempt uint64) time.Duration {
+	delay := time.Second
+	for i := uint64(1); i < attempt && delay < time.Minute; i++ {
+		delay *= 2
+	}
+	if delay > time.Minute {
+		delay = time.Minute
+	}
+	return delay
+}
+
+// decodeEvent decode envelope, rồi data theo loại event đã đăng ký (sai format hoặc loại lạ -> lỗi vĩnh viễn)
+func (p *EventProcessor) decodeEvent(data []byte, streamSeq uint64) (*eventJob, error) {
+	log.Printf("📩 Received event: %s", string(data))
+
+	event, err := models.DecodeEngineEvent(data)
+	if err != nil {
+		return nil, permanent(err)
+	}
+	bound, err := p.events.bind(event)
+	if err != nil {
+		return nil, permanent(err)
+	}
+
+	// Event từ engine cũ không có id: dùng sequence của stream (ổn định qua các lần redeliver)
+	eventID := event.EventID
+	if eventID == "" {
+		eventID = fmt.Sprintf("stream-%d", streamSeq)
+	}
+
+	return &eventJob{
+		data:      data,
+		event:     event,
+		bound:     bound,
+		eventID:   eventID,
+		streamSeq: streamSeq,
+	}, nil
+}
+
+// handleOrderPlaced xử lý event OrderPlaced
+func (p *EventProcessor) handleOrderPlaced(ctx context.Context, q *db.EventBatch, orderData *models.OrderPlacedData) error {
 	log.Printf("📝 Processing OrderPlaced: Order ID %d, Symbol %s", orderData.OrderID, orderData.Symbol)
 
 	// Lưu order vào database
@@ -93,43 +471,59 @@ func (p *EventProcessor) handleOrderPlaced(data interface{}) {
 		Side:   orderData.Side,
 	}
 
-	_, err := p.store.CreateOrder(context.Background(), arg)
+	_, err := q.CreateOrder(ctx, arg)
 	if err != nil {
-		log.Printf("❌ Failed to store order in DB: %v", err)
-		return
+		return fmt.Errorf("failed to store order in DB: %w", err)
 	}
 
 	log.Printf("✅ DB Updated: Order %d stored successfully", orderData.OrderID)
+	return nil
 }
 
-// handleTradeExecuted xử lý event TradeExecuted
-func (p *EventProcessor) handleTradeExecuted(data interface{}) {
-	// Parse data thành struct cụ thể
-	jsonData, _ := json.Marshal(data)
-	var tradeData models.TradeExecutedData
-	if err := json.Unmarshal(jsonData, &tradeData); err != nil {
-		log.Printf("❌ Error parsing TradeExecuted data: %v", err)
-		return
-	}
-
+// handleTradeExecuted xử lý event TradeExecuted: lưu trade, ghi trade + phí vào sổ cái và cập nhật trạng thái order
+func (p *EventProcessor) handleTradeExecuted(ctx context.Context, q *db.EventBatch, tradeData *models.TradeExecutedData) error {
 	log.Printf("💰 Processing TradeExecuted: Trade ID %d", tradeData.Trade.TradeID)
 
-	// Lưu trade vào database
-	arg := db.CreateTradeParams{
-		MakerOrderID: int64(tradeData.Trade.SellerOrderID), // Seller là maker (đặt lệnh trước)
-		TakerOrderID: int64(tradeData.Trade.BuyerOrderID),  // Buyer là taker (khớp vào)
+	// Gom trade, insert cùng các trade khác trong lô khi transaction kết thúc
+	maker, taker := tradeData.Trade.MakerTaker()
+	q.AddTrade(db.CreateTradeParams{
+		MakerOrderID: int64(maker),
+		TakerOrderID: int64(taker),
 		Price:        tradeData.Trade.Price,
 		Amount:       tradeData.Trade.Amount,
-	}
+	})
 
-	_, err := p.store.CreateTrade(context.Background(), arg)
+	// Sổ cái: trade + phí, cùng transaction với lô event
+	err := q.SettleTrade(ctx, db.SettleTradeParams{
+		TradeID:       int64(tradeData.Trade.TradeID),
+		BuyerOrderID:  int64(tradeData.Trade.BuyerOrderID),
+		SellerOrderID: int64(tradeData.Trade.SellerOrderID),
+		TakerOrderID:  int64(taker),
+		Price:         tradeData.Trade.Price,
+		Amount:        tradeData.Trade.Amount,
+		MakerFeeRate:  p.makerFeeRate,
+		TakerFeeRate:  p.takerFeeRate,
+	})
 	if err != nil {
-		log.Printf("❌ Failed to store trade in DB: %v", err)
-		return
+		if err.Error() != "order not found" {
+			return fmt.Errorf("failed to settle trade: %w", err)
+		}
+		// Order đặt qua đường cũ (không có engine_order_id): không biết chủ order để ghi sổ
+		log.Printf("⚠️  TradeExecuted: trade %d not settled, order not found", tradeData.Trade.TradeID)
+		return nil
 	}
 
-	log.Printf("💰 DB Updated: Trade stored %s @ %s", tradeData.Trade.Amount, tradeData.Trade.Price)
+	// Trạng thái order: khớp hết thì FILLED và trả phần còn giữ, cùng transaction với trade
+	for _, orderID := range []uint64{tradeData.Trade.BuyerOrderID, tradeData.Trade.SellerOrderID} {
+		if err := q.FillOrder(ctx, int64(orderID)); err != nil {
+			return fmt.Errorf("failed to update filled order %d: %w", orderID, err)
+		}
+	}
+	return nil
+}
 
+// broadcastTrade gửi trade tới WebSocket clients (sau khi đã commit)
+func (p *EventProcessor) broadcastTrade(_ context.Context, tradeData *models.TradeExecutedData) {
 	// Broadcast trade event to WebSocket clients for chart
 	msg := map[string]interface{}{
 		"type": "trade",
@@ -139,23 +533,94 @@ func (p *EventProcessor) handleTradeExecuted(data interface{}) {
 	p.hub.BroadcastToClients(jsonMsg)
 
 	log.Printf("📊 Trade broadcasted to WebSocket clients")
+}
+
+// handleOrderCancelled xử lý event OrderCancelled: đánh dấu order CANCELLED và giải phóng số dư bị giữ
+func (p *EventProcessor) handleOrderCancelled(ctx context.Context, q *db.EventBatch, cancelData *models.OrderCancelledData) error {
+	log.Printf("🚫 Processing OrderCancelled: Order ID %d, Success: %v",
+		cancelData.OrderID, cancelData.Success)
 
-	// TODO Nâng cao: Sau này sẽ cập nhật số dư (UpdateBalance) tại đây.
-	// Ví dụ: Cộng tiền cho người bán, Trừ tiền người mua (nếu chưa trừ lúc đặt).
+	if !cancelData.Success {
+		// Engine không hủy được (order đã khớp hết hoặc không tồn tại): giữ nguyên trạng thái
+		return nil
+	}
+
+	order, err := q.GetOrderByEngineID(ctx, int64(cancelData.OrderID))
+	if err != nil {
+		if err.Error() != "order not found" {
+			return fmt.Errorf("failed to get cancelled order: %w", err)
+		}
+		// Order đặt qua đường cũ (không có engine_order_id)
+		log.Printf("⚠️  OrderCancelled: no order with engine ID %d", cancelData.OrderID)
+	} else {
+		closed, err := q.CloseOrder(ctx, db.CloseOrderParams{ID: order.ID, Status: "CANCELLED"})
+		if err != nil {
+			return fmt.Errorf("failed to cancel order in DB: %w", err)
+		}
+		if closed {
+			if err := q.ReleaseOrderHold(ctx, order.ID); err != nil {
+				return fmt.Errorf("failed to release order hold: %w", err)
+			}
+		}
+	}
+
+	released, err := q.ReleaseEngineOrder(ctx, int64(cancelData.OrderID), "cancelled")
+	if err != nil {
+		return fmt.Errorf("failed to release engine order: %w", err)
+	}
+	if released {
+		log.Printf("🔓 Funds released for cancelled order %d", cancelData.OrderID)
+	}
+	return nil
 }
 
-// handleOrderCancelled xử lý event OrderCancelled
-func (p *EventProcessor) handleOrderCancelled(data interface{}) {
-	// Parse data thành struct cụ thể
-	jsonData, _ := json.Marshal(data)
-	var cancelData models.OrderCancelledData
-	if err := json.Unmarshal(jsonData, &cancelData); err != nil {
-		log.Printf("❌ Error parsing OrderCancelled data: %v", err)
-		return
+// handleOrderRejected xử lý event OrderRejected: đánh dấu order REJECTED và giải phóng số dư bị giữ
+func (p *EventProcessor) handleOrderRejected(ctx context.Context, q *db.EventBatch, rejectData *models.OrderRejectedData) error {
+	log.Printf("⛔ Processing OrderRejected: Order ID %d, Reason %s", rejectData.OrderID, rejectData.Reason)
+
+	order, err := q.RejectOrder(ctx, db.RejectOrderParams{
+		EngineOrderID: int64(rejectData.OrderID),
+		Reason:        rejectData.Reason,
+	})
+	if err != nil {
+		if err.Error() != "order not found" {
+			return fmt.Errorf("failed to reject order in DB: %w", err)
+		}
+		// Order đặt qua đường cũ (không có engine_order_id) hoặc đã ở trạng thái cuối
+		log.Printf("⚠️  OrderRejected: no open order with engine ID %d", rejectData.OrderID)
+	} else if err := q.ReleaseOrderHold(ctx, order.ID); err != nil {
+		return fmt.Errorf("failed to release order hold: %w", err)
 	}
 
-	log.Printf("🚫 Processing OrderCancelled: Order ID %d, Success: %v",
-		cancelData.OrderID, cancelData.Success)
+	released, err := q.ReleaseEngineOrder(ctx, int64(rejectData.OrderID), "rejected")
+	if err != nil {
+		return fmt.Errorf("failed to release engine order: %w", err)
+	}
+	if released {
+		log.Printf("🔓 Funds released for rejected order %d", rejectData.OrderID)
+	}
+	return nil
+}
+
+// notifyOrderRejected gửi lý do từ chối tới kênh riêng của chủ order (sau khi đã commit)
+func (p *EventProcessor) notifyOrderRejected(ctx context.Context, rejectData *models.OrderRejectedData) {
+	order, err := p.store.GetRejectedOrder(ctx, int64(rejectData.OrderID))
+	if err != nil {
+		log.Printf("⚠️  Cannot notify rejection of order %d: %v", rejectData.OrderID, err)
+		return
+	}
 
-	// TODO: Cập nhật status trong database
+	msg := map[string]interface{}{
+		"type":    "order_rejected",
+		"channel": websocket.UserChannel,
+		"data": map[string]interface{}{
+			"order_id":        order.ID,
+			"engine_order_id": rejectData.OrderID,
+			"symbol":          rejectData.Symbol,
+			"reason":          rejectData.Reason,
+			"message":         rejectData.Message,
+		},
+	}
+	jsonMsg, _ := json.Marshal(msg)
+	p.hub.SendToUser(order.UserID, jsonMsg)
 }
@@ -0,0 +1,459 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	db "github.com/trading-platform/gateway/internal/database/sqlc"
+	"github.com/trading-platform/gateway/internal/marketdata"
+	"github.com/trading-platform/gateway/internal/messaging"
+	"github.com/trading-platform/gateway/internal/models"
+)
+
+// Cách sửa một sai lệch khi đối soát
+const (
+	ReconcileActionResubmit       = "resubmit"         // Gửi lại lệnh (phần còn lại) sang engine
+	ReconcileActionCancel         = "cancel"           // Đóng order trong DB (CANCELLED), giải phóng số dư
+	ReconcileActionMarkFilled     = "mark_filled"      // Đã khớp hết theo engine_trades: đóng order là FILLED
+	ReconcileActionCancelInEngine = "cancel_in_engine" // Gửi lệnh hủy cho engine
+	ReconcileActionRelease        = "release"          // Giải phóng số dư engine_orders còn giữ
+)
+
+// ErrReconcileRunning khi một lần đối soát khác đang chạy
+var ErrReconcileRunning = errors.New("reconciliation is already running")
+
+// ReconcilerOptions cấu hình job đối soát
+type ReconcilerOptions struct {
+	Interval     time.Duration // Chu kỳ chạy định kỳ, 0 = chỉ chạy khi admin gọi
+	MinAge       time.Duration // Bỏ qua order mới hơn (command có thể chưa tới engine)
+	AutoFix      bool          // Lần chạy định kỳ tự sửa sai lệch
+	OrphanAction string        // Order mở trong DB nhưng engine không có: "resubmit" hoặc "cancel"
+}
+
+// ReconcileIssue là một sai lệch giữa DB và sổ lệnh của engine
+type ReconcileIssue struct {
+	Symbol        string `json:"symbol"`
+	EngineOrderID int64  `json:"engine_order_id"`
+	OrderID       string `json:"order_id,omitempty"` // UUID trong bảng orders (nếu có)
+	Status        string `json:"status,omitempty"`   // Status trong bảng orders
+	Detail        string `json:"detail"`
+	Action        string `json:"action,omitempty"` // Cách sửa (đã hoặc sẽ áp dụng)
+	Fixed         bool   `json:"fixed"`
+	Error         string `json:"error,omitempty"`
+}
+
+// ReconcileReport là kết quả một lần đối soát
+type ReconcileReport struct {
+	StartedAt     time.Time        `json:"started_at"`
+	FinishedAt    time.Time        `json:"finished_at"`
+	Fix           bool             `json:"fix"`
+	Symbols       []string         `json:"symbols"`
+	DBOrphans     []ReconcileIssue `json:"db_orphans"`     // Mở trong DB, không có trong sổ của engine
+	EngineOrphans []ReconcileIssue `json:"engine_orphans"` // Có trong sổ của engine, không mở trong DB
+	StaleHolds    []ReconcileIssue `json:"stale_holds"`    // engine_orders còn giữ số dư dù order đã đóng
+	Errors        []string         `json:"errors,omitempty"`
+}
+
+// Reconciler đối soát order mở trong Postgres (orders, engine_orders) với snapshot
+// sổ lệnh engine ghi trong Redis (orderbook:{symbol}), báo cáo và tùy chọn tự sửa sai lệch.
+type Reconciler struct {
+	store     db.Store
+	snapshots marketdata.SnapshotLoader
+	outbox    *OutboxRelay
+	events    *EventProcessor
+	opts      ReconcilerOptions
+
+	running sync.Mutex // Chỉ một lần đối soát tại một thời điểm
+	mu      sync.RWMutex
+	last    *ReconcileReport
+}
+
+// NewReconciler tạo Reconciler mới
+func NewReconciler(store db.Store, snapshots marketdata.SnapshotLoader, outbox *OutboxRelay, events *EventProcessor, opts ReconcilerOptions) *Reconciler {
+	if opts.OrphanAction != ReconcileActionCancel {
+		opts.OrphanAction = ReconcileActionResubmit
+	}
+	return &Reconciler{
+		store:     store,
+		snapshots: snapshots,
+		outbox:    outbox,
+		events:    events,
+		opts:      opts,
+	}
+}
+
+// Start chạy đối soát định kỳ cho tới khi ctx bị cancel (không làm gì nếu Interval = 0)
+func (r *Reconciler) Start(ctx context.Context) {
+	if r.opts.Interval <= 0 {
+		log.Println("🔍 Reconciler: periodic run disabled")
+		return
+	}
+
+	ticker := time.NewTicker(r.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.Run(ctx, r.opts.AutoFix); err != nil && !errors.Is(err, ErrReconcileRunning) {
+				log.Printf("❌ Reconciliation failed: %v", err)
+			}
+		}
+	}
+}
+
+// LastReport trả về kết quả lần đối soát gần nhất
+func (r *Reconciler) LastReport() (ReconcileReport, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.last == nil {
+		return ReconcileReport{}, false
+	}
+	return *r.last, true
+}
+
+// Run đối soát toàn bộ symbol; fix = true thì áp dụng cách sửa cho từng sai lệch
+func (r *Reconciler) Run(ctx context.Context, fix bool) (ReconcileReport, error) {
+	if !r.running.TryLock() {
+		return ReconcileReport{}, ErrReconcileRunning
+	}
+	defer r.running.Unlock()
+
+	report := ReconcileReport{StartedAt: time.Now(), Fix: fix}
+
+	// Event chưa xử lý xong thì DB còn thiếu fill/placed: sửa lúc này dễ gửi lại lệnh đã khớp
+	if fix {
+		if reason := r.eventsBacklog(); reason != "" {
+			report.Fix = false
+			report.Errors = append(report.Errors, "auto-fix skipped: "+reason)
+		}
+	}
+
+	open, err := r.store.ListReconcileOrders(ctx, report.StartedAt.Add(-r.opts.MinAge))
+	if err != nil {
+		return report, fmt.Errorf("failed to list open orders: %w", err)
+	}
+	symbols, err := r.symbols(ctx, open)
+	if err != nil {
+		return report, err
+	}
+	report.Symbols = symbols
+
+	openByID := make(map[int64]db.ReconcileOrder, len(open))
+	for _, order := range open {
+		openByID[order.EngineOrderID] = order
+	}
+
+	for _, symbol := range symbols {
+		book, err := r.loadBook(ctx, symbol)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", symbol, err))
+			continue
+		}
+
+		// Order mở trong DB nhưng engine không có
+		for _, order := range open {
+			if order.Symbol != symbol {
+				continue
+			}
+			if _, ok := book[uint64(order.EngineOrderID)]; ok {
+				continue
+			}
+			report.DBOrphans = append(report.DBOrphans, r.dbOrphan(ctx, order, report.Fix))
+		}
+
+		// Engine có nhưng DB không mở
+		engineOrphans, err := r.engineOrphans(ctx, symbol, book, openByID, report.Fix)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", symbol, err))
+			continue
+		}
+		report.EngineOrphans = append(report.EngineOrphans, engineOrphans...)
+	}
+
+	holds, err := r.staleHolds(ctx, report.Fix)
+	if err != nil {
+		report.Errors = append(report.Errors, err.Error())
+	}
+	report.StaleHolds = holds
+
+	if report.Fix {
+		r.outbox.Notify()
+	}
+	report.FinishedAt = time.Now()
+
+	r.mu.Lock()
+	r.last = &report
+	r.mu.Unlock()
+
+	log.Printf("🔍 Reconciliation done: %d symbol(s), %d DB orphan(s), %d engine orphan(s), %d stale hold(s), fix=%v",
+		len(report.Symbols), len(report.DBOrphans), len(report.EngineOrphans), len(report.StaleHolds), report.Fix)
+	return report, nil
+}
+
+// eventsBacklog trả về lý do chưa nên tự sửa nếu event của engine chưa được xử lý hết
+func (r *Reconciler) eventsBacklog() string {
+	if r.events == nil {
+		return ""
+	}
+	health := r.events.Health()
+	if health.Paused {
+		return "event processor is paused"
+	}
+	if health.Pipeline.QueueDepth > 0 {
+		return fmt.Sprintf("%d engine event(s) still queued", health.Pipeline.QueueDepth)
+	}
+	return ""
+}
+
+// symbols là các symbol có order mở trong DB cùng các cặp đang giao dịch
+func (r *Reconciler) symbols(ctx context.Context, open []db.ReconcileOrder) ([]string, error) {
+	active, err := r.store.ListActiveSymbols(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list symbols: %w", err)
+	}
+
+	set := make(map[string]bool, len(active))
+	for _, symbol := range active {
+		set[symbol] = true
+	}
+	for _, order := range open {
+		set[order.Symbol] = true
+	}
+
+	symbols := make([]string, 0, len(set))
+	for symbol := range set {
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	return symbols, nil
+}
+
+// loadBook đọc danh sách lệnh trong sổ của engine. Chưa có snapshot = sổ rỗng
+// (engine xóa snapshot khi khởi động và ghi lại sau mỗi command của symbol).
+func (r *Reconciler) loadBook(ctx context.Context, symbol string) (map[uint64]marketdata.SnapshotOrder, error) {
+	payload, err := r.snapshots.LoadSnapshot(ctx, symbol)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load snapshot: %w", err)
+	}
+
+	book := make(map[uint64]marketdata.SnapshotOrder)
+	if len(payload) == 0 {
+		return book, nil
+	}
+
+	var snap marketdata.EngineSnapshot
+	if err := json.Unmarshal(payload, &snap); err != nil {
+		return nil, fmt.Errorf("invalid snapshot: %w", err)
+	}
+	if snap.Orders == nil {
+		return nil, errors.New("snapshot has no order list (engine too old to reconcile)")
+	}
+	for _, order := range snap.Orders {
+		book[order.ID] = order
+	}
+	return book, nil
+}
+
+// dbOrphan chọn cách sửa cho order mở trong DB mà engine không có, và áp dụng nếu fix
+func (r *Reconciler) dbOrphan(ctx context.Context, order db.ReconcileOrder, fix bool) ReconcileIssue {
+	issue := ReconcileIssue{
+		Symbol:        order.Symbol,
+		EngineOrderID: order.EngineOrderID,
+		OrderID:       order.ID,
+		Status:        order.Status,
+		Detail:        fmt.Sprintf("open in DB (filled %s of %s) but not in engine book", order.Filled, order.Quantity),
+	}
+
+	remaining, err := strconv.ParseFloat(order.Remaining, 64)
+	switch {
+	case err == nil && remaining <= 0:
+		issue.Action = ReconcileActionMarkFilled
+	case order.OrderType == "MARKET" || r.opts.OrphanAction == ReconcileActionCancel:
+		// Lệnh market không nằm chờ trong sổ: phần chưa khớp không gửi lại
+		issue.Action = ReconcileActionCancel
+	default:
+		issue.Action = ReconcileActionResubmit
+	}
+	if !fix {
+		return issue
+	}
+
+	switch issue.Action {
+	case ReconcileActionMarkFilled:
+		err = r.closeOrder(ctx, order, "FILLED")
+	case ReconcileActionCancel:
+		err = r.closeOrder(ctx, order, "CANCELLED")
+	case ReconcileActionResubmit:
+		err = r.resubmit(ctx, order)
+	}
+	if err != nil {
+		issue.Error = err.Error()
+		return issue
+	}
+	issue.Fixed = true
+	log.Printf("🔧 Reconcile: order %s (engine %d) -> %s", order.ID, order.EngineOrderID, issue.Action)
+	return issue
+}
+
+// closeOrder đóng order trong DB và giải phóng số dư đang giữ
+func (r *Reconciler) closeOrder(ctx context.Context, order db.ReconcileOrder, status string) error {
+	closed, err := r.store.CloseOrderTx(ctx, db.CloseOrderTxParams{
+		ID:            order.ID,
+		EngineOrderID: order.EngineOrderID,
+		Status:        status,
+	})
+	if err != nil {
+		return err
+	}
+	if !closed {
+		return errors.New("order is no longer open")
+	}
+	return nil
+}
+
+// resubmit gửi lại command đặt lệnh ban đầu (lấy từ outbox) với số lượng còn lại
+func (r *Reconciler) resubmit(ctx context.Context, order db.ReconcileOrder) error {
+	original, err := r.store.GetOutboxMessageByMsgID(ctx, order.ID)
+	if err != nil {
+		if err.Error() == "outbox message not found" {
+			return errors.New("original place command not found")
+		}
+		return err
+	}
+
+	var cmd struct {
+		Type string           `json:"type"`
+		Data models.OrderData `json:"data"`
+	}
+	if err := json.Unmarshal(original.Payload, &cmd); err != nil || cmd.Type != "Place" {
+		return errors.New("original place command is invalid")
+	}
+	cmd.Data.Amount = order.Remaining
+	cmd.Data.Timestamp = time.Now().Unix()
+
+	payload, err := json.Marshal(models.Command{Type: cmd.Type, Data: cmd.Data})
+	if err != nil {
+		return err
+	}
+
+	_, err = r.store.CreateOutboxMessage(ctx, db.CreateOutboxMessageParams{
+		AggregateID: order.ID,
+		Subject:     messaging.OrdersSubject,
+		MsgID:       fmt.Sprintf("resubmit-%s-%d", order.ID, time.Now().UnixNano()),
+		Payload:     payload,
+	})
+	return err
+}
+
+// engineOrphans tìm lệnh trong sổ của engine mà DB không còn mở, hủy chúng nếu fix
+func (r *Reconciler) engineOrphans(ctx context.Context, symbol string, book map[uint64]marketdata.SnapshotOrder, open map[int64]db.ReconcileOrder, fix bool) ([]ReconcileIssue, error) {
+	var candidates []int64
+	for id := range book {
+		if _, ok := open[int64(id)]; !ok {
+			candidates = append(candidates, int64(id))
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i] < candidates[j] })
+
+	known, err := r.store.ListOrdersByEngineIDs(ctx, candidates)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up engine orders: %w", err)
+	}
+	byID := make(map[int64]db.ReconcileOrder, len(known))
+	for _, order := range known {
+		byID[order.EngineOrderID] = order
+	}
+
+	var issues []ReconcileIssue
+	for _, id := range candidates {
+		order, exists := byID[id]
+		if exists && (order.Status == "OPEN" || order.Status == "PARTIALLY_FILLED") {
+			continue // Order mới (chưa qua MinAge), không phải orphan
+		}
+
+		issue := ReconcileIssue{
+			Symbol:        symbol,
+			EngineOrderID: id,
+			Action:        ReconcileActionCancelInEngine,
+			Detail:        "in engine book but no order in DB",
+		}
+		if exists {
+			issue.OrderID = order.ID
+			issue.Status = order.Status
+			issue.Detail = fmt.Sprintf("in engine book but order is %s in DB", order.Status)
+		}
+
+		if fix {
+			if err := r.cancelInEngine(ctx, id); err != nil {
+				issue.Error = err.Error()
+			} else {
+				issue.Fixed = true
+				log.Printf("🔧 Reconcile: cancel engine order %d (%s)", id, symbol)
+			}
+		}
+		issues = append(issues, issue)
+	}
+	return issues, nil
+}
+
+// cancelInEngine ghi lệnh hủy vào outbox
+func (r *Reconciler) cancelInEngine(ctx context.Context, engineOrderID int64) error {
+	payload, err := json.Marshal(models.Command{
+		Type: "Cancel",
+		Data: models.CancelData{OrderID: uint64(engineOrderID)},
+	})
+	if err != nil {
+		return err
+	}
+
+	id := strconv.FormatInt(engineOrderID, 10)
+	_, err = r.store.CreateOutboxMessage(ctx, db.CreateOutboxMessageParams{
+		AggregateID: id,
+		Subject:     messaging.OrdersSubject,
+		MsgID:       fmt.Sprintf("reconcile-cancel-%s-%d", id, time.Now().UnixNano()),
+		Payload:     payload,
+	})
+	return err
+}
+
+// staleHolds tìm engine_orders còn giữ số dư dù order đã đóng, giải phóng nếu fix
+func (r *Reconciler) staleHolds(ctx context.Context, fix bool) ([]ReconcileIssue, error) {
+	holds, err := r.store.ListStaleEngineHolds(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stale holds: %w", err)
+	}
+
+	issues := make([]ReconcileIssue, 0, len(holds))
+	for _, hold := range holds {
+		issue := ReconcileIssue{
+			Symbol:        hold.Symbol,
+			EngineOrderID: hold.EngineOrderID,
+			OrderID:       hold.OrderID,
+			Status:        hold.OrderStatus,
+			Detail:        fmt.Sprintf("funds still held for %s order", hold.OrderStatus),
+			Action:        ReconcileActionRelease,
+		}
+		if fix {
+			if _, err := r.store.ReleaseEngineOrder(ctx, hold.EngineOrderID, strings.ToLower(hold.OrderStatus)); err != nil {
+				issue.Error = err.Error()
+			} else {
+				issue.Fixed = true
+			}
+		}
+		issues = append(issues, issue)
+	}
+	return issues, nil
+}
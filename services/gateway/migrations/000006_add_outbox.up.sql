@@ -0,0 +1,18 @@
+-- Transactional outbox: command gửi sang engine được ghi cùng transaction với order,
+-- relay worker đọc các dòng pending, publish lên JetStream rồi đánh dấu sent
+CREATE TABLE IF NOT EXISTS outbox (
+    id BIGSERIAL PRIMARY KEY,
+    aggregate_id VARCHAR(64) NOT NULL,          -- ID của đối tượng sinh ra command (order UUID, engine order id, ...)
+    subject VARCHAR(100) NOT NULL,              -- NATS subject đích
+    msg_id VARCHAR(100) NOT NULL,               -- Nats-Msg-Id, JetStream dùng để loại bản publish trùng
+    payload JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent')),
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    sent_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Relay chỉ quét các dòng pending theo thứ tự ghi
+CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox(id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_outbox_aggregate_id ON outbox(aggregate_id);
@@ -0,0 +1,4 @@
+-- Drop event tracking tables
+DROP TABLE IF EXISTS event_sequences;
+DROP INDEX IF EXISTS idx_processed_events_processed_at;
+DROP TABLE IF EXISTS processed_events;
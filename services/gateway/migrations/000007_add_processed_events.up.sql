@@ -0,0 +1,18 @@
+-- Event engine đã xử lý: ghi cùng transaction với side effect để mỗi event chỉ được áp dụng một lần
+CREATE TABLE IF NOT EXISTS processed_events (
+    event_id VARCHAR(100) PRIMARY KEY,          -- "{epoch}-{seq}" từ engine, hoặc "stream-{seq}" cho event cũ không có id
+    event_type VARCHAR(50) NOT NULL,
+    epoch BIGINT NOT NULL DEFAULT 0,
+    seq BIGINT NOT NULL DEFAULT 0,
+    processed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_processed_events_processed_at ON processed_events(processed_at);
+
+-- Sequence cuối cùng đã xử lý theo từng nguồn event, dùng để phát hiện event bị mất
+CREATE TABLE IF NOT EXISTS event_sequences (
+    source VARCHAR(50) PRIMARY KEY,
+    epoch BIGINT NOT NULL,                      -- Lần khởi động của engine (seq bắt đầu lại từ 1)
+    last_seq BIGINT NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,4 @@
+-- Drop dead-letter table
+DROP INDEX IF EXISTS idx_dead_letter_events_event_id;
+DROP INDEX IF EXISTS idx_dead_letter_events_status;
+DROP TABLE IF EXISTS dead_letter_events;
@@ -0,0 +1,20 @@
+-- Dead-letter queue: event engine xử lý thất bại (sai format, lỗi DB quá số lần retry)
+-- được giữ lại kèm lỗi để operator sửa nguyên nhân rồi replay
+CREATE TABLE IF NOT EXISTS dead_letter_events (
+    id BIGSERIAL PRIMARY KEY,
+    event_id VARCHAR(100),                      -- NULL nếu payload không parse được
+    event_type VARCHAR(50),
+    epoch BIGINT NOT NULL DEFAULT 0,
+    seq BIGINT NOT NULL DEFAULT 0,
+    stream_seq BIGINT NOT NULL DEFAULT 0,       -- Sequence trong JetStream stream EVENTS
+    payload TEXT NOT NULL,                      -- Giữ nguyên bytes gốc, kể cả JSON hỏng
+    error TEXT NOT NULL,
+    attempts INT NOT NULL DEFAULT 1,            -- Số lần xử lý thất bại (deliver + replay)
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'replayed', 'discarded')),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    replayed_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_dead_letter_events_status ON dead_letter_events(status, id);
+CREATE INDEX IF NOT EXISTS idx_dead_letter_events_event_id ON dead_letter_events(event_id);
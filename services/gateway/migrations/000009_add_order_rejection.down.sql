@@ -0,0 +1,5 @@
+-- Rollback order rejection support
+DROP INDEX IF EXISTS idx_orders_engine_order_id;
+
+ALTER TABLE orders DROP COLUMN IF EXISTS reject_reason;
+ALTER TABLE orders DROP COLUMN IF EXISTS engine_order_id;
@@ -0,0 +1,7 @@
+-- Liên kết order (UUID) với ID số engine dùng, để xử lý event OrderRejected/OrderCancelled theo order
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS engine_order_id BIGINT;
+
+-- Mã lý do engine từ chối lệnh (INVALID_AMOUNT, INVALID_PRICE, INVALID_TRIGGER_PRICE, ...)
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS reject_reason VARCHAR(50);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_orders_engine_order_id ON orders(engine_order_id) WHERE engine_order_id IS NOT NULL;
@@ -0,0 +1,5 @@
+-- Rollback session revocation support
+DROP INDEX IF EXISTS idx_sessions_active;
+
+ALTER TABLE sessions DROP COLUMN IF EXISTS revoked_at;
+ALTER TABLE sessions DROP COLUMN IF EXISTS previous_refresh_token_hash;
@@ -0,0 +1,5 @@
+-- Session đăng nhập: refresh token xoay vòng, thu hồi phía server
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS previous_refresh_token_hash VARCHAR(255); -- Refresh token vừa bị thay, dùng để phát hiện dùng lại
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS revoked_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_sessions_active ON sessions(user_id, expires_at) WHERE revoked_at IS NULL;
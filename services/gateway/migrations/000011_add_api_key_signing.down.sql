@@ -0,0 +1,5 @@
+-- Rollback API key signing support
+ALTER TABLE api_keys DROP COLUMN IF EXISTS revoked_at;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS allowed_ips;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS key_prefix;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS secret_ciphertext;
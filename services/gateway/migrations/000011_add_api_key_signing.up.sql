@@ -0,0 +1,5 @@
+-- API key ký request bằng HMAC: secret phải khôi phục được để kiểm tra chữ ký, nên được mã hóa (AES-GCM) thay vì chỉ hash
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS secret_ciphertext TEXT;
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS key_prefix VARCHAR(16);                    -- Vài ký tự đầu của key, để user nhận ra key trong danh sách
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS allowed_ips TEXT[] DEFAULT ARRAY[]::TEXT[]; -- IP/CIDR được phép, rỗng = mọi IP
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS revoked_at TIMESTAMP WITH TIME ZONE;
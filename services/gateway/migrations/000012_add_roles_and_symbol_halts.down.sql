@@ -0,0 +1,9 @@
+-- Rollback roles and symbol halts
+DELETE FROM transactions WHERE type = 'adjustment';
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_type_check;
+ALTER TABLE transactions ADD CONSTRAINT transactions_type_check
+    CHECK (type IN ('deposit', 'withdraw', 'transfer_in', 'transfer_out'));
+
+DROP TABLE IF EXISTS symbol_halts;
+
+ALTER TABLE users DROP COLUMN IF EXISTS role;
@@ -0,0 +1,16 @@
+-- Phân quyền: user (mặc định), support (xem), market-ops (điều hành thị trường), admin
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'user'
+    CHECK (role IN ('user', 'support', 'admin', 'market-ops'));
+
+-- Symbol đang bị tạm dừng giao dịch (không nhận lệnh mới); xóa dòng = giao dịch lại
+CREATE TABLE IF NOT EXISTS symbol_halts (
+    symbol VARCHAR(20) PRIMARY KEY,
+    reason TEXT NOT NULL,
+    halted_by VARCHAR(50) NOT NULL,
+    halted_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Điều chỉnh số dư bởi admin (bắt buộc có lý do, ghi trong description)
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_type_check;
+ALTER TABLE transactions ADD CONSTRAINT transactions_type_check
+    CHECK (type IN ('deposit', 'withdraw', 'transfer_in', 'transfer_out', 'adjustment'));
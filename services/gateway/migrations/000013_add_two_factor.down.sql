@@ -0,0 +1,3 @@
+-- Rollback two-factor authentication
+DROP TABLE IF EXISTS user_recovery_codes;
+DROP TABLE IF EXISTS user_totp;
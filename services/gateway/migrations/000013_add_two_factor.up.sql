@@ -0,0 +1,18 @@
+-- TOTP (RFC 6238) cho đăng nhập và thao tác nhạy cảm. Secret phải khôi phục được để tính mã nên được mã hóa (AES-GCM)
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret_ciphertext TEXT NOT NULL,
+    enabled_at TIMESTAMP WITH TIME ZONE, -- NULL = đang đăng ký, chưa xác nhận bằng mã đầu tiên
+    last_used_step BIGINT,               -- Bước thời gian (unix/30) của mã gần nhất, chặn dùng lại cùng một mã
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Mã khôi phục dùng một lần khi mất thiết bị; chỉ lưu hash
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, code_hash)
+);
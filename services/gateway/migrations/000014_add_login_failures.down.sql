@@ -0,0 +1,3 @@
+-- Rollback login brute-force protection
+DROP INDEX IF EXISTS idx_login_failures_locked;
+DROP TABLE IF EXISTS login_failures;
@@ -0,0 +1,11 @@
+-- Đếm lần đăng nhập sai theo username và theo IP để làm chậm / tạm khóa khi bị dò mật khẩu
+CREATE TABLE IF NOT EXISTS login_failures (
+    key_type VARCHAR(10) NOT NULL CHECK (key_type IN ('username', 'ip')),
+    key VARCHAR(255) NOT NULL,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    locked_until TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY (key_type, key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_failures_locked ON login_failures(locked_until) WHERE locked_until IS NOT NULL;
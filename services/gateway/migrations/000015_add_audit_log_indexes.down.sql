@@ -0,0 +1,4 @@
+-- Rollback audit log filter indexes
+DROP INDEX IF EXISTS idx_audit_logs_ip_address;
+DROP INDEX IF EXISTS idx_audit_logs_resource;
+DROP INDEX IF EXISTS idx_audit_logs_action_created_at;
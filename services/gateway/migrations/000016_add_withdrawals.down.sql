@@ -0,0 +1,5 @@
+-- Rollback withdrawal workflow
+DROP TRIGGER IF EXISTS update_withdrawals_updated_at ON withdrawals;
+DROP INDEX IF EXISTS idx_withdrawals_user_currency_created_at;
+DROP INDEX IF EXISTS idx_withdrawals_status_created_at;
+DROP TABLE IF EXISTS withdrawals;
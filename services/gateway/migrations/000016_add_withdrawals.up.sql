@@ -0,0 +1,29 @@
+-- Rút tiền: số tiền bị trừ khỏi ví ngay khi tạo yêu cầu (transaction 'withdraw' pending),
+-- được hoàn lại nếu yêu cầu bị từ chối, hủy hoặc chuyển thất bại.
+-- pending -> approved -> completed | failed;  pending -> rejected | cancelled
+CREATE TABLE IF NOT EXISTS withdrawals (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    account_id BIGINT NOT NULL,
+    transaction_id BIGINT NOT NULL,
+    currency VARCHAR(10) NOT NULL,
+    amount DECIMAL(20, 8) NOT NULL CHECK (amount > 0),
+    fee DECIMAL(20, 8) NOT NULL DEFAULT 0 CHECK (fee >= 0 AND fee < amount),
+    address VARCHAR(255) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'approved', 'completed', 'failed', 'rejected', 'cancelled')),
+    reviewed_by VARCHAR(50),             -- Người duyệt/từ chối
+    reviewed_at TIMESTAMP WITH TIME ZONE,
+    processed_by VARCHAR(50),            -- Người xác nhận completed/failed
+    processed_at TIMESTAMP WITH TIME ZONE,
+    external_reference VARCHAR(255),
+    failure_reason TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_withdrawals_status_created_at ON withdrawals(status, created_at);
+CREATE INDEX IF NOT EXISTS idx_withdrawals_user_currency_created_at ON withdrawals(user_id, currency, created_at DESC);
+
+CREATE TRIGGER update_withdrawals_updated_at BEFORE UPDATE ON withdrawals
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,8 @@
+-- Rollback double-entry ledger
+DROP TRIGGER IF EXISTS ledger_entries_balanced ON ledger_entries;
+DROP TRIGGER IF EXISTS ledger_entries_append_only ON ledger_entries;
+DROP TRIGGER IF EXISTS ledger_journals_append_only ON ledger_journals;
+DROP FUNCTION IF EXISTS ledger_check_journal_balanced();
+DROP FUNCTION IF EXISTS ledger_reject_modification();
+DROP TABLE IF EXISTS ledger_entries;
+DROP TABLE IF EXISTS ledger_journals;
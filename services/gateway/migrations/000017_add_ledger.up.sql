@@ -0,0 +1,80 @@
+-- Sổ cái kép (double-entry): mọi thay đổi số dư là một journal gồm các entry có tổng bằng 0 theo từng currency.
+-- Entry của ví user có account_id; tài khoản hệ thống (tiền nạp vào, tiền đang rút, phí...) chỉ có ledger_account.
+-- accounts.balance là projection: luôn bằng tổng entry của ví đó (kiểm tra bằng ledger checker).
+CREATE TABLE IF NOT EXISTS ledger_journals (
+    id BIGSERIAL PRIMARY KEY,
+    type VARCHAR(30) NOT NULL CHECK (type IN (
+        'opening_balance', 'deposit', 'adjustment', 'transfer',
+        'withdrawal_hold', 'withdrawal_release', 'withdrawal_settle',
+        'trade', 'fee'
+    )),
+    reference_id VARCHAR(100),
+    description TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS ledger_entries (
+    id BIGSERIAL PRIMARY KEY,
+    journal_id BIGINT NOT NULL REFERENCES ledger_journals(id),
+    ledger_account VARCHAR(100) NOT NULL, -- 'account:<accounts.id>' hoặc 'system:<tên>'
+    account_id BIGINT,                    -- accounts.id khi là ví user
+    currency VARCHAR(10) NOT NULL,
+    amount DECIMAL(30, 8) NOT NULL CHECK (amount <> 0), -- > 0: ghi có (tăng số dư), < 0: ghi nợ
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((account_id IS NULL) = (ledger_account LIKE 'system:%'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_ledger_journals_reference_id ON ledger_journals(reference_id);
+CREATE INDEX IF NOT EXISTS idx_ledger_journals_created_at ON ledger_journals(created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_journal_id ON ledger_entries(journal_id);
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_account_id ON ledger_entries(account_id) WHERE account_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_ledger_account ON ledger_entries(ledger_account, currency);
+
+-- Sổ cái chỉ được ghi thêm: sửa sai bằng journal bù trừ
+CREATE OR REPLACE FUNCTION ledger_reject_modification()
+RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'ledger is append-only: % on % is not allowed', TG_OP, TG_TABLE_NAME;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER ledger_journals_append_only BEFORE UPDATE OR DELETE ON ledger_journals
+    FOR EACH ROW EXECUTE FUNCTION ledger_reject_modification();
+CREATE TRIGGER ledger_entries_append_only BEFORE UPDATE OR DELETE ON ledger_entries
+    FOR EACH ROW EXECUTE FUNCTION ledger_reject_modification();
+
+-- Kiểm tra cân bằng lúc commit (các entry của một journal được insert trước khi commit)
+CREATE OR REPLACE FUNCTION ledger_check_journal_balanced()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM ledger_entries WHERE journal_id = NEW.journal_id
+        GROUP BY currency HAVING SUM(amount) <> 0
+    ) THEN
+        RAISE EXCEPTION 'ledger journal % is not balanced', NEW.journal_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ language 'plpgsql';
+
+CREATE CONSTRAINT TRIGGER ledger_entries_balanced AFTER INSERT ON ledger_entries
+    DEFERRABLE INITIALLY DEFERRED
+    FOR EACH ROW EXECUTE FUNCTION ledger_check_journal_balanced();
+
+-- Số dư đang có được ghi thành một journal mở sổ, đối ứng với system:opening_balance
+WITH opening AS (
+    INSERT INTO ledger_journals (type, description)
+    SELECT 'opening_balance', 'balances before the ledger was introduced'
+    WHERE EXISTS (SELECT 1 FROM accounts WHERE balance::numeric <> 0)
+    RETURNING id
+)
+INSERT INTO ledger_entries (journal_id, ledger_account, account_id, currency, amount)
+SELECT opening.id, 'account:' || a.id, a.id, a.currency, a.balance::numeric
+FROM accounts a, opening
+WHERE a.balance::numeric <> 0
+UNION ALL
+SELECT opening.id, 'system:opening_balance', NULL, a.currency, -SUM(a.balance::numeric)
+FROM accounts a, opening
+WHERE a.balance::numeric <> 0
+GROUP BY opening.id, a.currency
+HAVING SUM(a.balance::numeric) <> 0;
@@ -0,0 +1,7 @@
+-- Rollback order ledger journal types (chỉ được khi chưa có journal order_hold/order_release)
+ALTER TABLE ledger_journals DROP CONSTRAINT IF EXISTS ledger_journals_type_check;
+ALTER TABLE ledger_journals ADD CONSTRAINT ledger_journals_type_check CHECK (type IN (
+    'opening_balance', 'deposit', 'adjustment', 'transfer',
+    'withdrawal_hold', 'withdrawal_release', 'withdrawal_settle',
+    'trade', 'fee'
+));
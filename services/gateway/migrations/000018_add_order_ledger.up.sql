@@ -0,0 +1,9 @@
+-- Sổ cái cho lệnh: giữ số dư khi đặt lệnh và trả lại khi lệnh bị từ chối/hủy/đóng.
+-- Tiền giữ cho mỗi order nằm ở tài khoản hệ thống 'system:orders_held:<orders.id>';
+-- trade lấy tiền từ đó, phí khớp lệnh vào 'system:fees:trading'.
+ALTER TABLE ledger_journals DROP CONSTRAINT IF EXISTS ledger_journals_type_check;
+ALTER TABLE ledger_journals ADD CONSTRAINT ledger_journals_type_check CHECK (type IN (
+    'opening_balance', 'deposit', 'adjustment', 'transfer',
+    'withdrawal_hold', 'withdrawal_release', 'withdrawal_settle',
+    'order_hold', 'order_release', 'trade', 'fee'
+));